@@ -0,0 +1,138 @@
+// Command strava-report writes the training report PDF served at
+// /reports/monthly.pdf from the command line, e.g. for a monthly cron job.
+//
+// It authenticates with a token instead of a browser session, from the
+// environment or a .env file:
+//   - STRAVA_ACCESS_TOKEN: an access token with the activity:read_all scope, or
+//   - STRAVA_REFRESH_TOKEN with STRAVA_CLIENT_ID and STRAVA_CLIENT_SECRET, to
+//     get a fresh one
+//
+// Usage:
+//
+//	strava-report [-month 2024-03 | -start 2024-03-01 -end 2024-03-31] [-units metric] [-o report.pdf]
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+	"github.com/arungupta/strava-stats-go/internal/auth"
+	"github.com/arungupta/strava-stats-go/internal/report"
+	"github.com/joho/godotenv"
+	"golang.org/x/oauth2"
+)
+
+func main() {
+	month := flag.String("month", "", "month to report (YYYY-MM); defaults to this month up to today")
+	start := flag.String("start", "", "first day to report (YYYY-MM-DD), instead of -month")
+	end := flag.String("end", "", "last day to report (YYYY-MM-DD), instead of -month")
+	units := flag.String("units", "", `"metric" or "imperial"; defaults to the Strava profile's preference`)
+	tz := flag.String("tz", "", "timezone deciding today, e.g. America/Los_Angeles; defaults to local time")
+	weekStart := flag.String("week-start", "monday", "first day of the week")
+	output := flag.String("o", "", `output file, or "-" for standard output; defaults to training-report-START-END.pdf`)
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, relying on environment variables")
+	}
+	token := &oauth2.Token{
+		AccessToken:  os.Getenv("STRAVA_ACCESS_TOKEN"),
+		RefreshToken: os.Getenv("STRAVA_REFRESH_TOKEN"),
+	}
+	if token.AccessToken == "" && token.RefreshToken == "" {
+		log.Fatalf("Set STRAVA_ACCESS_TOKEN, or STRAVA_REFRESH_TOKEN with STRAVA_CLIENT_ID and STRAVA_CLIENT_SECRET")
+	}
+	if token.AccessToken == "" {
+		// Expired, so the OAuth client refreshes it before the first request
+		token.Expiry = time.Unix(1, 0)
+	}
+	oauthConfig := &oauth2.Config{
+		ClientID:     os.Getenv("STRAVA_CLIENT_ID"),
+		ClientSecret: os.Getenv("STRAVA_CLIENT_SECRET"),
+		Endpoint:     auth.StravaEndpoint,
+	}
+	client := api.NewClient("https://www.strava.com/api/v3", oauthConfig)
+
+	calendar := api.DefaultCalendar()
+	if *tz != "" {
+		loc, err := api.ParseStravaTimezone(*tz)
+		if err != nil {
+			log.Fatalf("Invalid -tz: %v", err)
+		}
+		calendar.Location = loc
+	}
+	day, err := api.ParseWeekday(*weekStart)
+	if err != nil {
+		log.Fatalf("Invalid -week-start: %v", err)
+	}
+	calendar.WeekStart = day
+
+	from, to, err := report.ParseRange(*month, *start, *end, calendar.Today())
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	ctx := context.Background()
+	athlete, err := client.FetchAthlete(ctx, token)
+	if err != nil {
+		log.Fatalf("Failed to fetch athlete: %v", err)
+	}
+	if *units == "" {
+		*units = api.SettingsFromStrava(athlete, nil).Units
+	}
+	if *units != "" && *units != api.UnitsMetric && *units != api.UnitsImperial {
+		log.Fatalf("Invalid -units %q: must be 'metric' or 'imperial'", *units)
+	}
+
+	// Activities are filtered by their local date, so fetch a day either side
+	first, _ := time.Parse("2006-01-02", from)
+	last, _ := time.Parse("2006-01-02", to)
+	after, before := first.AddDate(0, 0, -1).Unix(), last.AddDate(0, 0, 2).Unix()
+	var history []api.NormalizedActivity
+	err = client.StreamActivities(ctx, token, &api.FetchActivitiesOptions{After: &after, Before: &before}, func(activity api.Activity) error {
+		history = append(history, api.NormalizeActivity(activity))
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to fetch activities: %v", err)
+	}
+
+	monthly := report.NewMonthly(history, from, to, report.Options{
+		Athlete:   strings.TrimSpace(athlete.Firstname + " " + athlete.Lastname),
+		Metric:    *units == api.UnitsMetric,
+		WeekStart: calendar.WeekStart,
+		Generated: time.Now(),
+	})
+	var b bytes.Buffer
+	if err := monthly.WritePDF(&b); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+
+	path := *output
+	if path == "" {
+		path = fmt.Sprintf("training-report-%s-%s.pdf", from, to)
+	}
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", path, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if _, err := b.WriteTo(w); err != nil {
+		log.Fatalf("Failed to write %s: %v", path, err)
+	}
+	if path != "-" {
+		log.Printf("Wrote %s: %d activities from %s to %s", path, len(monthly.Activities), from, to)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+	"github.com/arungupta/strava-stats-go/internal/store"
+)
+
+// achievementsCollection is the store collection of the awards each athlete
+// has seen.
+const achievementsCollection = "achievements"
+
+// seenAwards records when the athlete first saw each award, by award key.
+type seenAwards struct {
+	AthleteID int64                `json:"athlete_id"`
+	Seen      map[string]time.Time `json:"seen"`
+}
+
+// AchievementStore holds the achievement rules and remembers which awards each
+// athlete has seen, so the dashboard only announces new ones. Awards
+// themselves are recomputed from the activities on every request.
+type AchievementStore struct {
+	mu    sync.Mutex
+	store *store.Store
+	rules []api.AchievementRule
+}
+
+// NewAchievementStore creates an achievement store backed by st.
+func NewAchievementStore(st *store.Store, rules []api.AchievementRule) *AchievementStore {
+	return &AchievementStore{store: st, rules: rules}
+}
+
+// Rules returns the achievement rules.
+func (s *AchievementStore) Rules() []api.AchievementRule {
+	return s.rules
+}
+
+// Seen returns the keys of the awards the athlete has seen.
+func (s *AchievementStore) Seen(athleteID int64) (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.load(athleteID)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(record.Seen))
+	for key := range record.Seen {
+		seen[key] = true
+	}
+	return seen, nil
+}
+
+// MarkSeen records that the athlete has seen the awards with the given keys.
+func (s *AchievementStore) MarkSeen(athleteID int64, keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.load(athleteID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, key := range keys {
+		if _, ok := record.Seen[key]; !ok {
+			record.Seen[key] = now
+		}
+	}
+	return s.store.Save(achievementsCollection, strconv.FormatInt(athleteID, 10), record)
+}
+
+// load reads the athlete's seen awards. s.mu must be held.
+func (s *AchievementStore) load(athleteID int64) (*seenAwards, error) {
+	record := &seenAwards{AthleteID: athleteID}
+	if _, err := s.store.Load(achievementsCollection, strconv.FormatInt(athleteID, 10), record); err != nil {
+		return nil, err
+	}
+	if record.Seen == nil {
+		record.Seen = make(map[string]time.Time)
+	}
+	return record, nil
+}
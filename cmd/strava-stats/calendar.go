@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/store"
+	"golang.org/x/oauth2"
+)
+
+// Store collections of calendar feeds: the feed of each secret token, and the
+// token of each athlete's feed.
+const (
+	calendarFeedsCollection = "calendar_feeds"
+	calendarsCollection     = "calendars"
+)
+
+// calendarFeed is an athlete's calendar subscription. Calendar apps fetch the
+// feed without a session, so it is synced with the athlete's token from the
+// token store.
+type calendarFeed struct {
+	AthleteID int64     `json:"athlete_id"`
+	CreatedAt time.Time `json:"created_at"`
+	// LegacyToken is the plaintext copy of the Strava token that feeds kept
+	// before tokens moved to the token store; see DropLegacyToken
+	LegacyToken *oauth2.Token `json:"strava_token,omitempty"`
+}
+
+// athleteCalendar points from an athlete to their feed.
+type athleteCalendar struct {
+	AthleteID int64  `json:"athlete_id"`
+	FeedToken string `json:"feed_token"`
+}
+
+// CalendarStore persists the secret-token calendar feeds of athletes, at most
+// one each.
+type CalendarStore struct {
+	mu    sync.Mutex
+	store *store.Store
+}
+
+// NewCalendarStore creates a calendar store backed by st.
+func NewCalendarStore(st *store.Store) *CalendarStore {
+	return &CalendarStore{store: st}
+}
+
+// newFeedToken returns a random URL-safe token that is also a valid store key.
+func newFeedToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Feed returns the feed of a token, or false if there is none.
+func (s *CalendarStore) Feed(feedToken string) (*calendarFeed, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	feed := &calendarFeed{}
+	found, err := s.store.Load(calendarFeedsCollection, feedToken, feed)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return feed, true, nil
+}
+
+// FeedToken returns the token of the athlete's feed, or "" if they have none.
+func (s *CalendarStore) FeedToken(athleteID int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var calendar athleteCalendar
+	if _, err := s.store.Load(calendarsCollection, strconv.FormatInt(athleteID, 10), &calendar); err != nil {
+		return "", err
+	}
+	return calendar.FeedToken, nil
+}
+
+// Create gives the athlete a feed with a new token, revoking any previous one
+// so old links stop working.
+func (s *CalendarStore) Create(athleteID int64) (string, error) {
+	feedToken, err := newFeedToken()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.revoke(athleteID); err != nil {
+		return "", err
+	}
+	feed := calendarFeed{AthleteID: athleteID, CreatedAt: time.Now().UTC()}
+	if err := s.store.Save(calendarFeedsCollection, feedToken, feed); err != nil {
+		return "", err
+	}
+	calendar := athleteCalendar{AthleteID: athleteID, FeedToken: feedToken}
+	if err := s.store.Save(calendarsCollection, strconv.FormatInt(athleteID, 10), calendar); err != nil {
+		return "", err
+	}
+	return feedToken, nil
+}
+
+// DropLegacyToken removes the plaintext Strava token from a feed created
+// before tokens moved to the token store, once it has been adopted there.
+func (s *CalendarStore) DropLegacyToken(feedToken string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	feed := &calendarFeed{}
+	found, err := s.store.Load(calendarFeedsCollection, feedToken, feed)
+	if err != nil || !found || feed.LegacyToken == nil {
+		return err
+	}
+	feed.LegacyToken = nil
+	return s.store.Save(calendarFeedsCollection, feedToken, feed)
+}
+
+// Revoke deletes the athlete's feed, if any.
+func (s *CalendarStore) Revoke(athleteID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.revoke(athleteID)
+}
+
+// revoke deletes the athlete's feed. s.mu must be held.
+func (s *CalendarStore) revoke(athleteID int64) error {
+	key := strconv.FormatInt(athleteID, 10)
+	var calendar athleteCalendar
+	if _, err := s.store.Load(calendarsCollection, key, &calendar); err != nil {
+		return err
+	}
+	if calendar.FeedToken != "" {
+		if err := s.store.Delete(calendarFeedsCollection, calendar.FeedToken); err != nil {
+			return err
+		}
+	}
+	return s.store.Delete(calendarsCollection, key)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+	"golang.org/x/oauth2"
+)
+
+// DetailCache stores detailed activities (with splits and laps) and their
+// streams per athlete. Details rarely change after upload, and pacing and
+// workout analyses need many of them, so they are kept much longer than
+// activity lists.
+type DetailCache struct {
+	mu      sync.RWMutex
+	cache   map[string]*cachedDetail
+	streams map[string]*cachedStreams
+	ttl     time.Duration
+}
+
+type cachedDetail struct {
+	activity  *api.DetailedActivity
+	fetchedAt time.Time
+}
+
+type cachedStreams struct {
+	streams   *api.Streams
+	fetchedAt time.Time
+}
+
+// NewDetailCache creates a cache whose entries expire after ttl.
+func NewDetailCache(ttl time.Duration) *DetailCache {
+	return &DetailCache{
+		cache:   make(map[string]*cachedDetail),
+		streams: make(map[string]*cachedStreams),
+		ttl:     ttl,
+	}
+}
+
+// detailKey scopes cached details to the athlete who fetched them.
+func detailKey(athleteID, activityID int64) string {
+	return fmt.Sprintf("%d:%d", athleteID, activityID)
+}
+
+// Get returns a cached detailed activity if present and not expired.
+func (c *DetailCache) Get(athleteID, activityID int64) (*api.DetailedActivity, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cached, ok := c.cache[detailKey(athleteID, activityID)]
+	if !ok || time.Since(cached.fetchedAt) > c.ttl {
+		return nil, false
+	}
+	return cached.activity, true
+}
+
+// Set stores a detailed activity.
+func (c *DetailCache) Set(athleteID int64, activity *api.DetailedActivity) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for key, cached := range c.cache {
+		if now.Sub(cached.fetchedAt) > c.ttl {
+			delete(c.cache, key)
+		}
+	}
+	c.cache[detailKey(athleteID, activity.ID)] = &cachedDetail{activity: activity, fetchedAt: now}
+}
+
+// GetStreams returns an activity's cached streams if present and not expired.
+func (c *DetailCache) GetStreams(athleteID, activityID int64) (*api.Streams, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cached, ok := c.streams[detailKey(athleteID, activityID)]
+	if !ok || time.Since(cached.fetchedAt) > c.ttl {
+		return nil, false
+	}
+	return cached.streams, true
+}
+
+// SetStreams stores an activity's streams.
+func (c *DetailCache) SetStreams(athleteID, activityID int64, streams *api.Streams) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for key, cached := range c.streams {
+		if now.Sub(cached.fetchedAt) > c.ttl {
+			delete(c.streams, key)
+		}
+	}
+	c.streams[detailKey(athleteID, activityID)] = &cachedStreams{streams: streams, fetchedAt: now}
+}
+
+// getOrFetchDetail returns the cached detailed activity or fetches it from Strava,
+// including its laps if the detail response left them out.
+func (s *server) getOrFetchDetail(ctx context.Context, token *oauth2.Token, athleteID, activityID int64) (*api.DetailedActivity, error) {
+	if activity, ok := s.details.Get(athleteID, activityID); ok {
+		return activity, nil
+	}
+	activity, err := s.stravaClient.FetchActivity(ctx, token, activityID)
+	if err != nil {
+		return nil, err
+	}
+	if activity.Laps == nil {
+		if activity.Laps, err = s.stravaClient.FetchActivityLaps(ctx, token, activityID); err != nil {
+			return nil, err
+		}
+	}
+	s.details.Set(athleteID, activity)
+	return activity, nil
+}
+
+// getOrFetchStreams returns an activity's cached streams or fetches them from Strava.
+func (s *server) getOrFetchStreams(ctx context.Context, token *oauth2.Token, athleteID, activityID int64) (*api.Streams, error) {
+	if streams, ok := s.details.GetStreams(athleteID, activityID); ok {
+		return streams, nil
+	}
+	streams, err := s.stravaClient.FetchActivityStreams(ctx, token, activityID)
+	if err != nil {
+		return nil, err
+	}
+	s.details.SetStreams(athleteID, activityID, streams)
+	return streams, nil
+}
+
+// cachedGradeFactors measures the grade adjustment of the runs, walks and hikes
+// whose streams are already cached (see api.StreamGradeAdjustment). It never
+// fetches; the others are estimated from their elevation gain.
+func (s *server) cachedGradeFactors(athleteID int64, activities []api.NormalizedActivity) map[int64]float64 {
+	factors := make(map[int64]float64)
+	for _, activity := range activities {
+		if !api.IsGradeAdjustable(activity.SportType) {
+			continue
+		}
+		if streams, ok := s.details.GetStreams(athleteID, activity.ID); ok {
+			if factor, ok := api.StreamGradeAdjustment(streams); ok {
+				factors[activity.ID] = factor
+			}
+		}
+	}
+	return factors
+}
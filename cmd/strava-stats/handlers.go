@@ -0,0 +1,2881 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+	"github.com/arungupta/strava-stats-go/internal/auth"
+	"github.com/arungupta/strava-stats-go/internal/charts"
+	"github.com/arungupta/strava-stats-go/internal/export"
+	"github.com/arungupta/strava-stats-go/internal/ical"
+	"github.com/arungupta/strava-stats-go/internal/report"
+	"golang.org/x/oauth2"
+)
+
+// server holds the dependencies shared by the HTTP handlers.
+type server struct {
+	authenticator *auth.Authenticator
+	stravaClient  *api.Client
+	activityCache *ActivityCache
+	rollups       *RollupStore
+	details       *DetailCache
+	settings      *SettingsStore
+	achievements  *AchievementStore
+	plans         *PlanStore
+	calendars     *CalendarStore
+}
+
+// writeJSONError writes a JSON error body with the given status code.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// dateRange holds the parsed start_date/end_date query parameters.
+type dateRange struct {
+	NormalizeOpts *api.NormalizeOptions
+	FetchOpts     *api.FetchActivitiesOptions
+	CacheKey      string
+	Calendar      api.Calendar // set by loadActivities
+}
+
+// parseDateRange parses the start_date and end_date query parameters (YYYY-MM-DD).
+// Missing or invalid parameters fall back to the default range (last 7 days).
+func parseDateRange(r *http.Request, logPrefix string) dateRange {
+	startDateStr := r.URL.Query().Get("start_date")
+	endDateStr := r.URL.Query().Get("end_date")
+
+	// Generate cache key from date range
+	result := dateRange{CacheKey: fmt.Sprintf("%s-%s", startDateStr, endDateStr)}
+	if result.CacheKey == "-" {
+		result.CacheKey = "default"
+	}
+
+	if startDateStr == "" || endDateStr == "" {
+		// Use default (7 days)
+		return result
+	}
+
+	// Parse custom date range - parse as UTC to avoid timezone issues
+	// The date string is YYYY-MM-DD format, which we want to treat as a date (not datetime)
+	startDate, err1 := time.Parse("2006-01-02", startDateStr)
+	endDate, err2 := time.Parse("2006-01-02", endDateStr)
+	if err1 != nil || err2 != nil {
+		log.Printf("%s: invalid date range parameters (start: %v, end: %v), using default (7 days)", logPrefix, err1, err2)
+		return result
+	}
+
+	// Ensure dates are in UTC and at midnight to avoid timezone comparison issues
+	startDate = time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, time.UTC)
+	endDate = time.Date(endDate.Year(), endDate.Month(), endDate.Day(), 0, 0, 0, 0, time.UTC)
+	result.NormalizeOpts = &api.NormalizeOptions{
+		StartDate: startDate,
+		EndDate:   endDate,
+	}
+
+	// Use Strava's After parameter to only fetch activities after the start date
+	// This is much more efficient than fetching all activities
+	afterTimestamp := startDate.AddDate(0, 0, -1).Unix() // Fetch from 1 day before to be safe
+	result.FetchOpts = &api.FetchActivitiesOptions{
+		After: &afterTimestamp,
+	}
+
+	log.Printf("%s: using custom date range: %s to %s", logPrefix, startDateStr, endDateStr)
+	return result
+}
+
+// parseCalendar reads the calendar query parameters:
+//   - tz: the athlete's timezone, in Strava's "(GMT-08:00) America/Los_Angeles"
+//     format or as an IANA name; defaults to homeTZ, then the server's local time
+//   - week_start: first day of the week (e.g. "sunday"); defaults to weekStart,
+//     the athlete's setting, then Monday
+func parseCalendar(r *http.Request, homeTZ, weekStart string) (api.Calendar, error) {
+	calendar := api.DefaultCalendar()
+
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		tz = homeTZ
+	}
+	if tz != "" {
+		loc, err := api.ParseStravaTimezone(tz)
+		if err != nil {
+			if r.URL.Query().Get("tz") != "" {
+				return calendar, err
+			}
+			// An unparseable home timezone from Strava is not the caller's fault
+			log.Printf("Ignoring unknown home timezone %q: %v", homeTZ, err)
+		} else {
+			calendar.Location = loc
+		}
+	}
+
+	if query := r.URL.Query().Get("week_start"); query != "" {
+		weekStart = query
+	}
+	if weekStart != "" {
+		day, err := api.ParseWeekday(weekStart)
+		if err != nil {
+			return calendar, err
+		}
+		calendar.WeekStart = day
+	}
+	return calendar, nil
+}
+
+// withLocation returns a copy of opts that decides "today" in loc.
+func withLocation(opts *api.NormalizeOptions, loc *time.Location) *api.NormalizeOptions {
+	result := api.NormalizeOptions{}
+	if opts != nil {
+		result = *opts
+	}
+	result.Location = loc
+	return &result
+}
+
+// getOrFetchActivities returns cached activities for cacheKey or fetches them from Strava.
+func (s *server) getOrFetchActivities(ctx context.Context, token *oauth2.Token, fetchOpts *api.FetchActivitiesOptions, cacheKey string) ([]api.Activity, error) {
+	// Try cache first
+	if cached, found := s.activityCache.Get(cacheKey); found {
+		log.Printf("Using cached activities for key: %s (%d activities)", cacheKey, len(cached))
+		return cached, nil
+	}
+
+	// Cache miss - fetch from Strava
+	log.Printf("Cache miss for key: %s, fetching from Strava", cacheKey)
+	activities, err := s.stravaClient.FetchAllActivities(ctx, token, fetchOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Store in cache
+	s.activityCache.Set(cacheKey, activities)
+	log.Printf("Cached activities for key: %s (%d activities)", cacheKey, len(activities))
+
+	return activities, nil
+}
+
+// authenticate returns the session's token and athlete ID. On failure it writes
+// a 401 response and returns ok=false.
+func (s *server) authenticate(w http.ResponseWriter, r *http.Request, logPrefix string) (*oauth2.Token, int64, bool) {
+	// Get token from session (this automatically refreshes if expired)
+	token, err := s.authenticator.GetToken(w, r)
+	if err != nil {
+		log.Printf("%s: unauthorized: %v", logPrefix, err)
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+		return nil, 0, false
+	}
+
+	athleteID, err := s.authenticator.GetAthleteID(w, r, token)
+	if err != nil {
+		log.Printf("%s: failed to identify athlete: %v", logPrefix, err)
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: could not identify athlete. Please log in again.")
+		return nil, 0, false
+	}
+	return token, athleteID, true
+}
+
+// authenticatePage is authenticate for pages opened in the browser, which
+// redirect to the login page instead of answering 401.
+func (s *server) authenticatePage(w http.ResponseWriter, r *http.Request, logPrefix string) (*oauth2.Token, int64, bool) {
+	token, err := s.authenticator.GetToken(w, r)
+	if err == nil {
+		var athleteID int64
+		if athleteID, err = s.authenticator.GetAthleteID(w, r, token); err == nil {
+			return token, athleteID, true
+		}
+	}
+	log.Printf("%s: unauthorized, redirecting to login: %v", logPrefix, err)
+	http.Redirect(w, r, "/auth/login", http.StatusFound)
+	return nil, 0, false
+}
+
+// withTokenRetry runs fn with token, retrying once with a refreshed token if
+// Strava answers 401. On failure it writes the error response and returns false.
+func (s *server) withTokenRetry(w http.ResponseWriter, r *http.Request, token *oauth2.Token, logPrefix string, fn func(*oauth2.Token) error) bool {
+	err := fn(token)
+	var apiErr *api.APIError
+	if err != nil && errors.As(err, &apiErr) && apiErr.IsUnauthorized() {
+		// Try to refresh token and retry once
+		log.Printf("%s: unauthorized error, attempting token refresh: %v", logPrefix, apiErr.Message)
+		newToken, refreshErr := s.authenticator.GetToken(w, r)
+		if refreshErr != nil {
+			log.Printf("%s: token refresh failed: %v", logPrefix, refreshErr)
+			writeJSONError(w, http.StatusUnauthorized, "Unauthorized: token refresh failed. Please log in again.")
+			return false
+		}
+		err = fn(newToken)
+	}
+	if err != nil {
+		writeFetchError(w, err, logPrefix)
+		return false
+	}
+	return true
+}
+
+// loadActivities fetches the athlete's activities for the requested date range,
+// with the token and athlete ID the handler authenticated. On failure it writes
+// the error response and returns ok=false.
+func (s *server) loadActivities(w http.ResponseWriter, r *http.Request, token *oauth2.Token, athleteID int64, logPrefix string) ([]api.Activity, dateRange, bool) {
+	// Parse date range from query parameters FIRST, so we can use it for fetching
+	dr := parseDateRange(r, logPrefix)
+	cacheKey := fmt.Sprintf("%d:%s", athleteID, dr.CacheKey)
+
+	var activities []api.Activity
+	ok := s.withTokenRetry(w, r, token, logPrefix, func(token *oauth2.Token) error {
+		var err error
+		activities, err = s.getOrFetchActivities(r.Context(), token, dr.FetchOpts, cacheKey)
+		return err
+	})
+	if !ok {
+		return nil, dr, false
+	}
+
+	// The default range ends on today in the athlete's home timezone
+	weekStart := s.settingsHistory(athleteID, logPrefix).Current().WeekStart
+	calendar, err := parseCalendar(r, api.HomeTimezone(activities), weekStart)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return nil, dr, false
+	}
+	dr.NormalizeOpts = withLocation(dr.NormalizeOpts, calendar.Location)
+	dr.Calendar = calendar
+
+	log.Printf("%s: fetched %d activities", logPrefix, len(activities))
+	return activities, dr, true
+}
+
+// excludeFlagged reports whether the request asks to leave activities flagged by
+// the data quality checks out of the stats (exclude_flagged=true).
+func excludeFlagged(r *http.Request) bool {
+	return r.URL.Query().Get("exclude_flagged") == "true"
+}
+
+// normalizeActivities normalizes the activities in the requested range, leaving
+// out flagged activities when the request asks to (see excludeFlagged).
+func normalizeActivities(r *http.Request, activities []api.Activity, opts *api.NormalizeOptions) []api.NormalizedActivity {
+	normalized := api.NormalizeActivities(activities, opts)
+	if excludeFlagged(r) {
+		normalized = api.ExcludeFlagged(normalized)
+	}
+	return normalized
+}
+
+// writeFetchError maps an activity fetch error to an HTTP error response.
+func writeFetchError(w http.ResponseWriter, err error, logPrefix string) {
+	var apiErr *api.APIError
+	if !errors.As(err, &apiErr) {
+		// Generic error (not an APIError)
+		log.Printf("%s: failed to fetch activities: %v", logPrefix, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to fetch activities: "+err.Error())
+		return
+	}
+
+	switch {
+	case apiErr.IsRateLimit():
+		// Handle rate limiting (429)
+		log.Printf("%s: rate limit exceeded: %v, retry after: %v", logPrefix, apiErr.Message, apiErr.RetryAfter)
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":       "Rate limit exceeded. Please try again later.",
+			"message":     apiErr.Message,
+			"retry_after": int(apiErr.RetryAfter.Seconds()),
+		})
+	case apiErr.IsUnauthorized():
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: please log in again.")
+	case apiErr.IsServerError():
+		// Handle server errors (5xx)
+		log.Printf("%s: Strava API server error: %v", logPrefix, apiErr.Message)
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":   "Strava API is temporarily unavailable. Please try again later.",
+			"message": apiErr.Message,
+		})
+	default:
+		// Other API errors
+		log.Printf("%s: API error: %v", logPrefix, apiErr)
+		writeJSONError(w, apiErr.StatusCode, apiErr.Message)
+	}
+}
+
+// activitiesSummary is the aggregate part of the /api/activities response.
+type activitiesSummary struct {
+	DateRange       string `json:"dateRange"`
+	StartDate       string `json:"startDate"`
+	EndDate         string `json:"endDate"`
+	TotalActivities int    `json:"totalActivities"`
+	TotalMovingTime string `json:"totalMovingTime"`
+	NextCursor      string `json:"nextCursor,omitempty"`
+}
+
+// summarizeActivities calculates the summary cards for the normalized activities
+// that keep accepts (nil accepts all).
+func summarizeActivities(normalized []api.NormalizedActivity, keep func(*api.NormalizedActivity) bool, normalizeOpts *api.NormalizeOptions) activitiesSummary {
+	var totalActivities, totalMovingTime int
+	var earliestDateStr, latestDateStr string
+
+	for i := range normalized {
+		activity := &normalized[i]
+		if keep != nil && !keep(activity) {
+			continue
+		}
+		totalActivities++
+		totalMovingTime += activity.MovingTime
+
+		// Track date range using LocalDateStr (YYYY-MM-DD) for consistency
+		// This ensures the date range matches exactly what's in the activities
+		if activity.LocalDateStr != "" {
+			if earliestDateStr == "" || activity.LocalDateStr < earliestDateStr {
+				earliestDateStr = activity.LocalDateStr
+			}
+			if latestDateStr == "" || activity.LocalDateStr > latestDateStr {
+				latestDateStr = activity.LocalDateStr
+			}
+		}
+	}
+
+	summary := activitiesSummary{
+		TotalActivities: totalActivities,
+		TotalMovingTime: api.FormatDuration(totalMovingTime),
+	}
+
+	// Format date range for display
+	// Use the requested date range if available, otherwise use the actual activity date range
+	if normalizeOpts != nil && !normalizeOpts.StartDate.IsZero() && !normalizeOpts.EndDate.IsZero() {
+		// Use the requested date range for display
+		summary.StartDate = normalizeOpts.StartDate.Format("2006-01-02")
+		summary.EndDate = normalizeOpts.EndDate.Format("2006-01-02")
+		summary.DateRange = fmt.Sprintf("%s - %s",
+			normalizeOpts.StartDate.Format("Jan 2"),
+			normalizeOpts.EndDate.Format("Jan 2"))
+	} else if earliestDateStr != "" && latestDateStr != "" {
+		// Fallback to actual activity date range if no explicit range was requested
+		// Parse the date strings to format for display
+		earliestDate, err1 := time.Parse("2006-01-02", earliestDateStr)
+		latestDate, err2 := time.Parse("2006-01-02", latestDateStr)
+		if err1 == nil && err2 == nil {
+			summary.DateRange = fmt.Sprintf("%s - %s",
+				earliestDate.Format("Jan 2"),
+				latestDate.Format("Jan 2"))
+		} else {
+			summary.DateRange = fmt.Sprintf("%s - %s", earliestDateStr, latestDateStr)
+		}
+		// Send date strings in YYYY-MM-DD format for frontend use
+		summary.StartDate = earliestDateStr
+		summary.EndDate = latestDateStr
+	} else {
+		summary.DateRange = "No activities"
+	}
+
+	return summary
+}
+
+// handleActivities serves the summary cards and the activity list.
+//
+// Query parameters (in addition to start_date/end_date):
+//   - summary_only=true: return only the aggregate summary, no activities
+//   - fields=a,b,c: only include these JSON fields for each activity
+//   - limit=N and cursor=...: page through activities newest first; the
+//     response's nextCursor fetches the following page
+//
+// Activities are paged from the athlete's history kept in the rollup store,
+// sorted once rather than on every request, and the activities array is
+// streamed one element at a time.
+func (s *server) handleActivities(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := r.URL.Query()
+
+	// Validate projection and paging parameters before fetching anything
+	var projection *api.ActivityProjection
+	if fields := query.Get("fields"); fields != "" {
+		var err error
+		projection, err = api.NewActivityProjection(strings.Split(fields, ","))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid fields: "+err.Error())
+			return
+		}
+	}
+	limit := 0
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "Invalid limit. Must be a positive integer")
+			return
+		}
+	}
+	summaryOnly := query.Get("summary_only") == "true"
+
+	token, athleteID, ok := s.authenticate(w, r, "Activities")
+	if !ok {
+		return
+	}
+
+	// The home timezone is only known once activities are loaded, and "today" can
+	// differ by a day between timezones, so load one extra day of history
+	dr := parseDateRange(r, "Activities")
+	startDate, _ := dr.NormalizeOpts.Bounds()
+	entry, ok := s.syncRollup(w, r, token, athleteID, startDate.AddDate(0, 0, -1), "Activities")
+	if !ok {
+		return
+	}
+	rollup, quality := entry.snapshot()
+	calendar, err := parseCalendar(r, rollup.HomeTimezone(), "")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	normalizeOpts := withLocation(dr.NormalizeOpts, calendar.Location)
+	startDate, endDate := normalizeOpts.Bounds()
+	start, end := startDate.Format("2006-01-02"), endDate.Format("2006-01-02")
+	var flagged map[int64]bool
+	if excludeFlagged(r) {
+		flagged = quality.Flagged()
+	}
+	inRange := func(activity *api.NormalizedActivity) bool {
+		return activity.LocalDateStr >= start && activity.LocalDateStr <= end && !flagged[activity.ID]
+	}
+
+	history := entry.newestFirst()
+	summary := summarizeActivities(history, inRange, normalizeOpts)
+	log.Printf("Activities: %d of %d activities in range", summary.TotalActivities, len(history))
+	if summaryOnly {
+		if err := json.NewEncoder(w).Encode(summary); err != nil {
+			log.Printf("Activities: failed to encode response: %v", err)
+		}
+		return
+	}
+
+	page, nextCursor, err := api.PageActivities(history, query.Get("cursor"), limit, inRange)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	summary.NextCursor = nextCursor
+
+	// Write the summary fields, then stream the activities array into the same object
+	header, err := json.Marshal(summary)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to encode response: "+err.Error())
+		return
+	}
+	header = append(header[:len(header)-1], `,"activities":`...)
+	if _, err := w.Write(header); err != nil {
+		log.Printf("Activities: failed to write response: %v", err)
+		return
+	}
+
+	enc := api.NewActivityArrayEncoder(w, projection)
+	for i := range page {
+		if err := enc.Encode(&page[i]); err != nil {
+			// Headers are already sent, so the best we can do is log and stop
+			log.Printf("Activities: failed to stream activity: %v", err)
+			return
+		}
+	}
+	if err := enc.Close(); err != nil {
+		log.Printf("Activities: failed to write response: %v", err)
+		return
+	}
+	w.Write([]byte("}\n"))
+}
+
+// handleRunningStats serves running statistics, PRs and the distance histogram.
+// exclude_stop_outliers=true leaves runs with out-of-line stop time (such as a
+// watch left running) out of the average pace; gap=true ranks the fastest mile
+// and 10K by grade-adjusted time.
+func (s *server) handleRunningStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	log.Printf("Running stats: fetching activities for user")
+	token, athleteID, ok := s.authenticate(w, r, "Running stats")
+	if !ok {
+		return
+	}
+	activities, dr, ok := s.loadActivities(w, r, token, athleteID, "Running stats")
+	if !ok {
+		return
+	}
+
+	// Normalize activities with date range
+	normalized := normalizeActivities(r, activities, dr.NormalizeOpts)
+	log.Printf("Running stats: normalized to %d activities", len(normalized))
+
+	// Calculate running statistics, optionally leaving stop time outliers out of the pace.
+	// Grade-adjusted pace is measured along the route for runs with cached streams.
+	gradeFactors := s.cachedGradeFactors(athleteID, normalized)
+	stats := api.CalculateRunningStatsWithOptions(normalized, api.RunningStatsOptions{
+		ExcludeStopOutliers: r.URL.Query().Get("exclude_stop_outliers") == "true",
+		GradeFactors:        gradeFactors,
+	})
+	gradeAdjusted := r.URL.Query().Get("gap") == "true"
+	prs := api.CalculatePersonalRecordsWithOptions(normalized, api.PersonalRecordsOptions{
+		GradeAdjusted: gradeAdjusted,
+		GradeFactors:  gradeFactors,
+	})
+	predictions := api.PredictRaceTimes(normalized, api.RacePredictionOptions{
+		GradeAdjusted: gradeAdjusted,
+		GradeFactors:  gradeFactors,
+	})
+
+	// Generate distance histogram (use miles for now, can be made configurable)
+	histogram := api.GenerateDistanceHistogram(normalized, true) // true = use miles
+
+	// Prepare response - always return valid structure even if empty
+	response := map[string]interface{}{
+		"stats":       stats,
+		"prs":         prs,
+		"predictions": predictions,
+		"histogram":   histogram,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Running stats: failed to encode response: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to encode response: "+err.Error())
+		return
+	}
+
+	log.Printf("Running stats: successfully returned stats: %d total runs", stats.TotalRuns)
+}
+
+// handleActivityDetail serves one activity with its laps, per-kilometer and
+// per-mile splits, pacing (negative/positive split, pace variation and fade)
+// and, for runs, walks and hikes, grade-adjusted pace measured from its streams.
+func (s *server) handleActivityDetail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	activityID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || activityID <= 0 {
+		writeJSONError(w, http.StatusBadRequest, "Invalid activity ID")
+		return
+	}
+	token, athleteID, ok := s.authenticate(w, r, "Activity detail")
+	if !ok {
+		return
+	}
+
+	var detail *api.DetailedActivity
+	var streams *api.Streams
+	ok = s.withTokenRetry(w, r, token, "Activity detail", func(token *oauth2.Token) error {
+		detail, err = s.getOrFetchDetail(r.Context(), token, athleteID, activityID)
+		if err != nil || !api.IsGradeAdjustable(detail.SportType) {
+			return err
+		}
+		streams, err = s.getOrFetchStreams(r.Context(), token, athleteID, activityID)
+		return err
+	})
+	if !ok {
+		return
+	}
+
+	normalized := api.NormalizeActivity(detail.Activity)
+	var gradeAdjustment map[string]interface{}
+	if streams != nil && normalized.Distance > 0 && normalized.MovingTime > 0 {
+		factor, source := api.EstimateGradeAdjustment(normalized.Distance, normalized.TotalElevationGain), api.GradeFromEstimate
+		if measured, ok := api.StreamGradeAdjustment(streams); ok {
+			factor, source = measured, api.GradeFromStreams
+		}
+		gradeAdjustment = map[string]interface{}{
+			"factor":                        factor,
+			"source":                        source,
+			"gradeAdjustedPaceSecondsPerKm": float64(normalized.MovingTime) / normalized.Distance * 1000 / factor,
+		}
+	}
+	response := map[string]interface{}{
+		"activity":       normalized,
+		"description":    detail.Description,
+		"laps":           detail.Laps,
+		"splitsMetric":   detail.SplitsMetric,
+		"splitsStandard": detail.SplitsStandard,
+		"pacing":         api.AnalyzeActivityPacing(detail),
+		"pacingKind":     api.PacingKind(normalized, defaultLongRunMeters),
+		"gradeAdjusted":  gradeAdjustment,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Activity detail: failed to encode response: %v", err)
+	}
+}
+
+// Pacing consistency defaults and limits.
+const (
+	defaultLongRunMeters = 18000.0 // runs this long count as long runs
+	defaultPacingRuns    = 20
+	maxPacingRuns        = 50 // each run needs an activity detail request
+)
+
+// handlePacing serves pacing consistency across races and long runs: split
+// types, pace variation and fade per run, and whether they are improving.
+//
+// Query parameters:
+//   - start_date/end_date: the dashboard date range
+//   - long_run_km: minimum distance of a long run (default 18)
+//   - limit: how many of the newest races and long runs to analyze (default 20, max 50)
+func (s *server) handlePacing(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	longRunMeters := defaultLongRunMeters
+	if kmStr := r.URL.Query().Get("long_run_km"); kmStr != "" {
+		km, err := strconv.ParseFloat(kmStr, 64)
+		if err != nil || km <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "Invalid long_run_km. Must be a positive number")
+			return
+		}
+		longRunMeters = km * 1000
+	}
+	limit := defaultPacingRuns
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxPacingRuns {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid limit. Must be between 1 and %d", maxPacingRuns))
+			return
+		}
+	}
+
+	token, athleteID, ok := s.authenticate(w, r, "Pacing")
+	if !ok {
+		return
+	}
+	activities, dr, ok := s.loadActivities(w, r, token, athleteID, "Pacing")
+	if !ok {
+		return
+	}
+	candidates := api.PacingCandidates(normalizeActivities(r, activities, dr.NormalizeOpts), longRunMeters, limit)
+
+	// Details are cached, so only new races and long runs cost a request
+	var runs []api.PacingRun
+	ok = s.withTokenRetry(w, r, token, "Pacing", func(token *oauth2.Token) error {
+		runs = runs[:0]
+		for _, activity := range candidates {
+			detail, err := s.getOrFetchDetail(r.Context(), token, athleteID, activity.ID)
+			if err != nil {
+				return err
+			}
+			if pacing := api.AnalyzeActivityPacing(detail); pacing != nil {
+				runs = append(runs, api.PacingRun{
+					ID:       activity.ID,
+					Name:     activity.Name,
+					Date:     activity.LocalDateStr,
+					Kind:     api.PacingKind(activity, longRunMeters),
+					Distance: activity.Distance,
+					Pacing:   *pacing,
+				})
+			}
+		}
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	response := map[string]interface{}{
+		"longRunKm": longRunMeters / 1000,
+		"pacing":    api.CalculatePacingConsistency(runs),
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Pacing: failed to encode response: %v", err)
+	}
+	log.Printf("Pacing: analyzed %d of %d races and long runs", len(runs), len(candidates))
+}
+
+// Workout detection defaults and limits.
+const (
+	defaultWorkoutRuns = 20
+	maxWorkoutRuns     = 50 // each run needs an activity streams request
+)
+
+// handleWorkouts serves the interval structure detected in workouts (warmup,
+// sets of reps with recoveries, cooldown) and how each session type, such as
+// 6×800m, improves over time.
+//
+// Query parameters:
+//   - start_date/end_date: the dashboard date range
+//   - all_runs: "true" to check every run, not just those tagged as workouts
+//   - limit: how many of the newest runs to analyze (default 20, max 50)
+func (s *server) handleWorkouts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	allRuns := r.URL.Query().Get("all_runs") == "true"
+	limit := defaultWorkoutRuns
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxWorkoutRuns {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid limit. Must be between 1 and %d", maxWorkoutRuns))
+			return
+		}
+	}
+
+	token, athleteID, ok := s.authenticate(w, r, "Workouts")
+	if !ok {
+		return
+	}
+	activities, dr, ok := s.loadActivities(w, r, token, athleteID, "Workouts")
+	if !ok {
+		return
+	}
+	candidates := api.WorkoutCandidates(normalizeActivities(r, activities, dr.NormalizeOpts), allRuns, limit)
+
+	// Streams are cached, so only new workouts cost a request
+	var runs []api.WorkoutRun
+	ok = s.withTokenRetry(w, r, token, "Workouts", func(token *oauth2.Token) error {
+		runs = runs[:0]
+		for _, activity := range candidates {
+			streams, err := s.getOrFetchStreams(r.Context(), token, athleteID, activity.ID)
+			if err != nil {
+				return err
+			}
+			runs = append(runs, api.WorkoutRun{
+				ID:        activity.ID,
+				Name:      activity.Name,
+				Date:      activity.LocalDateStr,
+				Structure: api.DetectWorkout(streams),
+			})
+		}
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	analysis := api.CalculateWorkoutProgress(runs)
+	response := map[string]interface{}{
+		"allRuns":  allRuns,
+		"analyzed": len(candidates),
+		"workouts": analysis,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Workouts: failed to encode response: %v", err)
+	}
+	log.Printf("Workouts: found structure in %d of %d runs", len(analysis.Workouts), len(candidates))
+}
+
+// maxForecastPeriods limits how far ahead /api/trends forecasts.
+const maxForecastPeriods = 366
+
+// parseTrendSmoothing reads the smoothing query parameters:
+//   - smoothing: "none", "sma" or "ewma"; defaults to api.DefaultTrendSmoothing
+//   - window: points in the moving average (sma, default 3)
+//   - alpha: weight of the newest point (ewma, default 0.3)
+func parseTrendSmoothing(r *http.Request) (api.TrendSmoothing, error) {
+	query := r.URL.Query()
+	smoothing := api.TrendSmoothing{Method: query.Get("smoothing")}
+	switch smoothing.Method {
+	case "":
+		return smoothing, nil
+	case api.SmoothingSMA:
+		smoothing.Window = 3
+		if windowStr := query.Get("window"); windowStr != "" {
+			window, err := strconv.Atoi(windowStr)
+			if err != nil {
+				return smoothing, fmt.Errorf("invalid window %q", windowStr)
+			}
+			smoothing.Window = window
+		}
+	case api.SmoothingEWMA:
+		smoothing.Alpha = 0.3
+		if alphaStr := query.Get("alpha"); alphaStr != "" {
+			alpha, err := strconv.ParseFloat(alphaStr, 64)
+			if err != nil {
+				return smoothing, fmt.Errorf("invalid alpha %q", alphaStr)
+			}
+			smoothing.Alpha = alpha
+		}
+	}
+	return smoothing, smoothing.Validate()
+}
+
+// handleTrends serves distance, time, elevation, heart rate, power and pace
+// trends for a period.
+//
+// Query parameters (in addition to start_date/end_date, tz and week_start):
+//   - period: "daily" (default), "weekly", "monthly", "quarterly" or "yearly"
+//   - running_only=true: only include running activities
+//   - cumulative=true: running totals from the start of the range
+//   - smoothing, window, alpha: see parseTrendSmoothing
+//   - regression=true: linear and Theil-Sen trend lines for every series
+//   - forecast=N: forecast distance, time and elevation for the next N periods
+func (s *server) handleTrends(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get query parameters
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "daily" // default to daily
+	}
+	if period != "daily" && period != "weekly" && period != "monthly" && period != "quarterly" && period != "yearly" {
+		writeJSONError(w, http.StatusBadRequest, "Invalid period. Must be 'daily', 'weekly', 'monthly', 'quarterly', or 'yearly'")
+		return
+	}
+
+	runningOnly := r.URL.Query().Get("running_only") == "true"
+	cumulative := r.URL.Query().Get("cumulative") == "true"
+	smoothing, err := parseTrendSmoothing(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid smoothing: "+err.Error())
+		return
+	}
+	regression := r.URL.Query().Get("regression") == "true"
+	forecastPeriods := 0
+	if forecastStr := r.URL.Query().Get("forecast"); forecastStr != "" {
+		forecastPeriods, err = strconv.Atoi(forecastStr)
+		if err != nil || forecastPeriods < 0 || forecastPeriods > maxForecastPeriods {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid forecast. Must be between 0 and %d periods", maxForecastPeriods))
+			return
+		}
+	}
+
+	log.Printf("Trends: loading rollups for period=%s, runningOnly=%v", period, runningOnly)
+	dr := parseDateRange(r, "Trends")
+	token, athleteID, ok := s.authenticate(w, r, "Trends")
+	if !ok {
+		return
+	}
+	rollup, calendar, ok := s.loadCalendarRollup(w, r, token, athleteID, dr.NormalizeOpts, "Trends")
+	if !ok {
+		return
+	}
+	startDate, endDate := withLocation(dr.NormalizeOpts, calendar.Location).Bounds()
+
+	// Calculate trends from the precomputed daily rollups
+	trendData := api.TrendsFromRollup(rollup, startDate.Format("2006-01-02"), endDate.Format("2006-01-02"), api.TrendOptions{
+		Period:          period,
+		RunningOnly:     runningOnly,
+		WeekStart:       calendar.WeekStart,
+		Cumulative:      cumulative,
+		Smoothing:       smoothing,
+		Regression:      regression,
+		ForecastPeriods: forecastPeriods,
+	})
+
+	// Prepare response
+	response := map[string]interface{}{
+		"period":      period,
+		"runningOnly": runningOnly,
+		"cumulative":  cumulative,
+		"trends":      trendData,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Trends: failed to encode response: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to encode response: "+err.Error())
+		return
+	}
+
+	log.Printf("Trends: successfully returned %d data points for period=%s", len(trendData.Points), period)
+}
+
+// handleSummary serves per-sport totals from the athlete's daily rollups.
+//
+// Query parameters:
+//   - period: "weekly", "monthly", "quarterly", "yearly", or "all" (default) for a single total
+//   - running_only=true: only include running activities
+//   - start_date/end_date: limit the range; defaults to all time
+func (s *server) handleSummary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "all"
+	}
+	if period != "weekly" && period != "monthly" && period != "quarterly" && period != "yearly" && period != "all" {
+		writeJSONError(w, http.StatusBadRequest, "Invalid period. Must be 'weekly', 'monthly', 'quarterly', 'yearly', or 'all'")
+		return
+	}
+	runningOnly := r.URL.Query().Get("running_only") == "true"
+
+	// Default to all time rather than the last 7 days
+	dr := parseDateRange(r, "Summary")
+	allTime := dr.NormalizeOpts == nil
+	if allTime {
+		dr.NormalizeOpts = &api.NormalizeOptions{StartDate: stravaEpoch, EndDate: stravaEpoch}
+	}
+
+	token, athleteID, ok := s.authenticate(w, r, "Summary")
+	if !ok {
+		return
+	}
+	rollup, calendar, ok := s.loadCalendarRollup(w, r, token, athleteID, dr.NormalizeOpts, "Summary")
+	if !ok {
+		return
+	}
+	today := calendar.Today()
+	startDate, endDate := dr.NormalizeOpts.Bounds()
+	if allTime {
+		endDate = today
+	}
+
+	// Streaks are over the whole history, not the range, so they need every
+	// activity synced however short the range is
+	history := rollup
+	if !allTime {
+		if history, ok = s.loadRollup(w, r, token, athleteID, stravaEpoch, "Summary"); !ok {
+			return
+		}
+	}
+
+	var filter func(string) bool
+	if runningOnly {
+		filter = api.IsRunningActivity
+	}
+	start, end := startDate.Format("2006-01-02"), endDate.Format("2006-01-02")
+
+	response := map[string]interface{}{
+		"period":      period,
+		"runningOnly": runningOnly,
+		"startDate":   start,
+		"endDate":     end,
+		"timezone":    calendar.Location.String(),
+		"weekStart":   calendar.WeekStart.String(),
+		"totals":      rollup.Totals(start, end, filter),
+		"periods":     rollup.Periods(start, end, period, calendar.WeekStart, filter),
+		"streaks":     api.CalculateStreaks(history.ActiveDates(filter), today),
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Summary: failed to encode response: %v", err)
+	}
+}
+
+// parseSportFilter reads the sport query parameters: sport_types=Ride,GravelRide
+// limits to those sport types, and running_only=true to running activities.
+// It returns nil to accept every sport, plus the sport types for the response.
+func parseSportFilter(r *http.Request) (func(string) bool, []string) {
+	if r.URL.Query().Get("running_only") == "true" {
+		return api.IsRunningActivity, []string{"Run", "TrailRun", "VirtualRun"}
+	}
+	sportTypes := []string{}
+	accepted := make(map[string]bool)
+	for _, sportType := range strings.Split(r.URL.Query().Get("sport_types"), ",") {
+		if sportType = strings.TrimSpace(sportType); sportType != "" && !accepted[sportType] {
+			accepted[sportType] = true
+			sportTypes = append(sportTypes, sportType)
+		}
+	}
+	if len(sportTypes) == 0 {
+		return nil, sportTypes
+	}
+	return func(sportType string) bool { return accepted[sportType] }, sportTypes
+}
+
+// filterSports returns the activities accepted by filter (nil accepts all),
+// reusing the slice.
+func filterSports(activities []api.NormalizedActivity, filter func(string) bool) []api.NormalizedActivity {
+	if filter == nil {
+		return activities
+	}
+	filtered := activities[:0]
+	for _, activity := range activities {
+		if filter(activity.SportType) {
+			filtered = append(filtered, activity)
+		}
+	}
+	return filtered
+}
+
+// handleEddington serves the Eddington number in miles and kilometers.
+//
+// Query parameters:
+//   - sport_types=Ride,VirtualRide or running_only=true: only count these sports
+//   - start_date/end_date: limit the range; defaults to all time
+func (s *server) handleEddington(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, sportTypes := parseSportFilter(r)
+
+	// Default to all time rather than the last 7 days
+	dr := parseDateRange(r, "Eddington")
+	allTime := dr.NormalizeOpts == nil
+	if allTime {
+		dr.NormalizeOpts = &api.NormalizeOptions{StartDate: stravaEpoch, EndDate: stravaEpoch}
+	}
+
+	token, athleteID, ok := s.authenticate(w, r, "Eddington")
+	if !ok {
+		return
+	}
+	rollup, calendar, ok := s.loadCalendarRollup(w, r, token, athleteID, dr.NormalizeOpts, "Eddington")
+	if !ok {
+		return
+	}
+	startDate, endDate := dr.NormalizeOpts.Bounds()
+	if allTime {
+		endDate = calendar.Today()
+	}
+	start, end := startDate.Format("2006-01-02"), endDate.Format("2006-01-02")
+
+	eddington := api.EddingtonFromRollup(rollup, start, end, filter)
+	response := map[string]interface{}{
+		"startDate":  start,
+		"endDate":    end,
+		"sportTypes": sportTypes,
+		"eddington":  eddington,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Eddington: failed to encode response: %v", err)
+	}
+}
+
+// handlePatterns serves when the athlete trains: a weekday × hour punch card,
+// the distribution of start times, the weekday/weekend split and usual slots.
+//
+// Query parameters:
+//   - start_date/end_date: the dashboard date range
+//   - sport_types=Ride,VirtualRide or running_only=true: only count these sports
+func (s *server) handlePatterns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, athleteID, ok := s.authenticate(w, r, "Patterns")
+	if !ok {
+		return
+	}
+	activities, dr, ok := s.loadActivities(w, r, token, athleteID, "Patterns")
+	if !ok {
+		return
+	}
+	filter, sportTypes := parseSportFilter(r)
+
+	normalized := filterSports(normalizeActivities(r, activities, dr.NormalizeOpts), filter)
+
+	startDate, endDate := dr.NormalizeOpts.Bounds()
+	start, end := startDate.Format("2006-01-02"), endDate.Format("2006-01-02")
+	patterns := api.CalculateTrainingPatterns(normalized, start, end)
+	response := map[string]interface{}{
+		"startDate":       start,
+		"endDate":         end,
+		"sportTypes":      sportTypes,
+		"totalActivities": len(normalized),
+		"patterns":        patterns,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Patterns: failed to encode response: %v", err)
+	}
+}
+
+// handleStopTime serves elapsed versus moving time: time stopped and the
+// moving/elapsed ratio in total, per sport and per period, plus outliers such
+// as a run where the watch was left on.
+//
+// Query parameters:
+//   - period: "daily", "weekly" (default), "monthly", "quarterly" or "yearly"
+//   - start_date/end_date: the dashboard date range
+//   - sport_types=Ride,VirtualRide or running_only=true: only include these sports
+func (s *server) handleStopTime(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "weekly"
+	}
+	if period != "daily" && period != "weekly" && period != "monthly" && period != "quarterly" && period != "yearly" {
+		writeJSONError(w, http.StatusBadRequest, "Invalid period. Must be 'daily', 'weekly', 'monthly', 'quarterly', or 'yearly'")
+		return
+	}
+
+	token, athleteID, ok := s.authenticate(w, r, "Stop time")
+	if !ok {
+		return
+	}
+	activities, dr, ok := s.loadActivities(w, r, token, athleteID, "Stop time")
+	if !ok {
+		return
+	}
+	filter, sportTypes := parseSportFilter(r)
+	normalized := filterSports(normalizeActivities(r, activities, dr.NormalizeOpts), filter)
+
+	response := map[string]interface{}{
+		"sportTypes": sportTypes,
+		"stopTime":   api.CalculateStopTime(normalized, period, dr.Calendar.WeekStart),
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Stop time: failed to encode response: %v", err)
+	}
+}
+
+// handleDataQuality serves the data quality report: activities recorded twice,
+// with implausible speeds for their sport, without distance, or with GPS glitches.
+// Pass exclude_flagged=true to any stats endpoint to leave them out.
+//
+// Query parameters:
+//   - start_date/end_date: limit the range; defaults to all time
+func (s *server) handleDataQuality(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Default to all time rather than the last 7 days
+	dr := parseDateRange(r, "Data quality")
+	from, start, end := stravaEpoch, "", ""
+	if dr.NormalizeOpts != nil {
+		startDate, endDate := dr.NormalizeOpts.Bounds()
+		from, start, end = startDate, startDate.Format("2006-01-02"), endDate.Format("2006-01-02")
+	}
+
+	// Duplicates can straddle midnight, so load one extra day of history
+	token, athleteID, ok := s.authenticate(w, r, "Data quality")
+	if !ok {
+		return
+	}
+	entry, ok := s.syncRollup(w, r, token, athleteID, from.AddDate(0, 0, -1), "Data quality")
+	if !ok {
+		return
+	}
+	_, quality := entry.snapshot()
+	report := quality.Report(start, end)
+	response := map[string]interface{}{
+		"startDate": start,
+		"endDate":   end,
+		"report":    report,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Data quality: failed to encode response: %v", err)
+	}
+	log.Printf("Data quality: flagged %d of %d activities", report.Flagged, report.Checked)
+}
+
+// parseWorkloadThresholds reads threshold overrides (weekly_increase, acwr,
+// monotony, strain) on top of api.DefaultWorkloadThresholds. 0 disables a check.
+func parseWorkloadThresholds(r *http.Request) (api.WorkloadThresholds, error) {
+	thresholds := api.DefaultWorkloadThresholds()
+	for name, field := range map[string]*float64{
+		"weekly_increase": &thresholds.WeeklyIncrease,
+		"acwr":            &thresholds.ACWR,
+		"monotony":        &thresholds.Monotony,
+		"strain":          &thresholds.Strain,
+	} {
+		if valueStr := r.URL.Query().Get(name); valueStr != "" {
+			value, err := strconv.ParseFloat(valueStr, 64)
+			if err != nil || value < 0 {
+				return thresholds, fmt.Errorf("invalid %s %q", name, valueStr)
+			}
+			*field = value
+		}
+	}
+	return thresholds, nil
+}
+
+// workloadDefaultWeeks is how far back /api/workload looks without a date range.
+const workloadDefaultWeeks = 12
+
+// handleWorkload serves the acute:chronic workload ratio, monotony and strain,
+// with weeks and alerts for thresholds that were broken.
+//
+// Query parameters:
+//   - metric: "distance" (default), "time" or "stress" (TRIMP from the heart
+//     rates in the athlete's settings on each day)
+//   - sport_types=... or running_only=true: only count these sports
+//   - weekly_increase, acwr, monotony, strain: threshold overrides
+//   - start_date/end_date: defaults to the last 12 weeks
+func (s *server) handleWorkload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		metric = api.LoadDistance
+	}
+	if metric != api.LoadDistance && metric != api.LoadTime && metric != api.LoadStress {
+		writeJSONError(w, http.StatusBadRequest, "Invalid metric. Must be 'distance', 'time', or 'stress'")
+		return
+	}
+	thresholds, err := parseWorkloadThresholds(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter, sportTypes := parseSportFilter(r)
+
+	token, athleteID, ok := s.authenticate(w, r, "Workload")
+	if !ok {
+		return
+	}
+	history := s.settingsHistory(athleteID, "Workload")
+
+	dr := parseDateRange(r, "Workload")
+	if dr.NormalizeOpts == nil {
+		dr.NormalizeOpts = &api.NormalizeOptions{DaysBack: workloadDefaultWeeks*7 - 1}
+	}
+	// The chronic load of the first day looks back another 27 days
+	opts := *dr.NormalizeOpts
+	startDate, _ := opts.Bounds()
+	chronic := &api.NormalizeOptions{StartDate: startDate.AddDate(0, 0, -27), EndDate: startDate}
+	rollup, calendar, ok := s.loadCalendarRollup(w, r, token, athleteID, chronic, "Workload")
+	if !ok {
+		return
+	}
+	startDate, endDate := withLocation(dr.NormalizeOpts, calendar.Location).Bounds()
+
+	workload, err := api.WorkloadFromRollup(rollup, startDate.Format("2006-01-02"), endDate.Format("2006-01-02"), filter, api.WorkloadOptions{
+		Metric:     metric,
+		WeekStart:  calendar.WeekStart,
+		Thresholds: thresholds,
+		Stress:     history.Current().StressModel(),
+		StressAt:   history.StressModelAt, // each day uses the heart rates in effect then
+	})
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response := map[string]interface{}{
+		"startDate":  startDate.Format("2006-01-02"),
+		"endDate":    endDate.Format("2006-01-02"),
+		"sportTypes": sportTypes,
+		"workload":   workload,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Workload: failed to encode response: %v", err)
+	}
+}
+
+// Climb detection defaults and limits.
+const (
+	defaultClimbActivities = 20
+	maxClimbActivities     = 50 // each activity needs an activity streams request
+	// climbMinActivityGain is the least elevation gain of an activity worth
+	// fetching streams for, in meters
+	climbMinActivityGain = 50.0
+)
+
+// handleClimbs serves the categorized climbs (Cat 4 to HC) detected in the
+// newest hilly runs, walks, hikes and rides, with repeated ascents of the
+// same climb and their times.
+//
+// Query parameters:
+//   - start_date/end_date: the dashboard date range
+//   - sport_types=... or running_only=true: only check these sports
+//   - limit: how many of the newest activities to analyze (default 20, max 50)
+func (s *server) handleClimbs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit := defaultClimbActivities
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxClimbActivities {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid limit. Must be between 1 and %d", maxClimbActivities))
+			return
+		}
+	}
+	filter, sportTypes := parseSportFilter(r)
+
+	token, athleteID, ok := s.authenticate(w, r, "Climbs")
+	if !ok {
+		return
+	}
+	activities, dr, ok := s.loadActivities(w, r, token, athleteID, "Climbs")
+	if !ok {
+		return
+	}
+	normalized := filterSports(normalizeActivities(r, activities, dr.NormalizeOpts), filter)
+	candidates := api.ClimbCandidates(normalized, climbMinActivityGain, limit)
+
+	// Streams are cached, so only new activities cost a request
+	var climbs []api.ActivityClimbs
+	ok = s.withTokenRetry(w, r, token, "Climbs", func(token *oauth2.Token) error {
+		climbs = climbs[:0]
+		for _, activity := range candidates {
+			streams, err := s.getOrFetchStreams(r.Context(), token, athleteID, activity.ID)
+			if err != nil {
+				return err
+			}
+			climbs = append(climbs, api.ActivityClimbs{
+				ID:        activity.ID,
+				Name:      activity.Name,
+				Date:      activity.LocalDateStr,
+				SportType: activity.SportType,
+				Climbs:    api.DetectClimbs(streams),
+			})
+		}
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	analysis := api.AnalyzeClimbs(climbs)
+	response := map[string]interface{}{
+		"sportTypes": sportTypes,
+		"analyzed":   len(candidates),
+		"climbs":     analysis,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Climbs: failed to encode response: %v", err)
+	}
+	log.Printf("Climbs: found climbs in %d of %d activities", len(analysis.Activities), len(candidates))
+}
+
+// handleElevation serves the total climbing per period and Everesting
+// milestones: the days the cumulative climbing passed each multiple of
+// Mount Everest.
+//
+// Query parameters:
+//   - period: "weekly", "monthly" (default), "quarterly" or "yearly"
+//   - sport_types=... or running_only=true: only count these sports
+//   - start_date/end_date: limit the range; defaults to all time
+func (s *server) handleElevation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "monthly"
+	}
+	if period != "weekly" && period != "monthly" && period != "quarterly" && period != "yearly" {
+		writeJSONError(w, http.StatusBadRequest, "Invalid period. Must be 'weekly', 'monthly', 'quarterly', or 'yearly'")
+		return
+	}
+	filter, sportTypes := parseSportFilter(r)
+
+	// Default to all time, as milestones count from the first climb
+	dr := parseDateRange(r, "Elevation")
+	allTime := dr.NormalizeOpts == nil
+	if allTime {
+		dr.NormalizeOpts = &api.NormalizeOptions{StartDate: stravaEpoch, EndDate: stravaEpoch}
+	}
+
+	token, athleteID, ok := s.authenticate(w, r, "Elevation")
+	if !ok {
+		return
+	}
+	rollup, calendar, ok := s.loadCalendarRollup(w, r, token, athleteID, dr.NormalizeOpts, "Elevation")
+	if !ok {
+		return
+	}
+	startDate, endDate := dr.NormalizeOpts.Bounds()
+	if allTime {
+		endDate = calendar.Today()
+	}
+	start, end := startDate.Format("2006-01-02"), endDate.Format("2006-01-02")
+
+	elevation := api.ElevationFromRollup(rollup, start, end, period, calendar.WeekStart, filter)
+	response := map[string]interface{}{
+		"startDate":  start,
+		"endDate":    end,
+		"period":     period,
+		"sportTypes": sportTypes,
+		"elevation":  elevation,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Elevation: failed to encode response: %v", err)
+	}
+}
+
+// Decoupling defaults and limits.
+const (
+	defaultDecouplingActivities = 20
+	maxDecouplingActivities     = 50 // each activity needs an activity streams request
+)
+
+// handleEfficiency serves the Efficiency Factor of runs and rides with heart
+// rate, and the Pa:HR or Pw:HR decoupling between the halves of the newest
+// efforts of at least 20 minutes.
+//
+// Query parameters:
+//   - start_date/end_date: the dashboard date range
+//   - sport_types=... or running_only=true: only count these sports
+//   - limit: how many of the newest efforts to measure decoupling of (default 20, max 50)
+func (s *server) handleEfficiency(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit := defaultDecouplingActivities
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxDecouplingActivities {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid limit. Must be between 1 and %d", maxDecouplingActivities))
+			return
+		}
+	}
+	filter, sportTypes := parseSportFilter(r)
+
+	token, athleteID, ok := s.authenticate(w, r, "Efficiency")
+	if !ok {
+		return
+	}
+	activities, dr, ok := s.loadActivities(w, r, token, athleteID, "Efficiency")
+	if !ok {
+		return
+	}
+	normalized := filterSports(normalizeActivities(r, activities, dr.NormalizeOpts), filter)
+	candidates := api.DecouplingCandidates(normalized, limit)
+
+	// Streams are cached, so only new efforts cost a request
+	decouplings := make(map[int64]api.Decoupling)
+	ok = s.withTokenRetry(w, r, token, "Efficiency", func(token *oauth2.Token) error {
+		for _, activity := range candidates {
+			streams, err := s.getOrFetchStreams(r.Context(), token, athleteID, activity.ID)
+			if err != nil {
+				return err
+			}
+			if d, ok := api.CalculateDecoupling(streams, api.EfficiencyBasis(activity.SportType)); ok {
+				decouplings[activity.ID] = d
+			}
+		}
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	// Grade factors of the streams just fetched count too
+	analysis := api.CalculateEfficiency(normalized, s.cachedGradeFactors(athleteID, normalized), decouplings)
+	response := map[string]interface{}{
+		"sportTypes": sportTypes,
+		"analyzed":   len(candidates),
+		"efficiency": analysis,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Efficiency: failed to encode response: %v", err)
+	}
+	log.Printf("Efficiency: %d activities with heart rate, decoupling of %d", len(analysis.Activities), len(decouplings))
+}
+
+// parseVO2maxOptions reads the athlete details for VO2max estimation from the
+// athlete's settings: the heart rates in effect on the date of each run, sex
+// and age on today, the athlete's date. Query parameters override them for
+// what-if estimates: max_hr and resting_hr (both), sex ("male" or "female")
+// and age. Heart rates that are in neither fall back to DefaultStressModel.
+func parseVO2maxOptions(r *http.Request, history *api.SettingsHistory, today time.Time) (api.VO2maxOptions, error) {
+	settings := history.Current()
+	current := settings.StressModel()
+	opts := api.VO2maxOptions{
+		MaxHR:               current.MaxHR,
+		RestingHR:           current.RestingHR,
+		HeartRateConfigured: settings.HeartRateConfigured(),
+		Sex:                 settings.Sex,
+		Age:                 settings.Age(today),
+		HeartRatesAt: func(date string) (float64, float64) {
+			model := history.StressModelAt(date)
+			return model.MaxHR, model.RestingHR
+		},
+	}
+	query := r.URL.Query()
+
+	maxStr, restingStr := query.Get("max_hr"), query.Get("resting_hr")
+	if maxStr != "" || restingStr != "" {
+		maxHR, err1 := strconv.ParseFloat(maxStr, 64)
+		restingHR, err2 := strconv.ParseFloat(restingStr, 64)
+		if err1 != nil || err2 != nil || restingHR < 25 || maxHR > 240 || restingHR >= maxHR {
+			return opts, fmt.Errorf("invalid heart rates %q and %q: give both max_hr and resting_hr, with 25 <= resting_hr < max_hr <= 240", maxStr, restingStr)
+		}
+		opts.MaxHR, opts.RestingHR, opts.HeartRateConfigured = maxHR, restingHR, true
+		opts.HeartRatesAt = nil
+	}
+
+	if sex := query.Get("sex"); sex != "" {
+		if sex != "male" && sex != "female" {
+			return opts, fmt.Errorf("invalid sex %q: must be 'male' or 'female'", sex)
+		}
+		opts.Sex = sex
+	}
+	if ageStr := query.Get("age"); ageStr != "" {
+		age, err := strconv.ParseFloat(ageStr, 64)
+		if err != nil || age < 10 || age > 110 {
+			return opts, fmt.Errorf("invalid age %q: must be between 10 and 110", ageStr)
+		}
+		opts.Age = age
+	}
+	return opts, nil
+}
+
+// handleVO2max serves VO2max estimated from the heart rate and grade-adjusted
+// speed of steady runs in the date range, smoothed into a trend, with fitness
+// age from population norms. The response documents the method and how
+// confident the estimate is.
+//
+// Query parameters:
+//   - start_date/end_date: the dashboard date range
+//   - max_hr, resting_hr: override the heart rates of the athlete's settings
+//     (without either, typical values are used at lower confidence)
+//   - sex: "male" or "female", for the fitness age norms; defaults to the setting
+//   - age: to compare with the fitness age; defaults to the age from the birthdate setting
+func (s *server) handleVO2max(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, athleteID, ok := s.authenticate(w, r, "VO2max")
+	if !ok {
+		return
+	}
+	activities, dr, ok := s.loadActivities(w, r, token, athleteID, "VO2max")
+	if !ok {
+		return
+	}
+	// Ages turn over on the birthday in the athlete's timezone
+	opts, err := parseVO2maxOptions(r, s.settingsHistory(athleteID, "VO2max"), dr.Calendar.Today())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	normalized := normalizeActivities(r, activities, dr.NormalizeOpts)
+
+	vo2max := api.EstimateVO2max(normalized, s.cachedGradeFactors(athleteID, normalized), opts)
+	response := map[string]interface{}{
+		"vo2max": vo2max,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("VO2max: failed to encode response: %v", err)
+	}
+	log.Printf("VO2max: %.1f from %d runs (%s confidence)", vo2max.VO2max, len(vo2max.Estimates), vo2max.Confidence)
+}
+
+// handleSettings serves (GET) and saves (PUT) the athlete's settings and their
+// history of changes.
+//
+// Until the athlete saves settings, GET prefills them from their Strava profile
+// and zones; prefill=strava returns Strava's values alongside saved settings too.
+// The response's units are the settings' units, then the athlete's Strava
+// measurement preference, then imperial.
+//
+// PUT takes the settings as a JSON object (max_hr, resting_hr, lthr, ftp,
+// weight, birthdate, sex, units, week_start) with an optional effective_date
+// (YYYY-MM-DD, default today in the tz query parameter's timezone) from which
+// they apply. Saving again with the same effective date replaces that change;
+// an earlier date records what the settings were in the past, so analyses of
+// that time use them.
+//
+// PATCH takes {"units": "metric"} to choose units alone, as the unit toggle
+// does. It leaves the settings and their history alone, so it never saves
+// prefilled values as the athlete's own.
+func (s *server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		w.Header().Set("Allow", "GET, PUT, PATCH")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed. Use GET, PUT or PATCH")
+		return
+	}
+	token, athleteID, ok := s.authenticate(w, r, "Settings")
+	if !ok {
+		return
+	}
+
+	var history *api.SettingsHistory
+	var err error
+	if r.Method == http.MethodPut {
+		var body struct {
+			api.AthleteSettings
+			EffectiveDate string `json:"effective_date"`
+		}
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid settings: "+err.Error())
+			return
+		}
+		if body.EffectiveDate == "" {
+			calendar, err := parseCalendar(r, "", "")
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			body.EffectiveDate = calendar.Today().Format("2006-01-02")
+		}
+		change := api.SettingsChange{
+			EffectiveDate: body.EffectiveDate,
+			Settings:      body.AthleteSettings,
+			ChangedAt:     time.Now().UTC(),
+			Source:        api.SourceUser,
+		}
+		// Validate before touching the store, so only storage failures are 500s
+		if err := (&api.SettingsHistory{}).Apply(change); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		history, err = s.settings.Update(athleteID, func(history *api.SettingsHistory) error {
+			if change.Settings.Units != "" {
+				history.Units = change.Settings.Units
+			}
+			return history.Apply(change)
+		})
+		if err == nil {
+			log.Printf("Settings: saved settings of athlete %d effective %s", athleteID, change.EffectiveDate)
+		}
+	} else if r.Method == http.MethodPatch {
+		var body struct {
+			Units string `json:"units"`
+		}
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid settings: "+err.Error())
+			return
+		}
+		if body.Units != api.UnitsMetric && body.Units != api.UnitsImperial {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid units %q: must be 'metric' or 'imperial'", body.Units))
+			return
+		}
+		history, err = s.settings.Update(athleteID, func(history *api.SettingsHistory) error {
+			history.Units = body.Units
+			return nil
+		})
+		if err == nil {
+			log.Printf("Settings: set units of athlete %d to %s", athleteID, body.Units)
+		}
+	} else {
+		history, err = s.settings.Get(athleteID)
+	}
+	if err != nil {
+		log.Printf("Settings: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to access settings: "+err.Error())
+		return
+	}
+
+	saved := len(history.Changes) > 0
+	settings := history.Current()
+	settings.Units = history.PreferredUnits()
+	response := map[string]interface{}{
+		"settings": settings,
+		"history":  history.Changes,
+		"saved":    saved,
+		"source":   api.SourceUser,
+	}
+	needsStrava := !saved || settings.Units == "" || r.URL.Query().Get("prefill") == "strava"
+	if r.Method != http.MethodPut && needsStrava {
+		// Prefilling is a convenience; settings still work without Strava's values
+		prefill, err := s.stravaSettings(r.Context(), token)
+		if err != nil {
+			log.Printf("Settings: failed to prefill from Strava: %v", err)
+		} else {
+			s.settings.SetStravaUnits(athleteID, prefill.Units)
+		}
+		response["strava"] = prefill
+		if !saved {
+			if settings.Units != "" {
+				prefill.Units = settings.Units
+			}
+			settings = prefill
+			response["settings"] = prefill
+			response["source"] = api.SourceStrava
+		} else if settings.Units == "" {
+			settings.Units = prefill.Units
+		}
+	}
+	response["units"] = settings.Units
+	if settings.Units == "" {
+		response["units"] = api.UnitsImperial
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Settings: failed to encode response: %v", err)
+	}
+}
+
+// handleDiagnostics checks the stats against Strava's own: it reconciles the
+// all-time, year-to-date and last-four-weeks totals of rides, runs and swims
+// computed from the athlete's activities with Strava's athlete stats, and
+// returns the athlete's Strava profile and zones as Strava reports them.
+// exclude_flagged=true shows how much the flagged activities account for.
+func (s *server) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, athleteID, ok := s.authenticate(w, r, "Diagnostics")
+	if !ok {
+		return
+	}
+	allTime := &api.NormalizeOptions{StartDate: stravaEpoch, EndDate: stravaEpoch}
+	rollup, calendar, ok := s.loadCalendarRollup(w, r, token, athleteID, allTime, "Diagnostics")
+	if !ok {
+		return
+	}
+
+	var stats *api.AthleteStats
+	var athlete *api.StravaAthlete
+	ok = s.withTokenRetry(w, r, token, "Diagnostics", func(token *oauth2.Token) error {
+		var err error
+		if stats, err = s.stravaClient.FetchAthleteStats(r.Context(), token, athleteID); err != nil {
+			return err
+		}
+		athlete, err = s.stravaClient.FetchAthlete(r.Context(), token)
+		return err
+	})
+	if !ok {
+		return
+	}
+	// Zones need a scope that older sessions lack
+	zones, err := s.stravaClient.FetchAthleteZones(r.Context(), token)
+	if err != nil {
+		log.Printf("Diagnostics: zones unavailable: %v", err)
+	}
+
+	totals := api.ReconcileTotals(rollup, stats, calendar.Today())
+	response := map[string]interface{}{
+		"athlete": athlete,
+		"zones":   zones,
+		"stats":   stats,
+		"totals":  totals,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Diagnostics: failed to encode response: %v", err)
+	}
+	log.Printf("Diagnostics: %d of %d totals differ from Strava's", totals.Discrepancies, len(totals.Comparisons))
+}
+
+// handleAchievements serves (GET) the milestones the athlete has earned, each
+// with the date and activity that earned it, and marks awards as seen (POST)
+// so the dashboard stops announcing them. Awards are always computed from the
+// athlete's whole history.
+//
+// Query parameters:
+//   - exclude_flagged=true: leave activities flagged by the data quality
+//     checks out, so a GPS glitch doesn't earn a record
+//
+// POST takes {"keys": [...]}, the keys of the awards the athlete has seen.
+func (s *server) handleAchievements(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed. Use GET or POST")
+		return
+	}
+	token, athleteID, ok := s.authenticate(w, r, "Achievements")
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var body struct {
+			Keys []string `json:"keys"`
+		}
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+			return
+		}
+		if err := s.achievements.MarkSeen(athleteID, body.Keys); err != nil {
+			log.Printf("Achievements: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to save seen awards: "+err.Error())
+			return
+		}
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{"seen": len(body.Keys)}); err != nil {
+			log.Printf("Achievements: failed to encode response: %v", err)
+		}
+		return
+	}
+
+	allTime := &api.NormalizeOptions{StartDate: stravaEpoch, EndDate: stravaEpoch}
+	_, calendar, ok := s.loadCalendarRollup(w, r, token, athleteID, allTime, "Achievements")
+	if !ok {
+		return
+	}
+	activities, ok := s.loadHistory(w, r, token, athleteID, "Achievements")
+	if !ok {
+		return
+	}
+	seen, err := s.achievements.Seen(athleteID)
+	if err != nil {
+		// Without the seen awards every recent award is announced again
+		log.Printf("Achievements: failed to load seen awards of athlete %d: %v", athleteID, err)
+	}
+
+	awards := api.EvaluateAchievements(activities, s.achievements.Rules(), calendar)
+	newAwards := api.MarkNewAwards(awards, seen, calendar.Today())
+	response := map[string]interface{}{
+		"awards":    awards,
+		"newAwards": newAwards,
+		"rules":     s.achievements.Rules(),
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Achievements: failed to encode response: %v", err)
+	}
+	log.Printf("Achievements: %d awards (%d new) from %d activities", len(awards), newAwards, len(activities))
+}
+
+// parseYear reads the year query parameter, defaulting to the current year.
+func parseYear(r *http.Request, today time.Time) (int, error) {
+	value := r.URL.Query().Get("year")
+	if value == "" {
+		return today.Year(), nil
+	}
+	year, err := strconv.Atoi(value)
+	if err != nil || year < stravaEpoch.Year() || year > today.Year() {
+		return 0, fmt.Errorf("invalid year %q: must be between %d and %d", value, stravaEpoch.Year(), today.Year())
+	}
+	return year, nil
+}
+
+// loadYearInReview summarizes the year requested by the year query parameter
+// from the athlete's whole history. On failure it writes the error response
+// and returns ok=false.
+func (s *server) loadYearInReview(w http.ResponseWriter, r *http.Request, token *oauth2.Token, athleteID int64, logPrefix string) (api.YearInReview, api.Calendar, bool) {
+	allTime := &api.NormalizeOptions{StartDate: stravaEpoch, EndDate: stravaEpoch}
+	_, calendar, ok := s.loadCalendarRollup(w, r, token, athleteID, allTime, logPrefix)
+	if !ok {
+		return api.YearInReview{}, calendar, false
+	}
+	year, err := parseYear(r, calendar.Today())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return api.YearInReview{}, calendar, false
+	}
+	history, ok := s.loadHistory(w, r, token, athleteID, logPrefix)
+	if !ok {
+		return api.YearInReview{}, calendar, false
+	}
+	review := api.YearInReviewFor(history, year, calendar)
+	log.Printf("%s: %d activities in %d", logPrefix, review.Total.Count, year)
+	return review, calendar, true
+}
+
+// handleYearInReview serves the "year wrapped" summary: totals per sport, the
+// longest activity, biggest month, most consistent week, records set, the
+// longest streak, favorite weekday and hour, and landmarks the distance covers.
+//
+// Query parameters:
+//   - year: the year to review; defaults to the current year
+//   - exclude_flagged=true: leave activities flagged by the data quality checks out
+func (s *server) handleYearInReview(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, athleteID, ok := s.authenticate(w, r, "Year in review")
+	if !ok {
+		return
+	}
+	review, _, ok := s.loadYearInReview(w, r, token, athleteID, "Year in review")
+	if !ok {
+		return
+	}
+	response := map[string]interface{}{
+		"review": review,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Year in review: failed to encode response: %v", err)
+	}
+}
+
+// handleYearInReviewPage renders the year in review as a self-contained HTML
+// page to share.
+//
+// Query parameters: as handleYearInReview, plus
+//   - units: "metric" or "imperial"; defaults to the athlete's settings (see parseUnits)
+//   - download=true: serve the page as a file to save
+func (s *server) handleYearInReviewPage(w http.ResponseWriter, r *http.Request) {
+	token, athleteID, ok := s.authenticatePage(w, r, "Year in review page")
+	if !ok {
+		return
+	}
+	metric, err := s.parseUnits(r, token, athleteID, "Year in review page")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	review, calendar, ok := s.loadYearInReview(w, r, token, athleteID, "Year in review page")
+	if !ok {
+		return
+	}
+	session, _ := s.authenticator.Store.Get(r, "strava-session")
+	name, _ := session.Values["athlete_name"].(string)
+	page := newYearReviewPage(review, name, metric, calendar.WeekStart)
+
+	tmpl, err := template.ParseFiles("web/templates/year_in_review.html")
+	if err != nil {
+		http.Error(w, "Could not load template", http.StatusInternalServerError)
+		log.Printf("Error parsing template: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.URL.Query().Get("download") == "true" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"year-in-review-%d.html\"", review.Year))
+	}
+	if err := tmpl.Execute(w, page); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// parseUnits reads the units query parameter, "metric" or "imperial", falling
+// back to the athlete's settings, then their preference on Strava, and then
+// imperial. It reports whether the units are metric.
+func (s *server) parseUnits(r *http.Request, token *oauth2.Token, athleteID int64, logPrefix string) (bool, error) {
+	units := r.URL.Query().Get("units")
+	if units == "" {
+		units = s.settingsHistory(athleteID, logPrefix).PreferredUnits()
+	}
+	if units == "" {
+		units = s.stravaUnits(r.Context(), token, athleteID, logPrefix)
+	}
+	if units != "" && units != api.UnitsMetric && units != api.UnitsImperial {
+		return false, fmt.Errorf("invalid units %q: must be 'metric' or 'imperial'", units)
+	}
+	return units == api.UnitsMetric, nil
+}
+
+// rangeParams returns the start and end query parameters, falling back to
+// start_date and end_date like the API.
+func rangeParams(r *http.Request) (string, string) {
+	start, end := r.URL.Query().Get("start"), r.URL.Query().Get("end")
+	if start == "" {
+		start = r.URL.Query().Get("start_date")
+	}
+	if end == "" {
+		end = r.URL.Query().Get("end_date")
+	}
+	return start, end
+}
+
+// parseChartRange reads the date range of a chart from the start and end query
+// parameters (YYYY-MM-DD), or start_date and end_date like the API. Without
+// them, charts cover the last year.
+func parseChartRange(r *http.Request) (*api.NormalizeOptions, error) {
+	start, end := rangeParams(r)
+	if start == "" && end == "" {
+		return &api.NormalizeOptions{DaysBack: 365}, nil
+	}
+	startDate, err := time.Parse("2006-01-02", start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date %q: must be YYYY-MM-DD", start)
+	}
+	endDate, err := time.Parse("2006-01-02", end)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end date %q: must be YYYY-MM-DD", end)
+	}
+	if endDate.Before(startDate) {
+		return nil, fmt.Errorf("invalid date range: %s is before %s", end, start)
+	}
+	return &api.NormalizeOptions{StartDate: startDate, EndDate: endDate}, nil
+}
+
+// handleChart renders a dashboard chart as an image: /charts/{name}.svg, or
+// .png for a raster image. Charts are heatmap (moving time per day), doughnut
+// (share of each sport), histogram (run distances), trends and plan (planned
+// against actual volume per period, see handlePlanAdherence).
+//
+// Query parameters:
+//   - start/end (or start_date/end_date): the range; defaults to the last year,
+//     or the whole training plan for the plan chart
+//   - sport_types=Ride,VirtualRide or running_only=true: only chart these sports
+//     (trends only take running_only, like the trends API)
+//   - units: "metric" or "imperial"; defaults to the athlete's settings (see parseUnits)
+//   - metric: what the doughnut shares, "count" (default), "time" or "distance"
+//   - period: trends and plan period, "daily", "weekly" (default), "monthly", "quarterly" or "yearly"
+//   - series: trends series, "distance" (default), "time", "elevation" or "pace";
+//     the plan chart takes "distance" (default) or "time"
+//   - exclude_flagged=true: leave activities flagged by the data quality checks out
+func (s *server) handleChart(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/charts/")
+	ext := path.Ext(name)
+	name = strings.TrimSuffix(name, ext)
+	if ext != ".svg" && ext != ".png" {
+		http.NotFound(w, r)
+		return
+	}
+	switch name {
+	case "heatmap", "doughnut", "histogram", "trends", "plan":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	logPrefix := "Chart " + name
+
+	token, athleteID, ok := s.authenticate(w, r, logPrefix)
+	if !ok {
+		return
+	}
+	metric, err := s.parseUnits(r, token, athleteID, logPrefix)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts, err := parseChartRange(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter, _ := parseSportFilter(r)
+
+	rollup, calendar, ok := s.loadCalendarRollup(w, r, token, athleteID, opts, logPrefix)
+	if !ok {
+		return
+	}
+	startDate, endDate := withLocation(opts, calendar.Location).Bounds()
+	start, end := startDate.Format("2006-01-02"), endDate.Format("2006-01-02")
+
+	var chart *charts.Chart
+	switch name {
+	case "heatmap":
+		chart, err = charts.Heatmap(rollup.Days(start, end, filter), start, end, calendar.WeekStart)
+	case "doughnut":
+		chart, err = sportDoughnut(rollup.Totals(start, end, filter), r.URL.Query().Get("metric"), metric)
+	case "histogram":
+		history, ok := s.loadHistory(w, r, token, athleteID, logPrefix)
+		if !ok {
+			return
+		}
+		var runs []api.NormalizedActivity
+		for _, activity := range filterSports(history, filter) {
+			if activity.LocalDateStr >= start && activity.LocalDateStr <= end {
+				runs = append(runs, activity)
+			}
+		}
+		chart = charts.Histogram(api.GenerateDistanceHistogram(runs, !metric), metric)
+	case "trends":
+		period := r.URL.Query().Get("period")
+		if period == "" {
+			period = "weekly"
+		}
+		if period != "daily" && period != "weekly" && period != "monthly" && period != "quarterly" && period != "yearly" {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid period %q", period))
+			return
+		}
+		series := r.URL.Query().Get("series")
+		if series == "" {
+			series = charts.SeriesDistance
+		}
+		trends := api.TrendsFromRollup(rollup, start, end, api.TrendOptions{
+			Period:      period,
+			RunningOnly: r.URL.Query().Get("running_only") == "true",
+			WeekStart:   calendar.WeekStart,
+		})
+		chart, err = charts.TrendLine(trends, series, metric)
+	case "plan":
+		adherence, ok := s.loadPlanAdherence(w, r, token, athleteID, logPrefix)
+		if !ok {
+			return
+		}
+		series := r.URL.Query().Get("series")
+		if series == "" {
+			series = charts.SeriesDistance
+		}
+		chart, err = charts.PlanVsActual(adherence, series, metric)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if ext == ".png" {
+		w.Header().Set("Content-Type", "image/png")
+		err = chart.WritePNG(w)
+	} else {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = chart.WriteSVG(w)
+	}
+	if err != nil {
+		log.Printf("%s: failed to write chart: %v", logPrefix, err)
+	}
+}
+
+// sportDoughnut charts each sport's share of totals by count, moving time or
+// distance.
+func sportDoughnut(totals api.PeriodTotals, by string, metric bool) (*charts.Chart, error) {
+	var (
+		title  string
+		value  func(api.RollupTotals) float64
+		format func(float64) string
+	)
+	switch by {
+	case "", "count":
+		title = "Activities by Sport"
+		value = func(t api.RollupTotals) float64 { return float64(t.Count) }
+		format = func(v float64) string { return fmt.Sprintf("%.0f activities", v) }
+	case "time":
+		title = "Moving Time by Sport"
+		value = func(t api.RollupTotals) float64 { return float64(t.MovingTime) }
+		format = func(v float64) string { return api.FormatDuration(int(v)) }
+	case "distance":
+		title = "Distance by Sport"
+		value = func(t api.RollupTotals) float64 { return t.Distance }
+		format = func(v float64) string {
+			if metric {
+				return fmt.Sprintf("%.1f km", v/1000)
+			}
+			return fmt.Sprintf("%.1f mi", v/1609.34)
+		}
+	default:
+		return nil, fmt.Errorf("invalid metric %q: must be 'count', 'time' or 'distance'", by)
+	}
+
+	slices := make([]charts.Slice, 0, len(totals.Sports))
+	for sport, sportTotals := range totals.Sports {
+		slices = append(slices, charts.Slice{Label: sport, Value: value(sportTotals)})
+	}
+	// Equal values keep a stable order
+	sort.Slice(slices, func(i, j int) bool { return slices[i].Label < slices[j].Label })
+	return charts.Doughnut(title, slices, format), nil
+}
+
+// handleMonthlyReport serves a printable training report as a PDF: summary
+// cards, totals per sport, running stats and PRs, the heatmap, distance trends
+// and histogram, and every activity in the range.
+//
+// Query parameters:
+//   - month: the month to report (YYYY-MM); defaults to this month up to today
+//   - start/end (or start_date/end_date): a range of days instead of a month
+//   - units: "metric" or "imperial"; defaults to the athlete's settings (see parseUnits)
+//   - download=true: serve the report as a file to save
+//   - exclude_flagged=true: leave activities flagged by the data quality checks out
+func (s *server) handleMonthlyReport(w http.ResponseWriter, r *http.Request) {
+	token, athleteID, ok := s.authenticatePage(w, r, "Monthly report")
+	if !ok {
+		return
+	}
+	metric, err := s.parseUnits(r, token, athleteID, "Monthly report")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	allTime := &api.NormalizeOptions{StartDate: stravaEpoch, EndDate: stravaEpoch}
+	_, calendar, ok := s.loadCalendarRollup(w, r, token, athleteID, allTime, "Monthly report")
+	if !ok {
+		return
+	}
+	start, end := rangeParams(r)
+	start, end, err = report.ParseRange(r.URL.Query().Get("month"), start, end, calendar.Today())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	history, ok := s.loadHistory(w, r, token, athleteID, "Monthly report")
+	if !ok {
+		return
+	}
+
+	session, _ := s.authenticator.Store.Get(r, "strava-session")
+	name, _ := session.Values["athlete_name"].(string)
+	monthly := report.NewMonthly(history, start, end, report.Options{
+		Athlete:   name,
+		Metric:    metric,
+		WeekStart: calendar.WeekStart,
+		Generated: time.Now(),
+	})
+
+	// Lay the whole report out first, so a failure can still be reported
+	var b bytes.Buffer
+	if err := monthly.WritePDF(&b); err != nil {
+		log.Printf("Monthly report: failed to write PDF: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to write report: "+err.Error())
+		return
+	}
+	disposition := "inline"
+	if r.URL.Query().Get("download") == "true" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=\"training-report-%s-%s.pdf\"", disposition, start, end))
+	if _, err := b.WriteTo(w); err != nil {
+		log.Printf("Monthly report: failed to write response: %v", err)
+		return
+	}
+	log.Printf("Monthly report: %d activities from %s to %s", len(monthly.Activities), start, end)
+}
+
+// dailyExportRow is a row of the daily rollup export: one sport's totals on
+// one day.
+type dailyExportRow struct {
+	Date      string `json:"date"`
+	SportType string `json:"sport_type"`
+	api.RollupTotals
+}
+
+// parseExportRange reads the optional start_date and end_date query parameters
+// (YYYY-MM-DD) of an export. An empty bound leaves that end of the range open.
+func parseExportRange(r *http.Request) (string, string, error) {
+	start, end := rangeParams(r)
+	for _, date := range []string{start, end} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			return "", "", fmt.Errorf("invalid date %q: must be YYYY-MM-DD", date)
+		}
+	}
+	if start != "" && end != "" && end < start {
+		return "", "", fmt.Errorf("invalid date range: %s is before %s", end, start)
+	}
+	return start, end, nil
+}
+
+// exportWriteTimeout replaces the server's 15s WriteTimeout for exports, whose
+// download of a long history can take longer on a slow connection.
+const exportWriteTimeout = 10 * time.Minute
+
+// handleExport streams a dataset as CSV, JSON Lines or Parquet for analysis in
+// other tools. Rows are written as they are produced, so the encoded export isn't
+// held in memory; only a Parquet row group is buffered at a time. Activities have
+// to be sorted first, so the selected ones are copied out of the athlete's
+// in-memory history (see athleteRollup.history).
+//
+// Query parameters:
+//   - format: "csv" (default), "jsonl" or "parquet"
+//   - dataset: "activities" (default) for every normalized activity with its
+//     derived unit fields, "daily" for the totals of each sport per day, or
+//     "trends" for aggregated trend points
+//   - start_date/end_date (or start/end): the range (YYYY-MM-DD); defaults to all time
+//   - fields=id,name,distance_km: only export these columns, in this order
+//   - sport_types=Ride,VirtualRide or running_only=true: only export these sports
+//     (trends only take running_only, like the trends API)
+//   - period, smoothing, window, alpha, cumulative: as for /api/trends, except
+//     that trends are exported unsmoothed unless smoothing is given
+//   - exclude_flagged=true: leave activities flagged by the data quality checks out
+func (s *server) handleExport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if format != export.FormatCSV && format != export.FormatJSONL && format != export.FormatParquet {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid format %q: must be 'csv', 'jsonl' or 'parquet'", format))
+		return
+	}
+	dataset := query.Get("dataset")
+	if dataset == "" {
+		dataset = "activities"
+	}
+	var table *export.Table
+	switch dataset {
+	case "activities":
+		table = export.NewTable(api.NormalizedActivity{})
+	case "daily":
+		table = export.NewTable(dailyExportRow{})
+	case "trends":
+		table = export.NewTable(api.TrendDataPoint{})
+	default:
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid dataset %q: must be 'activities', 'daily' or 'trends'", dataset))
+		return
+	}
+	if fields := query.Get("fields"); fields != "" {
+		var err error
+		if table, err = table.Select(strings.Split(fields, ",")); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid fields: "+err.Error())
+			return
+		}
+	}
+	start, end, err := parseExportRange(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	period := query.Get("period")
+	if period == "" {
+		period = "daily"
+	}
+	if period != "daily" && period != "weekly" && period != "monthly" && period != "quarterly" && period != "yearly" {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid period %q", period))
+		return
+	}
+	smoothing, err := parseTrendSmoothing(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid smoothing: "+err.Error())
+		return
+	}
+	if smoothing.Method == "" {
+		smoothing.Method = api.SmoothingNone
+	}
+	filter, _ := parseSportFilter(r)
+
+	// The deadline also covers loading the history from Strava
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil {
+		log.Printf("Export: failed to extend the write deadline: %v", err)
+	}
+
+	allTime := &api.NormalizeOptions{StartDate: stravaEpoch, EndDate: stravaEpoch}
+	token, athleteID, ok := s.authenticate(w, r, "Export")
+	if !ok {
+		return
+	}
+	rollup, calendar, ok := s.loadCalendarRollup(w, r, token, athleteID, allTime, "Export")
+	if !ok {
+		return
+	}
+	// Only the exported activities are copied out of the athlete's history
+	var activities []api.NormalizedActivity
+	if dataset == "activities" {
+		entry, ok := s.syncRollup(w, r, token, athleteID, stravaEpoch, "Export")
+		if !ok {
+			return
+		}
+		activities = entry.history(excludeFlagged(r), func(activity *api.NormalizedActivity) bool {
+			date := activity.LocalDateStr
+			return (filter == nil || filter(activity.SportType)) &&
+				(start == "" || date >= start) && (end == "" || date <= end)
+		})
+	}
+
+	filename := "strava-" + dataset
+	if start != "" || end != "" {
+		filename += "-" + start + "-" + end
+	}
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", filename, format))
+	writer, err := export.NewWriter(format, w, table.Columns())
+	if err != nil {
+		log.Printf("Export: failed to start export: %v", err)
+		return
+	}
+
+	// Once rows are written the response can't turn into an error, so
+	// failures are only logged
+	rows := 0
+	write := func(v interface{}) bool {
+		if err := writer.Write(table.Row(v)); err != nil {
+			log.Printf("Export: failed to write row: %v", err)
+			return false
+		}
+		rows++
+		return true
+	}
+	switch dataset {
+	case "activities":
+		sort.Slice(activities, func(i, j int) bool {
+			if !activities[i].StartDate.Equal(activities[j].StartDate) {
+				return activities[i].StartDate.Before(activities[j].StartDate)
+			}
+			return activities[i].ID < activities[j].ID
+		})
+		for i := range activities {
+			if !write(&activities[i]) {
+				return
+			}
+		}
+	case "daily":
+		for _, day := range rollup.Days(start, end, filter) {
+			sports := make([]string, 0, len(day.Sports))
+			for sport := range day.Sports {
+				sports = append(sports, sport)
+			}
+			sort.Strings(sports)
+			for _, sport := range sports {
+				if !write(dailyExportRow{Date: day.Date, SportType: sport, RollupTotals: day.Sports[sport]}) {
+					return
+				}
+			}
+		}
+	case "trends":
+		first, last := rollup.DateBounds()
+		if start == "" {
+			start = first
+		}
+		if end == "" {
+			end = last
+		}
+		if start != "" && end != "" {
+			trends := api.TrendsFromRollup(rollup, start, end, api.TrendOptions{
+				Period:      period,
+				RunningOnly: query.Get("running_only") == "true",
+				WeekStart:   calendar.WeekStart,
+				Cumulative:  query.Get("cumulative") == "true",
+				Smoothing:   smoothing,
+			})
+			for i := range trends.Points {
+				if !write(&trends.Points[i]) {
+					return
+				}
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		log.Printf("Export: failed to finish export: %v", err)
+		return
+	}
+	log.Printf("Export: wrote %d %s rows as %s", rows, dataset, format)
+}
+
+// handlePlan serves (GET) and replaces (PUT) the athlete's training plan.
+//
+// PUT takes {"workouts": [...]}, each workout with a date (YYYY-MM-DD),
+// sport_type and optional title, distance (meters), duration (seconds),
+// intensity and notes. Workouts without an id get one from their date.
+func (s *server) handlePlan(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		w.Header().Set("Allow", "GET, PUT")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed. Use GET or PUT")
+		return
+	}
+	_, athleteID, ok := s.authenticate(w, r, "Plan")
+	if !ok {
+		return
+	}
+
+	var plan *api.TrainingPlan
+	var err error
+	if r.Method == http.MethodPut {
+		var body struct {
+			Workouts []api.PlannedWorkout `json:"workouts"`
+		}
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid plan: "+err.Error())
+			return
+		}
+		workouts, err := api.NormalizePlan(body.Workouts)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		plan, err = s.plans.Save(athleteID, workouts)
+		if err == nil {
+			log.Printf("Plan: saved %d workouts of athlete %d", len(workouts), athleteID)
+		}
+	} else {
+		plan, err = s.plans.Get(athleteID)
+	}
+	if err != nil {
+		log.Printf("Plan: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to access plan: "+err.Error())
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"plan": plan}); err != nil {
+		log.Printf("Plan: failed to encode response: %v", err)
+	}
+}
+
+// planImportFormats maps the Content-Type of plan files to their format.
+var planImportFormats = map[string]string{
+	"text/csv":         "csv",
+	"text/calendar":    "ics",
+	"application/json": "json",
+}
+
+// handlePlanImport imports a training plan from a coach's file, posted as the
+// request body: CSV with a header row (date, sport, title, distance,
+// duration, intensity, notes), an iCalendar file of workouts, or JSON like
+// the plan API.
+//
+// Query parameters:
+//   - format: "csv", "ics" or "json"; defaults to the request's Content-Type
+//   - mode: "replace" (default) replaces the plan, "merge" only replaces the
+//     days the file has sessions on
+//   - units: "metric" or "imperial", for CSV distances without a unit;
+//     defaults to the athlete's settings
+func (s *server) handlePlanImport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed. Use POST")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		contentType, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";")
+		format = planImportFormats[strings.TrimSpace(strings.ToLower(contentType))]
+	}
+	if format != "csv" && format != "ics" && format != "json" {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid format %q: must be 'csv', 'ics' or 'json'", format))
+		return
+	}
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "replace"
+	}
+	if mode != "replace" && mode != "merge" {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid mode %q: must be 'replace' or 'merge'", mode))
+		return
+	}
+	token, athleteID, ok := s.authenticate(w, r, "Plan import")
+	if !ok {
+		return
+	}
+	metric, err := s.parseUnits(r, token, athleteID, "Plan import")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, 1<<20)
+	var workouts []api.PlannedWorkout
+	switch format {
+	case "csv":
+		workouts, err = api.ParsePlanCSV(body, metric)
+	case "ics":
+		workouts, err = ical.ReadPlan(body)
+	case "json":
+		workouts, err = api.ParsePlanJSON(body)
+	}
+	if err == nil {
+		workouts, err = api.NormalizePlan(workouts)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid plan: "+err.Error())
+		return
+	}
+	plan, err := s.plans.Import(athleteID, workouts, mode == "merge")
+	if err != nil {
+		log.Printf("Plan import: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to save plan: "+err.Error())
+		return
+	}
+	log.Printf("Plan import: imported %d workouts of athlete %d from %s (%s)", len(workouts), athleteID, format, mode)
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"imported": len(workouts), "plan": plan}); err != nil {
+		log.Printf("Plan import: failed to encode response: %v", err)
+	}
+}
+
+// planRange returns the range of a plan report: the start and end query
+// parameters (or start_date and end_date) if given, and otherwise the plan's
+// first and last sessions, or the four weeks up to today for an empty plan.
+func planRange(r *http.Request, plan *api.TrainingPlan, today time.Time) (string, string, error) {
+	start, end, err := parseExportRange(r)
+	if err != nil {
+		return "", "", err
+	}
+	if start == "" {
+		start = today.AddDate(0, 0, -27).Format("2006-01-02")
+		if len(plan.Workouts) > 0 {
+			start = plan.Workouts[0].Date
+		}
+	}
+	if end == "" {
+		end = today.Format("2006-01-02")
+		if len(plan.Workouts) > 0 {
+			end = plan.Workouts[len(plan.Workouts)-1].Date
+		}
+	}
+	if end < start {
+		return "", "", fmt.Errorf("invalid date range: %s is before %s", end, start)
+	}
+	return start, end, nil
+}
+
+// loadPlanAdherence loads the athlete's plan and activities and pairs them
+// (see api.ComputePlanAdherence), writing an error response on failure.
+func (s *server) loadPlanAdherence(w http.ResponseWriter, r *http.Request, token *oauth2.Token, athleteID int64, logPrefix string) (api.PlanAdherence, bool) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "weekly"
+	}
+	if period != "daily" && period != "weekly" && period != "monthly" && period != "quarterly" && period != "yearly" {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid period %q", period))
+		return api.PlanAdherence{}, false
+	}
+	filter, _ := parseSportFilter(r)
+
+	plan, err := s.plans.Get(athleteID)
+	if err != nil {
+		log.Printf("%s: %v", logPrefix, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to access plan: "+err.Error())
+		return api.PlanAdherence{}, false
+	}
+	_, calendar, ok := s.loadCalendarRollup(w, r, token, athleteID, &api.NormalizeOptions{StartDate: stravaEpoch, EndDate: stravaEpoch}, logPrefix)
+	if !ok {
+		return api.PlanAdherence{}, false
+	}
+	start, end, err := planRange(r, plan, calendar.Today())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return api.PlanAdherence{}, false
+	}
+	history, ok := s.loadHistory(w, r, token, athleteID, logPrefix)
+	if !ok {
+		return api.PlanAdherence{}, false
+	}
+
+	var workouts []api.PlannedWorkout
+	for _, workout := range plan.Workouts {
+		if filter == nil || filter(workout.SportType) {
+			workouts = append(workouts, workout)
+		}
+	}
+	return api.ComputePlanAdherence(workouts, filterSports(history, filter), api.PlanOptions{
+		Start:     start,
+		End:       end,
+		Today:     calendar.Today().Format("2006-01-02"),
+		Period:    period,
+		WeekStart: calendar.WeekStart,
+		Settings:  s.settingsHistory(athleteID, logPrefix),
+	}), true
+}
+
+// handlePlanAdherence serves how closely the athlete followed their training
+// plan: each planned session paired with the activity that fulfilled it, by
+// date and sport; missed, upcoming and extra sessions; and compliance with
+// the distance, duration and intensity targets, overall and per period.
+//
+// Query parameters:
+//   - start/end (or start_date/end_date): the range; defaults to the whole plan
+//   - period: "daily", "weekly" (default), "monthly", "quarterly" or "yearly"
+//   - sport_types=Ride,VirtualRide or running_only=true: only compare these sports
+//   - exclude_flagged=true: leave activities flagged by the data quality checks out
+func (s *server) handlePlanAdherence(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, athleteID, ok := s.authenticate(w, r, "Plan adherence")
+	if !ok {
+		return
+	}
+	adherence, ok := s.loadPlanAdherence(w, r, token, athleteID, "Plan adherence")
+	if !ok {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"adherence": adherence}); err != nil {
+		log.Printf("Plan adherence: failed to encode response: %v", err)
+	}
+}
+
+// calendarFeedPattern matches the tokens of calendar feeds (see newFeedToken).
+var calendarFeedPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+
+// calendarURLs returns the https and webcal URLs of a feed, served by the host
+// the request came to, with an optional query.
+func calendarURLs(r *http.Request, feedToken, query string) (string, string) {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	feedPath := "/calendar/" + feedToken + ".ics"
+	if query != "" {
+		feedPath += "?" + query
+	}
+	return scheme + "://" + r.Host + feedPath, "webcal://" + r.Host + feedPath
+}
+
+// handleCalendar manages the athlete's calendar feed: GET returns its links,
+// POST creates it or replaces its secret token (so old links stop working),
+// and DELETE turns it off. Besides the feed of every activity, the response
+// links a feed per sport the athlete has recorded.
+func (s *server) handleCalendar(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed. Use GET, POST or DELETE")
+		return
+	}
+	token, athleteID, ok := s.authenticate(w, r, "Calendar")
+	if !ok {
+		return
+	}
+
+	var feedToken string
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		feedToken, err = s.calendars.Create(athleteID)
+		if err == nil {
+			log.Printf("Calendar: created feed of athlete %d", athleteID)
+		}
+	case http.MethodDelete:
+		err = s.calendars.Revoke(athleteID)
+		if err == nil {
+			log.Printf("Calendar: revoked feed of athlete %d", athleteID)
+		}
+	default:
+		feedToken, err = s.calendars.FeedToken(athleteID)
+	}
+	if err != nil {
+		log.Printf("Calendar: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to access calendar feed: "+err.Error())
+		return
+	}
+
+	response := map[string]interface{}{"enabled": feedToken != ""}
+	if feedToken != "" {
+		feedURL, webcal := calendarURLs(r, feedToken, "")
+		response["url"] = feedURL
+		response["webcal"] = webcal
+
+		rollup, ok := s.loadRollup(w, r, token, athleteID, stravaEpoch, "Calendar")
+		if !ok {
+			return
+		}
+		totals := rollup.Totals("", "", nil)
+		sports := make([]string, 0, len(totals.Sports))
+		for sport := range totals.Sports {
+			sports = append(sports, sport)
+		}
+		sort.Strings(sports)
+		feeds := make([]map[string]string, 0, len(sports))
+		for _, sport := range sports {
+			feedURL, webcal := calendarURLs(r, feedToken, url.Values{"sport_types": {sport}}.Encode())
+			feeds = append(feeds, map[string]string{"sportType": sport, "url": feedURL, "webcal": webcal})
+		}
+		response["sports"] = feeds
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Calendar: failed to encode response: %v", err)
+	}
+}
+
+// handleCalendarFeed serves an athlete's activities as an iCalendar feed for
+// calendar apps to subscribe to: /calendar/{token}.ics, where the secret token
+// comes from /api/calendar. Each activity is an event from its start, in its
+// timezone, lasting its elapsed time.
+//
+// Query parameters:
+//   - sport_types=Ride,VirtualRide or running_only=true: a calendar of these sports only
+//   - planned=true: include the workouts of the athlete's training plan as all-day events
+//   - units: "metric" or "imperial"; defaults to the athlete's settings (see parseUnits)
+//   - exclude_flagged=true: leave activities flagged by the data quality checks out
+func (s *server) handleCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	feedToken, isICS := strings.CutSuffix(r.PathValue("feed"), ".ics")
+	if !isICS || !calendarFeedPattern.MatchString(feedToken) {
+		http.NotFound(w, r)
+		return
+	}
+	feed, found, err := s.calendars.Feed(feedToken)
+	if err != nil {
+		log.Printf("Calendar feed: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to access calendar feed: "+err.Error())
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	logPrefix := fmt.Sprintf("Calendar feed of athlete %d", feed.AthleteID)
+
+	filter, sportTypes := parseSportFilter(r)
+
+	if feed.LegacyToken != nil {
+		// Move the feed's own copy of the token into the token store, unless the
+		// athlete has logged in since and stored a newer one
+		if err := s.authenticator.AdoptToken(feed.AthleteID, feed.LegacyToken); err != nil {
+			log.Printf("%s: failed to adopt the feed's token: %v", logPrefix, err)
+		} else if err := s.calendars.DropLegacyToken(feedToken); err != nil {
+			log.Printf("%s: failed to drop the feed's token: %v", logPrefix, err)
+		}
+	}
+
+	// No session here: the athlete's stored token is shared with their sessions
+	token, err := s.authenticator.AthleteToken(r.Context(), feed.AthleteID)
+	if err != nil {
+		log.Printf("%s: no usable Strava token: %v", logPrefix, err)
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: Strava access was revoked. Log in again to resume the calendar feed.")
+		return
+	}
+	metric, err := s.parseUnits(r, token, feed.AthleteID, logPrefix)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	entry, ok := s.syncAthleteRollup(r, feed.AthleteID, stravaEpoch, logPrefix, func(fn func(*oauth2.Token) error) bool {
+		if err := fn(token); err != nil {
+			writeFetchError(w, err, logPrefix)
+			return false
+		}
+		return true
+	})
+	if !ok {
+		return
+	}
+
+	activities := entry.history(excludeFlagged(r), func(activity *api.NormalizedActivity) bool {
+		return filter == nil || filter(activity.SportType)
+	})
+	sort.Slice(activities, func(i, j int) bool {
+		if !activities[i].StartDate.Equal(activities[j].StartDate) {
+			return activities[i].StartDate.Before(activities[j].StartDate)
+		}
+		return activities[i].ID < activities[j].ID
+	})
+	opts := ical.EventOptions{Metric: metric}
+	events := make([]ical.Event, 0, len(activities))
+	for _, activity := range activities {
+		events = append(events, ical.ActivityEvent(activity, opts))
+	}
+	if r.URL.Query().Get("planned") == "true" {
+		plan, err := s.plans.Get(feed.AthleteID)
+		if err != nil {
+			log.Printf("%s: failed to load plan: %v", logPrefix, err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to load plan: "+err.Error())
+			return
+		}
+		for _, workout := range plan.Workouts {
+			if filter == nil || filter(workout.SportType) {
+				events = append(events, ical.PlannedEvent(workout, opts))
+			}
+		}
+	}
+
+	name := "Strava Training"
+	if len(sportTypes) > 0 {
+		name = "Strava " + strings.Join(sportTypes, ", ")
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", "inline; filename=\"training.ics\"")
+	cal := ical.Calendar{Name: name, Description: "Activities from Strava", Refresh: time.Hour}
+	if err := ical.Write(w, cal, events, time.Now()); err != nil {
+		log.Printf("%s: failed to write calendar: %v", logPrefix, err)
+		return
+	}
+	log.Printf("%s: served %d events", logPrefix, len(events))
+}
+
+// handleIndex renders the dashboard.
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	// Don't handle API routes - they should be handled by their specific handlers
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	session, _ := s.authenticator.Store.Get(r, "strava-session")
+	var data struct {
+		Authenticated bool
+		Name          string
+		ProfileURL    string
+	}
+
+	if tokenStr, ok := session.Values["token"].(string); ok && tokenStr != "" {
+		data.Authenticated = true
+		if name, ok := session.Values["athlete_name"].(string); ok && name != "" {
+			data.Name = name
+		}
+		if profile, ok := session.Values["athlete_profile"].(string); ok && profile != "" {
+			data.ProfileURL = profile
+		}
+
+		// Self-healing: Name or Profile missing, try to fetch it
+		if data.Name == "" || data.ProfileURL == "" {
+			var token oauth2.Token
+			if err := json.Unmarshal([]byte(tokenStr), &token); err == nil {
+				if athlete, err := s.authenticator.FetchAthlete(r.Context(), &token); err == nil {
+					name := strings.TrimSpace(fmt.Sprintf("%s %s", athlete.Firstname, athlete.Lastname))
+					if name == "" {
+						name = athlete.Username
+					}
+					if name != "" {
+						data.Name = name
+						session.Values["athlete_name"] = name
+					}
+					if athlete.Profile != "" {
+						data.ProfileURL = athlete.Profile
+						session.Values["athlete_profile"] = athlete.Profile
+					}
+					session.Save(r, w)
+				} else {
+					log.Printf("Failed to auto-recover athlete data: %v", err)
+				}
+			}
+		}
+	}
+
+	tmpl, err := template.ParseFiles("web/templates/index.html")
+	if err != nil {
+		http.Error(w, "Could not load template", http.StatusInternalServerError)
+		log.Printf("Error parsing template: %v", err)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
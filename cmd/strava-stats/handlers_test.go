@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+)
+
+// logIn returns a session cookie for the athlete, holding a token that doesn't
+// need refreshing.
+func logIn(t *testing.T, s *server, athleteID int64) *http.Cookie {
+	t.Helper()
+	token, err := json.Marshal(testToken())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	session, _ := s.authenticator.Store.New(r, "strava-session")
+	session.Values["token"] = string(token)
+	session.Values["athlete_id"] = athleteID
+	if err := session.Save(r, w); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return w.Result().Cookies()[0]
+}
+
+func TestHandleSummaryStreaks(t *testing.T) {
+	strava := &fakeStrava{activities: make(map[int64]api.Activity)}
+	for daysAgo := 30; daysAgo >= 10; daysAgo-- {
+		strava.put(int64(daysAgo), daysAgo, 5000)
+	}
+	strava.put(1, 1, 5000)
+	s := newTestServer(t, strava)
+	cookie := logIn(t, s, 1)
+
+	summary := func(query string) (totals api.PeriodTotals, streaks api.Streaks) {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/api/summary"+query, nil)
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		s.handleSummary(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+		}
+		var response struct {
+			Totals  api.PeriodTotals `json:"totals"`
+			Streaks api.Streaks      `json:"streaks"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return response.Totals, response.Streaks
+	}
+
+	// The week is requested first, so the rollup has only synced that far back
+	today := time.Now().UTC()
+	week := "?start_date=" + today.AddDate(0, 0, -6).Format("2006-01-02") + "&end_date=" + today.Format("2006-01-02")
+	totals, streaks := summary(week)
+	if totals.Total.Count != 1 {
+		t.Errorf("Expected one activity in the last week, got %+v", totals)
+	}
+	if streaks.Longest != 21 || streaks.Current != 1 {
+		t.Errorf("Expected streaks over the whole history, got %+v", streaks)
+	}
+
+	totals, allTime := summary("")
+	if totals.Total.Count != 22 {
+		t.Errorf("Expected every activity of all time, got %+v", totals)
+	}
+	if allTime != streaks {
+		t.Errorf("Expected the same streaks for all time, got %+v and %+v", allTime, streaks)
+	}
+}
+
+func TestHandleActivitiesPages(t *testing.T) {
+	strava := &fakeStrava{activities: make(map[int64]api.Activity)}
+	for id := int64(1); id <= 5; id++ {
+		strava.put(id, int(id), 5000)
+	}
+	strava.put(6, 40, 5000)
+	s := newTestServer(t, strava)
+	cookie := logIn(t, s, 1)
+
+	today := time.Now().UTC()
+	month := "start_date=" + today.AddDate(0, 0, -30).Format("2006-01-02") + "&end_date=" + today.Format("2006-01-02")
+	var seen []int64
+	cursor := ""
+	for pages := 0; pages < 3; pages++ {
+		r := httptest.NewRequest("GET", "/api/activities?"+month+"&fields=id&limit=2&cursor="+cursor, nil)
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		s.handleActivities(w, r)
+		var response struct {
+			TotalActivities int              `json:"totalActivities"`
+			NextCursor      string           `json:"nextCursor"`
+			Activities      []map[string]any `json:"activities"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); w.Code != http.StatusOK || err != nil {
+			t.Fatalf("Expected 200, got %d (%v)", w.Code, err)
+		}
+		if response.TotalActivities != 5 {
+			t.Errorf("Expected the summary of the 5 runs in range, got %d", response.TotalActivities)
+		}
+		for _, activity := range response.Activities {
+			seen = append(seen, int64(activity["id"].(float64)))
+		}
+		if cursor = response.NextCursor; cursor == "" {
+			break
+		}
+	}
+
+	expected := []int64{1, 2, 3, 4, 5}
+	if len(seen) != len(expected) || cursor != "" {
+		t.Fatalf("Expected %v over 3 pages, got %v", expected, seen)
+	}
+	for i := range expected {
+		if seen[i] != expected[i] {
+			t.Errorf("Position %d: expected ID %d, got %d", i, expected[i], seen[i])
+		}
+	}
+
+	// The sorted history is kept between requests until a sync changes it
+	entry := s.rollups.get(1)
+	if newest := entry.newestFirst(); &newest[0] != &entry.newestFirst()[0] {
+		t.Error("Expected the sorted history to be reused")
+	}
+}
+
+func TestParseUnits(t *testing.T) {
+	strava := &fakeStrava{activities: make(map[int64]api.Activity), measurementPreference: "meters"}
+	s := newTestServer(t, strava)
+	parse := func(query string) bool {
+		t.Helper()
+		metric, err := s.parseUnits(httptest.NewRequest("GET", "/"+query, nil), testToken(), 1, "Test")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return metric
+	}
+
+	if !parse("") || !parse("") {
+		t.Error("Expected the Strava preference for an athlete without settings")
+	}
+	if strava.athleteRequests != 1 {
+		t.Errorf("Expected the Strava preference to be fetched once, got %d requests", strava.athleteRequests)
+	}
+	if parse("?units=imperial") {
+		t.Error("Expected the units parameter to win")
+	}
+
+	_, err := s.settings.Update(1, func(history *api.SettingsHistory) error {
+		return history.Apply(api.SettingsChange{EffectiveDate: "2024-01-01", Settings: api.AthleteSettings{Units: api.UnitsImperial}})
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if parse("") {
+		t.Error("Expected saved settings to win over the Strava preference")
+	}
+
+	if _, err := s.parseUnits(httptest.NewRequest("GET", "/?units=furlongs", nil), testToken(), 1, "Test"); err == nil {
+		t.Error("Expected an error for unknown units")
+	}
+}
+
+func TestCalendarFeedSharesTheAthleteToken(t *testing.T) {
+	strava := &fakeStrava{activities: make(map[int64]api.Activity)}
+	strava.put(1, 2, 5000)
+	s := newTestServer(t, strava)
+	feed := func(feedToken string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/calendar/"+feedToken+".ics", nil)
+		r.SetPathValue("feed", feedToken+".ics")
+		w := httptest.NewRecorder()
+		s.handleCalendarFeed(w, r)
+		return w
+	}
+
+	// A feed created while logged in is synced with the token of the session
+	r := httptest.NewRequest("POST", "/api/calendar", nil)
+	r.AddCookie(logIn(t, s, 1))
+	w := httptest.NewRecorder()
+	s.handleCalendar(w, r)
+	feedToken, err := s.calendars.FeedToken(1)
+	if w.Code != http.StatusOK || err != nil || feedToken == "" {
+		t.Fatalf("Expected a feed, got %d: %s (%v)", w.Code, w.Body, err)
+	}
+	if w := feed(feedToken); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "BEGIN:VEVENT") {
+		t.Errorf("Expected the feed to serve the athlete's run, got %d: %s", w.Code, w.Body)
+	}
+
+	// A feed from before tokens were stored hands its token over
+	legacyToken := strings.Repeat("a", 43)
+	legacy := calendarFeed{AthleteID: 2, LegacyToken: testToken()}
+	if err := s.calendars.store.Save(calendarFeedsCollection, legacyToken, legacy); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if w := feed(legacyToken); w.Code != http.StatusOK {
+		t.Errorf("Expected the legacy feed to be served, got %d: %s", w.Code, w.Body)
+	}
+	if token, err := s.authenticator.Tokens.LoadToken(2); err != nil || token == nil {
+		t.Errorf("Expected the legacy feed's token to be stored, got %v (%v)", token, err)
+	}
+	if migrated, _, err := s.calendars.Feed(legacyToken); err != nil || migrated.LegacyToken != nil {
+		t.Errorf("Expected the legacy feed's token to be dropped, got %+v (%v)", migrated, err)
+	}
+
+	if w := feed(strings.Repeat("b", 43)); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown feed, got %d", w.Code)
+	}
+}
+
+func TestSettingsUnitToggle(t *testing.T) {
+	strava := &fakeStrava{activities: make(map[int64]api.Activity), measurementPreference: "feet"}
+	s := newTestServer(t, strava)
+	cookie := logIn(t, s, 1)
+	patch := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("PATCH", "/api/settings", strings.NewReader(body))
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		s.handleSettings(w, r)
+		return w
+	}
+
+	w := patch(`{"units": "metric"}`)
+	var response struct {
+		Settings api.AthleteSettings `json:"settings"`
+		Saved    bool                `json:"saved"`
+		Units    string              `json:"units"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("Expected 200, got %d (%v)", w.Code, err)
+	}
+	if response.Saved || response.Units != api.UnitsMetric || response.Settings.Units != api.UnitsMetric {
+		t.Errorf("Expected metric units without saved settings, got %+v", response)
+	}
+	history, err := s.settings.Get(1)
+	if err != nil || len(history.Changes) != 0 || history.Units != api.UnitsMetric {
+		t.Errorf("Expected the units to be kept outside the history, got %+v (%v)", history, err)
+	}
+	if metric, err := s.parseUnits(httptest.NewRequest("GET", "/", nil), testToken(), 1, "Test"); !metric || err != nil {
+		t.Errorf("Expected the chosen units to win over the Strava preference (%v)", err)
+	}
+
+	if w := patch(`{"units": "furlongs"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown units, got %d", w.Code)
+	}
+	if w := patch(`{"units": "imperial", "max_hr": 190}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for settings other than units, got %d", w.Code)
+	}
+}
+
+func TestParseVO2maxOptionsAge(t *testing.T) {
+	history := &api.SettingsHistory{}
+	if err := history.Apply(api.SettingsChange{EffectiveDate: "2024-01-01", Settings: api.AthleteSettings{Birthdate: "1990-06-15"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	r := httptest.NewRequest("GET", "/api/vo2max", nil)
+
+	// The athlete's date decides the age, not the server's
+	if opts, err := parseVO2maxOptions(r, history, time.Date(2024, 6, 14, 0, 0, 0, 0, time.UTC)); err != nil || opts.Age != 33 {
+		t.Errorf("Expected 33 the day before the birthday, got %v (%v)", opts.Age, err)
+	}
+	if opts, _ := parseVO2maxOptions(r, history, time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)); opts.Age != 34 {
+		t.Errorf("Expected 34 on the birthday, got %v", opts.Age)
+	}
+}
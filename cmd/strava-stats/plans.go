@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+	"github.com/arungupta/strava-stats-go/internal/store"
+)
+
+// plansCollection is the store collection of training plans.
+const plansCollection = "plans"
+
+// PlanStore persists each athlete's training plan.
+type PlanStore struct {
+	mu    sync.Mutex
+	store *store.Store
+}
+
+// NewPlanStore creates a plan store backed by st.
+func NewPlanStore(st *store.Store) *PlanStore {
+	return &PlanStore{store: st}
+}
+
+// Get returns the athlete's plan, which has no workouts if they never saved one.
+func (s *PlanStore) Get(athleteID int64) (*api.TrainingPlan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	plan := &api.TrainingPlan{AthleteID: athleteID, Workouts: []api.PlannedWorkout{}}
+	if _, err := s.store.Load(plansCollection, strconv.FormatInt(athleteID, 10), plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Save replaces the athlete's plan with workouts, which must be normalized
+// (see api.NormalizePlan).
+func (s *PlanStore) Save(athleteID int64, workouts []api.PlannedWorkout) (*api.TrainingPlan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if workouts == nil {
+		workouts = []api.PlannedWorkout{}
+	}
+	plan := &api.TrainingPlan{AthleteID: athleteID, Workouts: workouts, UpdatedAt: time.Now().UTC()}
+	if err := s.store.Save(plansCollection, strconv.FormatInt(athleteID, 10), plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Import adds imported workouts to the athlete's plan: replacing the whole
+// plan, or with merge only the days the import has sessions on (see
+// api.MergePlan). Imported workouts must be valid (see api.NormalizePlan);
+// the result is normalized before it's saved.
+func (s *PlanStore) Import(athleteID int64, imported []api.PlannedWorkout, merge bool) (*api.TrainingPlan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	workouts := imported
+	if merge {
+		existing := &api.TrainingPlan{}
+		if _, err := s.store.Load(plansCollection, strconv.FormatInt(athleteID, 10), existing); err != nil {
+			return nil, err
+		}
+		workouts = api.MergePlan(existing.Workouts, imported)
+	}
+	workouts, err := api.NormalizePlan(workouts)
+	if err != nil {
+		return nil, err
+	}
+	if workouts == nil {
+		workouts = []api.PlannedWorkout{}
+	}
+	plan := &api.TrainingPlan{AthleteID: athleteID, Workouts: workouts, UpdatedAt: time.Now().UTC()}
+	if err := s.store.Save(plansCollection, strconv.FormatInt(athleteID, 10), plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
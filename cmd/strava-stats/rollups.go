@@ -0,0 +1,295 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+	"golang.org/x/oauth2"
+)
+
+// stravaEpoch is the earliest date an activity can exist on Strava; it is the
+// start of "all time" ranges.
+var stravaEpoch = time.Date(2009, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// syncWindow is how far back every incremental sync fetches again, so
+// activities uploaded days after they were recorded, and recent edits, are
+// picked up; Rollup.Add replaces activities it already has.
+const syncWindow = 7 * 24 * time.Hour
+
+// RollupStore keeps each athlete's daily rollups in memory and tracks how much
+// of their history has been loaded, so later requests only fetch new activities.
+// Each athlete costs roughly 1 KB per activity loaded, mostly the activities
+// themselves, so athletes idle for longer than the idle timeout are dropped and
+// loaded again from Strava on their next request.
+type RollupStore struct {
+	mu              sync.Mutex
+	athletes        map[int64]*athleteRollup
+	syncInterval    time.Duration
+	rebuildInterval time.Duration
+	idleTimeout     time.Duration
+}
+
+// athleteRollup is the rollup of one athlete plus its sync state.
+type athleteRollup struct {
+	mu          sync.Mutex // serializes syncs for one athlete
+	rollup      *api.Rollup
+	quality     *api.QualityIndex
+	coveredFrom time.Time // every activity on or after this date has been loaded
+	latestStart time.Time // start time of the newest activity seen
+	syncedAt    time.Time
+	rebuiltAt   time.Time // when the covered history was last loaded in full
+	usedAt      time.Time // when the entry was last requested, guarded by the store's lock
+	// every activity loaded, for analyses that replay history activity by activity
+	activities map[int64]api.NormalizedActivity
+	newest     []api.NormalizedActivity // the activities newest first, built on demand; nil once they change
+}
+
+// NewRollupStore creates a store that checks Strava for new activities at most
+// once per syncInterval, reloads an athlete's history in full once per
+// rebuildInterval to pick up older edits and deletions, and forgets athletes
+// not requested for idleTimeout.
+func NewRollupStore(syncInterval, rebuildInterval, idleTimeout time.Duration) *RollupStore {
+	return &RollupStore{
+		athletes:        make(map[int64]*athleteRollup),
+		syncInterval:    syncInterval,
+		rebuildInterval: rebuildInterval,
+		idleTimeout:     idleTimeout,
+	}
+}
+
+// newAthleteRollup returns an empty entry.
+func newAthleteRollup() *athleteRollup {
+	return &athleteRollup{
+		rollup:     api.NewRollup(),
+		quality:    api.NewQualityIndex(),
+		activities: make(map[int64]api.NormalizedActivity),
+	}
+}
+
+// get returns the athlete's rollup entry, creating an empty one if needed, and
+// drops the entries of idle athletes. Requests still holding a dropped entry
+// keep using it; it is freed once they finish.
+func (s *RollupStore) get(athleteID int64) *athleteRollup {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, entry := range s.athletes {
+		if now.Sub(entry.usedAt) > s.idleTimeout {
+			delete(s.athletes, id)
+		}
+	}
+	entry, ok := s.athletes[athleteID]
+	if !ok {
+		entry = newAthleteRollup()
+		s.athletes[athleteID] = entry
+	}
+	entry.usedAt = now
+	return entry
+}
+
+// snapshot returns the entry's rollup and quality index. A rebuild replaces
+// them, so they are read under the entry's lock.
+func (entry *athleteRollup) snapshot() (*api.Rollup, *api.QualityIndex) {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	return entry.rollup, entry.quality
+}
+
+// ingest streams activities from Strava straight into the rollup and quality index.
+func (s *server) ingest(r *http.Request, token *oauth2.Token, entry *athleteRollup, opts *api.FetchActivitiesOptions) (int, error) {
+	count := 0
+	err := s.stravaClient.StreamActivities(r.Context(), token, opts, func(activity api.Activity) error {
+		normalized := api.NormalizeActivity(activity)
+		entry.rollup.Add(normalized)
+		entry.quality.Add(normalized)
+		entry.activities[normalized.ID] = normalized
+		entry.newest = nil
+		if activity.StartDate.After(entry.latestStart) {
+			entry.latestStart = activity.StartDate
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// loadRollup returns the athlete's daily rollups, covering every activity from the
+// given date onwards (see syncRollup). With exclude_flagged=true, activities flagged
+// by the data quality checks are left out. On failure it writes the error response
+// and returns ok=false.
+func (s *server) loadRollup(w http.ResponseWriter, r *http.Request, token *oauth2.Token, athleteID int64, from time.Time, logPrefix string) (*api.Rollup, bool) {
+	entry, ok := s.syncRollup(w, r, token, athleteID, from, logPrefix)
+	if !ok {
+		return nil, false
+	}
+	rollup, quality := entry.snapshot()
+	if excludeFlagged(r) {
+		return rollup.Without(quality.Flagged()), true
+	}
+	return rollup, true
+}
+
+// syncRollup returns the athlete's rollup entry, first syncing with Strava so it
+// covers every activity from the given date onwards. Once the sync interval has
+// passed, activities newer than the latest one seen are requested, along with
+// the last week again (see syncWindow); the rest of the history is only fetched
+// again by the rebuild once per rebuild interval. token and athleteID come from
+// the handler's authenticate. On failure it writes the error response and returns
+// ok=false.
+func (s *server) syncRollup(w http.ResponseWriter, r *http.Request, token *oauth2.Token, athleteID int64, from time.Time, logPrefix string) (*athleteRollup, bool) {
+	return s.syncAthleteRollup(r, athleteID, from, logPrefix, func(fn func(*oauth2.Token) error) bool {
+		return s.withTokenRetry(w, r, token, logPrefix, fn)
+	})
+}
+
+// syncAthleteRollup syncs an athlete's rollup entry like syncRollup, fetching
+// from Strava through fetch, which runs fn with the athlete's token and on
+// failure writes the error response and returns false.
+func (s *server) syncAthleteRollup(r *http.Request, athleteID int64, from time.Time, logPrefix string, fetch func(fn func(*oauth2.Token) error) bool) (*athleteRollup, bool) {
+	entry := s.rollups.get(athleteID)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	// Reload the covered history into a fresh rollup, dropping activities that
+	// were deleted and applying edits to older ones, then swap it in
+	if !entry.coveredFrom.IsZero() && time.Since(entry.rebuiltAt) > s.rollups.rebuildInterval {
+		fresh := newAthleteRollup()
+		after := entry.coveredFrom.AddDate(0, 0, -1).Unix()
+		ok := fetch(func(token *oauth2.Token) error {
+			count, err := s.ingest(r, token, fresh, &api.FetchActivitiesOptions{After: &after})
+			log.Printf("%s: rebuilt rollups from %d activities", logPrefix, count)
+			return err
+		})
+		if !ok {
+			return nil, false
+		}
+		entry.rollup, entry.quality, entry.activities = fresh.rollup, fresh.quality, fresh.activities
+		entry.newest = nil
+		entry.latestStart = fresh.latestStart
+		entry.syncedAt, entry.rebuiltAt = time.Now(), time.Now()
+	}
+
+	// Backfill history older than what is already loaded
+	if entry.coveredFrom.IsZero() || from.Before(entry.coveredFrom) {
+		after := from.AddDate(0, 0, -1).Unix() // Fetch from 1 day before to be safe
+		opts := &api.FetchActivitiesOptions{After: &after}
+		if !entry.coveredFrom.IsZero() {
+			before := entry.coveredFrom.AddDate(0, 0, 1).Unix()
+			opts.Before = &before
+		}
+		ok := fetch(func(token *oauth2.Token) error {
+			count, err := s.ingest(r, token, entry, opts)
+			log.Printf("%s: backfilled %d activities from %s into rollups", logPrefix, count, from.Format("2006-01-02"))
+			return err
+		})
+		if !ok {
+			return nil, false
+		}
+		if entry.coveredFrom.IsZero() {
+			// A first backfill runs up to now, so it is also a full sync
+			entry.syncedAt, entry.rebuiltAt = time.Now(), time.Now()
+		}
+		entry.coveredFrom = from
+	}
+
+	// Incrementally pick up activities recorded since the last sync, and
+	// those of the last week that were uploaded late or edited
+	if time.Since(entry.syncedAt) > s.rollups.syncInterval {
+		after := entry.coveredFrom.AddDate(0, 0, -1).Unix()
+		if !entry.latestStart.IsZero() {
+			window := time.Now().Add(-syncWindow).Unix()
+			after = max(after, min(entry.latestStart.Unix()-1, window))
+		}
+		ok := fetch(func(token *oauth2.Token) error {
+			count, err := s.ingest(r, token, entry, &api.FetchActivitiesOptions{After: &after})
+			log.Printf("%s: synced %d new activities into rollups", logPrefix, count)
+			return err
+		})
+		if !ok {
+			return nil, false
+		}
+		entry.syncedAt = time.Now()
+	}
+
+	return entry, true
+}
+
+// loadHistory returns every activity of the athlete since they joined Strava,
+// in no particular order, loaded incrementally like the rollups. With
+// exclude_flagged=true, activities flagged by the data quality checks are left
+// out. On failure it writes the error response and returns ok=false.
+func (s *server) loadHistory(w http.ResponseWriter, r *http.Request, token *oauth2.Token, athleteID int64, logPrefix string) ([]api.NormalizedActivity, bool) {
+	entry, ok := s.syncRollup(w, r, token, athleteID, stravaEpoch, logPrefix)
+	if !ok {
+		return nil, false
+	}
+	return entry.history(excludeFlagged(r), nil), true
+}
+
+// history returns a copy of the activities loaded into the entry that keep
+// accepts (nil accepts all), in no particular order, leaving flagged activities
+// out if excludeFlagged is set. Only the accepted activities are copied, so
+// callers needing a few should select them here rather than filter the result.
+func (entry *athleteRollup) history(excludeFlagged bool, keep func(*api.NormalizedActivity) bool) []api.NormalizedActivity {
+	// Another request may be syncing the entry by now
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	var flagged map[int64]bool
+	if excludeFlagged {
+		flagged = entry.quality.Flagged()
+	}
+	var activities []api.NormalizedActivity
+	if keep == nil {
+		activities = make([]api.NormalizedActivity, 0, len(entry.activities))
+	}
+	for id, activity := range entry.activities {
+		if !flagged[id] && (keep == nil || keep(&activity)) {
+			activities = append(activities, activity)
+		}
+	}
+	return activities
+}
+
+// newestFirst returns every activity loaded into the entry, newest first (see
+// api.SortActivities). The sorted slice is kept until a sync changes the
+// activities, so paging through the history doesn't sort it again on every
+// request. It is shared between requests and must not be modified.
+func (entry *athleteRollup) newestFirst() []api.NormalizedActivity {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.newest == nil {
+		newest := make([]api.NormalizedActivity, 0, len(entry.activities))
+		for _, activity := range entry.activities {
+			newest = append(newest, activity)
+		}
+		api.SortActivities(newest)
+		entry.newest = newest
+	}
+	return entry.newest
+}
+
+// loadCalendarRollup loads the athlete's rollups covering the range selected by
+// opts and resolves the athlete's calendar (see parseCalendar), defaulting to the
+// home timezone inferred from the rollup. On failure it writes the error response
+// and returns ok=false.
+func (s *server) loadCalendarRollup(w http.ResponseWriter, r *http.Request, token *oauth2.Token, athleteID int64, opts *api.NormalizeOptions, logPrefix string) (*api.Rollup, api.Calendar, bool) {
+	// The home timezone is only known once activities are loaded, and "today" can
+	// differ by a day between timezones, so load one extra day of history
+	startDate, _ := opts.Bounds()
+	rollup, ok := s.loadRollup(w, r, token, athleteID, startDate.AddDate(0, 0, -1), logPrefix)
+	if !ok {
+		return nil, api.Calendar{}, false
+	}
+
+	weekStart := s.settingsHistory(athleteID, logPrefix).Current().WeekStart
+	calendar, err := parseCalendar(r, rollup.HomeTimezone(), weekStart)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return nil, api.Calendar{}, false
+	}
+	return rollup, calendar, true
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+	"github.com/arungupta/strava-stats-go/internal/auth"
+	"github.com/arungupta/strava-stats-go/internal/config"
+	"github.com/arungupta/strava-stats-go/internal/store"
+	"golang.org/x/oauth2"
+)
+
+// fakeStrava serves an athlete's activities like Strava's /athlete/activities,
+// honouring after and before, and records the after of every request. It
+// serves the athlete's profile at /athlete, counting the requests.
+type fakeStrava struct {
+	mu                    sync.Mutex
+	activities            map[int64]api.Activity
+	afters                []time.Time
+	measurementPreference string
+	athleteRequests       int
+}
+
+func (f *fakeStrava) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.URL.Path {
+	case "/athlete":
+		f.athleteRequests++
+		json.NewEncoder(w).Encode(api.StravaAthlete{ID: 1, MeasurementPreference: f.measurementPreference})
+		return
+	case "/athlete/activities":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+	after, _ := strconv.ParseInt(query.Get("after"), 10, 64)
+	before, err := strconv.ParseInt(query.Get("before"), 10, 64)
+	if err != nil {
+		before = time.Now().Add(time.Hour).Unix()
+	}
+	f.afters = append(f.afters, time.Unix(after, 0))
+
+	page := []api.Activity{}
+	if query.Get("page") == "1" {
+		for _, activity := range f.activities {
+			if start := activity.StartDate.Unix(); start > after && start < before {
+				page = append(page, activity)
+			}
+		}
+	}
+	json.NewEncoder(w).Encode(page)
+}
+
+// put adds or replaces a run that started daysAgo days ago.
+func (f *fakeStrava) put(id int64, daysAgo int, distance float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	start := time.Now().UTC().AddDate(0, 0, -daysAgo).Truncate(time.Second)
+	f.activities[id] = api.Activity{
+		ID: id, Name: "Run", SportType: "Run", StartDate: start, StartDateLocal: start,
+		Distance: distance, MovingTime: 1800, ElapsedTime: 1800,
+	}
+}
+
+func (f *fakeStrava) remove(id int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.activities, id)
+}
+
+// lastAfter returns the after of the latest request.
+func (f *fakeStrava) lastAfter() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.afters[len(f.afters)-1]
+}
+
+// newTestServer returns a server talking to strava, with its data in a
+// temporary directory, that syncs rollups on every request.
+func newTestServer(t *testing.T, strava *fakeStrava) *server {
+	t.Helper()
+	ts := httptest.NewServer(strava)
+	t.Cleanup(ts.Close)
+	dataStore, err := store.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	authenticator := auth.NewAuthenticator(&config.Config{SessionSecret: "test-secret"})
+	authenticator.StravaAPIURL = ts.URL
+	if authenticator.Tokens, err = NewTokenStore(dataStore, "test-secret"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return &server{
+		authenticator: authenticator,
+		stravaClient:  api.NewClient(ts.URL, authenticator.Config),
+		activityCache: NewActivityCache(time.Second),
+		rollups:       NewRollupStore(0, time.Hour, time.Hour),
+		details:       NewDetailCache(time.Hour),
+		settings:      NewSettingsStore(dataStore),
+		achievements:  NewAchievementStore(dataStore, nil),
+		plans:         NewPlanStore(dataStore),
+		calendars:     NewCalendarStore(dataStore),
+	}
+}
+
+// testToken is a token that doesn't need refreshing.
+func testToken() *oauth2.Token {
+	return &oauth2.Token{AccessToken: "test-token", TokenType: "Bearer", Expiry: time.Now().Add(time.Hour)}
+}
+
+func TestSyncAthleteRollup(t *testing.T) {
+	strava := &fakeStrava{activities: make(map[int64]api.Activity)}
+	strava.put(1, 20, 5000)
+	strava.put(2, 1, 8000)
+	s := newTestServer(t, strava)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	fetch := func(fn func(*oauth2.Token) error) bool { return fn(testToken()) == nil }
+	sync := func() map[int64]api.NormalizedActivity {
+		t.Helper()
+		entry, ok := s.syncAthleteRollup(r, 1, time.Now().AddDate(0, 0, -30), "Test", fetch)
+		if !ok {
+			t.Fatal("Unexpected sync failure")
+		}
+		activities := make(map[int64]api.NormalizedActivity)
+		for _, activity := range entry.history(false, nil) {
+			activities[activity.ID] = activity
+		}
+		if rollup, _ := entry.snapshot(); rollup.Len() != len(activities) {
+			t.Errorf("Expected the rollup to hold the %d activities of the history, got %d", len(activities), rollup.Len())
+		}
+		return activities
+	}
+
+	if got := sync(); len(got) != 2 {
+		t.Fatalf("Expected the first sync to load both runs, got %v", got)
+	}
+
+	// A run uploaded late, older than the newest one, and an edit
+	strava.put(3, 3, 10000)
+	strava.put(2, 1, 8500)
+	got := sync()
+	if len(got) != 3 || got[2].Distance != 8500 {
+		t.Errorf("Expected the late upload and the edit to be picked up, got %v", got)
+	}
+	if after := strava.lastAfter(); time.Since(after) < syncWindow {
+		t.Errorf("Expected the incremental sync to fetch the last week again, fetched after %s", after)
+	}
+
+	// Deleting an older run is only noticed by the rebuild
+	strava.remove(1)
+	if got := sync(); len(got) != 3 {
+		t.Errorf("Expected the incremental sync to leave older runs alone, got %v", got)
+	}
+	entry := s.rollups.get(1)
+	entry.mu.Lock()
+	entry.rebuiltAt = time.Now().Add(-2 * time.Hour)
+	entry.mu.Unlock()
+	if got := sync(); len(got) != 2 || got[1].ID != 0 {
+		t.Errorf("Expected the rebuild to drop the deleted run, got %v", got)
+	}
+}
+
+func TestRollupStoreEvictsIdleAthletes(t *testing.T) {
+	rollups := NewRollupStore(time.Minute, time.Hour, time.Hour)
+	idle, active := rollups.get(1), rollups.get(2)
+	idle.usedAt = time.Now().Add(-2 * time.Hour)
+
+	if rollups.get(2) != active {
+		t.Error("Expected the active athlete's entry to be kept")
+	}
+	if _, ok := rollups.athletes[1]; ok {
+		t.Error("Expected the idle athlete's entry to be dropped")
+	}
+	if rollups.get(1) == idle {
+		t.Error("Expected the idle athlete to get a fresh entry")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+	"github.com/arungupta/strava-stats-go/internal/store"
+	"golang.org/x/oauth2"
+)
+
+// settingsCollection is the store collection of settings histories.
+const settingsCollection = "settings"
+
+// SettingsStore persists each athlete's settings history and keeps the ones
+// already read in memory, since most analyses look them up. It also remembers
+// each athlete's unit preference on Strava, the default for athletes who never
+// chose units here.
+type SettingsStore struct {
+	mu          sync.Mutex // also serializes read-modify-write updates
+	store       *store.Store
+	cache       map[int64]*api.SettingsHistory
+	stravaUnits map[int64]string
+}
+
+// NewSettingsStore creates a settings store backed by st.
+func NewSettingsStore(st *store.Store) *SettingsStore {
+	return &SettingsStore{
+		store:       st,
+		cache:       make(map[int64]*api.SettingsHistory),
+		stravaUnits: make(map[int64]string),
+	}
+}
+
+// StravaUnits returns the athlete's unit preference on Strava ("metric",
+// "imperial", or "" if Strava has none), and whether it is known.
+func (s *SettingsStore) StravaUnits(athleteID int64) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	units, ok := s.stravaUnits[athleteID]
+	return units, ok
+}
+
+// SetStravaUnits remembers the athlete's unit preference on Strava.
+func (s *SettingsStore) SetStravaUnits(athleteID int64, units string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stravaUnits[athleteID] = units
+}
+
+// Get returns the athlete's settings history, which is empty if they never
+// saved any. The history must not be modified; use Update.
+func (s *SettingsStore) Get(athleteID int64) (*api.SettingsHistory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(athleteID)
+}
+
+// load reads the athlete's history through the cache. s.mu must be held.
+func (s *SettingsStore) load(athleteID int64) (*api.SettingsHistory, error) {
+	if history, ok := s.cache[athleteID]; ok {
+		return history, nil
+	}
+	history := &api.SettingsHistory{AthleteID: athleteID, Changes: []api.SettingsChange{}}
+	if _, err := s.store.Load(settingsCollection, strconv.FormatInt(athleteID, 10), history); err != nil {
+		return nil, err
+	}
+	s.cache[athleteID] = history
+	return history, nil
+}
+
+// Update applies fn to a copy of the athlete's history and saves the result.
+// Nothing is saved if fn fails.
+func (s *SettingsStore) Update(athleteID int64, fn func(*api.SettingsHistory) error) (*api.SettingsHistory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.load(athleteID)
+	if err != nil {
+		return nil, err
+	}
+	updated := &api.SettingsHistory{AthleteID: athleteID, Changes: append([]api.SettingsChange(nil), current.Changes...), Units: current.Units}
+	if err := fn(updated); err != nil {
+		return nil, err
+	}
+	if err := s.store.Save(settingsCollection, strconv.FormatInt(athleteID, 10), updated); err != nil {
+		return nil, err
+	}
+	s.cache[athleteID] = updated
+	return updated, nil
+}
+
+// settingsHistory returns the athlete's settings history. A history that
+// can't be read is logged and treated as empty, so analyses fall back to
+// their defaults instead of failing.
+func (s *server) settingsHistory(athleteID int64, logPrefix string) *api.SettingsHistory {
+	history, err := s.settings.Get(athleteID)
+	if err != nil {
+		log.Printf("%s: failed to load settings of athlete %d: %v", logPrefix, athleteID, err)
+		return &api.SettingsHistory{AthleteID: athleteID}
+	}
+	return history
+}
+
+// stravaSettings prefills settings from the athlete's Strava profile and
+// zones. The zones need a scope that sessions from before it was requested
+// lack, so failing to fetch them only loses the maximum heart rate.
+func (s *server) stravaSettings(ctx context.Context, token *oauth2.Token) (api.AthleteSettings, error) {
+	athlete, err := s.stravaClient.FetchAthlete(ctx, token)
+	if err != nil {
+		return api.AthleteSettings{}, err
+	}
+	zones, err := s.stravaClient.FetchAthleteZones(ctx, token)
+	if err != nil {
+		log.Printf("Settings: zones unavailable, prefilling without them: %v", err)
+	}
+	return api.SettingsFromStrava(athlete, zones), nil
+}
+
+// stravaUnits returns the athlete's unit preference on Strava, fetching the
+// profile the first time. A failed fetch is logged and returns "", to be
+// tried again on the next request.
+func (s *server) stravaUnits(ctx context.Context, token *oauth2.Token, athleteID int64, logPrefix string) string {
+	if units, ok := s.settings.StravaUnits(athleteID); ok {
+		return units
+	}
+	athlete, err := s.stravaClient.FetchAthlete(ctx, token)
+	if err != nil {
+		log.Printf("%s: failed to fetch unit preference from Strava: %v", logPrefix, err)
+		return ""
+	}
+	units := api.SettingsFromStrava(athlete, nil).Units
+	s.settings.SetStravaUnits(athleteID, units)
+	return units
+}
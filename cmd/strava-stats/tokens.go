@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/arungupta/strava-stats-go/internal/store"
+	"golang.org/x/oauth2"
+)
+
+// tokensCollection is the store collection of athletes' Strava tokens.
+const tokensCollection = "strava_tokens"
+
+// sealedToken is an athlete's Strava token encrypted with AES-GCM. The athlete
+// ID is authenticated along with it, so a file copied to another athlete's key
+// doesn't decrypt.
+type sealedToken struct {
+	AthleteID  int64  `json:"athlete_id"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// TokenStore persists each athlete's current Strava token, encrypted with a key
+// derived from the session secret, and keeps the ones already read in memory.
+// Changing SESSION_SECRET makes stored tokens unreadable; athletes then log in
+// again. It implements auth.TokenStore.
+type TokenStore struct {
+	mu    sync.Mutex
+	store *store.Store
+	aead  cipher.AEAD
+	cache map[int64]*oauth2.Token
+}
+
+// NewTokenStore creates a token store backed by st, encrypting with a key
+// derived from secret.
+func NewTokenStore(st *store.Store, secret string) (*TokenStore, error) {
+	// Derive a key of its own rather than reuse the secret that signs cookies
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("strava token encryption"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenStore{store: st, aead: aead, cache: make(map[int64]*oauth2.Token)}, nil
+}
+
+// LoadToken returns the athlete's token, or nil if none is stored.
+func (s *TokenStore) LoadToken(athleteID int64) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token, ok := s.cache[athleteID]; ok {
+		return token, nil
+	}
+	var sealed sealedToken
+	found, err := s.store.Load(tokensCollection, strconv.FormatInt(athleteID, 10), &sealed)
+	if err != nil || !found {
+		return nil, err
+	}
+	data, err := s.aead.Open(nil, sealed.Nonce, sealed.Ciphertext, tokenAdditionalData(athleteID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt token of athlete %d (was SESSION_SECRET changed?): %w", athleteID, err)
+	}
+	token := &oauth2.Token{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, fmt.Errorf("failed to decode token of athlete %d: %w", athleteID, err)
+	}
+	s.cache[athleteID] = token
+	return token, nil
+}
+
+// SaveToken encrypts and stores the athlete's token, replacing any previous one.
+func (s *TokenStore) SaveToken(athleteID int64, token *oauth2.Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to encode token of athlete %d: %w", athleteID, err)
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := sealedToken{
+		AthleteID:  athleteID,
+		Nonce:      nonce,
+		Ciphertext: s.aead.Seal(nil, nonce, data, tokenAdditionalData(athleteID)),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.store.Save(tokensCollection, strconv.FormatInt(athleteID, 10), sealed); err != nil {
+		return err
+	}
+	s.cache[athleteID] = token
+	return nil
+}
+
+// tokenAdditionalData binds a sealed token to its athlete.
+func tokenAdditionalData(athleteID int64) []byte {
+	return []byte("athlete " + strconv.FormatInt(athleteID, 10))
+}
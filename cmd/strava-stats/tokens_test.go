@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arungupta/strava-stats-go/internal/store"
+)
+
+func TestTokenStore(t *testing.T) {
+	dir := t.TempDir()
+	dataStore, err := store.New(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tokens, err := NewTokenStore(dataStore, "test-secret")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if token, err := tokens.LoadToken(1); token != nil || err != nil {
+		t.Errorf("Expected no token for a new athlete, got %v (%v)", token, err)
+	}
+	if err := tokens.SaveToken(1, testToken()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, tokensCollection, "1.json"))
+	if err != nil {
+		t.Fatalf("Expected the token to be stored by athlete ID: %v", err)
+	}
+	if strings.Contains(string(data), "test-token") {
+		t.Errorf("Expected the token to be encrypted, got %s", data)
+	}
+
+	// Read back by a fresh store, as after a restart
+	reopened, _ := NewTokenStore(dataStore, "test-secret")
+	if token, err := reopened.LoadToken(1); err != nil || token == nil || token.AccessToken != "test-token" {
+		t.Errorf("Expected the stored token, got %v (%v)", token, err)
+	}
+
+	otherKey, _ := NewTokenStore(dataStore, "another-secret")
+	if _, err := otherKey.LoadToken(1); err == nil {
+		t.Error("Expected a token not to decrypt with another secret")
+	}
+
+	// A token copied to another athlete doesn't decrypt
+	if err := os.WriteFile(filepath.Join(dir, tokensCollection, "2.json"), data, 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := reopened.LoadToken(2); err == nil {
+		t.Error("Expected another athlete's token not to decrypt")
+	}
+}
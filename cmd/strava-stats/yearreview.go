@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+)
+
+// yearReviewPage is what the shareable year in review page shows. The page is
+// self-contained: styles are inline and the heatmap is laid out here, so the
+// saved HTML file works anywhere.
+type yearReviewPage struct {
+	Review   api.YearInReview
+	Name     string
+	Metric   bool
+	Weekdays []string        // heatmap row labels, from the first day of the week
+	Weeks    [][]heatmapCell // heatmap columns
+}
+
+// heatmapCell is one day of the year in review heatmap.
+type heatmapCell struct {
+	Date  string
+	Title string
+	Level int  // 0 for a rest day, up to 4 for the most moving time
+	Blank bool // padding before January 1 or after December 31
+}
+
+// newYearReviewPage lays out the review for the page.
+func newYearReviewPage(review api.YearInReview, name string, metric bool, weekStart time.Weekday) yearReviewPage {
+	page := yearReviewPage{Review: review, Name: name, Metric: metric}
+	for i := 0; i < 7; i++ {
+		page.Weekdays = append(page.Weekdays, time.Weekday((int(weekStart) + i) % 7).String()[:3])
+	}
+
+	days := make(map[string]api.RollupTotals, len(review.Days))
+	maxTime := 0
+	for _, day := range review.Days {
+		days[day.Date] = day.Total
+		if day.Total.MovingTime > maxTime {
+			maxTime = day.Total.MovingTime
+		}
+	}
+
+	first := time.Date(review.Year, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(review.Year, 12, 31, 0, 0, 0, 0, time.UTC)
+	date := first.AddDate(0, 0, -((int(first.Weekday()) - int(weekStart) + 7) % 7))
+	for !date.After(last) {
+		week := make([]heatmapCell, 7)
+		for i := range week {
+			dateStr := date.Format("2006-01-02")
+			cell := heatmapCell{Date: dateStr, Blank: date.Before(first) || date.After(last)}
+			if totals, ok := days[dateStr]; ok && !cell.Blank {
+				// Active days show even without moving time, e.g. a logged strength session
+				cell.Level = 1
+				if maxTime > 0 {
+					cell.Level = int(math.Max(1, math.Ceil(4*float64(totals.MovingTime)/float64(maxTime))))
+				}
+				cell.Title = fmt.Sprintf("%s: %d %s, %s", dateStr, totals.Count, plural(totals.Count, "activity", "activities"), api.FormatDuration(totals.MovingTime))
+			} else if !cell.Blank {
+				cell.Title = dateStr + ": rest day"
+			}
+			week[i] = cell
+			date = date.AddDate(0, 0, 1)
+		}
+		page.Weeks = append(page.Weeks, week)
+	}
+	return page
+}
+
+// Distance formats meters in the page's units.
+func (p yearReviewPage) Distance(meters float64) string {
+	if p.Metric {
+		return fmt.Sprintf("%.1f km", meters/1000)
+	}
+	return fmt.Sprintf("%.1f mi", meters/1609.34)
+}
+
+// Elevation formats meters in the page's units.
+func (p yearReviewPage) Elevation(meters float64) string {
+	if p.Metric {
+		return fmt.Sprintf("%.0f m", meters)
+	}
+	return fmt.Sprintf("%.0f ft", meters*3.28084)
+}
+
+// Duration formats seconds as hours and minutes.
+func (p yearReviewPage) Duration(seconds int) string {
+	return api.FormatDuration(seconds)
+}
+
+// Date formats a YYYY-MM-DD date like "March 4".
+func (p yearReviewPage) Date(date string) string {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return t.Format("January 2")
+}
+
+// Month formats a YYYY-MM-DD date as its month, like "March".
+func (p yearReviewPage) Month(date string) string {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return t.Format("January")
+}
+
+// plural picks the singular or plural noun for n.
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return singular
+	}
+	return pluralForm
+}
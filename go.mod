@@ -3,8 +3,9 @@ module github.com/arungupta/strava-stats-go
 go 1.25.4
 
 require (
-	github.com/gorilla/securecookie v1.1.2 // indirect
-	github.com/gorilla/sessions v1.4.0 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
-	golang.org/x/oauth2 v0.33.0 // indirect
+	github.com/gorilla/sessions v1.4.0
+	github.com/joho/godotenv v1.5.1
+	golang.org/x/oauth2 v0.33.0
 )
+
+require github.com/gorilla/securecookie v1.1.2 // indirect
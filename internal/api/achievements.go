@@ -0,0 +1,351 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Kinds of achievement rules.
+const (
+	AchievementTotal     = "total"      // a total over an activity, period or lifetime reaches a threshold
+	AchievementStreak    = "streak"     // active on consecutive days
+	AchievementFullMonth = "full_month" // active every day of a calendar month
+	AchievementRecord    = "record"     // fastest run of a distance so far
+)
+
+// NewAwardDays is how long an award stays new until the athlete has seen it.
+const NewAwardDays = 30
+
+//go:embed achievements.json
+var defaultAchievementRules []byte
+
+// AchievementRule declares a milestone. Rules are data: the engine only knows
+// the kinds, and LoadAchievementRules reads the rules themselves from JSON.
+type AchievementRule struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Icon        string   `json:"icon,omitempty"`
+	Kind        string   `json:"kind"`             // AchievementTotal, AchievementStreak, AchievementFullMonth or AchievementRecord
+	Sports      []string `json:"sports,omitempty"` // sport types, or "ride", "run" and "swim" as grouped in Strava's stats; empty for all
+	// Metric and Period select the total: "count", "distance" (meters),
+	// "moving_time" (seconds) or "elevation_gain" (meters), summed per
+	// "activity", "weekly", "monthly", "yearly" or "lifetime"
+	Metric    string  `json:"metric,omitempty"`
+	Period    string  `json:"period,omitempty"`
+	Threshold float64 `json:"threshold,omitempty"` // totals: in the metric's unit; streaks: days
+	Distance  float64 `json:"distance,omitempty"`  // records: in meters
+	Tolerance float64 `json:"tolerance,omitempty"` // records: meters either side of Distance
+	// Repeat awards the rule again for every period, streak or record rather
+	// than only the first time
+	Repeat bool `json:"repeat,omitempty"`
+}
+
+// Validate checks that the rule can be evaluated.
+func (rule AchievementRule) Validate() error {
+	if rule.ID == "" || rule.Name == "" {
+		return fmt.Errorf("invalid achievement rule %q: id and name are required", rule.ID)
+	}
+	switch rule.Kind {
+	case AchievementTotal:
+		switch rule.Metric {
+		case "count", "distance", "moving_time", "elevation_gain":
+		default:
+			return fmt.Errorf("invalid achievement rule %q: unknown metric %q", rule.ID, rule.Metric)
+		}
+		switch rule.Period {
+		case "activity", "weekly", "monthly", "yearly", "lifetime":
+		default:
+			return fmt.Errorf("invalid achievement rule %q: unknown period %q", rule.ID, rule.Period)
+		}
+		if rule.Threshold <= 0 {
+			return fmt.Errorf("invalid achievement rule %q: threshold must be positive", rule.ID)
+		}
+	case AchievementStreak:
+		if rule.Threshold < 2 {
+			return fmt.Errorf("invalid achievement rule %q: a streak needs at least 2 days", rule.ID)
+		}
+	case AchievementFullMonth:
+	case AchievementRecord:
+		if rule.Distance <= 0 || rule.Tolerance < 0 || rule.Tolerance >= rule.Distance {
+			return fmt.Errorf("invalid achievement rule %q: distance must be positive and larger than the tolerance", rule.ID)
+		}
+	default:
+		return fmt.Errorf("invalid achievement rule %q: unknown kind %q", rule.ID, rule.Kind)
+	}
+	return nil
+}
+
+// ParseAchievementRules parses and validates a JSON array of rules.
+func ParseAchievementRules(data []byte) ([]AchievementRule, error) {
+	var rules []AchievementRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid achievement rules: %w", err)
+	}
+	ids := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		if ids[rule.ID] {
+			return nil, fmt.Errorf("invalid achievement rules: duplicate id %q", rule.ID)
+		}
+		ids[rule.ID] = true
+	}
+	return rules, nil
+}
+
+// LoadAchievementRules reads the rules from a JSON file, or returns the
+// built-in rules when path is empty.
+func LoadAchievementRules(path string) ([]AchievementRule, error) {
+	if path == "" {
+		return ParseAchievementRules(defaultAchievementRules)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAchievementRules(data)
+}
+
+// Award is an achievement earned by the athlete.
+type Award struct {
+	Key          string  `json:"key"` // unique per award: the rule ID, plus the period, streak or activity for repeated rules
+	RuleID       string  `json:"rule_id"`
+	Name         string  `json:"name"`
+	Description  string  `json:"description"`
+	Icon         string  `json:"icon,omitempty"`
+	Date         string  `json:"date"`        // YYYY-MM-DD the award was earned
+	ActivityID   int64   `json:"activity_id"` // the activity that earned it
+	ActivityName string  `json:"activity_name"`
+	Value        float64 `json:"value"`            // the total, streak days or record time (seconds) that earned it
+	Period       string  `json:"period,omitempty"` // start (YYYY-MM-DD) of the period or streak of repeated totals, streaks and months
+	New          bool    `json:"new"`              // see MarkNewAwards
+}
+
+// EvaluateAchievements replays the athlete's activities in order and returns
+// every award they earned, oldest first. The calendar's week start decides
+// weekly totals.
+func EvaluateAchievements(activities []NormalizedActivity, rules []AchievementRule, calendar Calendar) []Award {
+	ordered := append([]NormalizedActivity(nil), activities...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].LocalDateStr != ordered[j].LocalDateStr {
+			return ordered[i].LocalDateStr < ordered[j].LocalDateStr
+		}
+		if !ordered[i].StartDate.Equal(ordered[j].StartDate) {
+			return ordered[i].StartDate.Before(ordered[j].StartDate)
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+
+	awards := []Award{}
+	for _, rule := range rules {
+		filter := achievementSportFilter(rule.Sports)
+		var matching []NormalizedActivity
+		for _, activity := range ordered {
+			if filter(activity.SportType) {
+				matching = append(matching, activity)
+			}
+		}
+		switch rule.Kind {
+		case AchievementTotal:
+			awards = append(awards, totalAwards(rule, matching, calendar)...)
+		case AchievementStreak:
+			awards = append(awards, streakAwards(rule, matching)...)
+		case AchievementFullMonth:
+			awards = append(awards, fullMonthAwards(rule, matching)...)
+		case AchievementRecord:
+			awards = append(awards, recordAwards(rule, matching)...)
+		}
+	}
+	// Rules are evaluated one after another; order the awards by when they were earned
+	sort.SliceStable(awards, func(i, j int) bool { return awards[i].Date < awards[j].Date })
+	return awards
+}
+
+// MarkNewAwards marks the awards the athlete hasn't seen yet as new, and
+// returns how many there are. Awards earned more than NewAwardDays before
+// today are old news, so a long history doesn't arrive as a flood of new
+// awards.
+func MarkNewAwards(awards []Award, seen map[string]bool, today time.Time) int {
+	since := today.AddDate(0, 0, -NewAwardDays).Format("2006-01-02")
+	count := 0
+	for i := range awards {
+		awards[i].New = !seen[awards[i].Key] && awards[i].Date >= since
+		if awards[i].New {
+			count++
+		}
+	}
+	return count
+}
+
+// achievementSportFilter accepts the given sport types and sport groups.
+func achievementSportFilter(sports []string) func(string) bool {
+	if len(sports) == 0 {
+		return func(string) bool { return true }
+	}
+	var sportTypes []string
+	for _, sport := range sports {
+		if group, ok := statsSportTypes[sport]; ok {
+			sportTypes = append(sportTypes, group...)
+		} else {
+			sportTypes = append(sportTypes, sport)
+		}
+	}
+	return sportFilter(sportTypes)
+}
+
+// newAward creates the award of rule earned by activity. Awards of rules that
+// repeat need a key of their own; see repeatedAward.
+func newAward(rule AchievementRule, activity NormalizedActivity, value float64) Award {
+	return Award{
+		Key:          rule.ID,
+		RuleID:       rule.ID,
+		Name:         rule.Name,
+		Description:  rule.Description,
+		Icon:         rule.Icon,
+		Date:         activity.LocalDateStr,
+		ActivityID:   activity.ID,
+		ActivityName: activity.Name,
+		Value:        value,
+	}
+}
+
+// repeatedAward is newAward for a rule that repeats: the award is keyed by
+// what it is repeated for (a period, streak or activity) and records the
+// period or streak's start date.
+func repeatedAward(rule AchievementRule, activity NormalizedActivity, value float64, key, period string) Award {
+	award := newAward(rule, activity, value)
+	award.Key = rule.ID + ":" + key
+	award.Period = period
+	return award
+}
+
+// totalAwards awards the activity that takes a total past the threshold.
+func totalAwards(rule AchievementRule, activities []NormalizedActivity, calendar Calendar) []Award {
+	var awards []Award
+	totals := make(map[string]float64)
+	for _, activity := range activities {
+		var period string
+		switch rule.Period {
+		case "activity":
+			period = strconv.FormatInt(activity.ID, 10)
+		case "lifetime":
+		default:
+			period = calendar.PeriodKey(activity.LocalDateStr, rule.Period)
+		}
+
+		before := totals[period]
+		totals[period] += achievementMetric(activity, rule.Metric)
+		if before >= rule.Threshold || totals[period] < rule.Threshold {
+			continue
+		}
+		if !rule.Repeat {
+			return []Award{newAward(rule, activity, totals[period])}
+		}
+		if rule.Period == "activity" {
+			awards = append(awards, repeatedAward(rule, activity, totals[period], period, ""))
+		} else {
+			awards = append(awards, repeatedAward(rule, activity, totals[period], period, period))
+		}
+	}
+	return awards
+}
+
+// achievementMetric is the activity's contribution to a total.
+func achievementMetric(activity NormalizedActivity, metric string) float64 {
+	switch metric {
+	case "distance":
+		return activity.Distance
+	case "moving_time":
+		return float64(activity.MovingTime)
+	case "elevation_gain":
+		return activity.TotalElevationGain
+	}
+	return 1 // count
+}
+
+// streakAwards awards the first activity of the day a streak reaches the
+// threshold.
+func streakAwards(rule AchievementRule, activities []NormalizedActivity) []Award {
+	var awards []Award
+	var previous time.Time
+	start, length := "", 0
+	for _, activity := range activities {
+		date, err := time.Parse("2006-01-02", activity.LocalDateStr)
+		if err != nil || (length > 0 && date.Equal(previous)) {
+			continue
+		}
+		if length > 0 && date.Equal(previous.AddDate(0, 0, 1)) {
+			length++
+		} else {
+			start, length = activity.LocalDateStr, 1
+		}
+		previous = date
+
+		if float64(length) != rule.Threshold {
+			continue
+		}
+		if !rule.Repeat {
+			return []Award{newAward(rule, activity, float64(length))}
+		}
+		awards = append(awards, repeatedAward(rule, activity, float64(length), start, start))
+	}
+	return awards
+}
+
+// fullMonthAwards awards the activity that fills in the last day of a month.
+func fullMonthAwards(rule AchievementRule, activities []NormalizedActivity) []Award {
+	var awards []Award
+	activeDays := make(map[string]map[string]bool)
+	for _, activity := range activities {
+		date, err := time.Parse("2006-01-02", activity.LocalDateStr)
+		if err != nil {
+			continue
+		}
+		month := date.Format("2006-01") + "-01"
+		if activeDays[month] == nil {
+			activeDays[month] = make(map[string]bool)
+		}
+		if activeDays[month][activity.LocalDateStr] {
+			continue
+		}
+		activeDays[month][activity.LocalDateStr] = true
+
+		daysInMonth := time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		if len(activeDays[month]) != daysInMonth {
+			continue
+		}
+		if !rule.Repeat {
+			return []Award{newAward(rule, activity, float64(daysInMonth))}
+		}
+		awards = append(awards, repeatedAward(rule, activity, float64(daysInMonth), month, month))
+	}
+	return awards
+}
+
+// recordAwards awards every run of the distance that is faster than all
+// before it, like CalculatePersonalRecords compares them: by moving time.
+func recordAwards(rule AchievementRule, activities []NormalizedActivity) []Award {
+	var awards []Award
+	best := -1
+	for _, activity := range activities {
+		if activity.MovingTime <= 0 || activity.Distance < rule.Distance-rule.Tolerance || activity.Distance > rule.Distance+rule.Tolerance {
+			continue
+		}
+		if best != -1 && activity.MovingTime >= best {
+			continue
+		}
+		best = activity.MovingTime
+		if !rule.Repeat {
+			return []Award{newAward(rule, activity, float64(best))}
+		}
+		awards = append(awards, repeatedAward(rule, activity, float64(best), strconv.FormatInt(activity.ID, 10), ""))
+	}
+	return awards
+}
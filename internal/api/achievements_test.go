@@ -0,0 +1,136 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testAchievementRules = `[
+	{"id": "first", "name": "First Steps", "kind": "total", "metric": "count", "period": "lifetime", "threshold": 1},
+	{"id": "100-mile-month", "name": "100-Mile Month", "kind": "total", "sports": ["run"], "metric": "distance", "period": "monthly", "threshold": 160934, "repeat": true},
+	{"id": "long-ride", "name": "Long Ride", "kind": "total", "sports": ["ride"], "metric": "distance", "period": "activity", "threshold": 100000, "repeat": true},
+	{"id": "streak-7", "name": "Week Streak", "kind": "streak", "threshold": 7, "repeat": true},
+	{"id": "streak-30", "name": "30-Day Streak", "kind": "streak", "threshold": 30},
+	{"id": "full-month", "name": "Perfect Month", "kind": "full_month", "repeat": true},
+	{"id": "pr-5k", "name": "5K PR", "kind": "record", "sports": ["Run"], "distance": 5000, "tolerance": 250, "repeat": true}
+]`
+
+func TestEvaluateAchievements(t *testing.T) {
+	rules, err := ParseAchievementRules([]byte(testAchievementRules))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing rules: %v", err)
+	}
+
+	// A run every day of February 2024, then a few 5Ks and long rides in March
+	var activities []NormalizedActivity
+	for day := 1; day <= 29; day++ {
+		activities = append(activities, rollupActivity(int64(day), "Run", fmt.Sprintf("2024-02-%02d", day), 6000, 1800))
+	}
+	activities = append(activities,
+		rollupActivity(100, "Run", "2024-03-01", 5000, 1500),
+		rollupActivity(101, "Run", "2024-03-05", 5100, 1550), // slower
+		rollupActivity(102, "Run", "2024-03-09", 4900, 1450),
+		rollupActivity(103, "Ride", "2024-03-09", 120000, 16000),
+		rollupActivity(104, "Ride", "2024-03-09", 101000, 14000),
+		rollupActivity(105, "Ride", "2024-03-10", 90000, 12000),
+	)
+
+	awards := EvaluateAchievements(activities, rules, DefaultCalendar())
+	byKey := make(map[string]Award)
+	for i, award := range awards {
+		if _, ok := byKey[award.Key]; ok {
+			t.Errorf("Expected unique award keys, got %q twice", award.Key)
+		}
+		byKey[award.Key] = award
+		if i > 0 && award.Date < awards[i-1].Date {
+			t.Errorf("Expected awards oldest first, got %s after %s", award.Date, awards[i-1].Date)
+		}
+	}
+
+	expected := map[string]struct {
+		date       string
+		activityID int64
+		value      float64
+	}{
+		"first":                     {"2024-02-01", 1, 1},
+		"100-mile-month:2024-02-01": {"2024-02-27", 27, 162000},
+		"streak-7:2024-02-01":       {"2024-02-07", 7, 7},
+		"streak-30":                 {"2024-03-01", 100, 30},
+		"full-month:2024-02-01":     {"2024-02-29", 29, 29},
+		"pr-5k:100":                 {"2024-03-01", 100, 1500},
+		"pr-5k:102":                 {"2024-03-09", 102, 1450},
+		"long-ride:103":             {"2024-03-09", 103, 120000},
+		"long-ride:104":             {"2024-03-09", 104, 101000},
+	}
+	if len(awards) != len(expected) {
+		t.Errorf("Expected %d awards, got %d: %+v", len(expected), len(awards), awards)
+	}
+	for key, want := range expected {
+		award, ok := byKey[key]
+		if !ok {
+			t.Errorf("Expected award %q", key)
+			continue
+		}
+		if award.Date != want.date || award.ActivityID != want.activityID || award.Value != want.value {
+			t.Errorf("Expected %q on %s by activity %d with %.0f, got %+v", key, want.date, want.activityID, want.value, award)
+		}
+	}
+	if award := byKey["full-month:2024-02-01"]; award.Period != "2024-02-01" || award.Name != "Perfect Month" {
+		t.Errorf("Unexpected full month award %+v", award)
+	}
+
+	// Only the runs count towards the running total
+	if awards := EvaluateAchievements(activities[len(activities)-3:], rules, DefaultCalendar()); len(awards) != 3 {
+		t.Errorf("Expected only the first activity and long rides from rides, got %+v", awards)
+	}
+}
+
+func TestMarkNewAwards(t *testing.T) {
+	awards := []Award{
+		{Key: "old", Date: "2024-01-15"},
+		{Key: "seen", Date: "2024-05-20"},
+		{Key: "recent", Date: "2024-05-25"},
+	}
+	count := MarkNewAwards(awards, map[string]bool{"seen": true}, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	if count != 1 || awards[0].New || awards[1].New || !awards[2].New {
+		t.Errorf("Expected only the recent unseen award to be new, got %d: %+v", count, awards)
+	}
+}
+
+func TestParseAchievementRules(t *testing.T) {
+	invalid := map[string]string{
+		"malformed JSON":    `[{"id": "a"`,
+		"unknown kind":      `[{"id": "a", "name": "A", "kind": "vibes"}]`,
+		"unknown metric":    `[{"id": "a", "name": "A", "kind": "total", "metric": "calories", "period": "lifetime", "threshold": 1}]`,
+		"unknown period":    `[{"id": "a", "name": "A", "kind": "total", "metric": "count", "period": "fortnightly", "threshold": 1}]`,
+		"missing threshold": `[{"id": "a", "name": "A", "kind": "total", "metric": "count", "period": "lifetime"}]`,
+		"one-day streak":    `[{"id": "a", "name": "A", "kind": "streak", "threshold": 1}]`,
+		"record tolerance":  `[{"id": "a", "name": "A", "kind": "record", "distance": 1000, "tolerance": 1000}]`,
+		"missing name":      `[{"id": "a", "kind": "full_month"}]`,
+		"duplicate id":      `[{"id": "a", "name": "A", "kind": "full_month"}, {"id": "a", "name": "B", "kind": "full_month"}]`,
+	}
+	for name, data := range invalid {
+		if _, err := ParseAchievementRules([]byte(data)); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+
+	defaults, err := LoadAchievementRules("")
+	if err != nil || len(defaults) == 0 {
+		t.Fatalf("Expected valid built-in rules, got %d rules and error %v", len(defaults), err)
+	}
+
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(testAchievementRules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if rules, err := LoadAchievementRules(path); err != nil || len(rules) != 7 {
+		t.Errorf("Expected 7 rules from the file, got %d and error %v", len(rules), err)
+	}
+	if _, err := LoadAchievementRules(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected an error for a missing rules file")
+	}
+}
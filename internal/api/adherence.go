@@ -0,0 +1,327 @@
+package api
+
+import (
+	"math"
+	"time"
+)
+
+// workoutRideRace is Strava's workout type of races on the bike.
+const workoutRideRace = 11
+
+// PlanOptions selects the range and bucketing of a plan adherence report.
+type PlanOptions struct {
+	Start, End string           // inclusive, YYYY-MM-DD
+	Today      string           // unmatched sessions from today on are upcoming rather than missed; empty means none are
+	Period     string           // "daily", "weekly" (default), "monthly", "quarterly" or "yearly"
+	WeekStart  time.Weekday     // first day of weekly periods
+	Settings   *SettingsHistory // heart rates for rating intensity; nil uses the defaults
+}
+
+// Statuses of planned sessions.
+const (
+	SessionCompleted = "completed"
+	SessionMissed    = "missed"
+	SessionUpcoming  = "upcoming"
+)
+
+// PlanActivity is the part of an activity a plan report shows.
+type PlanActivity struct {
+	ID               int64   `json:"id"`
+	Name             string  `json:"name"`
+	SportType        string  `json:"sport_type"`
+	Date             string  `json:"date"`
+	Distance         float64 `json:"distance"`    // meters
+	MovingTime       int     `json:"moving_time"` // seconds
+	AverageHeartrate float64 `json:"average_heartrate,omitempty"`
+	Intensity        int     `json:"intensity,omitempty"` // IntensityRecovery to IntensityMaximal, 0 without heart rate
+}
+
+// PlanSession is a planned session and the activity that fulfilled it, if any.
+// Percentages are of the session's targets and absent without one.
+type PlanSession struct {
+	Workout           PlannedWorkout `json:"workout"`
+	Status            string         `json:"status"` // SessionCompleted, SessionMissed or SessionUpcoming
+	Activity          *PlanActivity  `json:"activity,omitempty"`
+	DistancePercent   *float64       `json:"distance_percent,omitempty"`
+	DurationPercent   *float64       `json:"duration_percent,omitempty"`
+	PlannedIntensity  int            `json:"planned_intensity,omitempty"` // 0 if the plan doesn't say or isn't understood
+	IntensityOnTarget *bool          `json:"intensity_on_target,omitempty"`
+}
+
+// PlanCompliance sums up how closely sessions were followed. Only sessions
+// that are due (completed or missed) count towards the percentages, so a week
+// in progress isn't penalized for what's still to come; missed sessions count
+// with nothing done. Percentages are absent when nothing they measure was
+// planned.
+type PlanCompliance struct {
+	Planned           int      `json:"planned"`
+	Completed         int      `json:"completed"`
+	Missed            int      `json:"missed"`
+	Upcoming          int      `json:"upcoming"`
+	Extra             int      `json:"extra"` // activities that matched no session
+	CompletionPercent *float64 `json:"completion_percent"`
+
+	TargetDistance    float64  `json:"target_distance"`    // meters, of due sessions with a distance target
+	CompletedDistance float64  `json:"completed_distance"` // meters done in those sessions
+	DistancePercent   *float64 `json:"distance_percent"`
+	TargetDuration    int      `json:"target_duration"`    // seconds, of due sessions with a duration target
+	CompletedDuration int      `json:"completed_duration"` // seconds done in those sessions
+	DurationPercent   *float64 `json:"duration_percent"`
+
+	// Completed sessions whose planned and actual intensity are both known,
+	// and how many of them were within one level of the plan
+	IntensitySessions int      `json:"intensity_sessions"`
+	IntensityOnTarget int      `json:"intensity_on_target"`
+	IntensityPercent  *float64 `json:"intensity_percent"`
+}
+
+// PlanPeriod compares a period's plan with what was done: the targets of every
+// session (upcoming ones included) against every activity, extras included.
+type PlanPeriod struct {
+	Period          string         `json:"period"` // first day, YYYY-MM-DD
+	PlannedSessions int            `json:"planned_sessions"`
+	PlannedDistance float64        `json:"planned_distance"` // meters
+	PlannedDuration int            `json:"planned_duration"` // seconds
+	Activities      int            `json:"activities"`
+	ActualDistance  float64        `json:"actual_distance"` // meters
+	ActualDuration  int            `json:"actual_duration"` // seconds of moving time
+	Compliance      PlanCompliance `json:"compliance"`
+}
+
+// PlanAdherence is how an athlete followed their plan over a range.
+type PlanAdherence struct {
+	Start      string         `json:"start"`
+	End        string         `json:"end"`
+	Period     string         `json:"period"`
+	Compliance PlanCompliance `json:"compliance"`
+	Sessions   []PlanSession  `json:"sessions"`
+	Extra      []PlanActivity `json:"extra"`
+	Periods    []PlanPeriod   `json:"periods"`
+}
+
+// planSportFamily extends sportFamily to the sports a plan can't tell apart:
+// a planned walk is done by a hike, and strength sessions by any gym workout.
+func planSportFamily(sportType string) string {
+	switch sportType {
+	case "Walk", "Hike":
+		return "Walk"
+	case "WeightTraining", "Workout", "Crossfit", "HighIntensityIntervalTraining":
+		return "WeightTraining"
+	}
+	return sportFamily(sportType)
+}
+
+// ActivityIntensity rates an activity from IntensityRecovery to
+// IntensityMaximal by its average heart rate as a share of heart rate reserve.
+// Races are maximal; without heart rate it's 0.
+func ActivityIntensity(activity NormalizedActivity, model StressModel) int {
+	if activity.WorkoutType != nil && (*activity.WorkoutType == workoutRace || *activity.WorkoutType == workoutRideRace) {
+		return IntensityMaximal
+	}
+	if !activity.HasHeartrate || activity.AverageHeartrate <= 0 || model.MaxHR <= model.RestingHR {
+		return 0
+	}
+	reserve := (activity.AverageHeartrate - model.RestingHR) / (model.MaxHR - model.RestingHR)
+	switch {
+	case reserve < 0.55:
+		return IntensityRecovery
+	case reserve < 0.70:
+		return IntensityEasy
+	case reserve < 0.80:
+		return IntensityModerate
+	case reserve < 0.88:
+		return IntensityThreshold
+	default:
+		return IntensityMaximal
+	}
+}
+
+// matchScore is how far an activity is from a session's targets, lower being
+// closer: the log ratio of the distances, else of the durations, else longer
+// activities win.
+func matchScore(workout PlannedWorkout, activity NormalizedActivity) float64 {
+	switch {
+	case workout.Distance > 0 && activity.Distance > 0:
+		return math.Abs(math.Log(activity.Distance / workout.Distance))
+	case workout.Duration > 0 && activity.MovingTime > 0:
+		return math.Abs(math.Log(float64(activity.MovingTime) / float64(workout.Duration)))
+	case workout.Distance > 0 || workout.Duration > 0:
+		return math.MaxFloat64 / 2 // nothing to compare, but still the right sport
+	default:
+		return -float64(activity.MovingTime)
+	}
+}
+
+// percentOf returns done as a percentage of target, or nil without a target.
+func percentOf(done, target float64) *float64 {
+	if target <= 0 {
+		return nil
+	}
+	percent := math.Round(done/target*1000) / 10
+	return &percent
+}
+
+// addSession counts a session towards the compliance.
+func (c *PlanCompliance) addSession(session PlanSession) {
+	c.Planned++
+	switch session.Status {
+	case SessionUpcoming:
+		c.Upcoming++
+		return
+	case SessionMissed:
+		c.Missed++
+	case SessionCompleted:
+		c.Completed++
+	}
+	w := session.Workout
+	if w.Distance > 0 {
+		c.TargetDistance += w.Distance
+		if session.Activity != nil {
+			c.CompletedDistance += session.Activity.Distance
+		}
+	}
+	if w.Duration > 0 {
+		c.TargetDuration += w.Duration
+		if session.Activity != nil {
+			c.CompletedDuration += session.Activity.MovingTime
+		}
+	}
+	if session.IntensityOnTarget != nil {
+		c.IntensitySessions++
+		if *session.IntensityOnTarget {
+			c.IntensityOnTarget++
+		}
+	}
+}
+
+// finish computes the percentages.
+func (c *PlanCompliance) finish() {
+	c.CompletionPercent = percentOf(float64(c.Completed), float64(c.Completed+c.Missed))
+	c.DistancePercent = percentOf(c.CompletedDistance, c.TargetDistance)
+	c.DurationPercent = percentOf(float64(c.CompletedDuration), float64(c.TargetDuration))
+	c.IntensityPercent = percentOf(float64(c.IntensityOnTarget), float64(c.IntensitySessions))
+}
+
+// planActivity returns what a plan report shows of an activity.
+func planActivity(activity NormalizedActivity, settings *SettingsHistory) *PlanActivity {
+	return &PlanActivity{
+		ID:               activity.ID,
+		Name:             activity.Name,
+		SportType:        activity.SportType,
+		Date:             activity.LocalDateStr,
+		Distance:         activity.Distance,
+		MovingTime:       activity.MovingTime,
+		AverageHeartrate: activity.AverageHeartrate,
+		Intensity:        ActivityIntensity(activity, settings.StressModelAt(activity.LocalDateStr)),
+	}
+}
+
+// ComputePlanAdherence pairs the planned sessions between opts.Start and opts.End
+// with the activities done on the same day in the same sport family (see
+// planSportFamily), each activity fulfilling at most one session. Sessions of a
+// day are matched in plan order to the activity closest to their targets.
+// Activities left over are extra; sessions left over are missed, or upcoming
+// from opts.Today on. Compliance is reported over the range and per period.
+func ComputePlanAdherence(workouts []PlannedWorkout, activities []NormalizedActivity, opts PlanOptions) PlanAdherence {
+	period := opts.Period
+	if period == "" {
+		period = "weekly"
+	}
+	result := PlanAdherence{
+		Start:    opts.Start,
+		End:      opts.End,
+		Period:   period,
+		Sessions: []PlanSession{},
+		Extra:    []PlanActivity{},
+		Periods:  []PlanPeriod{},
+	}
+	inRange := func(date string) bool { return date >= opts.Start && date <= opts.End }
+
+	byDate := make(map[string][]int)
+	for i, activity := range activities {
+		if inRange(activity.LocalDateStr) {
+			byDate[activity.LocalDateStr] = append(byDate[activity.LocalDateStr], i)
+		}
+	}
+	used := make(map[int]bool)
+	for _, w := range workouts {
+		if !inRange(w.Date) {
+			continue
+		}
+		session := PlanSession{Workout: w, Status: SessionMissed, PlannedIntensity: IntensityLevel(w.Intensity)}
+		best, bestScore := -1, math.Inf(1)
+		for _, i := range byDate[w.Date] {
+			if used[i] || planSportFamily(activities[i].SportType) != planSportFamily(w.SportType) {
+				continue
+			}
+			if score := matchScore(w, activities[i]); score < bestScore {
+				best, bestScore = i, score
+			}
+		}
+		switch {
+		case best >= 0:
+			used[best] = true
+			session.Status = SessionCompleted
+			session.Activity = planActivity(activities[best], opts.Settings)
+			if w.Distance > 0 {
+				session.DistancePercent = percentOf(session.Activity.Distance, w.Distance)
+			}
+			if w.Duration > 0 {
+				session.DurationPercent = percentOf(float64(session.Activity.MovingTime), float64(w.Duration))
+			}
+			if session.PlannedIntensity > 0 && session.Activity.Intensity > 0 {
+				diff := session.Activity.Intensity - session.PlannedIntensity
+				onTarget := diff >= -1 && diff <= 1
+				session.IntensityOnTarget = &onTarget
+			}
+		case opts.Today != "" && w.Date >= opts.Today:
+			session.Status = SessionUpcoming
+		}
+		result.Sessions = append(result.Sessions, session)
+	}
+
+	// Bucket by period, including periods with nothing planned or done
+	periods := make(map[string]*PlanPeriod)
+	if opts.Start != "" && opts.End != "" && opts.Start <= opts.End {
+		for _, key := range periodSequence(periodKey(opts.Start, period, opts.WeekStart), periodKey(opts.End, period, opts.WeekStart), period) {
+			result.Periods = append(result.Periods, PlanPeriod{Period: key})
+		}
+		for i := range result.Periods {
+			periods[result.Periods[i].Period] = &result.Periods[i]
+		}
+	}
+	bucket := func(date string) *PlanPeriod {
+		if p, ok := periods[periodKey(date, period, opts.WeekStart)]; ok {
+			return p
+		}
+		return &PlanPeriod{} // not reported
+	}
+
+	for _, session := range result.Sessions {
+		result.Compliance.addSession(session)
+		p := bucket(session.Workout.Date)
+		p.PlannedSessions++
+		p.PlannedDistance += session.Workout.Distance
+		p.PlannedDuration += session.Workout.Duration
+		p.Compliance.addSession(session)
+	}
+	for i, activity := range activities {
+		if !inRange(activity.LocalDateStr) {
+			continue
+		}
+		p := bucket(activity.LocalDateStr)
+		p.Activities++
+		p.ActualDistance += activity.Distance
+		p.ActualDuration += activity.MovingTime
+		if !used[i] {
+			result.Extra = append(result.Extra, *planActivity(activity, opts.Settings))
+			result.Compliance.Extra++
+			p.Compliance.Extra++
+		}
+	}
+	result.Compliance.finish()
+	for i := range result.Periods {
+		result.Periods[i].Compliance.finish()
+	}
+	return result
+}
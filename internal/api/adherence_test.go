@@ -0,0 +1,124 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputePlanAdherence(t *testing.T) {
+	workouts := []PlannedWorkout{
+		{ID: "a", Date: "2024-03-04", SportType: "Run", Distance: 10000, Intensity: "easy"},
+		{ID: "b", Date: "2024-03-05", SportType: "Ride", Duration: 3600},
+		{ID: "c", Date: "2024-03-06", SportType: "Run", Distance: 8000, Intensity: "threshold"},
+		{ID: "d", Date: "2024-03-06", SportType: "Run", Distance: 3000},
+		{ID: "e", Date: "2024-03-12", SportType: "Run", Distance: 12000},
+		{ID: "f", Date: "2024-03-14", SportType: "Run", Distance: 5000},
+	}
+
+	easy := rollupActivity(1, "Run", "2024-03-04", 9000, 2900)
+	easy.HasHeartrate, easy.AverageHeartrate = true, 130 // 53% of reserve with the default model
+	short := rollupActivity(2, "TrailRun", "2024-03-06", 3200, 1100)
+	long := rollupActivity(3, "VirtualRun", "2024-03-06", 8400, 2500)
+	long.HasHeartrate, long.AverageHeartrate = true, 168 // 83% of reserve
+	activities := []NormalizedActivity{
+		easy,
+		rollupActivity(4, "Walk", "2024-03-05", 3000, 1800), // not the planned ride
+		short,
+		long,
+		rollupActivity(5, "Swim", "2024-03-07", 1500, 1800),
+		rollupActivity(6, "Run", "2024-03-20", 5000, 1500), // out of range
+	}
+
+	adherence := ComputePlanAdherence(workouts, activities, PlanOptions{
+		Start: "2024-03-04", End: "2024-03-17", Today: "2024-03-14", WeekStart: time.Monday,
+	})
+
+	statuses := map[string]string{"a": SessionCompleted, "b": SessionMissed, "c": SessionCompleted, "d": SessionCompleted, "e": SessionMissed, "f": SessionUpcoming}
+	for _, s := range adherence.Sessions {
+		if s.Status != statuses[s.Workout.ID] {
+			t.Errorf("Expected session %s to be %s, got %s", s.Workout.ID, statuses[s.Workout.ID], s.Status)
+		}
+	}
+	if got := adherence.Sessions[2].Activity; got == nil || got.ID != 3 {
+		t.Errorf("Expected the 8 km session to match the 8.4 km run, got %+v", got)
+	}
+	if got := adherence.Sessions[3].Activity; got == nil || got.ID != 2 {
+		t.Errorf("Expected the 3 km session to match the 3.2 km run, got %+v", got)
+	}
+	if p := adherence.Sessions[0].DistancePercent; p == nil || *p != 90 {
+		t.Errorf("Expected 90%% of the distance, got %v", p)
+	}
+	if on := adherence.Sessions[0].IntensityOnTarget; on == nil || !*on {
+		t.Errorf("Expected a recovery run to be within a level of easy, got %v", on)
+	}
+	if on := adherence.Sessions[2].IntensityOnTarget; on == nil || !*on || adherence.Sessions[2].Activity.Intensity != IntensityThreshold {
+		t.Errorf("Expected a threshold run on target, got %+v", adherence.Sessions[2])
+	}
+
+	c := adherence.Compliance
+	if c.Planned != 6 || c.Completed != 3 || c.Missed != 2 || c.Upcoming != 1 || c.Extra != 2 {
+		t.Errorf("Unexpected counts %+v", c)
+	}
+	if c.CompletionPercent == nil || *c.CompletionPercent != 60 {
+		t.Errorf("Expected 60%% completion, got %v", c.CompletionPercent)
+	}
+	// 9 + 8.4 + 3.2 km of 10 + 8 + 3 + 12 km
+	if c.TargetDistance != 33000 || c.CompletedDistance != 20600 || c.DistancePercent == nil || *c.DistancePercent != 62.4 {
+		t.Errorf("Unexpected distance compliance %g of %g (%v)", c.CompletedDistance, c.TargetDistance, c.DistancePercent)
+	}
+	if c.TargetDuration != 3600 || c.CompletedDuration != 0 || c.DurationPercent == nil || *c.DurationPercent != 0 {
+		t.Errorf("Unexpected duration compliance %d of %d (%v)", c.CompletedDuration, c.TargetDuration, c.DurationPercent)
+	}
+	if c.IntensitySessions != 2 || c.IntensityPercent == nil || *c.IntensityPercent != 100 {
+		t.Errorf("Unexpected intensity compliance %+v", c)
+	}
+	if len(adherence.Extra) != 2 || adherence.Extra[0].ID != 4 || adherence.Extra[1].ID != 5 {
+		t.Errorf("Expected the walk and swim as extra, got %+v", adherence.Extra)
+	}
+
+	if len(adherence.Periods) != 2 {
+		t.Fatalf("Expected 2 weeks, got %+v", adherence.Periods)
+	}
+	week1, week2 := adherence.Periods[0], adherence.Periods[1]
+	if week1.Period != "2024-03-04" || week1.PlannedSessions != 4 || week1.PlannedDistance != 21000 || week1.Activities != 5 || week1.ActualDistance != 25100 {
+		t.Errorf("Unexpected first week %+v", week1)
+	}
+	if week2.Period != "2024-03-11" || week2.PlannedDistance != 17000 || week2.Activities != 0 || week2.Compliance.Missed != 1 || week2.Compliance.Upcoming != 1 {
+		t.Errorf("Unexpected second week %+v", week2)
+	}
+	if p := week2.Compliance.DistancePercent; p == nil || *p != 0 {
+		t.Errorf("Expected 0%% distance in the second week, counting only the missed session, got %v", p)
+	}
+}
+
+func TestComputePlanAdherenceWithoutTargets(t *testing.T) {
+	workouts := []PlannedWorkout{{ID: "a", Date: "2024-03-04", SportType: "WeightTraining"}}
+	activities := []NormalizedActivity{
+		rollupActivity(1, "Workout", "2024-03-04", 0, 1200),
+		rollupActivity(2, "Crossfit", "2024-03-04", 0, 2400),
+	}
+	adherence := ComputePlanAdherence(workouts, activities, PlanOptions{Start: "2024-03-04", End: "2024-03-04", Period: "daily"})
+	if got := adherence.Sessions[0].Activity; got == nil || got.ID != 2 {
+		t.Errorf("Expected the longest gym session to match, got %+v", got)
+	}
+	c := adherence.Compliance
+	if c.DistancePercent != nil || c.DurationPercent != nil || c.IntensityPercent != nil {
+		t.Errorf("Expected no target percentages without targets, got %+v", c)
+	}
+	if c.CompletionPercent == nil || *c.CompletionPercent != 100 || c.Extra != 1 {
+		t.Errorf("Unexpected compliance %+v", c)
+	}
+}
+
+func TestActivityIntensity(t *testing.T) {
+	model := DefaultStressModel()
+	activity := rollupActivity(1, "Run", "2024-03-04", 10000, 3000)
+	if got := ActivityIntensity(activity, model); got != 0 {
+		t.Errorf("Expected 0 without heart rate, got %d", got)
+	}
+	race := workoutRace
+	activity.WorkoutType = &race
+	if got := ActivityIntensity(activity, model); got != IntensityMaximal {
+		t.Errorf("Expected races to be maximal, got %d", got)
+	}
+}
@@ -0,0 +1,343 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Climb detection settings.
+const (
+	climbSmoothMeters = 25.0 // altitude is averaged over this distance either side
+	climbMinDip       = 10.0 // a drop below the top of at least this ends a climb, in meters
+	climbDipShare     = 0.1  // ...or this share of the climb's gain, if more
+	climbMinGain      = 20.0 // least elevation gain of a climb, in meters
+	climbMinGrade     = 3.0  // least average grade of a climb, in percent
+	climbMaxGradeSpan = 100.0
+	// climbMatchMeters is how close the bottoms and tops of two climbs must be
+	// for them to be ascents of the same climb
+	climbMatchMeters = 150.0
+	climbMatchLength = 0.2 // how much their lengths may differ, as a share
+	earthRadius      = 6371000.0
+)
+
+// Climb categories, from the hardest.
+const (
+	ClimbHC            = "HC"
+	ClimbCat1          = "1"
+	ClimbCat2          = "2"
+	ClimbCat3          = "3"
+	ClimbCat4          = "4"
+	ClimbUncategorized = ""
+)
+
+// climbCategories are the least scores (length in meters × average grade in
+// percent) of each category, from the hardest, as Strava rates bike climbs.
+var climbCategories = []struct {
+	category string
+	minScore float64
+}{
+	{ClimbHC, 80000},
+	{ClimbCat1, 64000},
+	{ClimbCat2, 32000},
+	{ClimbCat3, 16000},
+	{ClimbCat4, 8000},
+}
+
+// Climb is a discrete climb within an activity.
+type Climb struct {
+	StartDistance float64 `json:"start_distance"` // meters into the activity
+	EndDistance   float64 `json:"end_distance"`   // meters into the activity
+	Length        float64 `json:"length"`         // in meters
+	ElevationGain float64 `json:"elevation_gain"` // top minus bottom, in meters
+	StartAltitude float64 `json:"start_altitude"` // in meters
+	EndAltitude   float64 `json:"end_altitude"`   // in meters
+	AverageGrade  float64 `json:"average_grade"`  // in percent
+	MaxGrade      float64 `json:"max_grade"`      // steepest climbMaxGradeSpan meters, in percent
+	Score         float64 `json:"score"`          // length in meters × average grade in percent
+	Category      string  `json:"category"`       // one of the Climb category constants
+	Time          int     `json:"time"`           // seconds from bottom to top
+	VAM           float64 `json:"vam"`            // meters climbed per hour
+	// Start and End are the bottom and top, when the activity has a GPS track
+	Start *[2]float64 `json:"start_latlng,omitempty"`
+	End   *[2]float64 `json:"end_latlng,omitempty"`
+	Label string      `json:"label"` // e.g. "Cat 3: 2.4 km at 6.1%"
+}
+
+// ClimbCategory returns the category of a climb with the given score.
+func ClimbCategory(score float64) string {
+	for _, c := range climbCategories {
+		if score >= c.minScore {
+			return c.category
+		}
+	}
+	return ClimbUncategorized
+}
+
+// climbCategoryName formats a category as "HC", "Cat 1" or "Uncategorized".
+func climbCategoryName(category string) string {
+	switch category {
+	case ClimbHC:
+		return "HC"
+	case ClimbUncategorized:
+		return "Uncategorized"
+	}
+	return "Cat " + category
+}
+
+// DetectClimbs finds the climbs in an activity's altitude and distance
+// streams. A climb runs from a low point to the highest point before the road
+// drops by more than climbMinDip (or climbDipShare of the gain so far); it
+// counts if it gains at least climbMinGain at an average of climbMinGrade.
+// Climbs are in the order they were ridden or run.
+func DetectClimbs(streams *Streams) []Climb {
+	climbs := []Climb{}
+	n := streams.Len()
+	if n < 2 || len(streams.Altitude) != n || len(streams.Distance) != n {
+		return climbs
+	}
+	altitude := smoothAltitude(streams)
+
+	bottom, top := 0, 0
+	end := func() {
+		if climb, ok := newClimb(streams, altitude, bottom, top); ok {
+			climbs = append(climbs, climb)
+		}
+	}
+	for i := 1; i < n; i++ {
+		dip := math.Max(climbMinDip, climbDipShare*(altitude[top]-altitude[bottom]))
+		switch {
+		case altitude[i] > altitude[top]:
+			top = i
+		case altitude[i] <= altitude[bottom] || altitude[top]-altitude[i] >= dip:
+			end()
+			bottom, top = i, i
+		}
+	}
+	end()
+	return climbs
+}
+
+// smoothAltitude averages the altitude over climbSmoothMeters either side, so
+// barometer and GPS noise don't break climbs apart.
+func smoothAltitude(streams *Streams) []float64 {
+	n := streams.Len()
+	smoothed := make([]float64, n)
+	lo, hi := 0, 0
+	var sum float64
+	for i := range smoothed {
+		for hi < n && streams.Distance[hi] <= streams.Distance[i]+climbSmoothMeters {
+			sum += streams.Altitude[hi]
+			hi++
+		}
+		for streams.Distance[lo] < streams.Distance[i]-climbSmoothMeters {
+			sum -= streams.Altitude[lo]
+			lo++
+		}
+		smoothed[i] = sum / float64(hi-lo)
+	}
+	return smoothed
+}
+
+// newClimb measures the climb from sample bottom to top; ok is false if it
+// is too small or too gentle to count.
+func newClimb(streams *Streams, altitude []float64, bottom, top int) (Climb, bool) {
+	length := streams.Distance[top] - streams.Distance[bottom]
+	gain := altitude[top] - altitude[bottom]
+	if top <= bottom || length <= 0 || gain < climbMinGain || gain/length*100 < climbMinGrade {
+		return Climb{}, false
+	}
+	climb := Climb{
+		StartDistance: streams.Distance[bottom],
+		EndDistance:   streams.Distance[top],
+		Length:        length,
+		ElevationGain: gain,
+		StartAltitude: altitude[bottom],
+		EndAltitude:   altitude[top],
+		AverageGrade:  gain / length * 100,
+		MaxGrade:      gain / length * 100,
+		Time:          streams.Time[top] - streams.Time[bottom],
+	}
+	climb.Score = climb.Length * climb.AverageGrade
+	climb.Category = ClimbCategory(climb.Score)
+	if climb.Time > 0 {
+		climb.VAM = gain / float64(climb.Time) * 3600
+	}
+	if len(streams.LatLng) == streams.Len() {
+		start, end := streams.LatLng[bottom], streams.LatLng[top]
+		climb.Start, climb.End = &start, &end
+	}
+
+	// Steepest stretch of at least climbMaxGradeSpan
+	j := bottom
+	for i := bottom; i <= top; i++ {
+		for j < top && streams.Distance[j]-streams.Distance[i] < climbMaxGradeSpan {
+			j++
+		}
+		run := streams.Distance[j] - streams.Distance[i]
+		if run < climbMaxGradeSpan {
+			break
+		}
+		if grade := (altitude[j] - altitude[i]) / run * 100; grade > climb.MaxGrade {
+			climb.MaxGrade = grade
+		}
+	}
+
+	climb.Label = fmt.Sprintf("%s: %.1f km at %.1f%%", climbCategoryName(climb.Category), climb.Length/metersPerKm, climb.AverageGrade)
+	return climb, true
+}
+
+// ActivityClimbs are the climbs detected in one activity.
+type ActivityClimbs struct {
+	ID        int64   `json:"id"`
+	Name      string  `json:"name"`
+	Date      string  `json:"date"` // YYYY-MM-DD
+	SportType string  `json:"sport_type"`
+	Climbs    []Climb `json:"climbs"`
+}
+
+// ClimbAscent is one ascent of a repeated climb.
+type ClimbAscent struct {
+	ActivityID int64   `json:"activity_id"`
+	Name       string  `json:"name"`
+	Date       string  `json:"date"` // YYYY-MM-DD
+	Time       int     `json:"time"` // in seconds
+	VAM        float64 `json:"vam"`  // meters climbed per hour
+}
+
+// RepeatedClimb is a climb ascended more than once, matched by where it starts
+// and ends. Ascents are compared within a sport family (see sportFamily), as a
+// run and a ride up the same hill aren't comparable.
+type RepeatedClimb struct {
+	Climb     Climb         `json:"climb"` // as first ascended
+	Sport     string        `json:"sport"` // sport family, e.g. "Run" or "Ride"
+	Ascents   []ClimbAscent `json:"ascents"`
+	BestTime  int           `json:"best_time"` // in seconds
+	BestIndex int           `json:"best_index"`
+}
+
+// ClimbAnalysis is the climbs of a set of activities.
+type ClimbAnalysis struct {
+	Activities []ActivityClimbs `json:"activities"` // with at least one climb, newest first
+	Categories map[string]int   `json:"categories"` // climbs per category ("" for uncategorized)
+	Hardest    []Climb          `json:"hardest"`    // highest scores first, at most 10
+	Repeated   []RepeatedClimb  `json:"repeated"`   // most ascents first
+}
+
+// maxHardestClimbs limits ClimbAnalysis.Hardest.
+const maxHardestClimbs = 10
+
+// AnalyzeClimbs summarizes the climbs of activities and finds repeated climbs.
+// Only climbs with GPS positions can be matched to each other.
+func AnalyzeClimbs(activities []ActivityClimbs) ClimbAnalysis {
+	analysis := ClimbAnalysis{
+		Activities: []ActivityClimbs{},
+		Categories: make(map[string]int),
+		Hardest:    []Climb{},
+		Repeated:   []RepeatedClimb{},
+	}
+	sorted := append([]ActivityClimbs(nil), activities...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date < sorted[j].Date })
+
+	var groups []*RepeatedClimb
+	for _, activity := range sorted {
+		if len(activity.Climbs) == 0 {
+			continue
+		}
+		analysis.Activities = append(analysis.Activities, activity)
+		for _, climb := range activity.Climbs {
+			analysis.Categories[climb.Category]++
+			analysis.Hardest = append(analysis.Hardest, climb)
+
+			if climb.Start == nil || climb.End == nil {
+				continue
+			}
+			ascent := ClimbAscent{ActivityID: activity.ID, Name: activity.Name, Date: activity.Date, Time: climb.Time, VAM: climb.VAM}
+			sport := sportFamily(activity.SportType)
+			var group *RepeatedClimb
+			for _, g := range groups {
+				if g.Sport == sport && sameClimb(g.Climb, climb) {
+					group = g
+					break
+				}
+			}
+			if group == nil {
+				group = &RepeatedClimb{Climb: climb, Sport: sport}
+				groups = append(groups, group)
+			}
+			group.Ascents = append(group.Ascents, ascent)
+		}
+	}
+
+	for i, j := 0, len(analysis.Activities)-1; i < j; i, j = i+1, j-1 {
+		analysis.Activities[i], analysis.Activities[j] = analysis.Activities[j], analysis.Activities[i]
+	}
+	sort.SliceStable(analysis.Hardest, func(i, j int) bool { return analysis.Hardest[i].Score > analysis.Hardest[j].Score })
+	if len(analysis.Hardest) > maxHardestClimbs {
+		analysis.Hardest = analysis.Hardest[:maxHardestClimbs]
+	}
+
+	for _, group := range groups {
+		if len(group.Ascents) < 2 {
+			continue
+		}
+		for i, ascent := range group.Ascents {
+			if ascent.Time > 0 && (group.BestTime == 0 || ascent.Time < group.BestTime) {
+				group.BestTime, group.BestIndex = ascent.Time, i
+			}
+		}
+		analysis.Repeated = append(analysis.Repeated, *group)
+	}
+	sort.SliceStable(analysis.Repeated, func(i, j int) bool {
+		return len(analysis.Repeated[i].Ascents) > len(analysis.Repeated[j].Ascents)
+	})
+	return analysis
+}
+
+// sameClimb reports whether two climbs start and end at the same places and
+// are about as long.
+func sameClimb(a, b Climb) bool {
+	return distanceBetween(*a.Start, *b.Start) <= climbMatchMeters &&
+		distanceBetween(*a.End, *b.End) <= climbMatchMeters &&
+		relativeDifference(a.Length, b.Length) <= climbMatchLength
+}
+
+// distanceBetween returns the great-circle distance between two positions
+// (latitude, longitude in degrees), in meters.
+func distanceBetween(a, b [2]float64) float64 {
+	lat1, lat2 := a[0]*math.Pi/180, b[0]*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b[1] - a[1]) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// IsClimbCandidate reports whether an activity may have climbs worth fetching
+// its streams for: a run, walk, hike or ride that gained at least
+// minElevationGain meters.
+func IsClimbCandidate(activity NormalizedActivity, minElevationGain float64) bool {
+	family := sportFamily(activity.SportType)
+	if !IsGradeAdjustable(activity.SportType) && family != "Ride" {
+		return false
+	}
+	return activity.SportType != "VirtualRide" && activity.SportType != "VirtualRun" &&
+		activity.TotalElevationGain >= minElevationGain
+}
+
+// ClimbCandidates returns the newest climb candidates (see IsClimbCandidate),
+// at most limit of them, newest first.
+func ClimbCandidates(activities []NormalizedActivity, minElevationGain float64, limit int) []NormalizedActivity {
+	var candidates []NormalizedActivity
+	for _, activity := range activities {
+		if IsClimbCandidate(activity, minElevationGain) {
+			candidates = append(candidates, activity)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].StartDate.After(candidates[j].StartDate)
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// profileStreams builds samples a meter apart at speed (m/s) along a route
+// heading north from latitude lat, over segments of {length, grade}.
+func profileStreams(lat, speed float64, segments ...[2]float64) *Streams {
+	streams := &Streams{}
+	distance, altitude := 0.0, 100.0
+	add := func() {
+		streams.Time = append(streams.Time, int(math.Round(distance/speed)))
+		streams.Distance = append(streams.Distance, distance)
+		streams.Altitude = append(streams.Altitude, altitude)
+		streams.LatLng = append(streams.LatLng, [2]float64{lat + distance/111195, -122})
+	}
+	add()
+	for _, segment := range segments {
+		for i := 0; i < int(segment[0]); i++ {
+			distance++
+			altitude += segment[1]
+			add()
+		}
+	}
+	return streams
+}
+
+func TestClimbCategory(t *testing.T) {
+	tests := map[float64]string{
+		90000: ClimbHC,
+		80000: ClimbHC,
+		64000: ClimbCat1,
+		40000: ClimbCat2,
+		16000: ClimbCat3,
+		8000:  ClimbCat4,
+		7999:  ClimbUncategorized,
+	}
+	for score, expected := range tests {
+		if got := ClimbCategory(score); got != expected {
+			t.Errorf("Expected score %.0f to be %q, got %q", score, expected, got)
+		}
+	}
+}
+
+func TestDetectClimbs(t *testing.T) {
+	streams := profileStreams(45, 3,
+		[2]float64{500, 0},
+		[2]float64{2000, 0.06}, // 120 m at 6%
+		[2]float64{1000, -0.08},
+		[2]float64{300, 0.03}, // 9 m is too little to count
+		[2]float64{500, 0},
+	)
+	climbs := DetectClimbs(streams)
+	if len(climbs) != 1 {
+		t.Fatalf("Expected one climb, got %+v", climbs)
+	}
+	climb := climbs[0]
+	// Smoothing rounds off the bottom and top by a few meters
+	if math.Abs(climb.StartDistance-500) > 30 || math.Abs(climb.Length-2000) > 60 {
+		t.Errorf("Expected a 2 km climb from 500 m, got %.0f m from %.0f m", climb.Length, climb.StartDistance)
+	}
+	if math.Abs(climb.AverageGrade-6) > 0.2 || math.Abs(climb.MaxGrade-6) > 0.2 {
+		t.Errorf("Expected a steady 6%% grade, got %.2f%% average and %.2f%% max", climb.AverageGrade, climb.MaxGrade)
+	}
+	if climb.Category != ClimbCat4 || climb.Label != fmt.Sprintf("Cat 4: %.1f km at %.1f%%", climb.Length/metersPerKm, climb.AverageGrade) {
+		t.Errorf("Unexpected category %q or label %q", climb.Category, climb.Label)
+	}
+	// 120 m in about 667 s
+	if math.Abs(climb.VAM-648) > 20 {
+		t.Errorf("Expected a VAM of about 648 m/h, got %.0f", climb.VAM)
+	}
+	if climb.Start == nil || climb.End == nil {
+		t.Error("Expected the climb to have positions")
+	}
+}
+
+func TestDetectClimbsDip(t *testing.T) {
+	// A short dip doesn't split a climb, a long descent does
+	streams := profileStreams(45, 3,
+		[2]float64{1000, 0.08},
+		[2]float64{50, -0.08},
+		[2]float64{1000, 0.08},
+		[2]float64{1000, -0.05},
+		[2]float64{1000, 0.05},
+	)
+	climbs := DetectClimbs(streams)
+	if len(climbs) != 2 {
+		t.Fatalf("Expected two climbs, got %+v", climbs)
+	}
+	if first := climbs[0]; math.Abs(first.Length-2050) > 60 || first.AverageGrade > 8 || first.MaxGrade < 7.8 {
+		t.Errorf("Expected the first climb to span the dip, got %+v", first)
+	}
+	if DetectClimbs(&Streams{}) == nil || len(DetectClimbs(&Streams{})) != 0 {
+		t.Error("Expected no climbs without streams")
+	}
+}
+
+func TestAnalyzeClimbs(t *testing.T) {
+	hill := [][2]float64{{200, 0}, {2000, 0.09}, {200, 0}}
+	ascent := func(id int64, date, sport string, lat, speed float64) ActivityClimbs {
+		return ActivityClimbs{ID: id, Date: date, SportType: sport, Climbs: DetectClimbs(profileStreams(lat, speed, hill...))}
+	}
+	activities := []ActivityClimbs{
+		ascent(2, "2024-05-10", "Run", 45, 3.2),
+		ascent(1, "2024-05-01", "TrailRun", 45, 3),
+		ascent(3, "2024-05-20", "Run", 45, 2.8),
+		// The same hill on a bike, and another hill 1 km away
+		ascent(4, "2024-05-21", "Ride", 45, 6),
+		ascent(5, "2024-05-22", "Run", 45.01, 3),
+		{ID: 6, Date: "2024-05-23", SportType: "Run"},
+	}
+	analysis := AnalyzeClimbs(activities)
+
+	if len(analysis.Activities) != 5 || analysis.Activities[0].ID != 5 {
+		t.Errorf("Expected 5 activities with climbs, newest first, got %+v", analysis.Activities)
+	}
+	if analysis.Categories[ClimbCat3] != 5 {
+		t.Errorf("Expected five Cat 3 climbs, got %+v", analysis.Categories)
+	}
+	if len(analysis.Repeated) != 1 {
+		t.Fatalf("Expected one repeated climb, got %+v", analysis.Repeated)
+	}
+	repeated := analysis.Repeated[0]
+	if repeated.Sport != "Run" || len(repeated.Ascents) != 3 || repeated.Ascents[0].ActivityID != 1 {
+		t.Errorf("Expected three runs up the hill, oldest first, got %+v", repeated.Ascents)
+	}
+	if best := repeated.Ascents[repeated.BestIndex]; best.ActivityID != 2 || best.Time != repeated.BestTime {
+		t.Errorf("Expected the fastest ascent to be activity 2, got %+v", best)
+	}
+}
+
+func TestClimbCandidates(t *testing.T) {
+	hilly := rollupActivity(1, "Run", "2024-03-01", 10000, 3000)
+	hilly.TotalElevationGain = 200
+	flat := rollupActivity(2, "Run", "2024-03-02", 10000, 3000)
+	ride := rollupActivity(3, "Ride", "2024-03-03", 40000, 3600)
+	ride.TotalElevationGain = 600
+	virtual := rollupActivity(4, "VirtualRide", "2024-03-04", 40000, 3600)
+	virtual.TotalElevationGain = 600
+	swim := rollupActivity(5, "Swim", "2024-03-05", 2000, 3600)
+	swim.TotalElevationGain = 100
+
+	got := ClimbCandidates([]NormalizedActivity{hilly, flat, ride, virtual, swim}, 50, 10)
+	if len(got) != 2 || got[0].ID != 3 || got[1].ID != 1 {
+		t.Errorf("Expected the ride and the hilly run, newest first, got %+v", got)
+	}
+	if got := ClimbCandidates([]NormalizedActivity{hilly, ride}, 50, 1); len(got) != 1 {
+		t.Errorf("Expected the limit to apply, got %d", len(got))
+	}
+}
+
+func TestElevationFromRollup(t *testing.T) {
+	climbing := func(id int64, date string, gain float64) NormalizedActivity {
+		activity := rollupActivity(id, "Ride", date, 50000, 7200)
+		activity.TotalElevationGain = gain
+		return activity
+	}
+	rollup := NewRollup()
+	rollup.Add(
+		climbing(1, "2024-01-10", 5000),
+		climbing(2, "2024-01-20", 5000),
+		climbing(3, "2024-01-25", 0),
+		climbing(4, "2024-02-05", 8000),
+	)
+
+	elevation := ElevationFromRollup(rollup, "", "", "monthly", time.Monday, nil)
+	if elevation.ElevationGain != 18000 || math.Abs(elevation.Everests-18000/EverestHeight) > 1e-9 {
+		t.Errorf("Expected 18000 m of climbing, got %.0f", elevation.ElevationGain)
+	}
+	expected := []EverestMilestone{{Everests: 1, Date: "2024-01-20"}, {Everests: 2, Date: "2024-02-05"}}
+	if !reflect.DeepEqual(elevation.Milestones, expected) {
+		t.Errorf("Expected milestones %+v, got %+v", expected, elevation.Milestones)
+	}
+	if math.Abs(elevation.MetersToNext-(3*EverestHeight-18000)) > 1e-9 {
+		t.Errorf("Unexpected meters to the next Everest: %.2f", elevation.MetersToNext)
+	}
+	if len(elevation.Periods) != 2 || elevation.Periods[0].ElevationGain != 10000 || elevation.Periods[0].Count != 3 {
+		t.Fatalf("Expected two months, got %+v", elevation.Periods)
+	}
+	if elevation.Periods[0].MetersPerKm != 10000/150.0 || elevation.Periods[0].Sports["Ride"] != 10000 {
+		t.Errorf("Unexpected January %+v", elevation.Periods[0])
+	}
+	if elevation.BestDay.Date != "2024-02-05" || elevation.BestPeriod.Period != "2024-01-01" {
+		t.Errorf("Unexpected best day %+v or period %+v", elevation.BestDay, elevation.BestPeriod)
+	}
+
+	empty := ElevationFromRollup(NewRollup(), "", "", "monthly", time.Monday, nil)
+	if empty.BestDay != nil || len(empty.Milestones) != 0 || empty.MetersToNext != EverestHeight {
+		t.Errorf("Unexpected elevation without activities: %+v", empty)
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import "math"
+
+// Meters per Eddington unit.
+const (
+	metersPerMile = 1609.34
+	metersPerKm   = 1000.0
+)
+
+// EddingtonMilestone records the day an Eddington number was first reached.
+type EddingtonMilestone struct {
+	E    int    `json:"e"`
+	Date string `json:"date"` // YYYY-MM-DD
+}
+
+// EddingtonNumber is the Eddington number in one unit: the largest E such that
+// E days each had at least E units of distance.
+type EddingtonNumber struct {
+	Unit string `json:"unit"` // "mi" or "km"
+	E    int    `json:"e"`
+	// QualifyingDaysForNext is how many days already have at least E+1 units
+	QualifyingDaysForNext int `json:"qualifying_days_for_next"`
+	// DaysNeededForNext is how many more days of at least E+1 units reach E+1
+	DaysNeededForNext int                  `json:"days_needed_for_next"`
+	History           []EddingtonMilestone `json:"history"` // when each E from 1 was reached
+}
+
+// Eddington holds the Eddington number in miles and kilometers.
+type Eddington struct {
+	Days  int             `json:"days"` // days with distance
+	Miles EddingtonNumber `json:"miles"`
+	Km    EddingtonNumber `json:"km"`
+}
+
+// CalculateEddington calculates the Eddington number of the activities accepted
+// by filter (nil accepts all). Distances of all activities on the same local day
+// are summed, so a morning and an evening ride count as one day.
+func CalculateEddington(activities []NormalizedActivity, filter func(sportType string) bool) Eddington {
+	rollup := NewRollup()
+	rollup.Add(activities...)
+	return EddingtonFromRollup(rollup, "", "", filter)
+}
+
+// EddingtonFromRollup calculates the Eddington number from daily rollups between
+// start and end (inclusive, YYYY-MM-DD; empty means unbounded).
+func EddingtonFromRollup(rollup *Rollup, start, end string, filter func(sportType string) bool) Eddington {
+	var dates []string
+	var distances []float64
+	for _, day := range rollup.Days(start, end, filter) {
+		if day.Total.Distance > 0 {
+			dates = append(dates, day.Date)
+			distances = append(distances, day.Total.Distance)
+		}
+	}
+	return Eddington{
+		Days:  len(dates),
+		Miles: eddingtonNumber(dates, distances, metersPerMile, "mi"),
+		Km:    eddingtonNumber(dates, distances, metersPerKm, "km"),
+	}
+}
+
+// eddingtonNumber calculates E in one unit from daily distances (meters) in
+// date order, recording the day each E was reached.
+func eddingtonNumber(dates []string, distances []float64, metersPerUnit float64, unit string) EddingtonNumber {
+	result := EddingtonNumber{Unit: unit, History: []EddingtonMilestone{}}
+
+	// atLeast[n] counts days with at least n units; it only needs to go one
+	// past E, and E can't exceed the number of days
+	atLeast := make([]int, len(dates)+2)
+	e := 0
+	for i, meters := range distances {
+		units := int(math.Floor(meters / metersPerUnit))
+		if units >= len(atLeast) {
+			units = len(atLeast) - 1
+		}
+		for n := 1; n <= units; n++ {
+			atLeast[n]++
+		}
+		// One long day can raise E by more than one
+		for e+1 < len(atLeast) && atLeast[e+1] >= e+1 {
+			e++
+			result.History = append(result.History, EddingtonMilestone{E: e, Date: dates[i]})
+		}
+	}
+
+	result.E = e
+	result.QualifyingDaysForNext = atLeast[e+1]
+	result.DaysNeededForNext = e + 1 - atLeast[e+1]
+	return result
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCalculateEddington(t *testing.T) {
+	activities := []NormalizedActivity{
+		rollupActivity(1, "Ride", "2024-06-01", 3*metersPerMile, 600),
+		rollupActivity(2, "Ride", "2024-06-02", 1.5*metersPerMile, 600),
+		// Two rides on one day add up to 2.4 miles
+		rollupActivity(3, "Ride", "2024-06-03", 1.2*metersPerMile, 600),
+		rollupActivity(4, "Ride", "2024-06-03", 1.2*metersPerMile, 600),
+		rollupActivity(5, "Ride", "2024-06-04", 2*metersPerMile, 600),
+		// A long run doesn't count for cycling
+		rollupActivity(6, "Run", "2024-06-05", 20*metersPerMile, 600),
+	}
+
+	rides := CalculateEddington(activities, func(sport string) bool { return sport == "Ride" })
+	if rides.Days != 4 {
+		t.Errorf("Expected 4 riding days, got %d", rides.Days)
+	}
+	// Days of 3, 1.5, 2.4 and 2 miles: 3 days of at least 2 miles, but not 3 of 3
+	miles := rides.Miles
+	if miles.E != 2 || miles.QualifyingDaysForNext != 1 || miles.DaysNeededForNext != 2 {
+		t.Errorf("Unexpected Eddington number in miles: %+v", miles)
+	}
+	expected := []EddingtonMilestone{{E: 1, Date: "2024-06-01"}, {E: 2, Date: "2024-06-03"}}
+	if !reflect.DeepEqual(miles.History, expected) {
+		t.Errorf("Expected history %+v, got %+v", expected, miles.History)
+	}
+	// 4.8, 2.4, 3.9 and 3.2 km: 3 days of at least 3 km
+	if km := rides.Km; km.E != 3 || km.DaysNeededForNext != 3 {
+		t.Errorf("Unexpected Eddington number in km: %+v", km)
+	}
+
+	// Without a filter the 20 mile run counts too: one more 3 mile day reaches E=3
+	all := CalculateEddington(activities, nil)
+	if all.Miles.E != 2 || all.Miles.QualifyingDaysForNext != 2 || all.Miles.DaysNeededForNext != 1 {
+		t.Errorf("Unexpected Eddington number for all sports: %+v", all.Miles)
+	}
+}
+
+func TestCalculateEddington_Empty(t *testing.T) {
+	result := CalculateEddington(nil, nil)
+	if result.Miles.E != 0 || result.Miles.DaysNeededForNext != 1 || len(result.Miles.History) != 0 {
+		t.Errorf("Unexpected Eddington number without activities: %+v", result.Miles)
+	}
+}
@@ -0,0 +1,345 @@
+package api
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Efficiency bases: what output the efficiency factor divides by heart rate.
+const (
+	EfficiencyPace  = "pace"  // normalized graded speed in meters per minute (runs, walks, hikes)
+	EfficiencyPower = "power" // normalized power in watts (rides)
+)
+
+// Decoupling settings.
+const (
+	decouplingMinSeconds = 20 * 60 // shorter efforts are too short to drift
+	// decouplingCoupled is the largest decoupling, in percent, of an effort
+	// that is aerobically well supported (Friel's 5% rule)
+	decouplingCoupled = 5.0
+	// Steady efforts vary less than this: the coefficient of variation of
+	// speed, or of power, averaged over normalizedPowerSeconds
+	steadyMaxSpeedVariation = 0.15
+	steadyMaxPowerVariation = 0.25
+	normalizedPowerSeconds  = 30
+)
+
+// EfficiencyBasis returns how the efficiency factor of a sport is measured:
+// EfficiencyPace for runs, walks and hikes, EfficiencyPower for rides, or ""
+// for other sports.
+func EfficiencyBasis(sportType string) string {
+	switch {
+	case IsGradeAdjustable(sportType):
+		return EfficiencyPace
+	case sportFamily(sportType) == "Ride":
+		return EfficiencyPower
+	}
+	return ""
+}
+
+// EfficiencyFactor returns the Efficiency Factor of an activity: its
+// normalized output over its average heart rate. Runs use normalized graded
+// speed (the grade-adjusted speed in meters per minute, with the grade factor
+// from gradeFactors when measured, otherwise estimated); rides use Strava's
+// weighted average watts, or the average watts without it. It returns 0 for
+// activities without heart rate or output, and for rides without a power
+// meter, as Strava's estimated power doesn't follow the effort.
+func EfficiencyFactor(activity NormalizedActivity, gradeFactors map[int64]float64) (float64, string) {
+	basis := EfficiencyBasis(activity.SportType)
+	if activity.AverageHeartrate <= 0 || activity.MovingTime <= 0 {
+		return 0, basis
+	}
+	switch basis {
+	case EfficiencyPace:
+		if activity.Distance <= 0 {
+			return 0, basis
+		}
+		factor, _ := activityGradeAdjustment(activity, gradeFactors)
+		return activity.Distance * factor / float64(activity.MovingTime) * 60 / activity.AverageHeartrate, basis
+	case EfficiencyPower:
+		if !activity.DeviceWatts {
+			return 0, basis
+		}
+		watts := activity.WeightedAverageWatts
+		if watts <= 0 {
+			watts = activity.AverageWatts
+		}
+		return watts / activity.AverageHeartrate, basis
+	}
+	return 0, basis
+}
+
+// Decoupling compares the efficiency factor of the first and second halves of
+// an effort (Pa:HR for pace, Pw:HR for power). Heart rate drifting up for the
+// same output shows as positive decoupling.
+type Decoupling struct {
+	Basis        string  `json:"basis"`          // EfficiencyPace or EfficiencyPower
+	FirstHalfEF  float64 `json:"first_half_ef"`  // efficiency factor of the first half
+	SecondHalfEF float64 `json:"second_half_ef"` // efficiency factor of the second half
+	Decoupling   float64 `json:"decoupling"`     // drop from the first half, in percent
+	// Steady is whether the output was even enough for decoupling to mean
+	// anything; intervals and stop-start rides aren't
+	Steady  bool `json:"steady"`
+	Coupled bool `json:"coupled"` // steady and decoupled by less than 5%
+	// NormalizedPower is the normalized power of a power effort, in watts
+	NormalizedPower float64 `json:"normalized_power,omitempty"`
+}
+
+// CalculateDecoupling measures the decoupling of an effort from its heart
+// rate stream and its distance (and altitude, for grade adjustment) or watts
+// stream, splitting the moving time in half. ok is false without the streams
+// or for efforts shorter than 20 minutes.
+func CalculateDecoupling(streams *Streams, basis string) (Decoupling, bool) {
+	result := Decoupling{Basis: basis}
+	n := streams.Len()
+	if n < 2 || len(streams.Heartrate) != n {
+		return result, false
+	}
+	var output []float64
+	switch basis {
+	case EfficiencyPace:
+		if len(streams.Distance) != n {
+			return result, false
+		}
+		output = smoothSpeeds(streams)
+	case EfficiencyPower:
+		if len(streams.Watts) != n {
+			return result, false
+		}
+		output = rollingAverage(streams.Time, streams.Watts, normalizedPowerSeconds)
+	default:
+		return result, false
+	}
+
+	// Moving seconds up to each sample
+	moving := make([]int, n)
+	for i := 1; i < n; i++ {
+		moving[i] = moving[i-1]
+		if len(streams.Moving) != n || streams.Moving[i] {
+			moving[i] += streams.Time[i] - streams.Time[i-1]
+		}
+	}
+	total := moving[n-1]
+	if total < decouplingMinSeconds {
+		return result, false
+	}
+	half := sort.SearchInts(moving, total/2)
+
+	result.FirstHalfEF = halfEfficiency(streams, basis, 0, half)
+	result.SecondHalfEF = halfEfficiency(streams, basis, half, n-1)
+	if result.FirstHalfEF <= 0 || result.SecondHalfEF <= 0 {
+		return result, false
+	}
+	result.Decoupling = (result.FirstHalfEF - result.SecondHalfEF) / result.FirstHalfEF * 100
+
+	var movingOutput []float64
+	for i := 1; i < n; i++ {
+		if len(streams.Moving) != n || streams.Moving[i] {
+			movingOutput = append(movingOutput, output[i])
+		}
+	}
+	maxVariation := steadyMaxSpeedVariation
+	if basis == EfficiencyPower {
+		maxVariation = steadyMaxPowerVariation
+		result.NormalizedPower = normalizedPower(movingOutput)
+	}
+	result.Steady = len(movingOutput) > 0 && coefficientOfVariation(movingOutput) <= maxVariation
+	result.Coupled = result.Steady && result.Decoupling < decouplingCoupled
+	return result, true
+}
+
+// halfEfficiency returns the efficiency factor of the moving samples after
+// start up to end: the normalized graded speed (meters per minute) or
+// normalized power over the average heart rate.
+func halfEfficiency(streams *Streams, basis string, start, end int) float64 {
+	var seconds, heartbeats, distance float64
+	for i := start + 1; i <= end; i++ {
+		if len(streams.Moving) == streams.Len() && !streams.Moving[i] {
+			continue
+		}
+		dt := float64(streams.Time[i] - streams.Time[i-1])
+		seconds += dt
+		heartbeats += streams.Heartrate[i] * dt
+		if basis == EfficiencyPace {
+			distance += streams.Distance[i] - streams.Distance[i-1]
+		}
+	}
+	if seconds <= 0 || heartbeats <= 0 {
+		return 0
+	}
+	heartrate := heartbeats / seconds
+
+	if basis == EfficiencyPower {
+		return normalizedPower(rollingAverage(streams.Time[start:end+1], streams.Watts[start:end+1], normalizedPowerSeconds)) / heartrate
+	}
+	half := &Streams{Time: streams.Time[start : end+1], Distance: streams.Distance[start : end+1]}
+	if len(streams.Altitude) == streams.Len() {
+		half.Altitude = streams.Altitude[start : end+1]
+	}
+	factor, ok := StreamGradeAdjustment(half)
+	if !ok {
+		factor = 1
+	}
+	return distance * factor / seconds * 60 / heartrate
+}
+
+// rollingAverage averages values over the trailing window seconds.
+func rollingAverage(times []int, values []float64, window int) []float64 {
+	averaged := make([]float64, len(values))
+	lo := 0
+	var sum float64
+	for i, v := range values {
+		sum += v
+		for times[lo] <= times[i]-window {
+			sum -= values[lo]
+			lo++
+		}
+		averaged[i] = sum / float64(i-lo+1)
+	}
+	return averaged
+}
+
+// normalizedPower returns the fourth-power mean of power already averaged
+// over 30 seconds, as in Coggan's normalized power.
+func normalizedPower(averaged []float64) float64 {
+	if len(averaged) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, w := range averaged {
+		sum += math.Pow(w, 4)
+	}
+	return math.Pow(sum/float64(len(averaged)), 0.25)
+}
+
+// ActivityEfficiency is the efficiency of one activity.
+type ActivityEfficiency struct {
+	ID               int64   `json:"id"`
+	Name             string  `json:"name"`
+	Date             string  `json:"date"` // YYYY-MM-DD
+	SportType        string  `json:"sport_type"`
+	Basis            string  `json:"basis"` // EfficiencyPace or EfficiencyPower
+	EfficiencyFactor float64 `json:"efficiency_factor"`
+	AverageHeartrate float64 `json:"average_heartrate"`
+	// Decoupling is measured from streams, for efforts of at least 20 minutes
+	Decoupling *Decoupling `json:"decoupling,omitempty"`
+}
+
+// EfficiencySummary summarizes the efficiency of one basis.
+type EfficiencySummary struct {
+	Activities int `json:"activities"`
+	// AverageEF weights each activity's efficiency factor by its moving time
+	AverageEF float64 `json:"average_ef"`
+	BestEF    float64 `json:"best_ef"`
+	// Steady and Coupled count the steady efforts with decoupling, and those
+	// of them decoupled by less than 5%
+	Steady            int     `json:"steady"`
+	Coupled           int     `json:"coupled"`
+	AverageDecoupling float64 `json:"average_decoupling"` // of steady efforts, in percent
+	// Trend fits the efficiency factor against days since the first activity
+	Trend *Regression `json:"trend,omitempty"`
+}
+
+// EfficiencyAnalysis is the efficiency of a set of activities.
+type EfficiencyAnalysis struct {
+	Activities []ActivityEfficiency `json:"activities"` // newest first
+	Pace       EfficiencySummary    `json:"pace"`
+	Power      EfficiencySummary    `json:"power"`
+}
+
+// IsEfficiencyCandidate reports whether an activity has an efficiency factor:
+// a run, walk, hike or ride with heart rate.
+func IsEfficiencyCandidate(activity NormalizedActivity) bool {
+	ef, _ := EfficiencyFactor(activity, nil)
+	return ef > 0
+}
+
+// CalculateEfficiency calculates the efficiency factor of activities with
+// heart rate, with grade factors measured from streams where known, and adds
+// the decoupling measured from streams of the activities in decouplings.
+func CalculateEfficiency(activities []NormalizedActivity, gradeFactors map[int64]float64, decouplings map[int64]Decoupling) EfficiencyAnalysis {
+	analysis := EfficiencyAnalysis{Activities: []ActivityEfficiency{}}
+	sorted := append([]NormalizedActivity(nil), activities...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].StartDate.Before(sorted[j].StartDate) })
+
+	type sums struct {
+		time, ef, decoupling float64
+		first                time.Time
+		xs, ys               []float64
+	}
+	totals := map[string]*sums{EfficiencyPace: {}, EfficiencyPower: {}}
+	summaries := map[string]*EfficiencySummary{EfficiencyPace: &analysis.Pace, EfficiencyPower: &analysis.Power}
+	for _, activity := range sorted {
+		ef, basis := EfficiencyFactor(activity, gradeFactors)
+		if ef <= 0 {
+			continue
+		}
+		entry := ActivityEfficiency{
+			ID:               activity.ID,
+			Name:             activity.Name,
+			Date:             activity.LocalDateStr,
+			SportType:        activity.SportType,
+			Basis:            basis,
+			EfficiencyFactor: ef,
+			AverageHeartrate: activity.AverageHeartrate,
+		}
+		summary, s := summaries[basis], totals[basis]
+		if d, ok := decouplings[activity.ID]; ok {
+			entry.Decoupling = &d
+			if d.Steady {
+				summary.Steady++
+				s.decoupling += d.Decoupling
+				if d.Coupled {
+					summary.Coupled++
+				}
+			}
+		}
+		analysis.Activities = append(analysis.Activities, entry)
+
+		summary.Activities++
+		summary.BestEF = math.Max(summary.BestEF, ef)
+		s.time += float64(activity.MovingTime)
+		s.ef += ef * float64(activity.MovingTime)
+		if len(s.xs) == 0 {
+			s.first = activity.LocalDate
+		}
+		s.xs = append(s.xs, activity.LocalDate.Sub(s.first).Hours()/24)
+		s.ys = append(s.ys, ef)
+	}
+
+	for basis, summary := range summaries {
+		s := totals[basis]
+		if s.time > 0 {
+			summary.AverageEF = s.ef / s.time
+		}
+		if summary.Steady > 0 {
+			summary.AverageDecoupling = s.decoupling / float64(summary.Steady)
+		}
+		summary.Trend = LinearRegression(s.xs, s.ys)
+	}
+
+	for i, j := 0, len(analysis.Activities)-1; i < j; i, j = i+1, j-1 {
+		analysis.Activities[i], analysis.Activities[j] = analysis.Activities[j], analysis.Activities[i]
+	}
+	return analysis
+}
+
+// DecouplingCandidates returns the newest activities with an efficiency factor
+// that are long enough for decoupling, at most limit of them, newest first.
+func DecouplingCandidates(activities []NormalizedActivity, limit int) []NormalizedActivity {
+	var candidates []NormalizedActivity
+	for _, activity := range activities {
+		if ef, _ := EfficiencyFactor(activity, nil); ef <= 0 || activity.MovingTime < decouplingMinSeconds {
+			continue
+		}
+		candidates = append(candidates, activity)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].StartDate.After(candidates[j].StartDate)
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
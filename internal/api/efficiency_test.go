@@ -0,0 +1,189 @@
+package api
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEfficiencyFactor(t *testing.T) {
+	// 10 km in 50 minutes is 200 m/min
+	run := rollupActivity(1, "Run", "2024-03-01", 10000, 3000, heartrate(150))
+	if ef, basis := EfficiencyFactor(run, nil); math.Abs(ef-200.0/150) > 1e-9 || basis != EfficiencyPace {
+		t.Errorf("Expected a pace EF of 1.33, got %f (%s)", ef, basis)
+	}
+	// Climbing makes the same pace worth more
+	run.TotalElevationGain = 300
+	if ef, _ := EfficiencyFactor(run, nil); ef <= 200.0/150 {
+		t.Errorf("Expected a hilly run to have a higher EF, got %f", ef)
+	}
+	if ef, _ := EfficiencyFactor(run, map[int64]float64{1: 1.1}); math.Abs(ef-220.0/150) > 1e-9 {
+		t.Errorf("Expected the measured grade factor to be used, got %f", ef)
+	}
+
+	ride := rollupActivity(2, "Ride", "2024-03-02", 40000, 3600, heartrate(140))
+	ride.AverageWatts = 180
+	if ef, _ := EfficiencyFactor(ride, nil); ef != 0 {
+		t.Errorf("Expected no EF from estimated power, got %f", ef)
+	}
+	ride.DeviceWatts = true
+	if ef, basis := EfficiencyFactor(ride, nil); math.Abs(ef-180.0/140) > 1e-9 || basis != EfficiencyPower {
+		t.Errorf("Expected a power EF from average watts, got %f (%s)", ef, basis)
+	}
+	ride.WeightedAverageWatts = 200
+	if ef, _ := EfficiencyFactor(ride, nil); math.Abs(ef-200.0/140) > 1e-9 {
+		t.Errorf("Expected a power EF from weighted average watts, got %f", ef)
+	}
+
+	if ef, _ := EfficiencyFactor(rollupActivity(3, "Run", "2024-03-03", 10000, 3000), nil); ef != 0 {
+		t.Errorf("Expected no EF without heart rate, got %f", ef)
+	}
+	if ef, basis := EfficiencyFactor(rollupActivity(4, "Swim", "2024-03-04", 2000, 2400, heartrate(130)), nil); ef != 0 || basis != "" {
+		t.Errorf("Expected no EF for a swim, got %f (%q)", ef, basis)
+	}
+}
+
+func TestCalculateDecoupling(t *testing.T) {
+	// Same pace, heart rate drifting from 140 to 150
+	b := &streamBuilder{}
+	b.run(1800, 3, 140)
+	b.run(1800, 3, 150)
+	d, ok := CalculateDecoupling(&b.streams, EfficiencyPace)
+	if !ok || math.Abs(d.FirstHalfEF-180.0/140) > 0.01 || math.Abs(d.SecondHalfEF-180.0/150) > 0.01 {
+		t.Fatalf("Unexpected halves %+v (ok %v)", d, ok)
+	}
+	if math.Abs(d.Decoupling-100.0/15) > 0.2 || !d.Steady || d.Coupled {
+		t.Errorf("Expected a steady effort decoupled by 6.7%%, got %+v", d)
+	}
+
+	steady := &streamBuilder{}
+	steady.run(3600, 3, 140)
+	if d, _ := CalculateDecoupling(&steady.streams, EfficiencyPace); math.Abs(d.Decoupling) > 0.1 || !d.Coupled {
+		t.Errorf("Expected a coupled effort, got %+v", d)
+	}
+
+	if d, ok := CalculateDecoupling(intervalSession(6, 800, 800.0/148, 90), EfficiencyPace); !ok || d.Steady {
+		t.Errorf("Expected intervals not to be steady, got %+v", d)
+	}
+	short := &streamBuilder{}
+	short.run(600, 3, 140)
+	if _, ok := CalculateDecoupling(&short.streams, EfficiencyPace); ok {
+		t.Error("Expected no decoupling for a 10-minute effort")
+	}
+	if _, ok := CalculateDecoupling(&steady.streams, EfficiencyPower); ok {
+		t.Error("Expected no power decoupling without watts")
+	}
+}
+
+func TestCalculateDecouplingPower(t *testing.T) {
+	streams := &Streams{}
+	for i := 0; i <= 3600; i++ {
+		heartrate := 130.0
+		if i > 1800 {
+			heartrate = 143
+		}
+		streams.Time = append(streams.Time, i)
+		streams.Heartrate = append(streams.Heartrate, heartrate)
+		streams.Watts = append(streams.Watts, 200)
+	}
+	d, ok := CalculateDecoupling(streams, EfficiencyPower)
+	if !ok || math.Abs(d.NormalizedPower-200) > 1e-6 {
+		t.Fatalf("Expected a normalized power of 200 W, got %+v (ok %v)", d, ok)
+	}
+	if math.Abs(d.Decoupling-100.0*13/143) > 0.1 || !d.Steady || d.Coupled {
+		t.Errorf("Expected a steady ride decoupled by 9.1%%, got %+v", d)
+	}
+}
+
+func TestDecouplingCandidates(t *testing.T) {
+	long := rollupActivity(1, "Run", "2024-03-01", 15000, 4500, heartrate(145))
+	short := rollupActivity(2, "Run", "2024-03-02", 3000, 900, heartrate(145))
+	ride := rollupActivity(3, "Ride", "2024-03-03", 60000, 7200, heartrate(135))
+	ride.AverageWatts = 190
+	powered := ride
+	powered.ID = 4
+	powered.DeviceWatts = true
+
+	got := DecouplingCandidates([]NormalizedActivity{long, short, ride, powered}, 10)
+	if len(got) != 2 || got[0].ID != 4 || got[1].ID != 1 {
+		t.Errorf("Expected the long run and the ride with a power meter, got %+v", got)
+	}
+}
+
+func TestNormalizedPower(t *testing.T) {
+	// Alternating a minute at 300 W and a minute at 100 W averages 200 W,
+	// but costs more than riding steadily at 200 W
+	var times []int
+	var watts []float64
+	for i := 0; i < 3600; i++ {
+		times = append(times, i)
+		if (i/60)%2 == 0 {
+			watts = append(watts, 300)
+		} else {
+			watts = append(watts, 100)
+		}
+	}
+	np := normalizedPower(rollingAverage(times, watts, normalizedPowerSeconds))
+	if np < 220 || np > 250 {
+		t.Errorf("Expected a normalized power of 220-250 W, got %.1f", np)
+	}
+}
+
+func TestCalculateEfficiency(t *testing.T) {
+	activities := []NormalizedActivity{
+		rollupActivity(2, "Run", "2024-03-15", 10000, 3000, heartrate(150)), // 1.33
+		rollupActivity(1, "Run", "2024-03-01", 10000, 3000, heartrate(160)), // 1.25
+		rollupActivity(3, "Run", "2024-03-29", 10000, 3000, heartrate(140)), // 1.43
+		rollupActivity(4, "Run", "2024-03-30", 10000, 3000),
+		strengthActivity(5, "2024-03-30"),
+	}
+	decouplings := map[int64]Decoupling{
+		2: {Basis: EfficiencyPace, Decoupling: 3, Steady: true, Coupled: true},
+		3: {Basis: EfficiencyPace, Decoupling: 8, Steady: true},
+	}
+	analysis := CalculateEfficiency(activities, nil, decouplings)
+
+	if len(analysis.Activities) != 3 || analysis.Activities[0].ID != 3 {
+		t.Fatalf("Expected 3 runs with heart rate, newest first, got %+v", analysis.Activities)
+	}
+	if analysis.Activities[0].Decoupling == nil || analysis.Activities[2].Decoupling != nil {
+		t.Errorf("Expected decoupling only where measured, got %+v", analysis.Activities)
+	}
+	pace := analysis.Pace
+	want := (200.0/150 + 200.0/160 + 200.0/140) / 3
+	if pace.Activities != 3 || math.Abs(pace.AverageEF-want) > 1e-9 || pace.BestEF != 200.0/140 {
+		t.Errorf("Unexpected pace summary %+v", pace)
+	}
+	if pace.Steady != 2 || pace.Coupled != 1 || pace.AverageDecoupling != 5.5 {
+		t.Errorf("Unexpected decoupling summary %+v", pace)
+	}
+	if pace.Trend == nil || pace.Trend.Slope <= 0 {
+		t.Errorf("Expected a rising EF trend, got %+v", pace.Trend)
+	}
+	if analysis.Power.Activities != 0 || analysis.Power.Trend != nil {
+		t.Errorf("Expected no power efficiency, got %+v", analysis.Power)
+	}
+}
+
+func TestEfficiencyTrends(t *testing.T) {
+	ride := rollupActivity(2, "Ride", "2024-03-05", 40000, 3600, heartrate(140))
+	ride.WeightedAverageWatts = 210
+	ride.DeviceWatts = true
+	activities := []NormalizedActivity{
+		rollupActivity(1, "Run", "2024-03-04", 10000, 3000, heartrate(150)),
+		rollupActivity(3, "Run", "2024-03-06", 5000, 1500, heartrate(125)),
+		ride,
+	}
+
+	trends := CalculateTrends(activities, "weekly", false)
+	if len(trends.Points) != 1 {
+		t.Fatalf("Expected one week, got %d", len(trends.Points))
+	}
+	point := trends.Points[0]
+	// Weighted by moving time: 1.33 for 50 minutes, 1.6 for 25
+	if want := (200.0/150*3000 + 200.0/125*1500) / 4500; math.Abs(point.EfficiencyFactor-want) > 1e-9 {
+		t.Errorf("Expected an EF of %.3f, got %.3f", want, point.EfficiencyFactor)
+	}
+	if point.PowerEfficiencyFactor != 1.5 {
+		t.Errorf("Expected a power EF of 1.5, got %.3f", point.PowerEfficiencyFactor)
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"math"
+	"time"
+)
+
+// EverestHeight is the height of Mount Everest in meters, the unit of
+// Everesting milestones.
+const EverestHeight = 8848.86
+
+// ElevationPeriod is the climbing of one period.
+type ElevationPeriod struct {
+	Period        string  `json:"period"`         // start date of the period (YYYY-MM-DD)
+	ElevationGain float64 `json:"elevation_gain"` // in meters
+	Distance      float64 `json:"distance"`       // in meters
+	Count         int     `json:"count"`          // activities
+	// MetersPerKm is the elevation gain per kilometer of distance
+	MetersPerKm float64            `json:"meters_per_km"`
+	Sports      map[string]float64 `json:"sports"` // elevation gain per sport type
+}
+
+// EverestMilestone records the day the cumulative climbing first passed a
+// multiple of Everest.
+type EverestMilestone struct {
+	Everests int    `json:"everests"`
+	Date     string `json:"date"` // YYYY-MM-DD
+}
+
+// ElevationDay is a day's climbing.
+type ElevationDay struct {
+	Date          string  `json:"date"`           // YYYY-MM-DD
+	ElevationGain float64 `json:"elevation_gain"` // in meters
+}
+
+// Elevation is the climbing between two dates.
+type Elevation struct {
+	Periods       []ElevationPeriod `json:"periods"`
+	ElevationGain float64           `json:"elevation_gain"` // total, in meters
+	// Everests is the total climbing in multiples of EverestHeight
+	Everests   float64            `json:"everests"`
+	Milestones []EverestMilestone `json:"milestones"` // each whole Everest, in order
+	// MetersToNext is how much more climbing reaches the next whole Everest
+	MetersToNext float64          `json:"meters_to_next"`
+	BestDay      *ElevationDay    `json:"best_day,omitempty"`
+	BestPeriod   *ElevationPeriod `json:"best_period,omitempty"`
+}
+
+// ElevationFromRollup totals the climbing of activities accepted by filter
+// (nil accepts all) between start and end (inclusive, YYYY-MM-DD; empty means
+// unbounded), per period ("weekly", "monthly", etc. as for Rollup.Periods).
+// Periods without climbing are left out.
+func ElevationFromRollup(rollup *Rollup, start, end, period string, weekStart time.Weekday, filter func(sportType string) bool) Elevation {
+	elevation := Elevation{Periods: []ElevationPeriod{}, Milestones: []EverestMilestone{}}
+
+	for _, day := range rollup.Days(start, end, filter) {
+		gain := day.Total.ElevationGain
+		if gain <= 0 {
+			continue
+		}
+		elevation.ElevationGain += gain
+		// One huge day can pass more than one Everest
+		for everests := len(elevation.Milestones) + 1; elevation.ElevationGain >= float64(everests)*EverestHeight; everests++ {
+			elevation.Milestones = append(elevation.Milestones, EverestMilestone{Everests: everests, Date: day.Date})
+		}
+		if elevation.BestDay == nil || gain > elevation.BestDay.ElevationGain {
+			elevation.BestDay = &ElevationDay{Date: day.Date, ElevationGain: gain}
+		}
+	}
+	elevation.Everests = elevation.ElevationGain / EverestHeight
+	elevation.MetersToNext = (math.Floor(elevation.Everests)+1)*EverestHeight - elevation.ElevationGain
+
+	for _, p := range rollup.Periods(start, end, period, weekStart, filter) {
+		if p.Total.ElevationGain <= 0 {
+			continue
+		}
+		ep := ElevationPeriod{
+			Period:        p.Period,
+			ElevationGain: p.Total.ElevationGain,
+			Distance:      p.Total.Distance,
+			Count:         p.Total.Count,
+			Sports:        make(map[string]float64),
+		}
+		if p.Total.Distance > 0 {
+			ep.MetersPerKm = p.Total.ElevationGain / (p.Total.Distance / metersPerKm)
+		}
+		for sport, totals := range p.Sports {
+			if totals.ElevationGain > 0 {
+				ep.Sports[sport] = totals.ElevationGain
+			}
+		}
+		elevation.Periods = append(elevation.Periods, ep)
+		if elevation.BestPeriod == nil || ep.ElevationGain > elevation.BestPeriod.ElevationGain {
+			best := ep
+			elevation.BestPeriod = &best
+		}
+	}
+	return elevation
+}
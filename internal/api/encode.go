@@ -0,0 +1,242 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// projectedField is a single JSON field selected by an ActivityProjection.
+type projectedField struct {
+	key   []byte // pre-encoded `"name":`
+	index []int  // reflect field index path within NormalizedActivity
+}
+
+// ActivityProjection selects a subset of NormalizedActivity's JSON fields
+// so large activity lists can be sent without every raw and converted value.
+type ActivityProjection struct {
+	fields []projectedField
+}
+
+// activityFieldIndex maps each JSON field name of NormalizedActivity (including
+// the embedded Activity fields) to its reflect index path.
+var activityFieldIndex = buildActivityFieldIndex()
+
+func buildActivityFieldIndex() map[string][]int {
+	index := make(map[string][]int)
+	var walk func(t reflect.Type, prefix []int)
+	walk = func(t reflect.Type, prefix []int) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			path := append(append([]int{}, prefix...), i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				walk(field.Type, path)
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			// Outer fields shadow embedded ones, matching encoding/json
+			if _, exists := index[name]; !exists || len(path) < len(index[name]) {
+				index[name] = path
+			}
+		}
+	}
+	walk(reflect.TypeOf(NormalizedActivity{}), nil)
+	return index
+}
+
+// ActivityFieldNames returns the JSON field names that can be requested in a projection.
+func ActivityFieldNames() []string {
+	names := make([]string, 0, len(activityFieldIndex))
+	for name := range activityFieldIndex {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewActivityProjection creates a projection for the given JSON field names.
+// Field order in the output follows the order requested. Unknown fields are an error.
+func NewActivityProjection(fields []string) (*ActivityProjection, error) {
+	projection := &ActivityProjection{}
+	seen := make(map[string]bool)
+	for _, name := range fields {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		path, ok := activityFieldIndex[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown activity field %q", name)
+		}
+		seen[name] = true
+		key, _ := json.Marshal(name)
+		projection.fields = append(projection.fields, projectedField{
+			key:   append(key, ':'),
+			index: path,
+		})
+	}
+	if len(projection.fields) == 0 {
+		return nil, fmt.Errorf("no activity fields requested")
+	}
+	return projection, nil
+}
+
+// AppendJSON appends the projected JSON object for activity to buf.
+func (p *ActivityProjection) AppendJSON(buf []byte, activity *NormalizedActivity) ([]byte, error) {
+	v := reflect.ValueOf(activity).Elem()
+	buf = append(buf, '{')
+	for i, field := range p.fields {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, field.key...)
+		value, err := json.Marshal(v.FieldByIndex(field.index).Interface())
+		if err != nil {
+			return buf, err
+		}
+		buf = append(buf, value...)
+	}
+	return append(buf, '}'), nil
+}
+
+// ActivityArrayEncoder writes normalized activities as a JSON array one element
+// at a time, so the encoded response is never buffered as a whole.
+type ActivityArrayEncoder struct {
+	w          io.Writer
+	projection *ActivityProjection // nil encodes every field
+	buf        []byte
+	count      int
+}
+
+// NewActivityArrayEncoder creates an encoder writing to w. A nil projection
+// encodes full activities.
+func NewActivityArrayEncoder(w io.Writer, projection *ActivityProjection) *ActivityArrayEncoder {
+	return &ActivityArrayEncoder{w: w, projection: projection}
+}
+
+// Encode writes a single activity, opening the array on the first call.
+func (e *ActivityArrayEncoder) Encode(activity *NormalizedActivity) error {
+	e.buf = e.buf[:0]
+	if e.count == 0 {
+		e.buf = append(e.buf, '[')
+	} else {
+		e.buf = append(e.buf, ',')
+	}
+
+	var err error
+	if e.projection != nil {
+		e.buf, err = e.projection.AppendJSON(e.buf, activity)
+	} else {
+		var encoded []byte
+		encoded, err = json.Marshal(activity)
+		e.buf = append(e.buf, encoded...)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode activity %d: %w", activity.ID, err)
+	}
+
+	e.count++
+	_, err = e.w.Write(e.buf)
+	return err
+}
+
+// Close terminates the array. An encoder that wrote nothing emits "[]".
+func (e *ActivityArrayEncoder) Close() error {
+	closing := "]"
+	if e.count == 0 {
+		closing = "[]"
+	}
+	_, err := io.WriteString(e.w, closing)
+	return err
+}
+
+// activityCursor identifies the last activity of a page in newest-first order.
+type activityCursor struct {
+	StartUnix int64
+	ID        int64
+}
+
+// encodeActivityCursor returns an opaque cursor pointing just after activity.
+func encodeActivityCursor(activity NormalizedActivity) string {
+	raw := fmt.Sprintf("%d.%d", activity.StartDate.Unix(), activity.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeActivityCursor parses a cursor produced by encodeActivityCursor.
+func decodeActivityCursor(cursor string) (activityCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return activityCursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+	parts := strings.SplitN(string(raw), ".", 2)
+	if len(parts) != 2 {
+		return activityCursor{}, fmt.Errorf("invalid cursor")
+	}
+	startUnix, err1 := strconv.ParseInt(parts[0], 10, 64)
+	id, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil {
+		return activityCursor{}, fmt.Errorf("invalid cursor")
+	}
+	return activityCursor{StartUnix: startUnix, ID: id}, nil
+}
+
+// activityBefore reports whether a sorts before b in newest-first order.
+func activityBefore(a, b NormalizedActivity) bool {
+	if a.StartDate.Unix() != b.StartDate.Unix() {
+		return a.StartDate.Unix() > b.StartDate.Unix()
+	}
+	return a.ID > b.ID
+}
+
+// SortActivities sorts activities newest first, the order PageActivities pages in.
+func SortActivities(activities []NormalizedActivity) {
+	sort.SliceStable(activities, func(i, j int) bool {
+		return activityBefore(activities[i], activities[j])
+	})
+}
+
+// PageActivities returns up to limit of the activities that keep accepts (nil
+// accepts all) following cursor (an empty cursor starts at the beginning). The
+// returned cursor points at the next page and is empty when there are no more
+// activities. A limit of zero or less returns all remaining activities.
+//
+// activities must already be sorted newest first (see SortActivities): the
+// cursor is found by binary search, and only the page itself is copied.
+func PageActivities(activities []NormalizedActivity, cursor string, limit int, keep func(*NormalizedActivity) bool) ([]NormalizedActivity, string, error) {
+	start := 0
+	if cursor != "" {
+		c, err := decodeActivityCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		// Skip every activity at or before the cursor position
+		start = sort.Search(len(activities), func(i int) bool {
+			a := activities[i]
+			if a.StartDate.Unix() != c.StartUnix {
+				return a.StartDate.Unix() < c.StartUnix
+			}
+			return a.ID < c.ID
+		})
+	}
+
+	var page []NormalizedActivity
+	for i := start; i < len(activities); i++ {
+		if keep != nil && !keep(&activities[i]) {
+			continue
+		}
+		if limit > 0 && len(page) == limit {
+			// Another activity follows the full page
+			return page, encodeActivityCursor(page[len(page)-1]), nil
+		}
+		page = append(page, activities[i])
+	}
+	return page, "", nil
+}
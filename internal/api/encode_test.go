@@ -0,0 +1,154 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeActivities_Streams(t *testing.T) {
+	body := `[{"id":1,"name":"Morning Run","sport_type":"Run","distance":5000},
+	          {"id":2,"name":"Evening Ride","sport_type":"Ride","distance":20000}]`
+
+	var ids []int64
+	count, err := decodeActivities(strings.NewReader(body), func(a Activity) error {
+		ids = append(ids, a.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("decodeActivities returned error: %v", err)
+	}
+	if count != 2 || len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("Expected activities 1 and 2, got count=%d ids=%v", count, ids)
+	}
+}
+
+func TestDecodeActivities_EmptyAndInvalid(t *testing.T) {
+	for _, body := range []string{`[]`, `null`} {
+		count, err := decodeActivities(strings.NewReader(body), func(Activity) error { return nil })
+		if err != nil || count != 0 {
+			t.Errorf("decodeActivities(%s) = %d, %v; want 0, nil", body, count, err)
+		}
+	}
+
+	if _, err := decodeActivities(strings.NewReader(`{"message":"oops"}`), func(Activity) error { return nil }); err == nil {
+		t.Error("Expected error decoding a non-array body")
+	}
+}
+
+func TestActivityProjection(t *testing.T) {
+	activity := normalizeActivity(Activity{
+		ID:        42,
+		Name:      "Tempo",
+		SportType: "Run",
+		Distance:  8046.7,
+	}, time.Date(2024, 11, 25, 0, 0, 0, 0, time.UTC))
+
+	projection, err := NewActivityProjection([]string{"id", "sport_type", "distance_km", "local_date_str"})
+	if err != nil {
+		t.Fatalf("NewActivityProjection returned error: %v", err)
+	}
+	encoded, err := projection.AppendJSON(nil, &activity)
+	if err != nil {
+		t.Fatalf("AppendJSON returned error: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Projected JSON is invalid: %v (%s)", err, encoded)
+	}
+	if len(decoded) != 4 {
+		t.Errorf("Expected 4 fields, got %d: %s", len(decoded), encoded)
+	}
+	if decoded["id"].(float64) != 42 || decoded["sport_type"] != "Run" || decoded["local_date_str"] != "2024-11-25" {
+		t.Errorf("Unexpected projected values: %s", encoded)
+	}
+
+	if _, err := NewActivityProjection([]string{"id", "not_a_field"}); err == nil {
+		t.Error("Expected error for unknown field")
+	}
+}
+
+func TestActivityArrayEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewActivityArrayEncoder(&buf, nil)
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[]" {
+		t.Errorf("Expected empty array, got %s", buf.String())
+	}
+
+	buf.Reset()
+	projection, _ := NewActivityProjection([]string{"id"})
+	enc = NewActivityArrayEncoder(&buf, projection)
+	for _, id := range []int64{1, 2, 3} {
+		activity := NormalizedActivity{Activity: Activity{ID: id}}
+		if err := enc.Encode(&activity); err != nil {
+			t.Fatal(err)
+		}
+	}
+	enc.Close()
+	if buf.String() != `[{"id":1},{"id":2},{"id":3}]` {
+		t.Errorf("Unexpected encoder output: %s", buf.String())
+	}
+}
+
+func TestPageActivities(t *testing.T) {
+	base := time.Date(2024, 11, 1, 7, 0, 0, 0, time.UTC)
+	var activities []NormalizedActivity
+	for i := 0; i < 5; i++ {
+		activities = append(activities, NormalizedActivity{Activity: Activity{
+			ID:        int64(i + 1),
+			StartDate: base.AddDate(0, 0, i),
+		}})
+	}
+	// Two activities starting at the same second are ordered by ID
+	activities = append(activities, NormalizedActivity{Activity: Activity{ID: 10, StartDate: base.AddDate(0, 0, 2)}})
+	SortActivities(activities)
+
+	var seen []int64
+	cursor := ""
+	pages := 0
+	for {
+		page, next, err := PageActivities(activities, cursor, 2, nil)
+		if err != nil {
+			t.Fatalf("PageActivities returned error: %v", err)
+		}
+		for _, a := range page {
+			seen = append(seen, a.ID)
+		}
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	expected := []int64{5, 4, 10, 3, 2, 1}
+	if pages != 3 || len(seen) != len(expected) {
+		t.Fatalf("Expected %v over 3 pages, got %v over %d pages", expected, seen, pages)
+	}
+	for i := range expected {
+		if seen[i] != expected[i] {
+			t.Errorf("Position %d: expected ID %d, got %d", i, expected[i], seen[i])
+		}
+	}
+
+	// Activities keep rejects are skipped, and don't count towards a page
+	even := func(a *NormalizedActivity) bool { return a.ID%2 == 0 }
+	page, next, err := PageActivities(activities, "", 2, even)
+	if err != nil || len(page) != 2 || page[0].ID != 4 || page[1].ID != 10 {
+		t.Fatalf("Expected activities 4 and 10, got %v (%v)", page, err)
+	}
+	page, next, err = PageActivities(activities, next, 2, even)
+	if err != nil || len(page) != 1 || page[0].ID != 2 || next != "" {
+		t.Errorf("Expected activity 2 on the last page, got %v and cursor %q (%v)", page, next, err)
+	}
+
+	if _, _, err := PageActivities(activities, "%%%", 2, nil); err == nil {
+		t.Error("Expected error for invalid cursor")
+	}
+}
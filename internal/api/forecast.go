@@ -0,0 +1,507 @@
+package api
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Trend series names used as keys in TrendAnalysis; they match the
+// TrendDataPoint JSON fields.
+const (
+	SeriesDistance          = "distance"
+	SeriesMovingTime        = "moving_time"
+	SeriesElevationGain     = "elevation_gain"
+	SeriesCount             = "count"
+	SeriesPace              = "pace_seconds_per_km"
+	SeriesGradeAdjustedPace = "grade_adjusted_pace_seconds_per_km"
+	SeriesAverageHeartrate  = "average_heartrate"
+	SeriesAverageWatts      = "average_watts"
+	SeriesEfficiency        = "efficiency_factor"
+	SeriesPowerEfficiency   = "power_efficiency_factor"
+)
+
+// TrendAnalysis holds regressions and forecasts of the trend series. They are
+// computed from the raw period totals, not the smoothed or cumulative points.
+type TrendAnalysis struct {
+	Regressions map[string]SeriesRegression `json:"regressions,omitempty"`
+	Forecasts   map[string]SeriesForecast   `json:"forecasts,omitempty"`
+}
+
+// SeriesRegression fits a straight line to one series with two methods.
+// Periods without activities count as zero for totals (distance, time,
+// elevation, count) and are skipped for averages (pace, grade-adjusted pace,
+// heart rate, power).
+type SeriesRegression struct {
+	Linear   *Regression `json:"linear"`    // ordinary least squares
+	TheilSen *Regression `json:"theil_sen"` // median of pairwise slopes, robust to outliers
+}
+
+// Regression is a fitted line value = Intercept + Slope * period.
+type Regression struct {
+	Slope     float64 `json:"slope"`     // change per period, in the series' unit
+	Intercept float64 `json:"intercept"` // fitted value at the first period
+	RSquared  float64 `json:"r_squared"` // share of variance explained (can be negative for Theil-Sen)
+	Points    int     `json:"points"`    // periods used for the fit
+}
+
+// ForecastInterval is a forecast value with its 95% prediction interval.
+type ForecastInterval struct {
+	Value float64 `json:"value"`
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// ForecastPoint is the forecast of one future period.
+type ForecastPoint struct {
+	Date string `json:"date"` // start of the period (YYYY-MM-DD)
+	ForecastInterval
+}
+
+// SeriesForecast forecasts a total series (distance, moving time, elevation)
+// for the periods after the trend range.
+type SeriesForecast struct {
+	Method        string           `json:"method"`                  // "holt_winters" (seasonal) or "holt" (trend only)
+	SeasonLength  int              `json:"season_length,omitempty"` // periods per season for holt_winters
+	ObservedTotal float64          `json:"observed_total"`          // sum of the series over the trend range
+	Points        []ForecastPoint  `json:"points"`
+	Total         ForecastInterval `json:"total"` // sum over the forecast periods
+}
+
+// minForecastPeriods is the least history worth forecasting from.
+const minForecastPeriods = 4
+
+// analyzeTrends calculates regressions (if requested) and forecasts for the
+// next forecastPeriods periods from the raw totals of each period. end is the
+// last date of the trend range; quiet periods up to it count as zero.
+func analyzeTrends(periods []PeriodTotals, period, end string, weekStart time.Weekday, regression bool, forecastPeriods int) *TrendAnalysis {
+	analysis := &TrendAnalysis{}
+	if len(periods) == 0 {
+		return analysis
+	}
+
+	// Lay the periods out on a continuous sequence so gaps are explicit
+	last := periods[len(periods)-1].Period
+	if end != "" {
+		if endKey := periodKey(end, period, weekStart); endKey > last {
+			last = endKey
+		}
+	}
+	keys := periodSequence(periods[0].Period, last, period)
+	totals := make([]*RollupTotals, len(keys))
+	index := make(map[string]int, len(keys))
+	for i, key := range keys {
+		index[key] = i
+	}
+	for i := range periods {
+		if j, ok := index[periods[i].Period]; ok {
+			totals[j] = &periods[i].Total
+		}
+	}
+
+	totalSeries := map[string]func(RollupTotals) float64{
+		SeriesDistance:      func(t RollupTotals) float64 { return t.Distance },
+		SeriesMovingTime:    func(t RollupTotals) float64 { return float64(t.MovingTime) },
+		SeriesElevationGain: func(t RollupTotals) float64 { return t.ElevationGain },
+		SeriesCount:         func(t RollupTotals) float64 { return float64(t.Count) },
+	}
+	averageSeries := map[string]func(RollupTotals) float64{
+		SeriesPace: func(t RollupTotals) float64 {
+			if t.Distance <= 0 || t.DistanceTime <= 0 {
+				return math.NaN()
+			}
+			return float64(t.DistanceTime) / t.Distance * 1000
+		},
+		SeriesGradeAdjustedPace: func(t RollupTotals) float64 {
+			if t.FlatDistance <= 0 || t.DistanceTime <= 0 {
+				return math.NaN()
+			}
+			return float64(t.DistanceTime) / t.FlatDistance * 1000
+		},
+		SeriesAverageHeartrate: func(t RollupTotals) float64 { return nanIfZero(t.AverageHeartrate()) },
+		SeriesAverageWatts:     func(t RollupTotals) float64 { return nanIfZero(t.AverageWatts()) },
+		SeriesEfficiency:       func(t RollupTotals) float64 { return nanIfZero(t.PaceEfficiencyFactor()) },
+		SeriesPowerEfficiency:  func(t RollupTotals) float64 { return nanIfZero(t.PowerEfficiencyFactor()) },
+	}
+
+	if regression {
+		analysis.Regressions = make(map[string]SeriesRegression)
+		for name, value := range totalSeries {
+			xs, ys := seriesValues(totals, value, true)
+			analysis.Regressions[name] = SeriesRegression{Linear: LinearRegression(xs, ys), TheilSen: TheilSenRegression(xs, ys)}
+		}
+		for name, value := range averageSeries {
+			xs, ys := seriesValues(totals, value, false)
+			analysis.Regressions[name] = SeriesRegression{Linear: LinearRegression(xs, ys), TheilSen: TheilSenRegression(xs, ys)}
+		}
+	}
+
+	if forecastPeriods > 0 && len(keys) >= minForecastPeriods {
+		// Dates of the forecast periods
+		future := make([]string, 0, forecastPeriods)
+		next := keys[len(keys)-1]
+		for len(future) < forecastPeriods {
+			next = nextPeriodKey(next, period)
+			future = append(future, next)
+		}
+
+		analysis.Forecasts = make(map[string]SeriesForecast)
+		for _, name := range []string{SeriesDistance, SeriesMovingTime, SeriesElevationGain} {
+			_, ys := seriesValues(totals, totalSeries[name], true)
+			analysis.Forecasts[name] = forecastSeries(ys, future, seasonLength(period))
+		}
+	}
+	return analysis
+}
+
+// nanIfZero marks a zero average (no data) as missing.
+func nanIfZero(v float64) float64 {
+	if v == 0 {
+		return math.NaN()
+	}
+	return v
+}
+
+// seriesValues extracts (period index, value) pairs. Missing periods are zero
+// when fillZero is set and skipped otherwise, as are NaN values.
+func seriesValues(totals []*RollupTotals, value func(RollupTotals) float64, fillZero bool) ([]float64, []float64) {
+	xs := make([]float64, 0, len(totals))
+	ys := make([]float64, 0, len(totals))
+	for i, t := range totals {
+		var y float64
+		switch {
+		case t != nil:
+			y = value(*t)
+		case fillZero:
+			y = 0
+		default:
+			continue
+		}
+		if math.IsNaN(y) {
+			continue
+		}
+		xs = append(xs, float64(i))
+		ys = append(ys, y)
+	}
+	return xs, ys
+}
+
+// nextPeriodKey returns the start of the period after the one starting on key.
+func nextPeriodKey(key, period string) string {
+	t, err := time.Parse("2006-01-02", key)
+	if err != nil {
+		return key
+	}
+	switch period {
+	case "weekly":
+		t = t.AddDate(0, 0, 7)
+	case "monthly":
+		t = t.AddDate(0, 1, 0)
+	case "quarterly":
+		t = t.AddDate(0, 3, 0)
+	case "yearly":
+		t = t.AddDate(1, 0, 0)
+	default: // "daily"
+		t = t.AddDate(0, 0, 1)
+	}
+	return t.Format("2006-01-02")
+}
+
+// periodSequence returns every period key from first to last (inclusive).
+func periodSequence(first, last, period string) []string {
+	keys := []string{first}
+	for key := first; ; {
+		next := nextPeriodKey(key, period)
+		if next > last || next == key {
+			return keys
+		}
+		keys = append(keys, next)
+		key = next
+	}
+}
+
+// seasonLength returns the number of periods in a season (a year, or a week
+// for daily trends), or 0 when the period has no seasonality to model.
+func seasonLength(period string) int {
+	switch period {
+	case "daily":
+		return 7
+	case "weekly":
+		return 52
+	case "monthly":
+		return 12
+	case "quarterly":
+		return 4
+	default:
+		return 0
+	}
+}
+
+// LinearRegression fits ys = intercept + slope*xs by ordinary least squares.
+// It returns nil if there are fewer than two distinct xs.
+func LinearRegression(xs, ys []float64) *Regression {
+	n := len(xs)
+	if n < 2 || len(ys) != n {
+		return nil
+	}
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(n)
+	meanY /= float64(n)
+
+	var sxx, sxy float64
+	for i := range xs {
+		sxx += (xs[i] - meanX) * (xs[i] - meanX)
+		sxy += (xs[i] - meanX) * (ys[i] - meanY)
+	}
+	if sxx == 0 {
+		return nil
+	}
+	slope := sxy / sxx
+	intercept := meanY - slope*meanX
+	return &Regression{
+		Slope:     slope,
+		Intercept: intercept + slope*xs[0],
+		RSquared:  rSquared(xs, ys, slope, intercept),
+		Points:    n,
+	}
+}
+
+// theilSenMaxPairs caps the pairwise slopes Theil-Sen looks at; beyond it a
+// fixed random sample of pairs keeps long daily series fast.
+const theilSenMaxPairs = 200000
+
+// TheilSenRegression fits a line through the median of the slopes between all
+// pairs of points, which ignores up to ~29% of outliers (e.g. one race week).
+// It returns nil if there are fewer than two distinct xs.
+func TheilSenRegression(xs, ys []float64) *Regression {
+	n := len(xs)
+	if n < 2 || len(ys) != n {
+		return nil
+	}
+
+	var slopes []float64
+	addSlope := func(i, j int) {
+		if dx := xs[j] - xs[i]; dx != 0 {
+			slopes = append(slopes, (ys[j]-ys[i])/dx)
+		}
+	}
+	if pairs := n * (n - 1) / 2; pairs <= theilSenMaxPairs {
+		slopes = make([]float64, 0, pairs)
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				addSlope(i, j)
+			}
+		}
+	} else {
+		// Deterministic sample so the same data always gives the same answer
+		rng := rand.New(rand.NewSource(1))
+		slopes = make([]float64, 0, theilSenMaxPairs)
+		for k := 0; k < theilSenMaxPairs; k++ {
+			i, j := rng.Intn(n), rng.Intn(n)
+			if i > j {
+				i, j = j, i
+			}
+			addSlope(i, j)
+		}
+	}
+	if len(slopes) == 0 {
+		return nil
+	}
+	slope := median(slopes)
+
+	residuals := make([]float64, n)
+	for i := range xs {
+		residuals[i] = ys[i] - slope*xs[i]
+	}
+	intercept := median(residuals)
+	return &Regression{
+		Slope:     slope,
+		Intercept: intercept + slope*xs[0],
+		RSquared:  rSquared(xs, ys, slope, intercept),
+		Points:    n,
+	}
+}
+
+// rSquared returns 1 - SSres/SStot for the line intercept + slope*x.
+func rSquared(xs, ys []float64, slope, intercept float64) float64 {
+	var meanY float64
+	for _, y := range ys {
+		meanY += y
+	}
+	meanY /= float64(len(ys))
+
+	var ssRes, ssTot float64
+	for i := range xs {
+		residual := ys[i] - (intercept + slope*xs[i])
+		ssRes += residual * residual
+		ssTot += (ys[i] - meanY) * (ys[i] - meanY)
+	}
+	if ssTot == 0 {
+		if ssRes == 0 {
+			return 1
+		}
+		return 0
+	}
+	return 1 - ssRes/ssTot
+}
+
+// median returns the median of values, reordering them.
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 1 {
+		return values[mid]
+	}
+	return (values[mid-1] + values[mid]) / 2
+}
+
+// holtWinters is an additive Holt-Winters (ETS A,A,A) model; with season == 0
+// it is Holt's linear trend model.
+type holtWinters struct {
+	alpha, beta, gamma float64
+	season             int
+}
+
+// holtWintersFit is the state of a model after running it over a series.
+type holtWintersFit struct {
+	level, trend float64
+	seasonal     []float64 // seasonal[i % season] for period i
+	sse          float64   // sum of squared one-step-ahead errors
+	errors       int
+	n            int
+}
+
+// fit runs the model over ys.
+func (m holtWinters) fit(ys []float64) holtWintersFit {
+	f := holtWintersFit{n: len(ys)}
+	start := 1
+	if m.season > 0 {
+		// Initialize from the first two seasons: the trend is the average
+		// change between their means
+		s := m.season
+		var first, second float64
+		for i := 0; i < s; i++ {
+			first += ys[i]
+			second += ys[s+i]
+		}
+		first /= float64(s)
+		second /= float64(s)
+		// The first season's mean is the level at its middle; detrend the
+		// seasonal components around it and roll the level to its last period
+		f.trend = (second - first) / float64(s)
+		middle := float64(s-1) / 2
+		f.seasonal = make([]float64, s)
+		for i := 0; i < s; i++ {
+			f.seasonal[i] = ys[i] - (first + f.trend*(float64(i)-middle))
+		}
+		f.level = first + f.trend*middle
+		start = s
+	} else {
+		f.level = ys[0]
+		if len(ys) > 1 {
+			f.trend = ys[1] - ys[0]
+		}
+	}
+
+	for i := start; i < len(ys); i++ {
+		seasonal := 0.0
+		if m.season > 0 {
+			seasonal = f.seasonal[i%m.season]
+		}
+		predicted := f.level + f.trend + seasonal
+		err := ys[i] - predicted
+		f.sse += err * err
+		f.errors++
+
+		previousLevel := f.level
+		f.level = m.alpha*(ys[i]-seasonal) + (1-m.alpha)*(f.level+f.trend)
+		f.trend = m.beta*(f.level-previousLevel) + (1-m.beta)*f.trend
+		if m.season > 0 {
+			f.seasonal[i%m.season] = m.gamma*(ys[i]-f.level) + (1-m.gamma)*seasonal
+		}
+	}
+	return f
+}
+
+// forecast returns the h-step-ahead point forecast and its 95% interval
+// half-width, using the ETS(A,A,A) forecast variance.
+func (m holtWinters) forecast(f holtWintersFit, h int) (float64, float64) {
+	value := f.level + float64(h)*f.trend
+	if m.season > 0 {
+		value += f.seasonal[(f.n+h-1)%m.season]
+	}
+
+	sigma2 := 0.0
+	if f.errors > 0 {
+		sigma2 = f.sse / float64(f.errors)
+	}
+	variance := 1.0
+	for j := 1; j < h; j++ {
+		c := m.alpha * (1 + float64(j)*m.beta)
+		if m.season > 0 && j%m.season == 0 {
+			c += m.gamma
+		}
+		variance += c * c
+	}
+	return value, 1.96 * math.Sqrt(sigma2*variance)
+}
+
+// forecastSeries picks the best smoothing parameters on a small grid by
+// one-step-ahead error and forecasts the periods in future. The model is
+// seasonal when there are at least two full seasons of history. Forecasts and
+// interval bounds are clamped at zero since totals can't be negative.
+func forecastSeries(ys []float64, future []string, season int) SeriesForecast {
+	result := SeriesForecast{Method: "holt", Points: make([]ForecastPoint, 0, len(future))}
+	for _, y := range ys {
+		result.ObservedTotal += y
+	}
+	if season > 0 && len(ys) >= 2*season {
+		result.Method = "holt_winters"
+		result.SeasonLength = season
+	} else {
+		season = 0
+	}
+
+	var best holtWinters
+	var bestFit holtWintersFit
+	found := false
+	gammas := []float64{0}
+	if season > 0 {
+		gammas = []float64{0.05, 0.2, 0.5}
+	}
+	for _, alpha := range []float64{0.1, 0.2, 0.3, 0.5, 0.7, 0.9} {
+		for _, beta := range []float64{0.01, 0.05, 0.1, 0.3} {
+			for _, gamma := range gammas {
+				m := holtWinters{alpha: alpha, beta: beta, gamma: gamma, season: season}
+				f := m.fit(ys)
+				if !found || f.sse < bestFit.sse {
+					best, bestFit, found = m, f, true
+				}
+			}
+		}
+	}
+
+	var total ForecastInterval
+	for h, date := range future {
+		value, halfWidth := best.forecast(bestFit, h+1)
+		point := ForecastPoint{Date: date, ForecastInterval: ForecastInterval{
+			Value: math.Max(value, 0),
+			Lower: math.Max(value-halfWidth, 0),
+			Upper: math.Max(value+halfWidth, 0),
+		}}
+		result.Points = append(result.Points, point)
+
+		// Summing the bounds assumes the errors are perfectly correlated, so the
+		// interval of the total is conservative
+		total.Value += point.Value
+		total.Lower += point.Lower
+		total.Upper += point.Upper
+	}
+	result.Total = total
+	return result
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLinearRegression(t *testing.T) {
+	xs := []float64{0, 1, 2, 3, 4}
+	ys := []float64{10, 12, 14, 16, 18}
+	reg := LinearRegression(xs, ys)
+	if reg == nil || reg.Slope != 2 || reg.Intercept != 10 || reg.RSquared != 1 || reg.Points != 5 {
+		t.Errorf("Unexpected regression: %+v", reg)
+	}
+
+	if LinearRegression([]float64{1}, []float64{1}) != nil {
+		t.Error("Expected no regression for a single point")
+	}
+	if LinearRegression([]float64{2, 2}, []float64{1, 3}) != nil {
+		t.Error("Expected no regression without spread in x")
+	}
+}
+
+func TestTheilSenRegression_IgnoresOutlier(t *testing.T) {
+	// Steady +1 per week with one huge race week at the end
+	xs := []float64{0, 1, 2, 3, 4, 5, 6, 7, 8}
+	ys := []float64{10, 11, 12, 13, 14, 15, 16, 17, 100}
+
+	robust := TheilSenRegression(xs, ys)
+	if robust == nil || robust.Slope != 1 || robust.Intercept != 10 {
+		t.Errorf("Expected Theil-Sen slope 1 and intercept 10, got %+v", robust)
+	}
+	linear := LinearRegression(xs, ys)
+	if math.Abs(linear.Slope-1) < 0.1 {
+		t.Errorf("Expected the outlier to skew least squares, got slope %f", linear.Slope)
+	}
+}
+
+func TestTheilSenRegression_SamplesLongSeries(t *testing.T) {
+	n := 2000 // ~2M pairs, above theilSenMaxPairs
+	xs := make([]float64, n)
+	ys := make([]float64, n)
+	for i := range xs {
+		xs[i] = float64(i)
+		ys[i] = 3*float64(i) + 7
+	}
+	reg := TheilSenRegression(xs, ys)
+	if reg == nil || reg.Slope != 3 || reg.Intercept != 7 {
+		t.Errorf("Expected slope 3 and intercept 7, got %+v", reg)
+	}
+}
+
+func TestForecastSeries_Seasonal(t *testing.T) {
+	// Three years of monthly totals: a summer peak on a rising baseline
+	var ys []float64
+	for i := 0; i < 36; i++ {
+		ys = append(ys, 100+float64(i)+50*math.Sin(2*math.Pi*float64(i)/12))
+	}
+	future := []string{"2027-01-01", "2027-02-01", "2027-03-01", "2027-04-01"}
+	forecast := forecastSeries(ys, future, 12)
+
+	if forecast.Method != "holt_winters" || forecast.SeasonLength != 12 || len(forecast.Points) != 4 {
+		t.Fatalf("Unexpected forecast: %+v", forecast)
+	}
+	for h, point := range forecast.Points {
+		i := float64(36 + h)
+		expected := 100 + i + 50*math.Sin(2*math.Pi*i/12)
+		if math.Abs(point.Value-expected) > 5 {
+			t.Errorf("Period %d: expected ~%f, got %f", h, expected, point.Value)
+		}
+		if point.Lower > point.Value || point.Upper < point.Value {
+			t.Errorf("Period %d: interval [%f, %f] doesn't contain %f", h, point.Lower, point.Upper, point.Value)
+		}
+	}
+	// Intervals widen with the horizon
+	first, last := forecast.Points[0], forecast.Points[3]
+	if last.Upper-last.Lower < first.Upper-first.Lower {
+		t.Errorf("Expected wider intervals further out: %+v vs %+v", first, last)
+	}
+}
+
+func TestForecastSeries_ShortHistoryUsesHolt(t *testing.T) {
+	forecast := forecastSeries([]float64{10, 20, 30, 40, 50}, []string{"a", "b"}, 52)
+	if forecast.Method != "holt" || forecast.SeasonLength != 0 {
+		t.Errorf("Expected Holt's linear method, got %+v", forecast)
+	}
+	if forecast.ObservedTotal != 150 {
+		t.Errorf("Expected observed total 150, got %f", forecast.ObservedTotal)
+	}
+	if math.Abs(forecast.Points[0].Value-60) > 1 || math.Abs(forecast.Points[1].Value-70) > 1 {
+		t.Errorf("Expected the linear trend to continue, got %+v", forecast.Points)
+	}
+	if math.Abs(forecast.Total.Value-130) > 2 {
+		t.Errorf("Expected total ~130, got %f", forecast.Total.Value)
+	}
+}
+
+func TestCalculateTrends_Analysis(t *testing.T) {
+	// Weekly runs growing by 1km a week, skipping week 3, plus a quiet last week
+	var activities []NormalizedActivity
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) // Monday
+	for week := 0; week < 8; week++ {
+		if week == 3 {
+			continue
+		}
+		date := start.AddDate(0, 0, 7*week).Format("2006-01-02")
+		activities = append(activities, rollupActivity(int64(week+1), "Run", date, float64(5000+1000*week), 1800))
+	}
+	rollup := NewRollup()
+	rollup.Add(activities...)
+
+	trends := TrendsFromRollup(rollup, "", "2024-03-01", TrendOptions{
+		Period:          "weekly",
+		WeekStart:       time.Monday,
+		Regression:      true,
+		ForecastPeriods: 2,
+	})
+	if trends.Analysis == nil {
+		t.Fatal("Expected trend analysis")
+	}
+
+	// 9 weeks through Mar 1: the skipped and quiet weeks count as zero distance
+	distance := trends.Analysis.Regressions[SeriesDistance]
+	if distance.Linear == nil || distance.Linear.Points != 9 || distance.TheilSen.Slope != 1000 {
+		t.Errorf("Unexpected distance regression: linear %+v, Theil-Sen %+v", distance.Linear, distance.TheilSen)
+	}
+	// but pace only uses weeks with runs
+	if pace := trends.Analysis.Regressions[SeriesPace]; pace.Linear == nil || pace.Linear.Points != 7 || pace.Linear.Slope >= 0 {
+		t.Errorf("Expected 7 weeks of improving pace, got %+v", pace.Linear)
+	}
+
+	forecast := trends.Analysis.Forecasts[SeriesDistance]
+	if len(forecast.Points) != 2 || forecast.Points[0].Date != "2024-03-04" || forecast.Points[1].Date != "2024-03-11" {
+		t.Errorf("Unexpected forecast periods: %+v", forecast.Points)
+	}
+
+	// No analysis unless requested
+	if plain := TrendsFromRollup(rollup, "", "", TrendOptions{Period: "weekly"}); plain.Analysis != nil {
+		t.Error("Expected no analysis by default")
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import "math"
+
+// Grade adjustment settings.
+const (
+	gapMaxGrade = 0.45 // the cost curve is fitted between -45% and +45%
+	// gapSegmentMeters is the least distance a grade is measured over, so
+	// altitude noise between neighbouring samples doesn't count as hills
+	gapSegmentMeters = 20.0
+	gapMinDistance   = 100.0 // shorter streams are too short to measure
+	// gapEstimateGrade is the grade assumed for climbs and descents when only
+	// the total elevation gain is known
+	gapEstimateGrade = 0.08
+)
+
+// Grade adjustment sources.
+const (
+	GradeFromStreams  = "streams"  // measured along the route
+	GradeFromEstimate = "estimate" // estimated from the total elevation gain
+)
+
+// minettiCost returns the energy cost of running on a grade (rise over run),
+// in J/kg/m, from the polynomial fitted by Minetti et al. (2002). It is
+// lowest around -20% and grows steeply uphill.
+func minettiCost(grade float64) float64 {
+	g := math.Max(-gapMaxGrade, math.Min(gapMaxGrade, grade))
+	return ((((155.4*g-30.4)*g-43.3)*g+46.3)*g+19.5)*g + 3.6
+}
+
+// gradeEffort returns how much harder (above 1) or easier running a meter on
+// the grade is than on the flat.
+func gradeEffort(grade float64) float64 {
+	return minettiCost(grade) / minettiCost(0)
+}
+
+// IsGradeAdjustable reports whether grade-adjusted pace applies to a sport:
+// running, walking and hiking, where hills are run or walked rather than
+// coasted down.
+func IsGradeAdjustable(sportType string) bool {
+	switch sportType {
+	case "Run", "TrailRun", "VirtualRun", "Walk", "Hike":
+		return true
+	}
+	return false
+}
+
+// StreamGradeAdjustment measures how much harder an activity's route was than
+// the flat, from its altitude and distance streams: the flat distance with the
+// same energy cost, over the distance. Grade-adjusted pace is pace divided by
+// the factor. ok is false without altitude or with too short a stream.
+func StreamGradeAdjustment(streams *Streams) (factor float64, ok bool) {
+	n := streams.Len()
+	if len(streams.Altitude) != n || len(streams.Distance) != n || n < 2 {
+		return 1, false
+	}
+	total := streams.Distance[n-1] - streams.Distance[0]
+	if total < gapMinDistance {
+		return 1, false
+	}
+
+	var equivalent float64
+	start := 0
+	for i := 1; i < n; i++ {
+		run := streams.Distance[i] - streams.Distance[start]
+		if run < gapSegmentMeters && i < n-1 {
+			continue
+		}
+		if run > 0 {
+			equivalent += run * gradeEffort((streams.Altitude[i]-streams.Altitude[start])/run)
+		}
+		start = i
+	}
+	return equivalent / total, true
+}
+
+// EstimateGradeAdjustment estimates the grade adjustment factor (see
+// StreamGradeAdjustment) from the total elevation gain alone. The route is
+// assumed to climb and descend the gain at gapEstimateGrade (steeper if that
+// wouldn't fit in the distance) and be flat otherwise, as on a loop.
+func EstimateGradeAdjustment(distance, elevationGain float64) float64 {
+	if distance <= 0 || elevationGain <= 0 {
+		return 1
+	}
+	grade := gapEstimateGrade
+	if 2*elevationGain/grade > distance {
+		grade = 2 * elevationGain / distance
+	}
+	slope := elevationGain / grade // meters each way
+	equivalent := distance - 2*slope + slope*(gradeEffort(grade)+gradeEffort(-grade))
+	return equivalent / distance
+}
+
+// activityGradeAdjustment returns the grade adjustment factor of an activity
+// and its source: measured from streams when factors has it, otherwise
+// estimated. Sports without grade-adjusted pace get 1.
+func activityGradeAdjustment(activity NormalizedActivity, factors map[int64]float64) (float64, string) {
+	if !IsGradeAdjustable(activity.SportType) {
+		return 1, ""
+	}
+	if factor, ok := factors[activity.ID]; ok {
+		return factor, GradeFromStreams
+	}
+	return EstimateGradeAdjustment(activity.Distance, activity.TotalElevationGain), GradeFromEstimate
+}
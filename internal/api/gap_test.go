@@ -0,0 +1,143 @@
+package api
+
+import (
+	"math"
+	"testing"
+)
+
+// hillStreams builds samples a meter apart climbing at grade for climb meters
+// and, if descend, back down the same way.
+func hillStreams(grade float64, climb int, descend bool) *Streams {
+	streams := &Streams{}
+	samples := climb
+	if descend {
+		samples = 2 * climb
+	}
+	for i := 0; i <= samples; i++ {
+		up := i
+		if i > climb {
+			up = 2*climb - i
+		}
+		streams.Time = append(streams.Time, i)
+		streams.Distance = append(streams.Distance, float64(i))
+		streams.Altitude = append(streams.Altitude, 100+grade*float64(up))
+	}
+	return streams
+}
+
+func TestMinettiCost(t *testing.T) {
+	if minettiCost(0) != 3.6 {
+		t.Errorf("Expected a flat cost of 3.6 J/kg/m, got %f", minettiCost(0))
+	}
+	// Uphill costs more, gentle downhill less, and the curve is clamped
+	if gradeEffort(0.1) < 1.6 || gradeEffort(-0.1) > 0.7 {
+		t.Errorf("Unexpected effort at ±10%%: %f, %f", gradeEffort(0.1), gradeEffort(-0.1))
+	}
+	if minettiCost(0.8) != minettiCost(gapMaxGrade) {
+		t.Error("Expected grades beyond the fitted range to be clamped")
+	}
+}
+
+func TestStreamGradeAdjustment(t *testing.T) {
+	flat, ok := StreamGradeAdjustment(hillStreams(0, 1000, false))
+	if !ok || math.Abs(flat-1) > 1e-9 {
+		t.Errorf("Expected a flat route to have factor 1, got %f (ok %v)", flat, ok)
+	}
+
+	climb, _ := StreamGradeAdjustment(hillStreams(0.1, 1000, false))
+	if math.Abs(climb-gradeEffort(0.1)) > 0.01 {
+		t.Errorf("Expected a 10%% climb to cost %f, got %f", gradeEffort(0.1), climb)
+	}
+
+	// Descending only gives back part of what the climb cost
+	loop, _ := StreamGradeAdjustment(hillStreams(0.1, 1000, true))
+	if loop <= 1 || loop >= climb {
+		t.Errorf("Expected an out-and-back hill between 1 and %f, got %f", climb, loop)
+	}
+
+	if _, ok := StreamGradeAdjustment(&Streams{Time: []int{0, 1}, Distance: []float64{0, 500}}); ok {
+		t.Error("Expected no adjustment without altitude")
+	}
+	if _, ok := StreamGradeAdjustment(hillStreams(0.1, 50, false)); ok {
+		t.Error("Expected no adjustment for a very short stream")
+	}
+}
+
+func TestEstimateGradeAdjustment(t *testing.T) {
+	if got := EstimateGradeAdjustment(10000, 0); got != 1 {
+		t.Errorf("Expected no adjustment without elevation, got %f", got)
+	}
+	hilly := EstimateGradeAdjustment(10000, 500)
+	if hilly < 1.05 || hilly > 1.15 {
+		t.Errorf("Expected 500 m of climbing over 10 km to add 5-15%%, got %f", hilly)
+	}
+	if EstimateGradeAdjustment(10000, 250) >= hilly {
+		t.Error("Expected less climbing to adjust less")
+	}
+	// So much climbing that the route must be steeper than the assumed grade
+	if steep := EstimateGradeAdjustment(5000, 1000); steep <= hilly {
+		t.Errorf("Expected a mountain run to adjust more, got %f", steep)
+	}
+}
+
+func TestGradeAdjustedRunningStats(t *testing.T) {
+	flat := rollupActivity(1, "Run", "2024-03-01", 10000, 3000)
+	trail := rollupActivity(2, "TrailRun", "2024-03-02", 10000, 3300)
+	trail.TotalElevationGain = 500
+	ride := rollupActivity(3, "Ride", "2024-03-03", 40000, 3600)
+	ride.TotalElevationGain = 800
+	activities := []NormalizedActivity{flat, trail, ride}
+
+	stats := CalculateRunningStats(activities)
+	if stats.AveragePaceMinPerKm != "5:15" {
+		t.Errorf("Expected a raw pace of 5:15/km, got %s", stats.AveragePaceMinPerKm)
+	}
+	factor := EstimateGradeAdjustment(10000, 500)
+	want := formatPace(6300 / (10000 + 10000*factor) * 1000)
+	if stats.AverageGradeAdjustedPaceMinPerKm != want || want >= stats.AveragePaceMinPerKm {
+		t.Errorf("Expected a faster grade-adjusted pace of %s, got %s", want, stats.AverageGradeAdjustedPaceMinPerKm)
+	}
+	if stats.GradeFromStreams != 0 {
+		t.Errorf("Expected every run to be estimated, got %d from streams", stats.GradeFromStreams)
+	}
+
+	measured := CalculateRunningStatsWithOptions(activities, RunningStatsOptions{GradeFactors: map[int64]float64{2: 1.2}})
+	if measured.GradeFromStreams != 1 || measured.AverageGradeAdjustedPaceMinPerKm != formatPace(6300/22000.0*1000) {
+		t.Errorf("Expected the measured factor to be used, got %+v", measured)
+	}
+}
+
+func TestGradeAdjustedPersonalRecords(t *testing.T) {
+	flat := rollupActivity(1, "Run", "2024-03-01", 10000, 2900)
+	hilly := rollupActivity(2, "Run", "2024-03-02", 10000, 3000)
+	hilly.TotalElevationGain = 400
+	activities := []NormalizedActivity{flat, hilly}
+
+	if prs := CalculatePersonalRecords(activities); prs.Fastest10K.ID != 1 {
+		t.Errorf("Expected the flat run to be the fastest 10K, got %d", prs.Fastest10K.ID)
+	}
+	prs := CalculatePersonalRecordsWithOptions(activities, PersonalRecordsOptions{GradeAdjusted: true})
+	if prs.Fastest10K.ID != 2 {
+		t.Errorf("Expected the hilly run to be the fastest grade-adjusted 10K, got %d", prs.Fastest10K.ID)
+	}
+	record := prs.Fastest10K
+	if record.GradeSource != GradeFromEstimate || record.GradeAdjustment <= 1 || record.GradeAdjustedPaceMinPerKm >= record.PaceMinPerKm {
+		t.Errorf("Unexpected grade adjustment of the record: %+v", record)
+	}
+}
+
+func TestGradeAdjustedTrends(t *testing.T) {
+	run := rollupActivity(1, "Run", "2024-03-04", 10000, 3000)
+	run.TotalElevationGain = 500
+	strength := strengthActivity(2, "2024-03-04")
+
+	trends := CalculateTrends([]NormalizedActivity{run, strength}, "weekly", false)
+	if len(trends.Points) != 1 {
+		t.Fatalf("Expected one week, got %d", len(trends.Points))
+	}
+	point := trends.Points[0]
+	want := 300 / EstimateGradeAdjustment(10000, 500)
+	if math.Abs(point.GradeAdjustedPaceSecondsPerKm-want) > 1e-9 || point.GradeAdjustedPaceMinPerKm != formatPaceSeconds(want) {
+		t.Errorf("Expected a grade-adjusted pace of %.1f s/km, got %.1f", want, point.GradeAdjustedPaceSecondsPerKm)
+	}
+}
@@ -0,0 +1,559 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Interval detection settings.
+const (
+	intervalSmoothSeconds  = 5    // half-width of the speed smoothing window
+	intervalMinWork        = 30   // shortest effort that counts as a rep, in seconds
+	intervalMinRecovery    = 10   // shorter easing off is part of the rep, in seconds
+	intervalMinSpeedRatio  = 1.2  // how much faster work must be than easy running
+	intervalMaxWorkShare   = 0.7  // more of the run at work speed is a steady run
+	intervalRepSimilarity  = 0.2  // how far apart reps of one set may be, as a share
+	intervalMinReps        = 2    // fewest reps of a set
+	intervalMinSpeed       = 0.5  // slower samples are standing still, in meters per second
+	intervalSpeedIteration = 20   // iterations of the two-cluster speed split
+	intervalRecoveryRound  = 5    // recovery durations are rounded to this, in seconds
+	intervalDurationRound  = 15   // time-based rep durations are rounded to this, in seconds
+	intervalShortStep      = 100  // rep distances under intervalLongRep are rounded to this, in meters
+	intervalLongStep       = 500  // longer rep distances are rounded to this, in meters
+	intervalLongRep        = 2000 // in meters
+)
+
+// Rep bases: whether the reps of a set were run over a distance or a time.
+const (
+	RepDistance = "distance"
+	RepTime     = "time"
+)
+
+// WorkoutSegment is a continuous stretch of a workout, such as the warmup or
+// one rep.
+type WorkoutSegment struct {
+	Start            int     `json:"start"`    // seconds since the start of the activity
+	Duration         int     `json:"duration"` // in seconds
+	Distance         float64 `json:"distance"` // in meters
+	PaceSecondsPerKm float64 `json:"pace_seconds_per_km"`
+	AverageHeartrate float64 `json:"average_heartrate,omitempty"`
+	MaxHeartrate     float64 `json:"max_heartrate,omitempty"`
+}
+
+// Interval is one rep of an interval set.
+type Interval struct {
+	WorkoutSegment
+	// Recovery is the easy running until the next rep, in seconds; 0 after the last
+	Recovery int `json:"recovery"`
+}
+
+// IntervalSet is a run of similar reps, such as 6×800m.
+type IntervalSet struct {
+	Reps      int        `json:"reps"`
+	Basis     string     `json:"basis"`      // RepDistance or RepTime
+	RepLength float64    `json:"rep_length"` // rounded rep distance in meters, or duration in seconds
+	Intervals []Interval `json:"intervals"`
+	// Averages over the reps; pace is total time over total distance
+	PaceSecondsPerKm float64 `json:"pace_seconds_per_km"`
+	Recovery         int     `json:"recovery"` // median recovery between reps, in seconds
+	AverageHeartrate float64 `json:"average_heartrate,omitempty"`
+	// SessionType names the set without its pace, e.g. "6×800m", to compare the
+	// same session across workouts
+	SessionType string `json:"session_type"`
+	Label       string `json:"label"` // e.g. "6×800m @ 3:05/km avg, 90s rec"
+}
+
+// WorkoutStructure is the structure detected in an activity's streams.
+type WorkoutStructure struct {
+	Structured bool            `json:"structured"` // whether any interval set was found
+	Warmup     *WorkoutSegment `json:"warmup,omitempty"`
+	Sets       []IntervalSet   `json:"sets"`
+	Cooldown   *WorkoutSegment `json:"cooldown,omitempty"`
+	Summary    string          `json:"summary"` // the set labels joined by " + "
+}
+
+// workoutSpan is a stretch of samples [start, end) at work or easy speed.
+type workoutSpan struct {
+	start, end int
+	work       bool
+}
+
+// DetectWorkout finds the structure of a workout from its velocity (or
+// distance) and heartrate streams: a warmup, sets of similar work intervals
+// with recoveries between them, and a cooldown. Work is told apart from easy
+// running by splitting the smoothed speeds into a fast and a slow cluster;
+// runs without a clearly faster cluster are unstructured.
+func DetectWorkout(streams *Streams) WorkoutStructure {
+	structure := WorkoutStructure{Sets: []IntervalSet{}}
+	n := streams.Len()
+	if n < 2 || len(streams.Distance) != n {
+		return structure
+	}
+
+	speeds := smoothSpeeds(streams)
+	threshold, ok := workSpeedThreshold(speeds)
+	if !ok {
+		return structure
+	}
+	spans := workoutSpans(streams, speeds, threshold)
+
+	var workTime int
+	var reps []Interval
+	for i, span := range spans {
+		if !span.work {
+			continue
+		}
+		rep := Interval{WorkoutSegment: streamSegment(streams, span.start, span.end)}
+		workTime += rep.Duration
+		if i+1 < len(spans)-1 {
+			// A recovery is followed by another rep; the last easy span is the cooldown
+			rep.Recovery = streamTime(streams, spans[i+1].end) - streamTime(streams, spans[i+1].start)
+		}
+		reps = append(reps, rep)
+	}
+	if total := streams.Time[n-1] - streams.Time[0]; total <= 0 || float64(workTime)/float64(total) > intervalMaxWorkShare {
+		return structure
+	}
+
+	structure.Sets = groupIntervals(reps)
+	if len(structure.Sets) == 0 {
+		return structure
+	}
+	structure.Structured = true
+
+	labels := make([]string, len(structure.Sets))
+	for i, set := range structure.Sets {
+		labels[i] = set.Label
+	}
+	structure.Summary = strings.Join(labels, " + ")
+
+	first := structure.Sets[0].Intervals[0]
+	if first.Start > streams.Time[0] {
+		warmup := streamSegment(streams, 0, streamIndex(streams, first.Start))
+		structure.Warmup = &warmup
+	}
+	lastSet := structure.Sets[len(structure.Sets)-1]
+	last := lastSet.Intervals[len(lastSet.Intervals)-1]
+	if end := streamIndex(streams, last.Start+last.Duration); end < n-1 {
+		cooldown := streamSegment(streams, end, n)
+		structure.Cooldown = &cooldown
+	}
+	return structure
+}
+
+// smoothSpeeds returns the speed at every sample, from the velocity stream or
+// derived from distance, averaged over intervalSmoothSeconds either side.
+func smoothSpeeds(streams *Streams) []float64 {
+	n := streams.Len()
+	raw := streams.VelocitySmooth
+	if len(raw) != n {
+		raw = make([]float64, n)
+		for i := 1; i < n; i++ {
+			if dt := streams.Time[i] - streams.Time[i-1]; dt > 0 {
+				raw[i] = (streams.Distance[i] - streams.Distance[i-1]) / float64(dt)
+			}
+		}
+	}
+
+	smoothed := make([]float64, n)
+	lo, hi := 0, 0
+	var sum float64
+	for i := range smoothed {
+		for hi < n && streams.Time[hi] <= streams.Time[i]+intervalSmoothSeconds {
+			sum += raw[hi]
+			hi++
+		}
+		for streams.Time[lo] < streams.Time[i]-intervalSmoothSeconds {
+			sum -= raw[lo]
+			lo++
+		}
+		smoothed[i] = sum / float64(hi-lo)
+	}
+	return smoothed
+}
+
+// workSpeedThreshold splits the moving speeds into a slow and a fast cluster
+// (one-dimensional k-means) and returns the speed halfway between them. ok is
+// false when the clusters are too close for the run to have distinct efforts.
+func workSpeedThreshold(speeds []float64) (float64, bool) {
+	var moving []float64
+	for _, speed := range speeds {
+		if speed >= intervalMinSpeed {
+			moving = append(moving, speed)
+		}
+	}
+	if len(moving) < 2 {
+		return 0, false
+	}
+	sort.Float64s(moving)
+	slow, fast := moving[len(moving)/5], moving[len(moving)*9/10]
+
+	for i := 0; i < intervalSpeedIteration; i++ {
+		threshold := (slow + fast) / 2
+		var slowSum, fastSum float64
+		var slowCount, fastCount int
+		for _, speed := range moving {
+			if speed < threshold {
+				slowSum += speed
+				slowCount++
+			} else {
+				fastSum += speed
+				fastCount++
+			}
+		}
+		if slowCount == 0 || fastCount == 0 {
+			return 0, false
+		}
+		slow, fast = slowSum/float64(slowCount), fastSum/float64(fastCount)
+	}
+	if fast < slow*intervalMinSpeedRatio {
+		return 0, false
+	}
+	return (slow + fast) / 2, true
+}
+
+// workoutSpans splits the samples into alternating work and easy spans.
+// Brief easing off within a rep is folded into the rep, then efforts too short
+// to be a rep (strides, a surge up a hill) into the easy running around them.
+func workoutSpans(streams *Streams, speeds []float64, threshold float64) []workoutSpan {
+	n := streams.Len()
+	work := make([]bool, n)
+	for i, speed := range speeds {
+		work[i] = speed >= threshold
+	}
+
+	for _, pass := range []struct {
+		work    bool
+		minimum int
+	}{{false, intervalMinRecovery}, {true, intervalMinWork}} {
+		spans := splitSpans(work)
+		for i, span := range spans {
+			// Leading and trailing easy spans are the warmup and cooldown
+			inner := i > 0 && i < len(spans)-1
+			if span.work == pass.work && (pass.work || inner) &&
+				streamTime(streams, span.end)-streamTime(streams, span.start) < pass.minimum {
+				for j := span.start; j < span.end; j++ {
+					work[j] = !pass.work
+				}
+			}
+		}
+	}
+	return splitSpans(work)
+}
+
+// splitSpans returns the runs of equal values.
+func splitSpans(work []bool) []workoutSpan {
+	var spans []workoutSpan
+	for i := 0; i < len(work); {
+		j := i
+		for j < len(work) && work[j] == work[i] {
+			j++
+		}
+		spans = append(spans, workoutSpan{start: i, end: j, work: work[i]})
+		i = j
+	}
+	return spans
+}
+
+// streamTime returns the time at sample boundary i, where len is the end.
+func streamTime(streams *Streams, i int) int {
+	if i >= streams.Len() {
+		return streams.Time[streams.Len()-1]
+	}
+	return streams.Time[i]
+}
+
+// streamIndex returns the first sample at or after t seconds.
+func streamIndex(streams *Streams, t int) int {
+	return sort.SearchInts(streams.Time, t)
+}
+
+// streamSegment summarizes samples [start, end).
+func streamSegment(streams *Streams, start, end int) WorkoutSegment {
+	last := end
+	if last >= streams.Len() {
+		last = streams.Len() - 1
+	}
+	segment := WorkoutSegment{
+		Start:    streams.Time[start],
+		Duration: streams.Time[last] - streams.Time[start],
+		Distance: streams.Distance[last] - streams.Distance[start],
+	}
+	if segment.Distance > 0 {
+		segment.PaceSecondsPerKm = float64(segment.Duration) / segment.Distance * metersPerKm
+	}
+	if len(streams.Heartrate) == streams.Len() && end > start {
+		var sum float64
+		for _, hr := range streams.Heartrate[start:end] {
+			sum += hr
+			segment.MaxHeartrate = math.Max(segment.MaxHeartrate, hr)
+		}
+		segment.AverageHeartrate = sum / float64(end-start)
+	}
+	return segment
+}
+
+// groupIntervals groups consecutive similar reps into sets, keeping sets of
+// at least intervalMinReps reps.
+func groupIntervals(reps []Interval) []IntervalSet {
+	var sets []IntervalSet
+	for i := 0; i < len(reps); {
+		j := i + 1
+		for j < len(reps) && similarReps(reps[i], reps[j]) {
+			j++
+		}
+		if j-i >= intervalMinReps {
+			group := append([]Interval(nil), reps[i:j]...)
+			// The recovery after a set's last rep belongs between sets
+			group[len(group)-1].Recovery = 0
+			sets = append(sets, newIntervalSet(group))
+		}
+		i = j
+	}
+	return sets
+}
+
+// similarReps reports whether two reps are about as long, by distance or time.
+func similarReps(a, b Interval) bool {
+	return relativeDifference(a.Distance, b.Distance) <= intervalRepSimilarity ||
+		relativeDifference(float64(a.Duration), float64(b.Duration)) <= intervalRepSimilarity
+}
+
+func relativeDifference(a, b float64) float64 {
+	larger := math.Max(a, b)
+	if larger <= 0 {
+		return 0
+	}
+	return math.Abs(a-b) / larger
+}
+
+// newIntervalSet summarizes a group of similar reps. Reps whose distances vary
+// less than their durations were run over a distance (800m repeats), otherwise
+// over a time (3-minute efforts).
+func newIntervalSet(reps []Interval) IntervalSet {
+	set := IntervalSet{Reps: len(reps), Intervals: reps}
+
+	var distance, duration, hrSum float64
+	var hrCount int
+	distances := make([]float64, len(reps))
+	durations := make([]float64, len(reps))
+	var recoveries []float64
+	for i, rep := range reps {
+		distance += rep.Distance
+		duration += float64(rep.Duration)
+		distances[i] = rep.Distance
+		durations[i] = float64(rep.Duration)
+		if i < len(reps)-1 {
+			recoveries = append(recoveries, float64(rep.Recovery))
+		}
+		if rep.AverageHeartrate > 0 {
+			hrSum += rep.AverageHeartrate
+			hrCount++
+		}
+	}
+	if distance > 0 {
+		set.PaceSecondsPerKm = duration / distance * metersPerKm
+	}
+	if len(recoveries) > 0 {
+		set.Recovery = int(math.Round(median(recoveries)/intervalRecoveryRound)) * intervalRecoveryRound
+	}
+	if hrCount > 0 {
+		set.AverageHeartrate = hrSum / float64(hrCount)
+	}
+
+	var rep string
+	if coefficientOfVariation(distances) <= coefficientOfVariation(durations) {
+		set.Basis = RepDistance
+		set.RepLength = roundRepDistance(distance / float64(len(reps)))
+		rep = formatRepDistance(set.RepLength)
+	} else {
+		set.Basis = RepTime
+		set.RepLength = math.Round(duration/float64(len(reps))/intervalDurationRound) * intervalDurationRound
+		rep = formatClock(int(set.RepLength))
+	}
+	set.SessionType = fmt.Sprintf("%d×%s", set.Reps, rep)
+	set.Label = fmt.Sprintf("%s @ %s/km avg, %s rec", set.SessionType, formatPace(set.PaceSecondsPerKm), formatRecovery(set.Recovery))
+	return set
+}
+
+// coefficientOfVariation returns the standard deviation over the mean.
+func coefficientOfVariation(values []float64) float64 {
+	var mean float64
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	if mean == 0 {
+		return 0
+	}
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(variance/float64(len(values))) / mean
+}
+
+// roundRepDistance rounds a rep distance to what it was likely meant to be.
+func roundRepDistance(meters float64) float64 {
+	step := float64(intervalShortStep)
+	if meters >= intervalLongRep {
+		step = intervalLongStep
+	}
+	return math.Max(step, math.Round(meters/step)*step)
+}
+
+// formatRepDistance formats a rep distance as "800m" or "3km".
+func formatRepDistance(meters float64) string {
+	if meters < intervalLongRep {
+		return fmt.Sprintf("%.0fm", meters)
+	}
+	return fmt.Sprintf("%gkm", meters/metersPerKm)
+}
+
+// formatClock formats seconds as "3:00" or "1:05:00".
+func formatClock(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// formatRecovery formats a recovery as "90s", or "2:30" from two minutes.
+func formatRecovery(seconds int) string {
+	if seconds < 120 {
+		return fmt.Sprintf("%ds", seconds)
+	}
+	return formatClock(seconds)
+}
+
+// IsWorkoutCandidate reports whether a run is worth checking for intervals:
+// runs tagged as workouts on Strava, or any run when allRuns is set.
+func IsWorkoutCandidate(activity NormalizedActivity, allRuns bool) bool {
+	if !IsRunningActivity(activity.SportType) {
+		return false
+	}
+	return allRuns || (activity.WorkoutType != nil && *activity.WorkoutType == workoutWorkout)
+}
+
+// WorkoutCandidates returns the newest workout candidates (see
+// IsWorkoutCandidate), at most limit of them, newest first.
+func WorkoutCandidates(activities []NormalizedActivity, allRuns bool, limit int) []NormalizedActivity {
+	var candidates []NormalizedActivity
+	for _, activity := range activities {
+		if IsWorkoutCandidate(activity, allRuns) {
+			candidates = append(candidates, activity)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].StartDate.After(candidates[j].StartDate)
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
+
+// WorkoutRun is the structure detected in one run.
+type WorkoutRun struct {
+	ID        int64            `json:"id"`
+	Name      string           `json:"name"`
+	Date      string           `json:"date"` // YYYY-MM-DD
+	Structure WorkoutStructure `json:"structure"`
+}
+
+// SessionRun is one time a session type was run.
+type SessionRun struct {
+	ID               int64   `json:"id"`
+	Name             string  `json:"name"`
+	Date             string  `json:"date"` // YYYY-MM-DD
+	Label            string  `json:"label"`
+	PaceSecondsPerKm float64 `json:"pace_seconds_per_km"`
+	Recovery         int     `json:"recovery"` // in seconds
+	AverageHeartrate float64 `json:"average_heartrate,omitempty"`
+}
+
+// SessionProgress tracks how the same session type, such as 6×800m, improves.
+type SessionProgress struct {
+	SessionType string       `json:"session_type"`
+	Runs        []SessionRun `json:"runs"` // oldest first
+	// BestPaceSecondsPerKm is the fastest average rep pace
+	BestPaceSecondsPerKm float64 `json:"best_pace_seconds_per_km"`
+	// Improvement is how much faster the latest run's reps were than the first
+	// run's, in percent; negative when slower
+	Improvement float64 `json:"improvement"`
+	// PaceTrend fits rep pace against days since the first run; a negative
+	// slope means the session is getting faster
+	PaceTrend *Regression `json:"pace_trend,omitempty"`
+}
+
+// WorkoutAnalysis is the interval structure of workouts and how each session
+// type progressed.
+type WorkoutAnalysis struct {
+	Workouts []WorkoutRun      `json:"workouts"` // structured runs, newest first
+	Sessions []SessionProgress `json:"sessions"` // most often run first
+}
+
+// CalculateWorkoutProgress groups the interval sets of structured runs by
+// session type to track each one over time.
+func CalculateWorkoutProgress(runs []WorkoutRun) WorkoutAnalysis {
+	analysis := WorkoutAnalysis{Workouts: []WorkoutRun{}, Sessions: []SessionProgress{}}
+	sessions := make(map[string]*SessionProgress)
+	for _, run := range runs {
+		if !run.Structure.Structured {
+			continue
+		}
+		analysis.Workouts = append(analysis.Workouts, run)
+		for _, set := range run.Structure.Sets {
+			session, ok := sessions[set.SessionType]
+			if !ok {
+				session = &SessionProgress{SessionType: set.SessionType}
+				sessions[set.SessionType] = session
+			}
+			session.Runs = append(session.Runs, SessionRun{
+				ID:               run.ID,
+				Name:             run.Name,
+				Date:             run.Date,
+				Label:            set.Label,
+				PaceSecondsPerKm: set.PaceSecondsPerKm,
+				Recovery:         set.Recovery,
+				AverageHeartrate: set.AverageHeartrate,
+			})
+		}
+	}
+	sort.Slice(analysis.Workouts, func(i, j int) bool {
+		return analysis.Workouts[i].Date > analysis.Workouts[j].Date
+	})
+
+	for _, session := range sessions {
+		sort.Slice(session.Runs, func(i, j int) bool {
+			return session.Runs[i].Date < session.Runs[j].Date
+		})
+		first, _ := time.Parse("2006-01-02", session.Runs[0].Date)
+		var days, paces []float64
+		for _, run := range session.Runs {
+			if session.BestPaceSecondsPerKm == 0 || run.PaceSecondsPerKm < session.BestPaceSecondsPerKm {
+				session.BestPaceSecondsPerKm = run.PaceSecondsPerKm
+			}
+			date, _ := time.Parse("2006-01-02", run.Date)
+			days = append(days, date.Sub(first).Hours()/24)
+			paces = append(paces, run.PaceSecondsPerKm)
+		}
+		if len(session.Runs) >= 2 {
+			firstPace, latestPace := paces[0], paces[len(paces)-1]
+			session.Improvement = (firstPace - latestPace) / firstPace * 100
+			session.PaceTrend = LinearRegression(days, paces)
+		}
+		analysis.Sessions = append(analysis.Sessions, *session)
+	}
+	sort.Slice(analysis.Sessions, func(i, j int) bool {
+		a, b := analysis.Sessions[i], analysis.Sessions[j]
+		if len(a.Runs) != len(b.Runs) {
+			return len(a.Runs) > len(b.Runs)
+		}
+		return a.SessionType < b.SessionType
+	})
+	return analysis
+}
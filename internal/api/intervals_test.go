@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// streamBuilder records 1 Hz samples of a synthetic run.
+type streamBuilder struct {
+	streams  Streams
+	distance float64
+}
+
+// run adds seconds of running at speed (m/s) and heartrate.
+func (b *streamBuilder) run(seconds int, speed, heartrate float64) *streamBuilder {
+	for i := 0; i < seconds; i++ {
+		b.streams.Time = append(b.streams.Time, len(b.streams.Time))
+		b.streams.Distance = append(b.streams.Distance, b.distance)
+		b.streams.VelocitySmooth = append(b.streams.VelocitySmooth, speed)
+		b.streams.Heartrate = append(b.streams.Heartrate, heartrate)
+		b.distance += speed
+	}
+	return b
+}
+
+// intervalSession builds a warmup, reps of repMeters at repSpeed with
+// recovery seconds of jogging between them, and a cooldown.
+func intervalSession(reps int, repMeters, repSpeed float64, recovery int) *Streams {
+	b := &streamBuilder{}
+	b.run(600, 3, 130)
+	for i := 0; i < reps; i++ {
+		b.run(int(math.Round(repMeters/repSpeed)), repSpeed, 170)
+		if i < reps-1 {
+			b.run(recovery, 2, 140)
+		}
+	}
+	b.run(600, 3, 135)
+	return &b.streams
+}
+
+func TestDetectWorkout(t *testing.T) {
+	// 800m in 148s is 3:05/km
+	structure := DetectWorkout(intervalSession(6, 800, 800.0/148, 90))
+
+	if !structure.Structured || len(structure.Sets) != 1 {
+		t.Fatalf("Expected one interval set, got %+v", structure)
+	}
+	set := structure.Sets[0]
+	if set.Reps != 6 || set.Basis != RepDistance || set.RepLength != 800 {
+		t.Errorf("Expected 6 reps of 800m, got %d reps of %v (%s)", set.Reps, set.RepLength, set.Basis)
+	}
+	if set.Label != "6×800m @ 3:05/km avg, 90s rec" {
+		t.Errorf("Unexpected label %q", set.Label)
+	}
+	if set.SessionType != "6×800m" || structure.Summary != set.Label {
+		t.Errorf("Unexpected session type %q or summary %q", set.SessionType, structure.Summary)
+	}
+	if set.AverageHeartrate < 165 || set.AverageHeartrate > 170 {
+		t.Errorf("Expected rep heartrate near 170, got %.1f", set.AverageHeartrate)
+	}
+	if last := set.Intervals[len(set.Intervals)-1]; last.Recovery != 0 {
+		t.Errorf("Expected no recovery after the last rep, got %d", last.Recovery)
+	}
+
+	if structure.Warmup == nil || math.Abs(float64(structure.Warmup.Duration-600)) > 10 {
+		t.Errorf("Expected a 10-minute warmup, got %+v", structure.Warmup)
+	}
+	if structure.Cooldown == nil || math.Abs(float64(structure.Cooldown.Duration-600)) > 10 {
+		t.Errorf("Expected a 10-minute cooldown, got %+v", structure.Cooldown)
+	}
+}
+
+func TestDetectWorkoutTimedReps(t *testing.T) {
+	// 3-minute efforts on a hilly route cover different distances
+	b := &streamBuilder{}
+	b.run(600, 3, 130)
+	for i, speed := range []float64{4.2, 5.0, 4.4, 4.8} {
+		b.run(180, speed, 168)
+		if i < 3 {
+			b.run(120, 2.2, 140)
+		}
+	}
+	b.run(300, 3, 135)
+
+	structure := DetectWorkout(&b.streams)
+	if len(structure.Sets) != 1 {
+		t.Fatalf("Expected one interval set, got %+v", structure)
+	}
+	set := structure.Sets[0]
+	if set.Basis != RepTime || set.SessionType != "4×3:00" {
+		t.Errorf("Expected 4×3:00 by time, got %s by %s", set.SessionType, set.Basis)
+	}
+	// Smoothing blurs the edges of reps by a few seconds
+	if set.Recovery < 110 || set.Recovery > 130 {
+		t.Errorf("Expected about 2:00 recoveries, got %d", set.Recovery)
+	}
+}
+
+func TestDetectWorkoutSteadyRun(t *testing.T) {
+	b := &streamBuilder{}
+	b.run(1800, 3.3, 150)
+	// A single surge is not a set
+	b.run(60, 4.5, 160)
+	b.run(1200, 3.3, 150)
+
+	structure := DetectWorkout(&b.streams)
+	if structure.Structured || len(structure.Sets) != 0 || structure.Summary != "" {
+		t.Errorf("Expected no structure, got %+v", structure)
+	}
+	if DetectWorkout(&Streams{}).Structured {
+		t.Error("Expected no structure without streams")
+	}
+}
+
+func TestDetectWorkoutWithoutVelocity(t *testing.T) {
+	streams := intervalSession(5, 1000, 1000.0/200, 120)
+	streams.VelocitySmooth = nil
+	streams.Heartrate = nil
+
+	structure := DetectWorkout(streams)
+	if len(structure.Sets) != 1 || structure.Sets[0].SessionType != "5×1000m" {
+		t.Fatalf("Expected 5×1000m from distance alone, got %+v", structure.Sets)
+	}
+	if structure.Sets[0].AverageHeartrate != 0 {
+		t.Errorf("Expected no heartrate, got %.1f", structure.Sets[0].AverageHeartrate)
+	}
+}
+
+func TestCalculateWorkoutProgress(t *testing.T) {
+	runs := []WorkoutRun{
+		{ID: 3, Name: "Track", Date: "2024-03-15", Structure: DetectWorkout(intervalSession(6, 800, 800.0/144, 90))},
+		{ID: 1, Name: "Track", Date: "2024-02-01", Structure: DetectWorkout(intervalSession(6, 800, 800.0/152, 90))},
+		{ID: 2, Name: "Tempo", Date: "2024-02-20", Structure: DetectWorkout(intervalSession(3, 2000, 2000.0/440, 120))},
+		{ID: 4, Name: "Easy", Date: "2024-03-10", Structure: WorkoutStructure{}},
+	}
+	analysis := CalculateWorkoutProgress(runs)
+
+	if len(analysis.Workouts) != 3 || analysis.Workouts[0].ID != 3 {
+		t.Fatalf("Expected 3 structured workouts, newest first, got %+v", analysis.Workouts)
+	}
+	if len(analysis.Sessions) != 2 {
+		t.Fatalf("Expected 2 session types, got %d", len(analysis.Sessions))
+	}
+	session := analysis.Sessions[0]
+	if session.SessionType != "6×800m" || len(session.Runs) != 2 || session.Runs[0].ID != 1 {
+		t.Fatalf("Expected 6×800m twice, oldest first, got %+v", session)
+	}
+	// 190 s/km to 180 s/km
+	if math.Abs(session.Improvement-100.0*8/152) > 0.5 {
+		t.Errorf("Expected about 5.3%% improvement, got %.2f", session.Improvement)
+	}
+	if session.PaceTrend == nil || session.PaceTrend.Slope >= 0 {
+		t.Errorf("Expected a falling pace trend, got %+v", session.PaceTrend)
+	}
+	if session.BestPaceSecondsPerKm != session.Runs[1].PaceSecondsPerKm {
+		t.Errorf("Expected the latest run to be the best, got %.1f", session.BestPaceSecondsPerKm)
+	}
+	if tempo := analysis.Sessions[1]; tempo.SessionType != "3×2km" || tempo.PaceTrend != nil {
+		t.Errorf("Expected a single 3×2km session, got %+v", tempo)
+	}
+}
+
+func TestWorkoutCandidates(t *testing.T) {
+	workout := workoutWorkout
+	tagged := rollupActivity(1, "Run", "2024-03-01", 8000, 2400)
+	tagged.WorkoutType = &workout
+	untagged := rollupActivity(2, "Run", "2024-03-02", 8000, 2400)
+	ride := rollupActivity(3, "Ride", "2024-03-03", 30000, 3600)
+	ride.WorkoutType = &workout
+	activities := []NormalizedActivity{tagged, untagged, ride}
+
+	if got := WorkoutCandidates(activities, false, 10); len(got) != 1 || got[0].ID != 1 {
+		t.Errorf("Expected only the tagged run, got %+v", got)
+	}
+	if got := WorkoutCandidates(activities, true, 10); len(got) != 2 || got[0].ID != 2 {
+		t.Errorf("Expected both runs newest first, got %+v", got)
+	}
+	if got := WorkoutCandidates(activities, true, 1); len(got) != 1 {
+		t.Errorf("Expected the limit to apply, got %d", len(got))
+	}
+}
+
+func TestFetchActivityStreams(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/activities/42/streams" || r.URL.Query().Get("key_by_type") != "true" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{
+			"time": {"data": [0, 1, 2], "series_type": "distance", "resolution": "high"},
+			"distance": {"data": [0, 3.1, 6.3]},
+			"heartrate": {"data": [120, 122, 125]},
+			"moving": {"data": [true, true, false]}
+		}`))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, &oauth2.Config{})
+
+	streams, err := client.FetchActivityStreams(context.Background(), &oauth2.Token{AccessToken: "token"}, 42)
+	if err != nil {
+		t.Fatalf("FetchActivityStreams failed: %v", err)
+	}
+	if streams.Len() != 3 || streams.Distance[2] != 6.3 || streams.Heartrate[1] != 122 || streams.Moving[2] {
+		t.Errorf("Unexpected streams %+v", streams)
+	}
+	if streams.VelocitySmooth != nil || streams.Watts != nil {
+		t.Errorf("Expected missing streams to be nil, got %+v", streams)
+	}
+}
@@ -27,6 +27,28 @@ type NormalizeOptions struct {
 	DaysBack  int       // Number of days to look back (default: 7) - used if StartDate/EndDate not set
 	StartDate time.Time // Start date for filtering (inclusive) - if set, overrides DaysBack
 	EndDate   time.Time // End date for filtering (inclusive) - if set, overrides DaysBack
+	Location  *time.Location // Athlete's home timezone, which decides "today" for DaysBack (default: server's local time)
+}
+
+// Bounds returns the inclusive date range (midnight UTC) selected by the options.
+// A nil receiver selects the default of the last 7 days.
+func (opts *NormalizeOptions) Bounds() (time.Time, time.Time) {
+	calendar := DefaultCalendar()
+	if opts != nil && opts.Location != nil {
+		calendar.Location = opts.Location
+	}
+	now := calendar.Today()
+	if opts != nil && !opts.StartDate.IsZero() && !opts.EndDate.IsZero() {
+		// Use explicit date range
+		return truncateToDate(opts.StartDate), truncateToDate(opts.EndDate)
+	}
+
+	// Use DaysBack (default behavior)
+	daysBack := 7
+	if opts != nil && opts.DaysBack > 0 {
+		daysBack = opts.DaysBack
+	}
+	return now.AddDate(0, 0, -daysBack), now
 }
 
 // NormalizeActivities normalizes a slice of activities:
@@ -34,32 +56,14 @@ type NormalizeOptions struct {
 // - Extracts local date for grouping
 // - Standardizes units (metric base with imperial conversions)
 func NormalizeActivities(activities []Activity, opts *NormalizeOptions) []NormalizedActivity {
-	if opts == nil {
-		opts = &NormalizeOptions{DaysBack: 7}
-	}
-
 	// Determine date range
-	var startDate, endDate time.Time
-	now := truncateToDate(time.Now())
-	
-	if !opts.StartDate.IsZero() && !opts.EndDate.IsZero() {
-		// Use explicit date range
-		startDate = truncateToDate(opts.StartDate)
-		endDate = truncateToDate(opts.EndDate)
-	} else {
-		// Use DaysBack (default behavior)
-		if opts.DaysBack <= 0 {
-			opts.DaysBack = 7
-		}
-		startDate = now.AddDate(0, 0, -opts.DaysBack)
-		endDate = now
-	}
+	startDate, endDate := opts.Bounds()
 
 		var normalized []NormalizedActivity
 		for _, activity := range activities {
 			// Extract local date from start_date_local
 			// Use the timezone from the activity if available to ensure correct date extraction
-			localDate := extractLocalDate(activity.StartDateLocal, activity.Timezone)
+			localDate := activityLocalDate(activity)
 			localDateTruncated := truncateToDate(localDate)
 			localDateStr := localDateTruncated.Format("2006-01-02")
 			
@@ -89,6 +93,11 @@ func NormalizeActivities(activities []Activity, opts *NormalizeOptions) []Normal
 	return normalized
 }
 
+// NormalizeActivity normalizes a single activity without any date filtering.
+func NormalizeActivity(activity Activity) NormalizedActivity {
+	return normalizeActivity(activity, activityLocalDate(activity))
+}
+
 // normalizeActivity normalizes a single activity.
 func normalizeActivity(activity Activity, localDate time.Time) NormalizedActivity {
 	norm := NormalizedActivity{
@@ -118,16 +127,31 @@ func normalizeActivity(activity Activity, localDate time.Time) NormalizedActivit
 	return norm
 }
 
-// extractLocalDate extracts the local date from a time, using the timezone if provided.
+// activityLocalDate returns the calendar date an activity happened on, in the
+// timezone it was recorded in. An activity recorded while traveling keeps the
+// date where it happened, not the date back home.
+//
+// When Strava's timezone is available, the UTC start time is converted with it,
+// which also accounts for DST. Otherwise the date is read from start_date_local.
+func activityLocalDate(activity Activity) time.Time {
+	if !activity.StartDate.IsZero() {
+		if loc := activityLocation(activity.Timezone); loc != nil {
+			year, month, day := activity.StartDate.In(loc).Date()
+			return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		}
+	}
+	return extractLocalDate(activity.StartDateLocal)
+}
+
+// extractLocalDate extracts the local date from start_date_local.
 // The key insight: start_date_local from Strava is the local time, but when Go's JSON
 // unmarshaler parses it, it might interpret it as UTC. However, the date components
 // (year, month, day) in the original string are the local date we want.
 // 
 // The solution: Extract date components from the time as if it represents local time.
-// If the timezone is provided, we can use it to properly interpret the time.
-// Otherwise, we extract the date components directly, which works because the
+// We extract the date components directly, which works because the
 // date part of start_date_local is what we want regardless of timezone conversion.
-func extractLocalDate(t time.Time, timezone string) time.Time {
+func extractLocalDate(t time.Time) time.Time {
 	// CRITICAL: The user wants activities to be counted based on the day they occurred
 	// in the local timezone, independent of UTC conversion.
 	//
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Split classifications: how the second half compares to the first.
+const (
+	SplitNegative = "negative" // second half faster
+	SplitPositive = "positive" // second half slower
+	SplitEven     = "even"
+)
+
+// Pacing run kinds.
+const (
+	PacingRace    = "race"
+	PacingLongRun = "long_run"
+)
+
+// Strava workout types of runs.
+const (
+	workoutRace    = 1
+	workoutLongRun = 2
+	workoutWorkout = 3
+)
+
+// evenSplitTolerance is how close (as a share of the first half's pace) the
+// halves must be for an even split.
+const evenSplitTolerance = 0.01
+
+// PaceSegment is a stretch of an activity, such as a split or a lap.
+type PaceSegment struct {
+	Distance   float64 // in meters
+	MovingTime int     // in seconds
+}
+
+// Pacing describes how evenly an activity was paced.
+type Pacing struct {
+	Source   string `json:"source"` // "splits" or "laps"
+	Segments int    `json:"segments"`
+	// Paces are in seconds per kilometer
+	PaceSecondsPerKm           float64 `json:"pace_seconds_per_km"`
+	FirstHalfPaceSecondsPerKm  float64 `json:"first_half_pace_seconds_per_km"`
+	SecondHalfPaceSecondsPerKm float64 `json:"second_half_pace_seconds_per_km"`
+	SplitType                  string  `json:"split_type"` // one of the Split constants
+	// SplitDifference is how much slower the second half was than the first, in
+	// percent; negative for a negative split
+	SplitDifference float64 `json:"split_difference"`
+	// PaceCV is the coefficient of variation of the segment paces, in percent
+	PaceCV float64 `json:"pace_cv"`
+	// FadePercent is how much slower the final quarter was than the average
+	// pace, in percent; negative for a fast finish
+	FadePercent float64 `json:"fade_percent"`
+}
+
+// SplitSegments returns the segments of per-kilometer or per-mile splits.
+func SplitSegments(splits []Split) []PaceSegment {
+	segments := make([]PaceSegment, 0, len(splits))
+	for _, split := range splits {
+		segments = append(segments, PaceSegment{Distance: split.Distance, MovingTime: split.MovingTime})
+	}
+	return segments
+}
+
+// LapSegments returns the segments of laps.
+func LapSegments(laps []Lap) []PaceSegment {
+	segments := make([]PaceSegment, 0, len(laps))
+	for _, lap := range laps {
+		segments = append(segments, PaceSegment{Distance: lap.Distance, MovingTime: lap.MovingTime})
+	}
+	return segments
+}
+
+// AnalyzeActivityPacing analyzes the pacing of a detailed activity from its
+// per-kilometer splits, falling back to its laps. It returns nil if the activity
+// has fewer than two segments with distance.
+func AnalyzeActivityPacing(activity *DetailedActivity) *Pacing {
+	if pacing, ok := AnalyzePacing(SplitSegments(activity.SplitsMetric)); ok {
+		pacing.Source = "splits"
+		return &pacing
+	}
+	if pacing, ok := AnalyzePacing(LapSegments(activity.Laps)); ok {
+		pacing.Source = "laps"
+		return &pacing
+	}
+	return nil
+}
+
+// AnalyzePacing classifies the split and measures pace variation and fade of
+// consecutive segments. Halves and quarters are split by distance, assuming an
+// even pace within each segment. ok is false with fewer than two segments
+// with distance.
+func AnalyzePacing(segments []PaceSegment) (Pacing, bool) {
+	var pacing Pacing
+	var distance float64
+	var movingTime int
+	var paced []PaceSegment
+	for _, segment := range segments {
+		distance += segment.Distance
+		movingTime += segment.MovingTime
+		if segment.Distance > 0 && segment.MovingTime > 0 {
+			paced = append(paced, segment)
+		}
+	}
+	if len(paced) < 2 || distance <= 0 {
+		return pacing, false
+	}
+
+	pacing.Segments = len(segments)
+	total := float64(movingTime)
+	pacing.PaceSecondsPerKm = total / distance * metersPerKm
+
+	half := segmentTimeAt(segments, distance/2)
+	pacing.FirstHalfPaceSecondsPerKm = half / (distance / 2) * metersPerKm
+	pacing.SecondHalfPaceSecondsPerKm = (total - half) / (distance / 2) * metersPerKm
+	pacing.SplitDifference = (pacing.SecondHalfPaceSecondsPerKm/pacing.FirstHalfPaceSecondsPerKm - 1) * 100
+	switch {
+	case pacing.SplitDifference < -evenSplitTolerance*100:
+		pacing.SplitType = SplitNegative
+	case pacing.SplitDifference > evenSplitTolerance*100:
+		pacing.SplitType = SplitPositive
+	default:
+		pacing.SplitType = SplitEven
+	}
+
+	lastQuarter := (total - segmentTimeAt(segments, distance*0.75)) / (distance / 4) * metersPerKm
+	pacing.FadePercent = (lastQuarter/pacing.PaceSecondsPerKm - 1) * 100
+
+	pacing.PaceCV = segmentPaceCV(paced)
+	return pacing, true
+}
+
+// segmentTimeAt returns the moving time at the given distance into the
+// segments, interpolating within the segment it falls in.
+func segmentTimeAt(segments []PaceSegment, distance float64) float64 {
+	var covered, elapsed float64
+	for _, segment := range segments {
+		if segment.Distance > 0 && covered+segment.Distance >= distance {
+			return elapsed + float64(segment.MovingTime)*(distance-covered)/segment.Distance
+		}
+		covered += segment.Distance
+		elapsed += float64(segment.MovingTime)
+	}
+	return elapsed
+}
+
+// segmentPaceCV returns the coefficient of variation (percent) of segment paces.
+// Segments under half the usual length, like the last partial kilometer, are
+// left out as their pace is noisy.
+func segmentPaceCV(segments []PaceSegment) float64 {
+	lengths := make([]float64, len(segments))
+	for i, segment := range segments {
+		lengths[i] = segment.Distance
+	}
+	minLength := median(lengths) / 2
+
+	var paces []float64
+	for _, segment := range segments {
+		if segment.Distance >= minLength {
+			paces = append(paces, float64(segment.MovingTime)/segment.Distance)
+		}
+	}
+	if len(paces) < 2 {
+		return 0
+	}
+	var mean float64
+	for _, pace := range paces {
+		mean += pace
+	}
+	mean /= float64(len(paces))
+	var variance float64
+	for _, pace := range paces {
+		variance += (pace - mean) * (pace - mean)
+	}
+	variance /= float64(len(paces))
+	return math.Sqrt(variance) / mean * 100
+}
+
+// PacingKind returns whether a run is a race or a long run for pacing
+// consistency, or "" for neither. Runs marked as races or long runs on Strava
+// count, as does any run of at least longRunMeters.
+func PacingKind(activity NormalizedActivity, longRunMeters float64) string {
+	if !IsRunningActivity(activity.SportType) {
+		return ""
+	}
+	if activity.WorkoutType != nil && *activity.WorkoutType == workoutRace {
+		return PacingRace
+	}
+	if (activity.WorkoutType != nil && *activity.WorkoutType == workoutLongRun) || activity.Distance >= longRunMeters {
+		return PacingLongRun
+	}
+	return ""
+}
+
+// PacingCandidates returns the newest races and long runs (see PacingKind), at
+// most limit of them, newest first.
+func PacingCandidates(activities []NormalizedActivity, longRunMeters float64, limit int) []NormalizedActivity {
+	var candidates []NormalizedActivity
+	for _, activity := range activities {
+		if PacingKind(activity, longRunMeters) != "" {
+			candidates = append(candidates, activity)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].StartDate.After(candidates[j].StartDate)
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
+
+// PacingRun is the pacing of one race or long run.
+type PacingRun struct {
+	ID       int64   `json:"id"`
+	Name     string  `json:"name"`
+	Date     string  `json:"date"`     // YYYY-MM-DD
+	Kind     string  `json:"kind"`     // PacingRace or PacingLongRun
+	Distance float64 `json:"distance"` // in meters
+	Pacing   Pacing  `json:"pacing"`
+}
+
+// PacingConsistency aggregates pacing over races and long runs, to show
+// whether an athlete is learning to pace.
+type PacingConsistency struct {
+	Runs           []PacingRun `json:"runs"` // oldest first
+	NegativeSplits int         `json:"negative_splits"`
+	EvenSplits     int         `json:"even_splits"`
+	PositiveSplits int         `json:"positive_splits"`
+	AveragePaceCV  float64     `json:"average_pace_cv"`
+	AverageFade    float64     `json:"average_fade_percent"`
+	// CVTrend fits pace CV against days since the first run; a negative slope
+	// means pacing is getting more even
+	CVTrend *Regression `json:"cv_trend,omitempty"`
+	// FadeTrend fits fade against days since the first run
+	FadeTrend *Regression `json:"fade_trend,omitempty"`
+}
+
+// CalculatePacingConsistency aggregates the pacing of races and long runs.
+func CalculatePacingConsistency(runs []PacingRun) PacingConsistency {
+	result := PacingConsistency{Runs: append([]PacingRun{}, runs...)}
+	sort.Slice(result.Runs, func(i, j int) bool {
+		return result.Runs[i].Date < result.Runs[j].Date
+	})
+	if len(result.Runs) == 0 {
+		return result
+	}
+
+	first, _ := time.Parse("2006-01-02", result.Runs[0].Date)
+	var days, cvs, fades []float64
+	for _, run := range result.Runs {
+		switch run.Pacing.SplitType {
+		case SplitNegative:
+			result.NegativeSplits++
+		case SplitEven:
+			result.EvenSplits++
+		case SplitPositive:
+			result.PositiveSplits++
+		}
+		result.AveragePaceCV += run.Pacing.PaceCV
+		result.AverageFade += run.Pacing.FadePercent
+
+		date, _ := time.Parse("2006-01-02", run.Date)
+		days = append(days, date.Sub(first).Hours()/24)
+		cvs = append(cvs, run.Pacing.PaceCV)
+		fades = append(fades, run.Pacing.FadePercent)
+	}
+	n := float64(len(result.Runs))
+	result.AveragePaceCV /= n
+	result.AverageFade /= n
+	if len(result.Runs) >= 3 {
+		result.CVTrend = LinearRegression(days, cvs)
+		result.FadeTrend = LinearRegression(days, fades)
+	}
+	return result
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"math"
+	"testing"
+)
+
+// kmSplits returns per-kilometer splits with the given paces (seconds).
+func kmSplits(paces ...int) []Split {
+	splits := make([]Split, len(paces))
+	for i, pace := range paces {
+		splits[i] = Split{Split: i + 1, Distance: 1000, MovingTime: pace}
+	}
+	return splits
+}
+
+func TestAnalyzePacing(t *testing.T) {
+	// 10K: 5 km at 5:00/km, then 5 km at 4:50/km
+	pacing, ok := AnalyzePacing(SplitSegments(kmSplits(300, 300, 300, 300, 300, 290, 290, 290, 290, 290)))
+	if !ok {
+		t.Fatal("Expected pacing")
+	}
+	if pacing.SplitType != SplitNegative || pacing.FirstHalfPaceSecondsPerKm != 300 || pacing.SecondHalfPaceSecondsPerKm != 290 {
+		t.Errorf("Expected a 5:00/4:50 negative split, got %+v", pacing)
+	}
+	if math.Abs(pacing.FadePercent-(290.0/295-1)*100) > 1e-9 {
+		t.Errorf("Expected a fast finish, got fade %f", pacing.FadePercent)
+	}
+	// Paces alternate evenly around 295: the CV is 5/295
+	if math.Abs(pacing.PaceCV-5.0/295*100) > 1e-9 {
+		t.Errorf("Unexpected pace CV %f", pacing.PaceCV)
+	}
+
+	// Blowing up: the last quarter is much slower, and the short final
+	// split doesn't count toward the CV
+	segments := SplitSegments(kmSplits(280, 280, 290, 330))
+	segments = append(segments, PaceSegment{Distance: 100, MovingTime: 60})
+	pacing, _ = AnalyzePacing(segments)
+	if pacing.SplitType != SplitPositive || pacing.FadePercent < 10 {
+		t.Errorf("Expected a positive split with a fade, got %+v", pacing)
+	}
+	if pacing.Segments != 5 {
+		t.Errorf("Expected 5 segments, got %d", pacing.Segments)
+	}
+
+	even, _ := AnalyzePacing(SplitSegments(kmSplits(300, 301, 300, 301)))
+	if even.SplitType != SplitEven {
+		t.Errorf("Expected an even split, got %s", even.SplitType)
+	}
+	if _, ok := AnalyzePacing(SplitSegments(kmSplits(300))); ok {
+		t.Error("Expected no pacing from a single split")
+	}
+}
+
+func TestAnalyzeActivityPacing_FallsBackToLaps(t *testing.T) {
+	activity := &DetailedActivity{Laps: []Lap{{Distance: 5000, MovingTime: 1500}, {Distance: 5000, MovingTime: 1450}}}
+	pacing := AnalyzeActivityPacing(activity)
+	if pacing == nil || pacing.Source != "laps" || pacing.SplitType != SplitNegative {
+		t.Errorf("Expected negative split from laps, got %+v", pacing)
+	}
+	if AnalyzeActivityPacing(&DetailedActivity{}) != nil {
+		t.Error("Expected no pacing without splits or laps")
+	}
+}
+
+func TestCalculatePacingConsistency(t *testing.T) {
+	run := func(date string, cv float64, split string) PacingRun {
+		return PacingRun{Date: date, Kind: PacingLongRun, Pacing: Pacing{PaceCV: cv, SplitType: split}}
+	}
+	consistency := CalculatePacingConsistency([]PacingRun{
+		run("2024-03-01", 2, SplitEven),
+		run("2024-01-01", 6, SplitPositive),
+		run("2024-02-01", 4, SplitNegative),
+	})
+	if consistency.Runs[0].Date != "2024-01-01" {
+		t.Errorf("Expected runs oldest first, got %+v", consistency.Runs)
+	}
+	if consistency.NegativeSplits != 1 || consistency.EvenSplits != 1 || consistency.PositiveSplits != 1 || consistency.AveragePaceCV != 4 {
+		t.Errorf("Unexpected consistency: %+v", consistency)
+	}
+	if consistency.CVTrend == nil || consistency.CVTrend.Slope >= 0 {
+		t.Errorf("Expected pacing to get more even, got %+v", consistency.CVTrend)
+	}
+}
+
+func TestPacingCandidates(t *testing.T) {
+	race, longRun := workoutRace, workoutLongRun
+	a := rollupActivity(1, "Run", "2024-11-01", 5000, 1200)
+	a.WorkoutType = &race
+	b := rollupActivity(2, "Run", "2024-11-02", 12000, 3600)
+	b.WorkoutType = &longRun
+	c := rollupActivity(3, "Run", "2024-11-03", 21100, 6300)
+	d := rollupActivity(4, "Run", "2024-11-04", 8000, 2400)
+	e := rollupActivity(5, "Ride", "2024-11-05", 80000, 10000)
+
+	candidates := PacingCandidates([]NormalizedActivity{a, b, c, d, e}, 18000, 2)
+	if len(candidates) != 2 || candidates[0].ID != 3 || candidates[1].ID != 2 {
+		t.Errorf("Expected the newest two races/long runs, got %+v", candidates)
+	}
+	if PacingKind(a, 18000) != PacingRace || PacingKind(c, 18000) != PacingLongRun || PacingKind(d, 18000) != "" {
+		t.Error("Unexpected pacing kinds")
+	}
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PatternCell is the volume of the activities in one pattern bucket.
+type PatternCell struct {
+	Count      int     `json:"count"`
+	MovingTime int     `json:"moving_time"` // in seconds
+	Distance   float64 `json:"distance"`    // in meters
+}
+
+func (c *PatternCell) add(activity NormalizedActivity) {
+	c.Count++
+	c.MovingTime += activity.MovingTime
+	c.Distance += activity.Distance
+}
+
+// PunchCard is a 7×24 matrix of activity volume by local start weekday
+// (0 = Sunday, as time.Weekday) and hour.
+type PunchCard [7][24]PatternCell
+
+// StartTimeBin counts activities starting in a half-hour slot.
+type StartTimeBin struct {
+	Time  string `json:"time"` // start of the slot, "HH:MM" local time
+	Count int    `json:"count"`
+}
+
+// WeekSplit compares weekday (Monday–Friday) and weekend volume.
+type WeekSplit struct {
+	Weekday PatternCell `json:"weekday"`
+	Weekend PatternCell `json:"weekend"`
+	// WeekendTimeShare is the weekend's share of moving time (0–1)
+	WeekendTimeShare float64 `json:"weekend_time_share"`
+}
+
+// TrainingSlot is a recurring time an athlete trains a sport, e.g. runs on
+// Monday, Wednesday and Friday between 6 and 8 AM.
+type TrainingSlot struct {
+	SportType string   `json:"sport_type"`
+	Weekdays  []string `json:"weekdays"`
+	StartHour int      `json:"start_hour"` // local hour the slot starts
+	EndHour   int      `json:"end_hour"`   // local hour the slot ends (exclusive)
+	Days      int      `json:"days"`       // days with an activity starting in the slot
+	// Regularity is the share of those weekdays in the range that had an
+	// activity in the slot (0–1)
+	Regularity float64 `json:"regularity"`
+	Label      string  `json:"label"` // e.g. "Run: Mon, Wed, Fri 06:00–08:00"
+}
+
+// TrainingPatterns describes when an athlete trains.
+type TrainingPatterns struct {
+	PunchCard  PunchCard             `json:"punch_card"` // all sports
+	Sports     map[string]*PunchCard `json:"sports"`     // per sport type
+	StartTimes []StartTimeBin        `json:"start_times"`
+	Split      WeekSplit             `json:"split"`
+	Slots      []TrainingSlot        `json:"slots"` // most regular first
+}
+
+// Usual slot detection settings.
+const (
+	slotHours         = 2    // width of a training slot
+	slotMinDays       = 3    // fewest days for a slot to count as usual
+	slotMinRegularity = 0.25 // fewest share of weekdays with an activity in the slot
+)
+
+// CalculateTrainingPatterns builds the punch card, start time distribution,
+// weekday/weekend split and usual training slots of the activities. Times are
+// local to where each activity was recorded (start_date_local). start and end
+// (YYYY-MM-DD) bound the range, which decides how many of each weekday there
+// were when measuring how regular a slot is; empty means the activities' range.
+func CalculateTrainingPatterns(activities []NormalizedActivity, start, end string) TrainingPatterns {
+	patterns := TrainingPatterns{
+		Sports:     make(map[string]*PunchCard),
+		StartTimes: make([]StartTimeBin, 48),
+		Slots:      []TrainingSlot{},
+	}
+	for i := range patterns.StartTimes {
+		patterns.StartTimes[i].Time = fmt.Sprintf("%02d:%02d", i/2, i%2*30)
+	}
+
+	// Hours (as a bitmask) each sport was started on each date, for slot detection
+	startHours := make(map[string]map[string]uint32) // sport -> date -> hours
+	first, last := start, end
+	for _, activity := range activities {
+		local := activity.StartDateLocal
+		weekday, hour := local.Weekday(), local.Hour()
+
+		patterns.PunchCard[weekday][hour].add(activity)
+		sport, ok := patterns.Sports[activity.SportType]
+		if !ok {
+			sport = &PunchCard{}
+			patterns.Sports[activity.SportType] = sport
+		}
+		sport[weekday][hour].add(activity)
+		patterns.StartTimes[hour*2+local.Minute()/30].Count++
+
+		if weekday == time.Saturday || weekday == time.Sunday {
+			patterns.Split.Weekend.add(activity)
+		} else {
+			patterns.Split.Weekday.add(activity)
+		}
+
+		date := local.Format("2006-01-02")
+		if startHours[activity.SportType] == nil {
+			startHours[activity.SportType] = make(map[string]uint32)
+		}
+		startHours[activity.SportType][date] |= 1 << uint(hour)
+		if start == "" && (first == "" || date < first) {
+			first = date
+		}
+		if end == "" && date > last {
+			last = date
+		}
+	}
+
+	if total := patterns.Split.Weekday.MovingTime + patterns.Split.Weekend.MovingTime; total > 0 {
+		patterns.Split.WeekendTimeShare = float64(patterns.Split.Weekend.MovingTime) / float64(total)
+	}
+	patterns.Slots = detectTrainingSlots(startHours, weekdayCounts(first, last))
+	return patterns
+}
+
+// weekdayCounts returns how many of each weekday fall between first and last (inclusive).
+func weekdayCounts(first, last string) [7]int {
+	var counts [7]int
+	from, err1 := time.Parse("2006-01-02", first)
+	to, err2 := time.Parse("2006-01-02", last)
+	if err1 != nil || err2 != nil {
+		return counts
+	}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		counts[d.Weekday()]++
+	}
+	return counts
+}
+
+// detectTrainingSlots finds, for every sport and weekday, the slotHours-wide
+// window with the most days of activity starts. Windows that are regular
+// enough are merged across weekdays with the same window.
+func detectTrainingSlots(startHours map[string]map[string]uint32, weekdays [7]int) []TrainingSlot {
+	type slotKey struct {
+		sport string
+		hour  int
+	}
+	slots := make(map[slotKey]*TrainingSlot)
+	possibleDays := make(map[slotKey]int)
+
+	for sport, dates := range startHours {
+		// Days per weekday with a start in each hour, and in each window from that hour
+		var hourDays, days [7][24]int
+		for date, hours := range dates {
+			t, err := time.Parse("2006-01-02", date)
+			if err != nil {
+				continue
+			}
+			for h := 0; h < 24; h++ {
+				if hours&(1<<uint(h)) != 0 {
+					hourDays[t.Weekday()][h]++
+				}
+			}
+			for h := 0; h+slotHours <= 24; h++ {
+				window := uint32(1<<slotHours-1) << uint(h)
+				if hours&window != 0 {
+					days[t.Weekday()][h]++
+				}
+			}
+		}
+
+		for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+			// Ties go to the window starting at the busier hour, so 6:30 starts
+			// make a 6–8 AM slot rather than 5–7 AM
+			best := 0
+			for h := 1; h+slotHours <= 24; h++ {
+				if days[weekday][h] > days[weekday][best] ||
+					days[weekday][h] == days[weekday][best] && hourDays[weekday][h] > hourDays[weekday][best] {
+					best = h
+				}
+			}
+			count := days[weekday][best]
+			if count < slotMinDays || weekdays[weekday] == 0 ||
+				float64(count)/float64(weekdays[weekday]) < slotMinRegularity {
+				continue
+			}
+
+			key := slotKey{sport, best}
+			slot, ok := slots[key]
+			if !ok {
+				slot = &TrainingSlot{SportType: sport, StartHour: best, EndHour: best + slotHours}
+				slots[key] = slot
+			}
+			slot.Weekdays = append(slot.Weekdays, weekday.String())
+			slot.Days += count
+			possibleDays[key] += weekdays[weekday]
+		}
+	}
+
+	result := make([]TrainingSlot, 0, len(slots))
+	for key, slot := range slots {
+		slot.Regularity = float64(slot.Days) / float64(possibleDays[key])
+		slot.Label = fmt.Sprintf("%s: %s %02d:00–%02d:00", slot.SportType, abbreviateWeekdays(slot.Weekdays), slot.StartHour, slot.EndHour)
+		result = append(result, *slot)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Days != result[j].Days {
+			return result[i].Days > result[j].Days
+		}
+		return result[i].Label < result[j].Label
+	})
+	return result
+}
+
+// abbreviateWeekdays formats weekdays as "Mon, Wed, Fri", or "Weekdays",
+// "Weekends" and "Every day" for the common groups.
+func abbreviateWeekdays(weekdays []string) string {
+	joined := ""
+	for i, day := range weekdays {
+		if i > 0 {
+			joined += ", "
+		}
+		joined += day[:3]
+	}
+	switch joined {
+	case "Mon, Tue, Wed, Thu, Fri":
+		return "Weekdays"
+	case "Sun, Sat":
+		return "Weekends"
+	case "Sun, Mon, Tue, Wed, Thu, Fri, Sat":
+		return "Every day"
+	}
+	return joined
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalculateTrainingPatterns(t *testing.T) {
+	var activities []NormalizedActivity
+	id := int64(1)
+	// Four weeks of 6:30 AM runs on Monday, Wednesday and Friday, Nov 4 - Dec 1
+	monday := time.Date(2024, 11, 4, 0, 0, 0, 0, time.UTC)
+	for week := 0; week < 4; week++ {
+		for _, offset := range []int{0, 2, 4} {
+			date := monday.AddDate(0, 0, 7*week+offset).Format("2006-01-02")
+			activities = append(activities, rollupActivity(id, "Run", date, 8000, 2400, startingAt("06:30:00")))
+			id++
+		}
+	}
+	// Two Saturday rides at 9 AM aren't regular enough for a slot
+	activities = append(activities,
+		rollupActivity(id, "Ride", "2024-11-09", 40000, 5400, startingAt("09:00:00")),
+		rollupActivity(id+1, "Ride", "2024-11-16", 40000, 5400, startingAt("09:15:00")),
+	)
+
+	patterns := CalculateTrainingPatterns(activities, "2024-11-04", "2024-12-01")
+
+	if cell := patterns.PunchCard[time.Monday][6]; cell.Count != 4 || cell.Distance != 32000 || cell.MovingTime != 9600 {
+		t.Errorf("Unexpected Monday 6 AM cell: %+v", cell)
+	}
+	if cell := patterns.Sports["Ride"][time.Saturday][9]; cell.Count != 2 {
+		t.Errorf("Unexpected Saturday 9 AM ride cell: %+v", cell)
+	}
+	if patterns.Sports["Run"][time.Saturday][9].Count != 0 {
+		t.Error("Rides should not appear on the running punch card")
+	}
+
+	if bin := patterns.StartTimes[13]; bin.Time != "06:30" || bin.Count != 12 {
+		t.Errorf("Unexpected 06:30 start time bin: %+v", bin)
+	}
+	if bin := patterns.StartTimes[18]; bin.Time != "09:00" || bin.Count != 2 {
+		t.Errorf("Unexpected 09:00 start time bin: %+v", bin)
+	}
+
+	split := patterns.Split
+	if split.Weekday.Count != 12 || split.Weekend.Count != 2 {
+		t.Errorf("Unexpected weekday/weekend split: %+v", split)
+	}
+	if expected := 10800.0 / (28800 + 10800); split.WeekendTimeShare != expected {
+		t.Errorf("Expected weekend share %f, got %f", expected, split.WeekendTimeShare)
+	}
+
+	if len(patterns.Slots) != 1 {
+		t.Fatalf("Expected one usual slot, got %+v", patterns.Slots)
+	}
+	slot := patterns.Slots[0]
+	if slot.SportType != "Run" || slot.Days != 12 || slot.Regularity != 1 || len(slot.Weekdays) != 3 {
+		t.Errorf("Unexpected slot: %+v", slot)
+	}
+	if slot.Label != "Run: Mon, Wed, Fri 06:00–08:00" {
+		t.Errorf("Unexpected slot label: %s", slot.Label)
+	}
+}
+
+func TestAbbreviateWeekdays(t *testing.T) {
+	tests := map[string][]string{
+		"Weekdays":  {"Monday", "Tuesday", "Wednesday", "Thursday", "Friday"},
+		"Weekends":  {"Sunday", "Saturday"},
+		"Tue, Thu":  {"Tuesday", "Thursday"},
+		"Every day": {"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+	}
+	for expected, weekdays := range tests {
+		if got := abbreviateWeekdays(weekdays); got != expected {
+			t.Errorf("abbreviateWeekdays(%v) = %s, want %s", weekdays, got, expected)
+		}
+	}
+}
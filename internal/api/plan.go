@@ -0,0 +1,104 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PlannedWorkout is a session of an athlete's training plan. A session can
+// target a distance, a duration or both.
+type PlannedWorkout struct {
+	ID        string  `json:"id"`   // unique within the plan (see validWorkoutID); assigned by NormalizePlan if empty
+	Date      string  `json:"date"` // YYYY-MM-DD
+	SportType string  `json:"sport_type"`
+	Title     string  `json:"title,omitempty"`
+	Distance  float64 `json:"distance,omitempty"`  // target, in meters
+	Duration  int     `json:"duration,omitempty"`  // target moving time, in seconds
+	Intensity string  `json:"intensity,omitempty"` // e.g. "easy" or "tempo"
+	Notes     string  `json:"notes,omitempty"`
+}
+
+// validWorkoutID matches the IDs a session can be given. IDs come from
+// imported files and end up in calendar feeds as event UIDs, so they are kept
+// to characters with no meaning there.
+var validWorkoutID = regexp.MustCompile(`^[A-Za-z0-9._:@+-]{1,128}$`)
+
+// Validate checks that the session has a date and sport, sensible targets and
+// a valid ID, if it has one.
+func (w PlannedWorkout) Validate() error {
+	if w.ID != "" && !validWorkoutID.MatchString(w.ID) {
+		return fmt.Errorf("invalid id %q: must be up to 128 letters, digits and . _ : @ + -", w.ID)
+	}
+	if _, err := time.Parse("2006-01-02", w.Date); err != nil {
+		return fmt.Errorf("invalid date %q: must be YYYY-MM-DD", w.Date)
+	}
+	if strings.TrimSpace(w.SportType) == "" {
+		return fmt.Errorf("missing sport_type on %s", w.Date)
+	}
+	if w.Distance < 0 {
+		return fmt.Errorf("invalid distance %g on %s: must not be negative", w.Distance, w.Date)
+	}
+	if w.Duration < 0 {
+		return fmt.Errorf("invalid duration %d on %s: must not be negative", w.Duration, w.Date)
+	}
+	return nil
+}
+
+// TrainingPlan is the planned sessions of an athlete.
+type TrainingPlan struct {
+	AthleteID int64            `json:"athlete_id"`
+	Workouts  []PlannedWorkout `json:"workouts"` // by date, then as given
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// NormalizePlan validates the sessions and returns them sorted by date. Sessions
+// without an ID get "<date>-<n>", numbering the sessions of a day from 1; IDs
+// must be unique.
+func NormalizePlan(workouts []PlannedWorkout) ([]PlannedWorkout, error) {
+	normalized := make([]PlannedWorkout, len(workouts))
+	for i, w := range workouts {
+		w.SportType = strings.TrimSpace(w.SportType)
+		w.Intensity = strings.ToLower(strings.TrimSpace(w.Intensity))
+		if err := w.Validate(); err != nil {
+			return nil, err
+		}
+		normalized[i] = w
+	}
+	sort.SliceStable(normalized, func(i, j int) bool { return normalized[i].Date < normalized[j].Date })
+
+	seen := make(map[string]bool)
+	for _, w := range normalized {
+		if w.ID != "" {
+			seen[w.ID] = true
+		}
+	}
+	perDay := make(map[string]int)
+	for i := range normalized {
+		w := &normalized[i]
+		if w.ID != "" {
+			continue
+		}
+		for {
+			perDay[w.Date]++
+			id := w.Date + "-" + strconv.Itoa(perDay[w.Date])
+			if !seen[id] {
+				w.ID = id
+				seen[id] = true
+				break
+			}
+		}
+	}
+
+	ids := make(map[string]bool, len(normalized))
+	for _, w := range normalized {
+		if ids[w.ID] {
+			return nil, fmt.Errorf("duplicate workout id %q", w.ID)
+		}
+		ids[w.ID] = true
+	}
+	return normalized, nil
+}
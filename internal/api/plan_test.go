@@ -0,0 +1,44 @@
+package api
+
+import "testing"
+
+func TestNormalizePlan(t *testing.T) {
+	plan, err := NormalizePlan([]PlannedWorkout{
+		{Date: "2024-03-06", SportType: "Run", Distance: 10000, Intensity: " Tempo "},
+		{Date: "2024-03-05", SportType: " Ride ", Duration: 3600},
+		{ID: "2024-03-06-1", Date: "2024-03-06", SportType: "Swim"},
+		{Date: "2024-03-06", SportType: "Run"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []struct{ id, sport string }{
+		{"2024-03-05-1", "Ride"},
+		{"2024-03-06-2", "Run"},
+		{"2024-03-06-1", "Swim"},
+		{"2024-03-06-3", "Run"},
+	}
+	for i, w := range want {
+		if plan[i].ID != w.id || plan[i].SportType != w.sport {
+			t.Errorf("Expected workout %d to be %s %s, got %s %s", i, w.id, w.sport, plan[i].ID, plan[i].SportType)
+		}
+	}
+	if plan[1].Intensity != "tempo" {
+		t.Errorf("Expected intensity to be normalized to 'tempo', got %q", plan[1].Intensity)
+	}
+
+	invalid := map[string][]PlannedWorkout{
+		"malformed date":    {{Date: "06/03/2024", SportType: "Run"}},
+		"missing sport":     {{Date: "2024-03-06"}},
+		"negative distance": {{Date: "2024-03-06", SportType: "Run", Distance: -1}},
+		"negative duration": {{Date: "2024-03-06", SportType: "Run", Duration: -60}},
+		"duplicate id":      {{ID: "a", Date: "2024-03-06", SportType: "Run"}, {ID: "a", Date: "2024-03-07", SportType: "Run"}},
+		"id with a newline": {{ID: "a\r\nBEGIN:VEVENT", Date: "2024-03-06", SportType: "Run"}},
+		"id with a space":   {{ID: "a b", Date: "2024-03-06", SportType: "Run"}},
+	}
+	for name, workouts := range invalid {
+		if _, err := NormalizePlan(workouts); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+}
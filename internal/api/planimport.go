@@ -0,0 +1,409 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sportAliases maps the names plans give sports, lowercased, to Strava sport
+// types. Strava's own names are included, so they keep their capitalization.
+var sportAliases = map[string]string{
+	"run": "Run", "running": "Run", "jog": "Run", "trailrun": "TrailRun", "trail run": "TrailRun",
+	"virtualrun": "VirtualRun", "treadmill": "VirtualRun",
+	"ride": "Ride", "bike": "Ride", "cycling": "Ride", "cycle": "Ride", "biking": "Ride",
+	"virtualride": "VirtualRide", "indoor ride": "VirtualRide", "trainer": "VirtualRide", "zwift": "VirtualRide",
+	"gravelride": "GravelRide", "mountainbikeride": "MountainBikeRide", "mtb": "MountainBikeRide", "ebikeride": "EBikeRide",
+	"swim": "Swim", "swimming": "Swim",
+	"walk": "Walk", "walking": "Walk", "hike": "Hike", "hiking": "Hike",
+	"weighttraining": "WeightTraining", "weight training": "WeightTraining", "strength": "WeightTraining",
+	"weights": "WeightTraining", "gym": "WeightTraining",
+	"workout": "Workout", "cross training": "Workout", "crossfit": "Crossfit",
+	"yoga": "Yoga", "rowing": "Rowing", "row": "Rowing",
+	"nordicski": "NordicSki", "alpineski": "AlpineSki", "backcountryski": "BackcountrySki",
+}
+
+// NormalizeSport returns the Strava sport type of a plan's sport name ("run",
+// "Cycling", "strength"), or the name as given if it isn't known.
+func NormalizeSport(name string) string {
+	name = strings.TrimSpace(name)
+	if sport, ok := sportAliases[strings.ToLower(name)]; ok {
+		return sport
+	}
+	return name
+}
+
+// KnownSport is like NormalizeSport, but reports false for unknown names.
+func KnownSport(name string) (string, bool) {
+	sport, ok := sportAliases[strings.ToLower(strings.TrimSpace(name))]
+	return sport, ok
+}
+
+// aliasesByLength are the sport aliases, longest first, so "trail run" is found
+// before "run".
+var aliasesByLength = func() []string {
+	aliases := make([]string, 0, len(sportAliases))
+	for alias := range sportAliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Slice(aliases, func(i, j int) bool {
+		if len(aliases[i]) != len(aliases[j]) {
+			return len(aliases[i]) > len(aliases[j])
+		}
+		return aliases[i] < aliases[j]
+	})
+	return aliases
+}()
+
+// wordsPattern splits free text into lowercase words.
+var wordsPattern = regexp.MustCompile(`[a-z0-9]+`)
+
+// DetectSport finds a sport named in free text, like "Easy run with strides",
+// or returns "" if there is none.
+func DetectSport(text string) string {
+	words := " " + strings.Join(wordsPattern.FindAllString(strings.ToLower(text), -1), " ") + " "
+	for _, alias := range aliasesByLength {
+		if strings.Contains(words, " "+alias+" ") {
+			return sportAliases[alias]
+		}
+	}
+	return ""
+}
+
+// Intensity levels of sessions, from easiest to hardest. Zero means unknown.
+const (
+	IntensityRecovery  = 1
+	IntensityEasy      = 2
+	IntensityModerate  = 3
+	IntensityThreshold = 4
+	IntensityMaximal   = 5
+)
+
+// intensityWords are the words plans describe intensity with.
+var intensityWords = map[string]int{
+	"recovery": IntensityRecovery, "rest": IntensityRecovery, "z1": IntensityRecovery,
+	"easy": IntensityEasy, "endurance": IntensityEasy, "aerobic": IntensityEasy, "base": IntensityEasy,
+	"long": IntensityEasy, "z2": IntensityEasy,
+	"moderate": IntensityModerate, "steady": IntensityModerate, "marathon": IntensityModerate,
+	"tempo": IntensityModerate, "z3": IntensityModerate,
+	"threshold": IntensityThreshold, "sweetspot": IntensityThreshold, "lt": IntensityThreshold,
+	"cruise": IntensityThreshold, "hard": IntensityThreshold, "z4": IntensityThreshold,
+	"interval": IntensityMaximal, "intervals": IntensityMaximal, "vo2": IntensityMaximal,
+	"vo2max": IntensityMaximal, "speed": IntensityMaximal, "race": IntensityMaximal,
+	"anaerobic": IntensityMaximal, "sprint": IntensityMaximal, "sprints": IntensityMaximal, "z5": IntensityMaximal,
+}
+
+// IntensityLevel returns the level of an intensity like "tempo", "Z4",
+// "zone 2" or "3", or 0 if it isn't recognized.
+func IntensityLevel(intensity string) int {
+	intensity = strings.ToLower(strings.TrimSpace(intensity))
+	intensity = strings.Join(strings.Fields(strings.TrimPrefix(intensity, "zone")), "")
+	if level, err := strconv.Atoi(intensity); err == nil && level >= IntensityRecovery && level <= IntensityMaximal {
+		return level
+	}
+	intensity = strings.NewReplacer(" ", "", "-", "", "_", "").Replace(intensity)
+	return intensityWords[intensity]
+}
+
+// DetectIntensity finds the first intensity word in free text, like "tempo"
+// in "Tempo run 3 x 10 min", or returns "".
+func DetectIntensity(text string) string {
+	for _, word := range wordsPattern.FindAllString(strings.ToLower(text), -1) {
+		if _, ok := intensityWords[word]; ok {
+			return word
+		}
+	}
+	return ""
+}
+
+// Distance units of plans, in meters.
+var distanceUnits = map[string]float64{
+	"km": 1000, "k": 1000, "kilometer": 1000, "kilometers": 1000, "kilometre": 1000, "kilometres": 1000,
+	"mi": 1609.34, "mile": 1609.34, "miles": 1609.34,
+	"m": 1, "meter": 1, "meters": 1, "metre": 1, "metres": 1,
+	"yd": 0.9144, "yard": 0.9144, "yards": 0.9144,
+}
+
+var distancePattern = regexp.MustCompile(`^([0-9]*\.?[0-9]+)\s*([a-z]*)$`)
+
+// ParsePlanDistance parses a distance like "10 km", "6.2mi" or "800 m" into
+// meters. Bare numbers are in defaultUnit ("km", "mi" or "m"); empty is 0.
+func ParsePlanDistance(s, defaultUnit string) (float64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	match := distancePattern.FindStringSubmatch(s)
+	if match == nil {
+		return 0, fmt.Errorf("invalid distance %q", s)
+	}
+	unit := match[2]
+	if unit == "" {
+		unit = defaultUnit
+	}
+	meters, ok := distanceUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid distance %q: unknown unit %q", s, unit)
+	}
+	value, _ := strconv.ParseFloat(match[1], 64)
+	return math.Round(value*meters*10) / 10, nil
+}
+
+var (
+	clockPattern    = regexp.MustCompile(`^(\d+):(\d{1,2})(?::(\d{1,2}))?$`)
+	isoDuration     = regexp.MustCompile(`^p(?:(\d+)d)?t?(?:(\d+(?:\.\d+)?)h)?(?:(\d+(?:\.\d+)?)m)?(?:(\d+(?:\.\d+)?)s)?$`)
+	unitDuration    = regexp.MustCompile(`^(?:(\d+(?:\.\d+)?)\s*(?:h|hr|hrs|hour|hours))?\s*(?:(\d+(?:\.\d+)?)\s*(?:m|min|mins|minute|minutes))?\s*(?:(\d+)\s*(?:s|sec|secs|seconds?))?$`)
+	bareNumber      = regexp.MustCompile(`^\d+(?:\.\d+)?$`)
+	textDistance    = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(km|k|kilometers?|kilometres?|mi|miles?|meters?|metres?|m|yd|yards?)\b`)
+	textDuration    = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(h|hr|hrs|hours?)\b(?:\s*(\d+)\s*(m|min|mins|minutes?)\b)?|(\d+(?:\.\d+)?)\s*(min|mins|minutes?|m)\b`)
+	textMinutesOnly = 100.0 // "45m" is minutes, "400m" meters
+)
+
+// ParsePlanDuration parses a duration like "1:15:00", "45:00" (minutes and
+// seconds), "1h30m", "90 min", "1.5 hours" or "PT45M" into seconds. Bare
+// numbers are minutes; empty is 0.
+func ParsePlanDuration(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	if bareNumber.MatchString(s) {
+		minutes, _ := strconv.ParseFloat(s, 64)
+		return int(math.Round(minutes * 60)), nil
+	}
+	if match := clockPattern.FindStringSubmatch(s); match != nil {
+		a, _ := strconv.Atoi(match[1])
+		b, _ := strconv.Atoi(match[2])
+		if match[3] == "" {
+			return a*60 + b, nil
+		}
+		c, _ := strconv.Atoi(match[3])
+		return a*3600 + b*60 + c, nil
+	}
+	var days, hours, minutes, seconds string
+	if match := isoDuration.FindStringSubmatch(s); match != nil && s != "p" && s != "pt" {
+		days, hours, minutes, seconds = match[1], match[2], match[3], match[4]
+	} else if match := unitDuration.FindStringSubmatch(s); match != nil {
+		hours, minutes, seconds = match[1], match[2], match[3]
+	} else {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	total := 0.0
+	for _, part := range []struct {
+		value string
+		unit  float64
+	}{{days, 86400}, {hours, 3600}, {minutes, 60}, {seconds, 1}} {
+		if part.value != "" {
+			v, _ := strconv.ParseFloat(part.value, 64)
+			total += v * part.unit
+		}
+	}
+	return int(math.Round(total)), nil
+}
+
+// repeatPattern ends text that repeats what follows, like "6 x " in
+// "6 x 400m": a repetition's length isn't the session's target.
+var repeatPattern = regexp.MustCompile(`\d\s*[x×*]\s*$`)
+
+// FindDistance finds the first distance with a unit in free text, like
+// "10 km" in "Long run 10 km easy", in meters. A number of meters needs to be
+// at least 100, since "45m" is more likely minutes; repetitions are skipped.
+func FindDistance(text string) float64 {
+	text = strings.ToLower(text)
+	for _, match := range textDistance.FindAllStringSubmatchIndex(text, -1) {
+		value, _ := strconv.ParseFloat(text[match[2]:match[3]], 64)
+		unit := text[match[4]:match[5]]
+		if unit == "m" && value < textMinutesOnly || repeatPattern.MatchString(text[:match[0]]) {
+			continue
+		}
+		return math.Round(value*distanceUnits[unit]*10) / 10
+	}
+	return 0
+}
+
+// FindDuration finds the first duration in free text, like "1h 30m" or
+// "45 min", in seconds. Minutes written "m" must be below 100 (see
+// FindDistance); repetitions are skipped.
+func FindDuration(text string) int {
+	text = strings.ToLower(text)
+	for _, match := range textDuration.FindAllStringSubmatchIndex(text, -1) {
+		if repeatPattern.MatchString(text[:match[0]]) {
+			continue
+		}
+		group := func(i int) string {
+			if match[2*i] < 0 {
+				return ""
+			}
+			return text[match[2*i]:match[2*i+1]]
+		}
+		if group(1) != "" {
+			hours, _ := strconv.ParseFloat(group(1), 64)
+			minutes, _ := strconv.ParseFloat(group(3), 64)
+			return int(math.Round(hours*3600 + minutes*60))
+		}
+		minutes, _ := strconv.ParseFloat(group(5), 64)
+		if group(6) == "m" && minutes >= textMinutesOnly {
+			continue
+		}
+		return int(math.Round(minutes * 60))
+	}
+	return 0
+}
+
+// planColumns maps CSV header names, normalized to lowercase words joined by
+// underscores, to workout fields.
+var planColumns = map[string]string{
+	"date": "date", "day": "date",
+	"sport": "sport", "sport_type": "sport", "type": "sport", "activity": "sport", "discipline": "sport",
+	"title": "title", "name": "title", "workout": "title", "session": "title",
+	"distance": "distance", "target_distance": "distance",
+	"distance_km": "distance_km", "distance_mi": "distance_mi", "distance_miles": "distance_mi",
+	"distance_m": "distance_m", "distance_meters": "distance_m",
+	"duration": "duration", "time": "duration", "target_duration": "duration", "target_time": "duration",
+	"duration_min": "duration", "duration_minutes": "duration",
+	"intensity": "intensity", "effort": "intensity", "zone": "intensity",
+	"notes": "notes", "description": "notes", "details": "notes",
+	"id": "id",
+}
+
+var headerWords = regexp.MustCompile(`[a-z0-9]+`)
+
+// ParsePlanCSV reads a plan from CSV with a header row. Columns are matched by
+// name: date (YYYY-MM-DD), sport, title, distance, duration, intensity and
+// notes, plus a few synonyms like "type" or "time". Distances may carry a
+// unit ("10 km"); bare numbers are in kilometers if metric and miles
+// otherwise, or the unit of a "distance_km", "distance_mi" or "distance_m"
+// column. Durations are read by ParsePlanDuration.
+func ParsePlanCSV(r io.Reader, metric bool) ([]PlannedWorkout, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty plan")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.Join(headerWords.FindAllString(strings.ToLower(strings.TrimPrefix(name, "\ufeff")), -1), "_")
+		if field, ok := planColumns[name]; ok {
+			if _, dup := columns[field]; !dup {
+				columns[field] = i
+			}
+		}
+	}
+	if _, ok := columns["date"]; !ok {
+		return nil, fmt.Errorf("invalid CSV: no date column")
+	}
+	if _, ok := columns["sport"]; !ok {
+		return nil, fmt.Errorf("invalid CSV: no sport column")
+	}
+	distanceUnit := "mi"
+	if metric {
+		distanceUnit = "km"
+	}
+	distanceColumn := "distance"
+	for _, c := range []struct{ column, unit string }{{"distance_km", "km"}, {"distance_mi", "mi"}, {"distance_m", "m"}} {
+		if _, ok := columns[c.column]; ok {
+			if _, ok := columns["distance"]; !ok {
+				distanceColumn, distanceUnit = c.column, c.unit
+			}
+		}
+	}
+
+	var workouts []PlannedWorkout
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		get := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+		w := PlannedWorkout{
+			ID:        get("id"),
+			Date:      get("date"),
+			SportType: NormalizeSport(get("sport")),
+			Title:     get("title"),
+			Intensity: get("intensity"),
+			Notes:     get("notes"),
+		}
+		if w.Distance, err = ParsePlanDistance(get(distanceColumn), distanceUnit); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if w.Duration, err = ParsePlanDuration(get("duration")); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := w.Validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		workouts = append(workouts, w)
+	}
+	return workouts, nil
+}
+
+// ParsePlanJSON reads a plan from JSON: either {"workouts": [...]} like the
+// plan API, or just the array of workouts. Sport names are normalized like
+// in CSV plans.
+func ParsePlanJSON(r io.Reader) ([]PlannedWorkout, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var workouts []PlannedWorkout
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(data, &workouts)
+	} else {
+		var plan struct {
+			Workouts []PlannedWorkout `json:"workouts"`
+		}
+		err = json.Unmarshal(data, &plan)
+		workouts = plan.Workouts
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	for i := range workouts {
+		workouts[i].SportType = NormalizeSport(workouts[i].SportType)
+	}
+	return workouts, nil
+}
+
+// MergePlan replaces the sessions of plan on the dates that imported has
+// sessions on, keeping the rest. The result still needs NormalizePlan.
+func MergePlan(plan, imported []PlannedWorkout) []PlannedWorkout {
+	dates := make(map[string]bool)
+	for _, w := range imported {
+		dates[w.Date] = true
+	}
+	merged := make([]PlannedWorkout, 0, len(plan)+len(imported))
+	for _, w := range plan {
+		if !dates[w.Date] {
+			merged = append(merged, w)
+		}
+	}
+	for _, w := range imported {
+		w.ID = "" // renumbered with the day's other sessions
+		merged = append(merged, w)
+	}
+	return merged
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePlanDistance(t *testing.T) {
+	tests := []struct {
+		input, unit string
+		want        float64
+	}{
+		{"10 km", "mi", 10000},
+		{"6.2mi", "km", 9977.9},
+		{"800 m", "km", 800},
+		{"5", "km", 5000},
+		{"5", "mi", 8046.7},
+		{"1500", "m", 1500},
+		{"", "km", 0},
+	}
+	for _, tt := range tests {
+		got, err := ParsePlanDistance(tt.input, tt.unit)
+		if err != nil || got != tt.want {
+			t.Errorf("Expected ParsePlanDistance(%q, %q) = %g, got %g (%v)", tt.input, tt.unit, tt.want, got, err)
+		}
+	}
+	for _, input := range []string{"ten km", "5 furlongs"} {
+		if _, err := ParsePlanDistance(input, "km"); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
+
+func TestParsePlanDuration(t *testing.T) {
+	tests := map[string]int{
+		"1:15:00":   4500,
+		"45:30":     2730,
+		"1h30m":     5400,
+		"1h 30 min": 5400,
+		"90 min":    5400,
+		"1.5 hours": 5400,
+		"PT45M":     2700,
+		"45":        2700,
+		"":          0,
+	}
+	for input, want := range tests {
+		got, err := ParsePlanDuration(input)
+		if err != nil || got != want {
+			t.Errorf("Expected ParsePlanDuration(%q) = %d, got %d (%v)", input, want, got, err)
+		}
+	}
+	if _, err := ParsePlanDuration("a while"); err == nil {
+		t.Error("Expected an error for an unparseable duration")
+	}
+}
+
+func TestFindInText(t *testing.T) {
+	if got := FindDistance("Long run 21.1 km easy"); got != 21100 {
+		t.Errorf("Expected 21100 m, got %g", got)
+	}
+	if got := FindDistance("Track 800 m warm-up, 6 x 400m"); got != 800 {
+		t.Errorf("Expected 800 m, got %g", got)
+	}
+	if got := FindDistance("6 x 400m with 45m warm-up"); got != 0 {
+		t.Errorf("Expected repetitions not to be the distance, got %g", got)
+	}
+	if got := FindDuration("6 x 400m with 45m warm-up"); got != 2700 {
+		t.Errorf("Expected 45 minutes, got %d s", got)
+	}
+	if got := FindDuration("Ride 1h 30min endurance"); got != 5400 {
+		t.Errorf("Expected 90 minutes, got %d s", got)
+	}
+	if got := DetectSport("Easy trail run with strides"); got != "TrailRun" {
+		t.Errorf("Expected TrailRun, got %q", got)
+	}
+	if got := DetectSport("Rest day"); got != "" {
+		t.Errorf("Expected no sport, got %q", got)
+	}
+	if got := DetectIntensity("Tempo run 3 x 10 min"); got != "tempo" {
+		t.Errorf("Expected tempo, got %q", got)
+	}
+}
+
+func TestIntensityLevel(t *testing.T) {
+	tests := map[string]int{
+		"easy": IntensityEasy, "Tempo": IntensityModerate, "Z4": IntensityThreshold,
+		"zone 2": IntensityEasy, "5": IntensityMaximal, "VO2max": IntensityMaximal,
+		"": 0, "whatever": 0, "7": 0,
+	}
+	for input, want := range tests {
+		if got := IntensityLevel(input); got != want {
+			t.Errorf("Expected IntensityLevel(%q) = %d, got %d", input, want, got)
+		}
+	}
+}
+
+func TestParsePlanCSV(t *testing.T) {
+	csv := "Date,Type,Workout,Distance,Time,Effort,Notes\n" +
+		"2024-03-04,running,Easy,8,,easy,\n" +
+		"2024-03-05,Bike,Endurance,,1:30:00,z2,\"flat, steady\"\n" +
+		"\n" +
+		"2024-03-06,Swim,Drills,1500 m,,,\n"
+	workouts, err := ParsePlanCSV(strings.NewReader(csv), true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(workouts) != 3 {
+		t.Fatalf("Expected 3 workouts, got %d", len(workouts))
+	}
+	run, ride, swim := workouts[0], workouts[1], workouts[2]
+	if run.SportType != "Run" || run.Distance != 8000 || run.Title != "Easy" || run.Intensity != "easy" {
+		t.Errorf("Unexpected run %+v", run)
+	}
+	if ride.SportType != "Ride" || ride.Duration != 5400 || ride.Notes != "flat, steady" {
+		t.Errorf("Unexpected ride %+v", ride)
+	}
+	if swim.Distance != 1500 {
+		t.Errorf("Expected 1500 m swim, got %g", swim.Distance)
+	}
+
+	miles, err := ParsePlanCSV(strings.NewReader("date,sport,distance_mi\n2024-03-04,Run,5\n"), true)
+	if err != nil || miles[0].Distance != 8046.7 {
+		t.Errorf("Expected a distance_mi column in miles, got %+v (%v)", miles, err)
+	}
+
+	_, err = ParsePlanCSV(strings.NewReader("date,sport\n2024-03-04,Run\n03/05/2024,Run\n"), true)
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Expected an error on line 3, got %v", err)
+	}
+	if _, err := ParsePlanCSV(strings.NewReader("when,sport\n"), true); err == nil {
+		t.Error("Expected an error without a date column")
+	}
+}
+
+func TestParsePlanJSON(t *testing.T) {
+	for _, input := range []string{
+		`[{"date": "2024-03-04", "sport_type": "run", "distance": 8000}]`,
+		`{"workouts": [{"date": "2024-03-04", "sport_type": "run", "distance": 8000}]}`,
+	} {
+		workouts, err := ParsePlanJSON(strings.NewReader(input))
+		if err != nil || len(workouts) != 1 || workouts[0].SportType != "Run" || workouts[0].Distance != 8000 {
+			t.Errorf("Unexpected workouts %+v (%v) from %s", workouts, err, input)
+		}
+	}
+	if _, err := ParsePlanJSON(strings.NewReader(`{"workouts": 3}`)); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+}
+
+func TestMergePlan(t *testing.T) {
+	plan := []PlannedWorkout{
+		{ID: "2024-03-04-1", Date: "2024-03-04", SportType: "Run"},
+		{ID: "2024-03-05-1", Date: "2024-03-05", SportType: "Run"},
+	}
+	merged, err := NormalizePlan(MergePlan(plan, []PlannedWorkout{{ID: "x", Date: "2024-03-05", SportType: "Ride"}}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(merged) != 2 || merged[0].SportType != "Run" || merged[1].SportType != "Ride" || merged[1].ID != "2024-03-05-1" {
+		t.Errorf("Expected the imported day to replace the planned one, got %+v", merged)
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import "math"
+
+// riegelExponent is the fatigue exponent of Riegel's formula
+// T2 = T1 * (D2/D1)^1.06: pace slows about 6% for each doubling of distance.
+const riegelExponent = 1.06
+
+// minPredictionEffort is the shortest run a race time is predicted from;
+// shorter runs are rarely raced and extrapolate badly.
+const minPredictionEffort = 3000.0
+
+// predictionRaces are the race distances times are predicted for.
+var predictionRaces = []struct {
+	name     string
+	distance float64 // in meters
+}{
+	{"5K", 5000},
+	{"10K", 10000},
+	{"Half Marathon", 21097.5},
+	{"Marathon", 42195},
+}
+
+// RacePredictionOptions contains options for predicting race times.
+type RacePredictionOptions struct {
+	GradeAdjusted bool              // Predict from grade-adjusted times, as if the runs had been on the flat
+	GradeFactors  map[int64]float64 // As in RunningStatsOptions
+}
+
+// RacePrediction is the predicted time of a race distance, with the run it
+// is predicted from.
+type RacePrediction struct {
+	Race          string     `json:"race"`     // e.g. "10K"
+	Distance      float64    `json:"distance"` // in meters
+	Time          int        `json:"time"`     // in seconds
+	TimeFormatted string     `json:"time_formatted"`
+	Pace          string     `json:"pace"`            // formatted as "X:XX min/mi"
+	PaceMinPerKm  string     `json:"pace_min_per_km"` // formatted as "X:XX min/km"
+	GradeAdjusted bool       `json:"grade_adjusted"`  // predicted from grade-adjusted time
+	BasedOn       *RunRecord `json:"based_on"`
+}
+
+// PredictRaceTimes predicts 5K, 10K, half marathon and marathon times with
+// Riegel's formula. Each race is predicted from the run giving the fastest
+// time among runs of at least 3 km and a quarter of the race distance, since
+// the formula is only reliable over moderate extrapolations. Races no run
+// qualifies for are left out.
+func PredictRaceTimes(activities []NormalizedActivity, opts RacePredictionOptions) []RacePrediction {
+	predictions := []RacePrediction{}
+	for _, race := range predictionRaces {
+		best := -1.0
+		var from NormalizedActivity
+		var factor float64
+		var source string
+		for _, activity := range activities {
+			if !IsRunningActivity(activity.SportType) || activity.MovingTime <= 0 ||
+				activity.Distance < math.Max(minPredictionEffort, race.distance/4) {
+				continue
+			}
+			f, s := activityGradeAdjustment(activity, opts.GradeFactors)
+			effort := float64(activity.MovingTime)
+			if opts.GradeAdjusted {
+				effort /= f
+			}
+			predicted := effort * math.Pow(race.distance/activity.Distance, riegelExponent)
+			if best < 0 || predicted < best {
+				best, from, factor, source = predicted, activity, f, s
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		seconds := int(math.Round(best))
+		predictions = append(predictions, RacePrediction{
+			Race:          race.name,
+			Distance:      race.distance,
+			Time:          seconds,
+			TimeFormatted: FormatDuration(seconds),
+			Pace:          formatPace(best / race.distance * 1609.34),
+			PaceMinPerKm:  formatPace(best / race.distance * 1000),
+			GradeAdjusted: opts.GradeAdjusted,
+			BasedOn:       createRunRecord(from, factor, source),
+		})
+	}
+	return predictions
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPredictRaceTimes(t *testing.T) {
+	hilly := rollupActivity(2, "TrailRun", "2024-03-02", 10000, 3000)
+	hilly.TotalElevationGain = 400
+	activities := []NormalizedActivity{
+		rollupActivity(1, "Run", "2024-03-01", 10000, 2900),
+		hilly,
+		rollupActivity(3, "Run", "2024-03-03", 2000, 420),    // too short to predict from
+		rollupActivity(4, "Ride", "2024-03-04", 50000, 5400), // not a run
+	}
+
+	predictions := PredictRaceTimes(activities, RacePredictionOptions{})
+	if len(predictions) != 3 {
+		t.Fatalf("Expected no marathon prediction from 10K runs, got %+v", predictions)
+	}
+	fiveK, tenK, half := predictions[0], predictions[1], predictions[2]
+	if want := int(math.Round(2900 * math.Pow(0.5, riegelExponent))); fiveK.Race != "5K" || fiveK.Time != want || fiveK.BasedOn.ID != 1 {
+		t.Errorf("Expected a 5K in %d s from the flat run, got %+v", want, fiveK)
+	}
+	if tenK.Time != 2900 || tenK.TimeFormatted != "48m 20s" || tenK.PaceMinPerKm != "4:50" || tenK.GradeAdjusted {
+		t.Errorf("Expected the 10K to be the flat run's time, got %+v", tenK)
+	}
+	if want := int(math.Round(2900 * math.Pow(2.10975, riegelExponent))); half.Race != "Half Marathon" || half.Time != want {
+		t.Errorf("Expected a half marathon in %d s, got %+v", want, half)
+	}
+
+	// On the flat, the trail run was the better effort
+	gap := PredictRaceTimes(activities, RacePredictionOptions{GradeAdjusted: true, GradeFactors: map[int64]float64{2: 1.25}})
+	if tenK := gap[1]; tenK.Time != 2400 || tenK.BasedOn.ID != 2 || tenK.BasedOn.GradeSource != GradeFromStreams || !tenK.GradeAdjusted {
+		t.Errorf("Expected a grade-adjusted 10K of 2400 s from the trail run, got %+v", tenK)
+	}
+
+	if got := PredictRaceTimes(nil, RacePredictionOptions{}); got == nil || len(got) != 0 {
+		t.Errorf("Expected an empty list without runs, got %v", got)
+	}
+}
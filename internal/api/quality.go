@@ -0,0 +1,332 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Data quality checks.
+const (
+	CheckDuplicate        = "duplicate"         // overlaps another recording of the same activity
+	CheckImplausibleSpeed = "implausible_speed" // average speed impossible for the sport
+	CheckZeroDistance     = "zero_distance"     // distance sport with no distance
+	CheckGPSGlitch        = "gps_glitch"        // speed spike or distance without moving time
+)
+
+// speedLimits are the fastest plausible speeds of a sport, in meters per second.
+type speedLimits struct {
+	average float64 // over the whole activity
+	max     float64 // at any moment; faster means a GPS spike
+}
+
+// sportSpeedLimits covers the distance sports. Running allows a little over the
+// 5K world record pace; rides allow fast descents but not a car ride.
+var sportSpeedLimits = map[string]speedLimits{
+	"Run":              {average: 7.0, max: 12.5},
+	"TrailRun":         {average: 7.0, max: 12.5},
+	"VirtualRun":       {average: 7.0, max: 12.5},
+	"Walk":             {average: 3.0, max: 8.0},
+	"Hike":             {average: 3.0, max: 8.0},
+	"Ride":             {average: 20.0, max: 33.0},
+	"GravelRide":       {average: 20.0, max: 33.0},
+	"MountainBikeRide": {average: 20.0, max: 33.0},
+	"EBikeRide":        {average: 20.0, max: 33.0},
+	"VirtualRide":      {average: 20.0, max: 33.0},
+	"Swim":             {average: 2.5, max: 5.0},
+}
+
+// duplicateMinOverlap is the share of the shorter activity that must overlap
+// another of the same sport for the two to be the same activity recorded twice.
+const duplicateMinOverlap = 0.5
+
+// QualityIssue is one problem found with an activity.
+type QualityIssue struct {
+	Check       string `json:"check"` // one of the Check constants
+	Reason      string `json:"reason"`
+	DuplicateOf int64  `json:"duplicate_of,omitempty"` // the recording that is kept
+}
+
+// FlaggedActivity is an activity with data quality issues.
+type FlaggedActivity struct {
+	ID           int64          `json:"id"`
+	Name         string         `json:"name"`
+	Date         string         `json:"date"` // YYYY-MM-DD
+	SportType    string         `json:"sport_type"`
+	Distance     float64        `json:"distance"`      // in meters
+	MovingTime   int            `json:"moving_time"`   // in seconds
+	AverageSpeed float64        `json:"average_speed"` // distance over moving time, in meters per second
+	Issues       []QualityIssue `json:"issues"`
+}
+
+// DataQualityReport lists the activities flagged by the data quality checks.
+type DataQualityReport struct {
+	Checked    int               `json:"checked"`
+	Flagged    int               `json:"flagged"`
+	Checks     map[string]int    `json:"checks"`     // flagged activities per check
+	Activities []FlaggedActivity `json:"activities"` // newest first
+}
+
+// qualityRecord is what the checks need to know about an activity.
+type qualityRecord struct {
+	id           int64
+	name         string
+	date         string
+	sport        string
+	start        time.Time
+	end          time.Time
+	distance     float64
+	movingTime   int
+	maxSpeed     float64
+	hasHeartrate bool
+}
+
+// QualityIndex checks the data quality of an athlete's activities. Activities
+// are added incrementally, like a Rollup, and the checks rerun only when
+// something changed. A QualityIndex is safe for concurrent use.
+type QualityIndex struct {
+	mu      sync.Mutex
+	records map[int64]qualityRecord
+	flagged map[int64][]QualityIssue // nil when records changed since the last check
+}
+
+// NewQualityIndex creates an empty quality index.
+func NewQualityIndex() *QualityIndex {
+	return &QualityIndex{records: make(map[int64]qualityRecord)}
+}
+
+// Add adds activities to the index, replacing any with the same ID.
+func (q *QualityIndex) Add(activities ...NormalizedActivity) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, activity := range activities {
+		q.records[activity.ID] = qualityRecord{
+			id:           activity.ID,
+			name:         activity.Name,
+			date:         activity.LocalDateStr,
+			sport:        activity.SportType,
+			start:        activity.StartDate,
+			end:          activity.StartDate.Add(time.Duration(activityElapsedTime(activity)) * time.Second),
+			distance:     activity.Distance,
+			movingTime:   activity.MovingTime,
+			maxSpeed:     activity.MaxSpeed,
+			hasHeartrate: activity.HasHeartrate,
+		}
+	}
+	q.flagged = nil
+}
+
+// Flagged returns the IDs of every flagged activity.
+func (q *QualityIndex) Flagged() map[int64]bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ids := make(map[int64]bool)
+	for id := range q.checkLocked() {
+		ids[id] = true
+	}
+	return ids
+}
+
+// Report lists the flagged activities between start and end (inclusive,
+// YYYY-MM-DD; empty means unbounded).
+func (q *QualityIndex) Report(start, end string) DataQualityReport {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	report := DataQualityReport{
+		Checks:     make(map[string]int),
+		Activities: []FlaggedActivity{},
+	}
+	flagged := q.checkLocked()
+	for _, record := range q.records {
+		if (start != "" && record.date < start) || (end != "" && record.date > end) {
+			continue
+		}
+		report.Checked++
+		issues, ok := flagged[record.id]
+		if !ok {
+			continue
+		}
+		activity := FlaggedActivity{
+			ID:         record.id,
+			Name:       record.name,
+			Date:       record.date,
+			SportType:  record.sport,
+			Distance:   record.distance,
+			MovingTime: record.movingTime,
+			Issues:     issues,
+		}
+		if record.movingTime > 0 {
+			activity.AverageSpeed = record.distance / float64(record.movingTime)
+		}
+		report.Activities = append(report.Activities, activity)
+		seen := make(map[string]bool)
+		for _, issue := range issues {
+			if !seen[issue.Check] {
+				seen[issue.Check] = true
+				report.Checks[issue.Check]++
+			}
+		}
+	}
+	report.Flagged = len(report.Activities)
+	sort.Slice(report.Activities, func(i, j int) bool {
+		a, b := report.Activities[i], report.Activities[j]
+		if a.Date != b.Date {
+			return a.Date > b.Date
+		}
+		return a.ID > b.ID
+	})
+	return report
+}
+
+// checkLocked runs the checks over every record, reusing the last result if
+// nothing changed.
+func (q *QualityIndex) checkLocked() map[int64][]QualityIssue {
+	if q.flagged != nil {
+		return q.flagged
+	}
+
+	flagged := make(map[int64][]QualityIssue)
+	records := make([]qualityRecord, 0, len(q.records))
+	for _, record := range q.records {
+		records = append(records, record)
+		if issues := checkActivity(record); len(issues) > 0 {
+			flagged[record.id] = issues
+		}
+	}
+
+	// Sweep activities in start order; each can only overlap later ones that
+	// start before it ends
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].start.Equal(records[j].start) {
+			return records[i].start.Before(records[j].start)
+		}
+		return records[i].id < records[j].id
+	})
+	duplicate := make(map[int64]bool)
+	for i, a := range records {
+		for _, b := range records[i+1:] {
+			if !b.start.Before(a.end) {
+				break
+			}
+			if duplicate[a.id] || duplicate[b.id] || sportFamily(a.sport) != sportFamily(b.sport) || !overlapping(a, b) {
+				continue
+			}
+			kept, dropped := a, b
+			if preferRecording(b, a) {
+				kept, dropped = b, a
+			}
+			duplicate[dropped.id] = true
+			flagged[dropped.id] = append(flagged[dropped.id], QualityIssue{
+				Check:       CheckDuplicate,
+				Reason:      fmt.Sprintf("overlaps %q, recorded at the same time", kept.name),
+				DuplicateOf: kept.id,
+			})
+		}
+	}
+
+	q.flagged = flagged
+	return flagged
+}
+
+// checkActivity runs the checks that only need the activity itself.
+func checkActivity(record qualityRecord) []QualityIssue {
+	limits, ok := sportSpeedLimits[record.sport]
+	if !ok {
+		return nil
+	}
+
+	var issues []QualityIssue
+	if record.distance <= 0 {
+		issues = append(issues, QualityIssue{
+			Check:  CheckZeroDistance,
+			Reason: fmt.Sprintf("%s with no distance", record.sport),
+		})
+	} else if record.movingTime <= 0 {
+		issues = append(issues, QualityIssue{
+			Check:  CheckGPSGlitch,
+			Reason: fmt.Sprintf("%.2f km without any moving time", record.distance/metersPerKm),
+		})
+	} else if speed := record.distance / float64(record.movingTime); speed > limits.average {
+		issues = append(issues, QualityIssue{
+			Check:  CheckImplausibleSpeed,
+			Reason: fmt.Sprintf("average %.1f km/h is too fast for a %s (limit %.1f km/h)", speed*3.6, record.sport, limits.average*3.6),
+		})
+	}
+	if record.maxSpeed > limits.max {
+		issues = append(issues, QualityIssue{
+			Check:  CheckGPSGlitch,
+			Reason: fmt.Sprintf("max speed %.1f km/h is too fast for a %s (limit %.1f km/h)", record.maxSpeed*3.6, record.sport, limits.max*3.6),
+		})
+	}
+	return issues
+}
+
+// sportFamily groups sport types that can be the same activity recorded by
+// different devices, such as a run on a watch and a treadmill run on an app.
+func sportFamily(sport string) string {
+	switch sport {
+	case "Run", "TrailRun", "VirtualRun":
+		return "Run"
+	case "Ride", "GravelRide", "MountainBikeRide", "EBikeRide", "VirtualRide":
+		return "Ride"
+	}
+	return sport
+}
+
+// overlapping reports whether two activities overlap for at least
+// duplicateMinOverlap of the shorter one.
+func overlapping(a, b qualityRecord) bool {
+	start, end := a.start, a.end
+	if b.start.After(start) {
+		start = b.start
+	}
+	if b.end.Before(end) {
+		end = b.end
+	}
+	shorter := a.end.Sub(a.start)
+	if d := b.end.Sub(b.start); d < shorter {
+		shorter = d
+	}
+	if shorter <= 0 {
+		return false
+	}
+	return end.Sub(start).Seconds() >= duplicateMinOverlap*shorter.Seconds()
+}
+
+// preferRecording reports whether a is the better of two recordings of the same
+// activity: one with heart rate, then the longer moving time, then the first upload.
+func preferRecording(a, b qualityRecord) bool {
+	if a.hasHeartrate != b.hasHeartrate {
+		return a.hasHeartrate
+	}
+	if a.movingTime != b.movingTime {
+		return a.movingTime > b.movingTime
+	}
+	return a.id < b.id
+}
+
+// CheckDataQuality runs the data quality checks over the activities.
+func CheckDataQuality(activities []NormalizedActivity) DataQualityReport {
+	index := NewQualityIndex()
+	index.Add(activities...)
+	return index.Report("", "")
+}
+
+// ExcludeFlagged returns the activities that pass the data quality checks.
+func ExcludeFlagged(activities []NormalizedActivity) []NormalizedActivity {
+	index := NewQualityIndex()
+	index.Add(activities...)
+	flagged := index.Flagged()
+
+	var clean []NormalizedActivity
+	for _, activity := range activities {
+		if !flagged[activity.ID] {
+			clean = append(clean, activity)
+		}
+	}
+	return clean
+}
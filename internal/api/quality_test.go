@@ -0,0 +1,83 @@
+package api
+
+import "testing"
+
+func TestCheckDataQuality(t *testing.T) {
+	watch := rollupActivity(1, "Run", "2024-11-25", 10000, 3000)
+	watch.Name = "Watch run"
+	watch.HasHeartrate = true
+	phone := rollupActivity(2, "Run", "2024-11-25", 10100, 3010, startingAt("07:00:30"))
+	phone.Name = "Phone run"
+	// 25 mph "run" that was really a ride
+	mislabelled := rollupActivity(3, "Run", "2024-11-26", 40000, 3600)
+	mislabelled.MaxSpeed = 12
+	glitch := rollupActivity(4, "Ride", "2024-11-27", 30000, 3600)
+	glitch.MaxSpeed = 70
+	noDistance := rollupActivity(5, "Walk", "2024-11-28", 0, 1800)
+	strength := strengthActivity(6, "2024-11-28")
+	// A ride after the run isn't a duplicate, even though it's the same day
+	ride := rollupActivity(7, "Ride", "2024-11-25", 30000, 3600, startingAt("08:00:00"))
+
+	report := CheckDataQuality([]NormalizedActivity{watch, phone, mislabelled, glitch, noDistance, strength, ride})
+	if report.Checked != 7 || report.Flagged != 4 {
+		t.Fatalf("Expected 4 of 7 activities flagged, got %+v", report)
+	}
+	expected := map[int64]string{
+		2: CheckDuplicate,
+		3: CheckImplausibleSpeed,
+		4: CheckGPSGlitch,
+		5: CheckZeroDistance,
+	}
+	for _, activity := range report.Activities {
+		if len(activity.Issues) != 1 || activity.Issues[0].Check != expected[activity.ID] {
+			t.Errorf("Activity %d: expected %s, got %+v", activity.ID, expected[activity.ID], activity.Issues)
+		}
+	}
+	if dup := report.Activities[3]; dup.ID != 2 || dup.Issues[0].DuplicateOf != 1 {
+		t.Errorf("Expected the phone run to duplicate the watch run (with heart rate), got %+v", dup)
+	}
+	if report.Checks[CheckDuplicate] != 1 || report.Checks[CheckGPSGlitch] != 1 {
+		t.Errorf("Unexpected check counts: %v", report.Checks)
+	}
+}
+
+func TestQualityIndex_Report(t *testing.T) {
+	index := NewQualityIndex()
+	index.Add(rollupActivity(1, "Run", "2024-11-25", 0, 1800))
+	index.Add(rollupActivity(2, "Run", "2024-12-02", 0, 1800))
+	if report := index.Report("2024-12-01", ""); report.Checked != 1 || report.Flagged != 1 || report.Activities[0].ID != 2 {
+		t.Errorf("Expected only the second run in range, got %+v", report)
+	}
+
+	// Fixing an activity on Strava clears its flag
+	index.Add(rollupActivity(2, "Run", "2024-12-02", 5000, 1800))
+	if flagged := index.Flagged(); len(flagged) != 1 || !flagged[1] {
+		t.Errorf("Expected only the first run flagged, got %v", flagged)
+	}
+}
+
+func TestExcludeFlagged(t *testing.T) {
+	activities := []NormalizedActivity{
+		rollupActivity(1, "Run", "2024-11-25", 10000, 3000),
+		rollupActivity(2, "Run", "2024-11-25", 10000, 2990),
+		rollupActivity(3, "Run", "2024-11-26", 40000, 3600),
+	}
+	clean := ExcludeFlagged(activities)
+	if len(clean) != 1 || clean[0].ID != 1 {
+		t.Fatalf("Expected only the first run, got %+v", clean)
+	}
+
+	// Flagged activities also drop out of rollups
+	rollup := NewRollup()
+	rollup.Add(activities...)
+	without := rollup.Without(map[int64]bool{2: true, 3: true})
+	if totals := without.Totals("", "", nil); totals.Total.Count != 1 || totals.Total.Distance != 10000 {
+		t.Errorf("Unexpected totals without flagged activities: %+v", totals.Total)
+	}
+	if rollup.Len() != 3 || without.Len() != 1 {
+		t.Errorf("Expected the original rollup untouched, got %d and %d activities", rollup.Len(), without.Len())
+	}
+	if first, last := without.DateBounds(); first != "2024-11-25" || last != "2024-11-25" {
+		t.Errorf("Expected the emptied day to be dropped, got %s to %s", first, last)
+	}
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"math"
+	"time"
+)
+
+// Periods of Strava's athlete stats.
+const (
+	TotalsRecent = "recent" // the last four weeks
+	TotalsYTD    = "ytd"
+	TotalsAll    = "all"
+)
+
+// statsSportTypes are the sport types counted in each category of Strava's
+// athlete stats.
+var statsSportTypes = map[string][]string{
+	"ride": {"Ride", "MountainBikeRide", "GravelRide", "EBikeRide", "EMountainBikeRide", "VirtualRide", "Velomobile", "Handcycle"},
+	"run":  {"Run", "TrailRun", "VirtualRun"},
+	"swim": {"Swim"},
+}
+
+// Computed totals may differ from Strava's by this much, relative to Strava's
+// value or absolute, whichever is larger, before they count as a discrepancy;
+// Strava rounds its totals and recomputes some values after upload.
+const (
+	totalsRelativeTolerance  = 0.01
+	totalsDistanceTolerance  = 100 // meters
+	totalsTimeTolerance      = 60  // seconds
+	totalsElevationTolerance = 10  // meters
+)
+
+// recentTotalsDays is the window of Strava's recent totals.
+const recentTotalsDays = 28
+
+// TotalsDifference is a total that differs between Strava and the rollups.
+type TotalsDifference struct {
+	Field      string  `json:"field"` // "count", "distance", "moving_time", "elapsed_time" or "elevation_gain"
+	Strava     float64 `json:"strava"`
+	Computed   float64 `json:"computed"`
+	Difference float64 `json:"difference"` // computed minus Strava's
+	Percent    float64 `json:"percent"`    // of Strava's value; 0 when that is 0
+}
+
+// TotalsComparison compares Strava's totals of one sport and period with the
+// totals computed from the athlete's activities.
+type TotalsComparison struct {
+	Period      string             `json:"period"`          // TotalsRecent, TotalsYTD or TotalsAll
+	Sport       string             `json:"sport"`           // "ride", "run" or "swim"
+	Start       string             `json:"start,omitempty"` // YYYY-MM-DD; empty for all time
+	End         string             `json:"end"`             // YYYY-MM-DD
+	Strava      ActivityTotals     `json:"strava"`
+	Computed    ActivityTotals     `json:"computed"`
+	Differences []TotalsDifference `json:"differences"` // only those beyond the tolerance
+	Matches     bool               `json:"matches"`
+	Hint        string             `json:"hint,omitempty"` // likely cause of a discrepancy
+}
+
+// TotalsReconciliation checks the rollups against Strava's athlete stats.
+type TotalsReconciliation struct {
+	Comparisons   []TotalsComparison `json:"comparisons"`
+	Discrepancies int                `json:"discrepancies"` // comparisons that don't match
+	Notes         []string           `json:"notes"`
+}
+
+// ReconcileTotals compares the rollup's totals for the last four weeks, the
+// year to date and all time with Strava's athlete stats, for rides, runs and
+// swims. today is the athlete's local date. The rollup must cover all time.
+func ReconcileTotals(rollup *Rollup, stats *AthleteStats, today time.Time) TotalsReconciliation {
+	end := today.Format("2006-01-02")
+	periods := []struct {
+		name, start string
+		totals      map[string]ActivityTotals
+	}{
+		{TotalsRecent, today.AddDate(0, 0, -(recentTotalsDays - 1)).Format("2006-01-02"), map[string]ActivityTotals{
+			"ride": stats.RecentRideTotals, "run": stats.RecentRunTotals, "swim": stats.RecentSwimTotals,
+		}},
+		{TotalsYTD, time.Date(today.Year(), 1, 1, 0, 0, 0, 0, time.UTC).Format("2006-01-02"), map[string]ActivityTotals{
+			"ride": stats.YTDRideTotals, "run": stats.YTDRunTotals, "swim": stats.YTDSwimTotals,
+		}},
+		{TotalsAll, "", map[string]ActivityTotals{
+			"ride": stats.AllRideTotals, "run": stats.AllRunTotals, "swim": stats.AllSwimTotals,
+		}},
+	}
+
+	result := TotalsReconciliation{
+		Comparisons: []TotalsComparison{},
+		Notes: []string{
+			"Strava's stats only include activities visible to Everyone; private and followers-only activities are counted here but not there.",
+			"Strava's recent totals cover the last four weeks, and its day boundaries may differ from your local dates by a few hours.",
+		},
+	}
+	for _, period := range periods {
+		for _, sport := range []string{"ride", "run", "swim"} {
+			comparison := TotalsComparison{
+				Period:   period.name,
+				Sport:    sport,
+				Start:    period.start,
+				End:      end,
+				Strava:   period.totals[sport],
+				Computed: computedTotals(rollup, period.start, end, statsSportTypes[sport]),
+			}
+			comparison.Differences = totalsDifferences(comparison.Strava, comparison.Computed)
+			comparison.Matches = len(comparison.Differences) == 0
+			if !comparison.Matches {
+				comparison.Hint = totalsHint(comparison.Strava, comparison.Computed)
+				result.Discrepancies++
+			}
+			result.Comparisons = append(result.Comparisons, comparison)
+		}
+	}
+	return result
+}
+
+// computedTotals totals the rollup's activities of the given sport types.
+func computedTotals(rollup *Rollup, start, end string, sportTypes []string) ActivityTotals {
+	totals := rollup.Totals(start, end, sportFilter(sportTypes)).Total
+	return ActivityTotals{
+		Count:         totals.Count,
+		Distance:      totals.Distance,
+		MovingTime:    totals.MovingTime,
+		ElapsedTime:   totals.ElapsedTime,
+		ElevationGain: totals.ElevationGain,
+	}
+}
+
+// sportFilter accepts the given sport types.
+func sportFilter(sportTypes []string) func(string) bool {
+	accepted := make(map[string]bool, len(sportTypes))
+	for _, sport := range sportTypes {
+		accepted[sport] = true
+	}
+	return func(sport string) bool { return accepted[sport] }
+}
+
+// totalsDifferences lists the totals that differ by more than the tolerance.
+func totalsDifferences(strava, computed ActivityTotals) []TotalsDifference {
+	fields := []struct {
+		name             string
+		strava, computed float64
+		tolerance        float64
+	}{
+		{"count", float64(strava.Count), float64(computed.Count), 0},
+		{"distance", strava.Distance, computed.Distance, totalsDistanceTolerance},
+		{"moving_time", float64(strava.MovingTime), float64(computed.MovingTime), totalsTimeTolerance},
+		{"elapsed_time", float64(strava.ElapsedTime), float64(computed.ElapsedTime), totalsTimeTolerance},
+		{"elevation_gain", strava.ElevationGain, computed.ElevationGain, totalsElevationTolerance},
+	}
+
+	differences := []TotalsDifference{}
+	for _, field := range fields {
+		difference := field.computed - field.strava
+		tolerance := field.tolerance
+		if field.name != "count" {
+			tolerance = math.Max(tolerance, totalsRelativeTolerance*field.strava)
+		}
+		if math.Abs(difference) <= tolerance {
+			continue
+		}
+		d := TotalsDifference{Field: field.name, Strava: field.strava, Computed: field.computed, Difference: difference}
+		if field.strava != 0 {
+			d.Percent = 100 * difference / field.strava
+		}
+		differences = append(differences, d)
+	}
+	return differences
+}
+
+// totalsHint suggests why computed totals differ from Strava's.
+func totalsHint(strava, computed ActivityTotals) string {
+	switch {
+	case computed.Count > strava.Count:
+		return "More activities here than on Strava: private or followers-only activities, which Strava's stats leave out"
+	case computed.Count < strava.Count:
+		return "Fewer activities here than on Strava: history that hasn't loaded yet, or activities of a sport type counted differently"
+	}
+	return "Same activities, different totals: Strava may have corrected distances or elevation after upload"
+}
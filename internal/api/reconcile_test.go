@@ -0,0 +1,72 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconcileTotals(t *testing.T) {
+	rollup := NewRollup()
+	rollup.Add(
+		rollupActivity(1, "Run", "2023-06-01", 10000, 3000),
+		rollupActivity(2, "TrailRun", "2024-02-01", 15000, 5400),
+		rollupActivity(3, "Run", "2024-05-20", 5000, 1500),
+		rollupActivity(4, "Ride", "2024-05-25", 40000, 5400),
+		rollupActivity(5, "VirtualRide", "2024-05-26", 20000, 2400),
+		rollupActivity(6, "Walk", "2024-05-27", 3000, 1800),
+	)
+	today := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// rollupActivity stops for a minute
+	stats := &AthleteStats{
+		RecentRunTotals:  ActivityTotals{Count: 1, Distance: 5000, MovingTime: 1500, ElapsedTime: 1560},
+		RecentRideTotals: ActivityTotals{Count: 2, Distance: 60000, MovingTime: 7800, ElapsedTime: 7920},
+		// Strava rounds: within 1% is a match
+		YTDRunTotals:  ActivityTotals{Count: 2, Distance: 19900, MovingTime: 6900, ElapsedTime: 7020},
+		YTDRideTotals: ActivityTotals{Count: 2, Distance: 60000, MovingTime: 7800, ElapsedTime: 7920},
+		// A private run is counted here but not by Strava
+		AllRunTotals:  ActivityTotals{Count: 2, Distance: 20000, MovingTime: 6900, ElapsedTime: 7020},
+		AllRideTotals: ActivityTotals{Count: 2, Distance: 60000, MovingTime: 7800, ElapsedTime: 7920},
+	}
+
+	result := ReconcileTotals(rollup, stats, today)
+	if len(result.Comparisons) != 9 {
+		t.Fatalf("Expected 9 comparisons, got %d", len(result.Comparisons))
+	}
+	if result.Discrepancies != 1 {
+		t.Errorf("Expected one discrepancy, got %d: %+v", result.Discrepancies, result.Comparisons)
+	}
+
+	byKey := make(map[string]TotalsComparison)
+	for _, c := range result.Comparisons {
+		byKey[c.Period+"/"+c.Sport] = c
+	}
+	recent := byKey["recent/run"]
+	if recent.Start != "2024-05-05" || recent.End != "2024-06-01" || recent.Computed.Count != 1 {
+		t.Errorf("Unexpected recent run comparison %+v", recent)
+	}
+	if ytd := byKey["ytd/run"]; !ytd.Matches || ytd.Computed.Distance != 20000 || ytd.Start != "2024-01-01" {
+		t.Errorf("Expected the YTD runs to match within tolerance, got %+v", ytd)
+	}
+	if rides := byKey["all/ride"]; !rides.Matches || rides.Computed.Count != 2 {
+		t.Errorf("Expected virtual rides to count as rides, got %+v", rides)
+	}
+
+	all := byKey["all/run"]
+	if all.Matches || all.Start != "" || all.Hint == "" {
+		t.Fatalf("Expected the all-time runs to differ, got %+v", all)
+	}
+	fields := make(map[string]TotalsDifference)
+	for _, d := range all.Differences {
+		fields[d.Field] = d
+	}
+	if d, ok := fields["count"]; !ok || d.Difference != 1 || d.Percent != 50 {
+		t.Errorf("Expected one extra run, got %+v", all.Differences)
+	}
+	if d, ok := fields["distance"]; !ok || d.Difference != 10000 {
+		t.Errorf("Expected 10 km more running, got %+v", all.Differences)
+	}
+	if _, ok := fields["elevation_gain"]; ok {
+		t.Errorf("Expected no elevation difference, got %+v", all.Differences)
+	}
+}
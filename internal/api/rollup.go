@@ -0,0 +1,397 @@
+package api
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RollupTotals holds additive totals for a set of activities. Every field can be
+// summed across days and sports, so any period can be answered from daily rollups.
+type RollupTotals struct {
+	Count         int     `json:"count"`
+	Distance      float64 `json:"distance"`       // in meters
+	MovingTime    int     `json:"moving_time"`    // in seconds
+	DistanceTime  int     `json:"distance_time"`  // moving seconds of activities that covered distance
+	FlatDistance  float64 `json:"flat_distance"`  // grade-adjusted distance, in meters (see EstimateGradeAdjustment)
+	ElapsedTime   int     `json:"elapsed_time"`   // in seconds
+	ElevationGain float64 `json:"elevation_gain"` // in meters
+	HeartrateTime int     `json:"heartrate_time"` // moving seconds of activities with heart rate
+	HeartrateSum  float64 `json:"heartrate_sum"`  // average heart rate weighted by moving seconds
+	WattsTime     int     `json:"watts_time"`     // moving seconds of activities with power
+	WattsSum      float64 `json:"watts_sum"`      // average watts weighted by moving seconds
+	PaceEFTime    int     `json:"pace_ef_time"`   // moving seconds of runs, walks and hikes with an efficiency factor
+	PaceEFSum     float64 `json:"pace_ef_sum"`    // their efficiency factor weighted by moving seconds
+	PowerEFTime   int     `json:"power_ef_time"`  // moving seconds of rides with an efficiency factor
+	PowerEFSum    float64 `json:"power_ef_sum"`   // their efficiency factor weighted by moving seconds
+}
+
+// add accumulates other into t.
+func (t *RollupTotals) add(other RollupTotals) {
+	t.Count += other.Count
+	t.Distance += other.Distance
+	t.MovingTime += other.MovingTime
+	t.DistanceTime += other.DistanceTime
+	t.FlatDistance += other.FlatDistance
+	t.ElapsedTime += other.ElapsedTime
+	t.ElevationGain += other.ElevationGain
+	t.HeartrateTime += other.HeartrateTime
+	t.HeartrateSum += other.HeartrateSum
+	t.WattsTime += other.WattsTime
+	t.WattsSum += other.WattsSum
+	t.PaceEFTime += other.PaceEFTime
+	t.PaceEFSum += other.PaceEFSum
+	t.PowerEFTime += other.PowerEFTime
+	t.PowerEFSum += other.PowerEFSum
+}
+
+// sub removes other from t.
+func (t *RollupTotals) sub(other RollupTotals) {
+	t.Count -= other.Count
+	t.Distance -= other.Distance
+	t.MovingTime -= other.MovingTime
+	t.DistanceTime -= other.DistanceTime
+	t.FlatDistance -= other.FlatDistance
+	t.ElapsedTime -= other.ElapsedTime
+	t.ElevationGain -= other.ElevationGain
+	t.HeartrateTime -= other.HeartrateTime
+	t.HeartrateSum -= other.HeartrateSum
+	t.WattsTime -= other.WattsTime
+	t.WattsSum -= other.WattsSum
+	t.PaceEFTime -= other.PaceEFTime
+	t.PaceEFSum -= other.PaceEFSum
+	t.PowerEFTime -= other.PowerEFTime
+	t.PowerEFSum -= other.PowerEFSum
+}
+
+// AverageHeartrate returns the moving-time weighted average heart rate, or 0 without data.
+func (t RollupTotals) AverageHeartrate() float64 {
+	if t.HeartrateTime == 0 {
+		return 0
+	}
+	return t.HeartrateSum / float64(t.HeartrateTime)
+}
+
+// AverageWatts returns the moving-time weighted average power, or 0 without data.
+func (t RollupTotals) AverageWatts() float64 {
+	if t.WattsTime == 0 {
+		return 0
+	}
+	return t.WattsSum / float64(t.WattsTime)
+}
+
+// PaceEfficiencyFactor returns the moving-time weighted efficiency factor of
+// runs, walks and hikes, or 0 without data.
+func (t RollupTotals) PaceEfficiencyFactor() float64 {
+	if t.PaceEFTime == 0 {
+		return 0
+	}
+	return t.PaceEFSum / float64(t.PaceEFTime)
+}
+
+// PowerEfficiencyFactor returns the moving-time weighted efficiency factor of
+// rides, or 0 without data.
+func (t RollupTotals) PowerEfficiencyFactor() float64 {
+	if t.PowerEFTime == 0 {
+		return 0
+	}
+	return t.PowerEFSum / float64(t.PowerEFTime)
+}
+
+// activityTotals returns the rollup contribution of a single activity.
+func activityTotals(activity NormalizedActivity) RollupTotals {
+	totals := RollupTotals{
+		Count:         1,
+		Distance:      activity.Distance,
+		MovingTime:    activity.MovingTime,
+		ElapsedTime:   activity.ElapsedTime,
+		ElevationGain: activity.TotalElevationGain,
+	}
+	if activity.Distance > 0 {
+		// Other sports than runs, walks and hikes count their distance as is
+		factor, _ := activityGradeAdjustment(activity, nil)
+		totals.DistanceTime = activity.MovingTime
+		totals.FlatDistance = activity.Distance * factor
+	}
+	if activity.AverageHeartrate > 0 && activity.MovingTime > 0 {
+		totals.HeartrateTime = activity.MovingTime
+		totals.HeartrateSum = activity.AverageHeartrate * float64(activity.MovingTime)
+	}
+	if activity.AverageWatts > 0 && activity.MovingTime > 0 {
+		totals.WattsTime = activity.MovingTime
+		totals.WattsSum = activity.AverageWatts * float64(activity.MovingTime)
+	}
+	switch ef, basis := EfficiencyFactor(activity, nil); {
+	case ef > 0 && basis == EfficiencyPace:
+		totals.PaceEFTime = activity.MovingTime
+		totals.PaceEFSum = ef * float64(activity.MovingTime)
+	case ef > 0 && basis == EfficiencyPower:
+		totals.PowerEFTime = activity.MovingTime
+		totals.PowerEFSum = ef * float64(activity.MovingTime)
+	}
+	return totals
+}
+
+// rollupContribution records what an activity added, so it can be replaced
+// when the same activity arrives again (e.g. after being edited on Strava).
+type rollupContribution struct {
+	date     string
+	sport    string
+	timezone string
+	totals   RollupTotals
+}
+
+// Rollup maintains per-day, per-sport totals for one athlete. Activities are
+// added incrementally and queries over any date range only touch the days that
+// have activities, instead of re-aggregating every activity per request.
+// A Rollup is safe for concurrent use.
+type Rollup struct {
+	mu            sync.RWMutex
+	days          map[string]map[string]*RollupTotals // date (YYYY-MM-DD) -> sport type -> totals
+	dates         []string                            // sorted keys of days
+	contributions map[int64]rollupContribution
+	timezones     map[string]int       // activity count per Strava timezone
+	timezoneSeen  map[string]time.Time // latest activity start per timezone
+}
+
+// NewRollup creates an empty rollup.
+func NewRollup() *Rollup {
+	return &Rollup{
+		days:          make(map[string]map[string]*RollupTotals),
+		contributions: make(map[int64]rollupContribution),
+		timezones:     make(map[string]int),
+		timezoneSeen:  make(map[string]time.Time),
+	}
+}
+
+// Add adds activities to the rollup. Adding an activity that is already present
+// replaces its previous contribution, so re-syncing overlapping ranges is safe.
+func (r *Rollup) Add(activities ...NormalizedActivity) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, activity := range activities {
+		if activity.LocalDateStr == "" {
+			continue
+		}
+		if previous, ok := r.contributions[activity.ID]; ok {
+			r.removeLocked(previous)
+		}
+		contribution := rollupContribution{
+			date:     activity.LocalDateStr,
+			sport:    activity.SportType,
+			timezone: activity.Timezone,
+			totals:   activityTotals(activity),
+		}
+		r.addLocked(contribution)
+		r.contributions[activity.ID] = contribution
+		if activity.Timezone != "" && activity.StartDate.After(r.timezoneSeen[activity.Timezone]) {
+			r.timezoneSeen[activity.Timezone] = activity.StartDate
+		}
+	}
+}
+
+func (r *Rollup) addLocked(c rollupContribution) {
+	if c.timezone != "" {
+		r.timezones[c.timezone]++
+	}
+	sports, ok := r.days[c.date]
+	if !ok {
+		sports = make(map[string]*RollupTotals)
+		r.days[c.date] = sports
+		// Keep dates sorted for range queries
+		i := sort.SearchStrings(r.dates, c.date)
+		r.dates = append(r.dates, "")
+		copy(r.dates[i+1:], r.dates[i:])
+		r.dates[i] = c.date
+	}
+	totals, ok := sports[c.sport]
+	if !ok {
+		totals = &RollupTotals{}
+		sports[c.sport] = totals
+	}
+	totals.add(c.totals)
+}
+
+func (r *Rollup) removeLocked(c rollupContribution) {
+	if c.timezone != "" {
+		r.timezones[c.timezone]--
+		if r.timezones[c.timezone] <= 0 {
+			delete(r.timezones, c.timezone)
+		}
+	}
+	sports, ok := r.days[c.date]
+	if !ok {
+		return
+	}
+	totals, ok := sports[c.sport]
+	if !ok {
+		return
+	}
+	totals.sub(c.totals)
+	if totals.Count <= 0 {
+		delete(sports, c.sport)
+	}
+	if len(sports) == 0 {
+		delete(r.days, c.date)
+		i := sort.SearchStrings(r.dates, c.date)
+		if i < len(r.dates) && r.dates[i] == c.date {
+			r.dates = append(r.dates[:i], r.dates[i+1:]...)
+		}
+	}
+}
+
+// Without returns a copy of the rollup leaving out the given activities, e.g.
+// those flagged by the data quality checks.
+func (r *Rollup) Without(ids map[int64]bool) *Rollup {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clone := NewRollup()
+	for date, sports := range r.days {
+		cloned := make(map[string]*RollupTotals, len(sports))
+		for sport, totals := range sports {
+			copied := *totals
+			cloned[sport] = &copied
+		}
+		clone.days[date] = cloned
+	}
+	clone.dates = append([]string(nil), r.dates...)
+	for tz, count := range r.timezones {
+		clone.timezones[tz] = count
+	}
+	for tz, seen := range r.timezoneSeen {
+		clone.timezoneSeen[tz] = seen
+	}
+	for id, contribution := range r.contributions {
+		if ids[id] {
+			clone.removeLocked(contribution)
+		} else {
+			clone.contributions[id] = contribution
+		}
+	}
+	return clone
+}
+
+// Len returns the number of activities in the rollup.
+func (r *Rollup) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.contributions)
+}
+
+// HomeTimezone returns the timezone most of the rollup's activities were
+// recorded in (see HomeTimezone), or "" if none is known.
+func (r *Rollup) HomeTimezone() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return mostFrequentTimezone(r.timezones, r.timezoneSeen)
+}
+
+// DateBounds returns the first and last dates with activities, or empty strings.
+func (r *Rollup) DateBounds() (string, string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.dates) == 0 {
+		return "", ""
+	}
+	return r.dates[0], r.dates[len(r.dates)-1]
+}
+
+// DailyRollup is the per-sport totals of a single day.
+type DailyRollup struct {
+	Date   string                  `json:"date"` // YYYY-MM-DD
+	Total  RollupTotals            `json:"total"`
+	Sports map[string]RollupTotals `json:"sports"`
+}
+
+// Days returns the daily rollups between start and end (inclusive, YYYY-MM-DD;
+// empty means unbounded) for sports accepted by filter (nil accepts all).
+// Days without matching activities are omitted.
+func (r *Rollup) Days(start, end string, filter func(sportType string) bool) []DailyRollup {
+	var days []DailyRollup
+	r.forEachDay(start, end, filter, func(date, sport string, totals RollupTotals) {
+		if len(days) == 0 || days[len(days)-1].Date != date {
+			days = append(days, DailyRollup{Date: date, Sports: make(map[string]RollupTotals)})
+		}
+		day := &days[len(days)-1]
+		day.Total.add(totals)
+		day.Sports[sport] = totals
+	})
+	return days
+}
+
+// forEachDay calls fn for every (date, sport) pair in range, in date order.
+func (r *Rollup) forEachDay(start, end string, filter func(string) bool, fn func(date, sport string, totals RollupTotals)) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := 0
+	if start != "" {
+		i = sort.SearchStrings(r.dates, start)
+	}
+	for ; i < len(r.dates); i++ {
+		date := r.dates[i]
+		if end != "" && date > end {
+			break
+		}
+		sports := r.days[date]
+		// Visit sports in a stable order so results are deterministic
+		names := make([]string, 0, len(sports))
+		for sport := range sports {
+			if filter == nil || filter(sport) {
+				names = append(names, sport)
+			}
+		}
+		sort.Strings(names)
+		for _, sport := range names {
+			fn(date, sport, *sports[sport])
+		}
+	}
+}
+
+// PeriodTotals is the rollup of one period (e.g. a week), overall and per sport.
+type PeriodTotals struct {
+	Period string                  `json:"period"` // start date of the period (YYYY-MM-DD), or "all"
+	Total  RollupTotals            `json:"total"`
+	Sports map[string]RollupTotals `json:"sports"`
+}
+
+// Periods aggregates the daily rollups between start and end into periods
+// ("daily", "weekly", "monthly", "quarterly", "yearly" or "all"), sorted by period start.
+// Weekly periods start on weekStart.
+func (r *Rollup) Periods(start, end, period string, weekStart time.Weekday, filter func(sportType string) bool) []PeriodTotals {
+	var periods []PeriodTotals
+	index := make(map[string]int)
+	lastDate, key := "", "all"
+	r.forEachDay(start, end, filter, func(date, sport string, totals RollupTotals) {
+		// Days arrive in order, so the period key only changes with the date
+		if period != "all" && date != lastDate {
+			lastDate, key = date, periodKey(date, period, weekStart)
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(periods)
+			index[key] = i
+			periods = append(periods, PeriodTotals{Period: key, Sports: make(map[string]RollupTotals)})
+		}
+		p := &periods[i]
+		p.Total.add(totals)
+		sportTotals := p.Sports[sport]
+		sportTotals.add(totals)
+		p.Sports[sport] = sportTotals
+	})
+	// Days are visited in order and period keys are monotonic in the date,
+	// but sort anyway so custom period keys stay correct
+	sort.Slice(periods, func(i, j int) bool { return periods[i].Period < periods[j].Period })
+	return periods
+}
+
+// Totals returns the combined totals between start and end.
+func (r *Rollup) Totals(start, end string, filter func(sportType string) bool) PeriodTotals {
+	periods := r.Periods(start, end, "all", time.Monday, filter)
+	if len(periods) == 0 {
+		return PeriodTotals{Period: "all", Sports: map[string]RollupTotals{}}
+	}
+	return periods[0]
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// activityOption sets a field of a test activity before it is normalized.
+type activityOption func(*Activity)
+
+// startingAt starts an activity at a "15:04:05" time of day instead of 7 AM.
+func startingAt(clock string) activityOption {
+	return func(a *Activity) {
+		t, _ := time.Parse("15:04:05", clock)
+		day := a.StartDateLocal.Truncate(24 * time.Hour)
+		a.StartDateLocal = day.Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second)
+		a.StartDate = a.StartDateLocal
+	}
+}
+
+// elapsed sets the elapsed time, a minute more than the moving time otherwise.
+func elapsed(seconds int) activityOption {
+	return func(a *Activity) { a.ElapsedTime = seconds }
+}
+
+// heartrate sets the average heart rate.
+func heartrate(bpm float64) activityOption {
+	return func(a *Activity) { a.AverageHeartrate = bpm }
+}
+
+// rollupActivity creates a normalized activity at 7 AM (UTC and local) on the
+// given date.
+func rollupActivity(id int64, sport, date string, distance float64, movingTime int, options ...activityOption) NormalizedActivity {
+	start, _ := time.Parse("2006-01-02", date)
+	activity := Activity{
+		ID:             id,
+		SportType:      sport,
+		StartDate:      start.Add(7 * time.Hour),
+		StartDateLocal: start.Add(7 * time.Hour),
+		Distance:       distance,
+		MovingTime:     movingTime,
+		ElapsedTime:    movingTime + 60,
+	}
+	for _, option := range options {
+		option(&activity)
+	}
+	return normalizeActivity(activity, start)
+}
+
+// tenYearsOfActivities generates one or two activities a day for ten years.
+func tenYearsOfActivities() []NormalizedActivity {
+	start := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	var activities []NormalizedActivity
+	id := int64(1)
+	for d := 0; d < 3650; d++ {
+		date := start.AddDate(0, 0, d).Format("2006-01-02")
+		activities = append(activities, rollupActivity(id, "Run", date, 8000, 2700))
+		id++
+		if d%3 == 0 {
+			activities = append(activities, rollupActivity(id, "Ride", date, 30000, 3600))
+			id++
+		}
+	}
+	return activities
+}
+
+func TestRollup_AddAndTotals(t *testing.T) {
+	rollup := NewRollup()
+	rollup.Add(
+		rollupActivity(1, "Run", "2024-11-25", 5000, 1500),
+		rollupActivity(2, "Ride", "2024-11-25", 20000, 3600),
+		rollupActivity(3, "Run", "2024-11-27", 10000, 3000),
+	)
+
+	totals := rollup.Totals("", "", nil)
+	if totals.Total.Count != 3 || totals.Total.Distance != 35000 || totals.Total.MovingTime != 8100 {
+		t.Errorf("Unexpected totals: %+v", totals.Total)
+	}
+	if totals.Sports["Run"].Count != 2 || totals.Sports["Ride"].Count != 1 {
+		t.Errorf("Unexpected sport totals: %+v", totals.Sports)
+	}
+
+	runs := rollup.Totals("2024-11-26", "2024-11-30", IsRunningActivity)
+	if runs.Total.Count != 1 || runs.Total.Distance != 10000 {
+		t.Errorf("Expected only the Nov 27 run in range, got %+v", runs.Total)
+	}
+
+	if first, last := rollup.DateBounds(); first != "2024-11-25" || last != "2024-11-27" {
+		t.Errorf("Unexpected date bounds %s..%s", first, last)
+	}
+}
+
+func TestRollup_AddReplacesExistingActivity(t *testing.T) {
+	rollup := NewRollup()
+	rollup.Add(rollupActivity(1, "Run", "2024-11-25", 5000, 1500))
+
+	// The same activity arrives again after being edited and moved to another day
+	rollup.Add(rollupActivity(1, "Run", "2024-11-26", 6000, 1800))
+
+	if rollup.Len() != 1 {
+		t.Errorf("Expected 1 activity, got %d", rollup.Len())
+	}
+	days := rollup.Days("", "", nil)
+	if len(days) != 1 || days[0].Date != "2024-11-26" || days[0].Total.Distance != 6000 {
+		t.Errorf("Expected the edited activity only on Nov 26, got %+v", days)
+	}
+}
+
+func TestRollup_HeartrateWeightedAverage(t *testing.T) {
+	a := rollupActivity(1, "Run", "2024-11-25", 5000, 1000)
+	a.AverageHeartrate = 140
+	b := rollupActivity(2, "Run", "2024-11-25", 5000, 3000)
+	b.AverageHeartrate = 160
+	c := rollupActivity(3, "Run", "2024-11-25", 5000, 3000) // no heart rate
+
+	rollup := NewRollup()
+	rollup.Add(a, b, c)
+
+	avg := rollup.Totals("", "", nil).Total.AverageHeartrate()
+	if avg != 155 {
+		t.Errorf("Expected time-weighted average HR 155, got %f", avg)
+	}
+}
+
+func TestRollup_Periods(t *testing.T) {
+	rollup := NewRollup()
+	rollup.Add(
+		rollupActivity(1, "Run", "2024-11-25", 5000, 1500), // Monday
+		strengthActivity(2, "2024-12-01"),                  // Sunday, same week
+		rollupActivity(3, "Run", "2024-12-02", 5000, 1500), // next Monday
+		rollupActivity(4, "Run", "2025-01-05", 5000, 1500),
+	)
+
+	weekly := rollup.Periods("", "", "weekly", time.Monday, nil)
+	if len(weekly) != 3 || weekly[0].Period != "2024-11-25" || weekly[0].Total.Count != 2 {
+		t.Errorf("Unexpected weekly periods: %+v", weekly)
+	}
+
+	yearly := rollup.Periods("", "", "yearly", time.Monday, nil)
+	if len(yearly) != 2 || yearly[0].Period != "2024-01-01" || yearly[0].Total.Count != 3 || yearly[1].Total.Count != 1 {
+		t.Errorf("Unexpected yearly periods: %+v", yearly)
+	}
+}
+
+// strengthActivity creates a zero-distance activity (e.g. a strength session).
+func strengthActivity(id int64, date string) NormalizedActivity {
+	return rollupActivity(id, "WeightTraining", date, 0, 1800)
+}
+
+func TestTrendsFromRollup_MatchesCalculateTrends(t *testing.T) {
+	activities := tenYearsOfActivities()
+	rollup := NewRollup()
+	rollup.Add(activities...)
+
+	for _, period := range []string{"daily", "weekly", "monthly", "yearly"} {
+		expected := CalculateTrends(activities, period, true)
+		actual := TrendsFromRollup(rollup, "", "", TrendOptions{Period: period, RunningOnly: true, WeekStart: time.Monday})
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("Trends for %s differ between per-request and rollup calculation", period)
+		}
+	}
+}
+
+// BenchmarkCalculateTrends_TenYears measures the per-request path: aggregating
+// every activity from scratch.
+func BenchmarkCalculateTrends_TenYears(b *testing.B) {
+	activities := tenYearsOfActivities()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		CalculateTrends(activities, "weekly", false)
+	}
+}
+
+// BenchmarkTrendsFromRollup_TenYears measures answering "all time" weekly
+// trends from precomputed rollups.
+func BenchmarkTrendsFromRollup_TenYears(b *testing.B) {
+	rollup := NewRollup()
+	rollup.Add(tenYearsOfActivities()...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		TrendsFromRollup(rollup, "", "", TrendOptions{Period: "weekly", WeekStart: time.Monday})
+	}
+}
+
+// BenchmarkRollupTotals_TenYears measures an all-time summary query.
+func BenchmarkRollupTotals_TenYears(b *testing.B) {
+	rollup := NewRollup()
+	rollup.Add(tenYearsOfActivities()...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rollup.Totals("", "", nil)
+	}
+}
+
+// BenchmarkRollupAdd_Incremental measures adding one new activity to a
+// ten-year rollup.
+func BenchmarkRollupAdd_Incremental(b *testing.B) {
+	rollup := NewRollup()
+	rollup.Add(tenYearsOfActivities()...)
+	activity := rollupActivity(1<<40, "Run", "2025-01-01", 5000, 1500)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rollup.Add(activity)
+	}
+}
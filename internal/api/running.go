@@ -14,6 +14,24 @@ type RunningStats struct {
 	TotalDistanceMiles float64 `json:"total_distance_miles"`
 	AveragePace    string  `json:"average_pace"`   // formatted as "X:XX min/mi"
 	AveragePaceMinPerKm string `json:"average_pace_min_per_km"` // formatted as "X:XX min/km"
+	PaceExcludedRuns int `json:"pace_excluded_runs"` // stop time outliers left out of the average pace
+	AverageGradeAdjustedPace string `json:"average_grade_adjusted_pace"` // formatted as "X:XX min/mi"
+	AverageGradeAdjustedPaceMinPerKm string `json:"average_grade_adjusted_pace_min_per_km"` // formatted as "X:XX min/km"
+	GradeFromStreams int `json:"grade_from_streams"` // runs whose grade adjustment was measured from streams rather than estimated
+}
+
+// RunningStatsOptions contains options for calculating running statistics.
+type RunningStatsOptions struct {
+	ExcludeStopOutliers bool // Leave runs with out-of-line stop time (see StopTimeOutliers) out of the average pace
+	// GradeFactors are grade adjustment factors measured from streams (see
+	// StreamGradeAdjustment) by activity ID; other runs use EstimateGradeAdjustment
+	GradeFactors map[int64]float64
+}
+
+// PersonalRecordsOptions contains options for finding personal records.
+type PersonalRecordsOptions struct {
+	GradeAdjusted bool // Rank the fastest mile and 10K by grade-adjusted time
+	GradeFactors map[int64]float64 // As in RunningStatsOptions
 }
 
 // PersonalRecords contains personal best records.
@@ -37,6 +55,10 @@ type RunRecord struct {
 	PaceMinPerKm    string  `json:"pace_min_per_km"` // formatted as "X:XX min/km"
 	ElevationGain   float64 `json:"elevation_gain"` // in meters
 	ElevationGainFeet float64 `json:"elevation_gain_feet"`
+	GradeAdjustedPace string `json:"grade_adjusted_pace"` // formatted as "X:XX min/mi"
+	GradeAdjustedPaceMinPerKm string `json:"grade_adjusted_pace_min_per_km"` // formatted as "X:XX min/km"
+	GradeAdjustment float64 `json:"grade_adjustment"` // flat distance of the same effort over the distance
+	GradeSource string `json:"grade_source"` // GradeFromStreams or GradeFromEstimate
 }
 
 // DistanceHistogram represents a histogram of run distances.
@@ -54,9 +76,9 @@ type HistogramBin struct {
 	DistanceMiles float64 `json:"distance_miles"`
 }
 
-// isRunningActivity checks if an activity is a running-related activity.
+// IsRunningActivity checks if an activity is a running-related activity.
 // Includes: Run, VirtualRun, TrailRun, etc.
-func isRunningActivity(sportType string) bool {
+func IsRunningActivity(sportType string) bool {
 	runningTypes := map[string]bool{
 		"Run":        true,
 		"VirtualRun": true,
@@ -67,18 +89,30 @@ func isRunningActivity(sportType string) bool {
 
 // CalculateRunningStats calculates running statistics from normalized activities.
 func CalculateRunningStats(activities []NormalizedActivity) RunningStats {
+	return CalculateRunningStatsWithOptions(activities, RunningStatsOptions{})
+}
+
+// CalculateRunningStatsWithOptions calculates running statistics with the given options.
+func CalculateRunningStatsWithOptions(activities []NormalizedActivity, opts RunningStatsOptions) RunningStats {
 	var stats RunningStats
 	var totalDistance float64
-	var totalMovingTime int
 	var runsOver10K int
 
+	// Distance and time behind the average pace
+	var paceDistance, paceFlatDistance float64
+	var paceMovingTime int
+	var outliers map[int64]string
+	if opts.ExcludeStopOutliers {
+		outliers = StopTimeOutliers(activities)
+	}
+
 	// Debug: count all activities and running activities
 	var totalActivities = len(activities)
 	var runningActivities = 0
 	var nonRunningTypes = make(map[string]int)
 
 	for _, activity := range activities {
-		if !isRunningActivity(activity.SportType) {
+		if !IsRunningActivity(activity.SportType) {
 			nonRunningTypes[activity.SportType]++
 			continue
 		}
@@ -87,7 +121,17 @@ func CalculateRunningStats(activities []NormalizedActivity) RunningStats {
 		// Count all running activities, even if distance is 0
 		stats.TotalRuns++
 		totalDistance += activity.Distance
-		totalMovingTime += activity.MovingTime
+		if _, outlier := outliers[activity.ID]; outlier {
+			stats.PaceExcludedRuns++
+		} else {
+			factor, source := activityGradeAdjustment(activity, opts.GradeFactors)
+			if source == GradeFromStreams {
+				stats.GradeFromStreams++
+			}
+			paceDistance += activity.Distance
+			paceFlatDistance += activity.Distance * factor
+			paceMovingTime += activity.MovingTime
+		}
 
 		// Count runs over 10K (10000 meters = 10 kilometers)
 		// Use a small tolerance (9999.5m) to account for GPS precision issues
@@ -114,10 +158,10 @@ func CalculateRunningStats(activities []NormalizedActivity) RunningStats {
 	stats.TotalDistanceMiles = totalDistance / 1609.34
 
 	// Calculate average pace (min/mi and min/km)
-	if stats.TotalRuns > 0 && totalDistance > 0 {
+	if stats.TotalRuns > 0 && paceDistance > 0 {
 		// Average pace = total time / total distance
 		// Pace in seconds per meter
-		paceSecPerMeter := float64(totalMovingTime) / totalDistance
+		paceSecPerMeter := float64(paceMovingTime) / paceDistance
 		
 		// Convert to min/mi
 		paceSecPerMile := paceSecPerMeter * 1609.34
@@ -126,6 +170,11 @@ func CalculateRunningStats(activities []NormalizedActivity) RunningStats {
 		// Convert to min/km
 		paceSecPerKm := paceSecPerMeter * 1000
 		stats.AveragePaceMinPerKm = formatPace(paceSecPerKm)
+
+		// Grade-adjusted pace = total time / flat distance of the same effort
+		gapSecPerMeter := float64(paceMovingTime) / paceFlatDistance
+		stats.AverageGradeAdjustedPace = formatPace(gapSecPerMeter * 1609.34)
+		stats.AverageGradeAdjustedPaceMinPerKm = formatPace(gapSecPerMeter * 1000)
 	}
 
 	return stats
@@ -133,48 +182,61 @@ func CalculateRunningStats(activities []NormalizedActivity) RunningStats {
 
 // CalculatePersonalRecords finds personal records from running activities.
 func CalculatePersonalRecords(activities []NormalizedActivity) PersonalRecords {
+	return CalculatePersonalRecordsWithOptions(activities, PersonalRecordsOptions{})
+}
+
+// CalculatePersonalRecordsWithOptions finds personal records with the given options.
+func CalculatePersonalRecordsWithOptions(activities []NormalizedActivity, opts PersonalRecordsOptions) PersonalRecords {
 	var prs PersonalRecords
 	const mileInMeters = 1609.34
 	const tenKInMeters = 10000.0
 	const mileTolerance = 200.0 // 200 meters tolerance for "mile" runs
 	const tenKTolerance = 500.0 // 500 meters tolerance for "10K" runs
 
-	var fastestMileTime int = -1
-	var fastest10KTime int = -1
+	var fastestMileTime float64 = -1
+	var fastest10KTime float64 = -1
 	var longestDistance float64 = -1
 	var mostElevation float64 = -1
 
 	for _, activity := range activities {
-		if !isRunningActivity(activity.SportType) {
+		if !IsRunningActivity(activity.SportType) {
 			continue
 		}
 
+		// Compare times on the flat when grade adjusted: a hilly 10K in 50:00
+		// may have been the effort of a flat one in 47:00
+		factor, source := activityGradeAdjustment(activity, opts.GradeFactors)
+		runTime := float64(activity.MovingTime)
+		if opts.GradeAdjusted {
+			runTime /= factor
+		}
+
 		// Fastest mile: find runs between 0.9 and 1.1 miles
 		if activity.Distance >= (mileInMeters-mileTolerance) && activity.Distance <= (mileInMeters+mileTolerance) {
-			if fastestMileTime == -1 || activity.MovingTime < fastestMileTime {
-				fastestMileTime = activity.MovingTime
-				prs.FastestMile = createRunRecord(activity)
+			if fastestMileTime == -1 || runTime < fastestMileTime {
+				fastestMileTime = runTime
+				prs.FastestMile = createRunRecord(activity, factor, source)
 			}
 		}
 
 		// Fastest 10K: find runs between 9.5K and 10.5K
 		if activity.Distance >= (tenKInMeters-tenKTolerance) && activity.Distance <= (tenKInMeters+tenKTolerance) {
-			if fastest10KTime == -1 || activity.MovingTime < fastest10KTime {
-				fastest10KTime = activity.MovingTime
-				prs.Fastest10K = createRunRecord(activity)
+			if fastest10KTime == -1 || runTime < fastest10KTime {
+				fastest10KTime = runTime
+				prs.Fastest10K = createRunRecord(activity, factor, source)
 			}
 		}
 
 		// Longest run
 		if activity.Distance > longestDistance {
 			longestDistance = activity.Distance
-			prs.LongestRun = createRunRecord(activity)
+			prs.LongestRun = createRunRecord(activity, factor, source)
 		}
 
 		// Most elevation gain
 		if activity.TotalElevationGain > mostElevation {
 			mostElevation = activity.TotalElevationGain
-			prs.MostElevation = createRunRecord(activity)
+			prs.MostElevation = createRunRecord(activity, factor, source)
 		}
 	}
 
@@ -190,7 +252,7 @@ func GenerateDistanceHistogram(activities []NormalizedActivity, useMiles bool) D
 	// Filter to only running activities
 	var runs []NormalizedActivity
 	for _, activity := range activities {
-		if isRunningActivity(activity.SportType) {
+		if IsRunningActivity(activity.SportType) {
 			runs = append(runs, activity)
 		}
 	}
@@ -269,8 +331,9 @@ func GenerateDistanceHistogram(activities []NormalizedActivity, useMiles bool) D
 	return histogram
 }
 
-// createRunRecord creates a RunRecord from a NormalizedActivity.
-func createRunRecord(activity NormalizedActivity) *RunRecord {
+// createRunRecord creates a RunRecord from a NormalizedActivity with its grade
+// adjustment factor and where that came from.
+func createRunRecord(activity NormalizedActivity, gradeFactor float64, gradeSource string) *RunRecord {
 	record := &RunRecord{
 		ID:              activity.ID,
 		Name:            activity.Name,
@@ -281,6 +344,8 @@ func createRunRecord(activity NormalizedActivity) *RunRecord {
 		MovingTime:      activity.MovingTime,
 		ElevationGain:   activity.TotalElevationGain,
 		ElevationGainFeet: activity.ElevationGainFeet,
+		GradeAdjustment: gradeFactor,
+		GradeSource: gradeSource,
 	}
 
 	// Calculate pace (min/mi and min/km)
@@ -295,6 +360,10 @@ func createRunRecord(activity NormalizedActivity) *RunRecord {
 		// Convert to min/km
 		paceSecPerKm := paceSecPerMeter * 1000
 		record.PaceMinPerKm = formatPace(paceSecPerKm)
+
+		// Grade-adjusted pace in both units
+		record.GradeAdjustedPace = formatPace(paceSecPerMile / gradeFactor)
+		record.GradeAdjustedPaceMinPerKm = formatPace(paceSecPerKm / gradeFactor)
 	}
 
 	return record
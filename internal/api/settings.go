@@ -0,0 +1,245 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Unit systems for AthleteSettings.Units.
+const (
+	UnitsMetric   = "metric"
+	UnitsImperial = "imperial"
+)
+
+// Sources of a settings change.
+const (
+	SourceUser   = "user"
+	SourceStrava = "strava"
+)
+
+// AthleteSettings are the athlete's physiological details and display
+// preferences. Zero values mean unknown.
+type AthleteSettings struct {
+	MaxHR     float64 `json:"max_hr,omitempty"`     // beats per minute
+	RestingHR float64 `json:"resting_hr,omitempty"` // beats per minute
+	// LTHR is the lactate threshold heart rate, in beats per minute
+	LTHR      float64 `json:"lthr,omitempty"`
+	FTP       float64 `json:"ftp,omitempty"`        // functional threshold power, in watts
+	Weight    float64 `json:"weight,omitempty"`     // in kilograms
+	Birthdate string  `json:"birthdate,omitempty"`  // YYYY-MM-DD
+	Sex       string  `json:"sex,omitempty"`        // "male" or "female"
+	Units     string  `json:"units,omitempty"`      // UnitsMetric or UnitsImperial
+	WeekStart string  `json:"week_start,omitempty"` // weekday name, e.g. "monday"
+}
+
+// Validate checks that every known setting is plausible.
+func (s AthleteSettings) Validate() error {
+	if s.MaxHR != 0 && (s.MaxHR < 100 || s.MaxHR > 240) {
+		return fmt.Errorf("invalid max_hr %g: must be between 100 and 240", s.MaxHR)
+	}
+	if s.RestingHR != 0 && (s.RestingHR < 25 || s.RestingHR > 120) {
+		return fmt.Errorf("invalid resting_hr %g: must be between 25 and 120", s.RestingHR)
+	}
+	if s.MaxHR != 0 && s.RestingHR != 0 && s.RestingHR >= s.MaxHR {
+		return fmt.Errorf("invalid heart rates: resting_hr %g must be below max_hr %g", s.RestingHR, s.MaxHR)
+	}
+	if s.LTHR != 0 {
+		if s.LTHR < 80 || s.LTHR > 230 {
+			return fmt.Errorf("invalid lthr %g: must be between 80 and 230", s.LTHR)
+		}
+		if (s.MaxHR != 0 && s.LTHR > s.MaxHR) || (s.RestingHR != 0 && s.LTHR <= s.RestingHR) {
+			return fmt.Errorf("invalid lthr %g: must lie between resting_hr and max_hr", s.LTHR)
+		}
+	}
+	if s.FTP != 0 && (s.FTP < 30 || s.FTP > 2000) {
+		return fmt.Errorf("invalid ftp %g: must be between 30 and 2000 watts", s.FTP)
+	}
+	if s.Weight != 0 && (s.Weight < 20 || s.Weight > 300) {
+		return fmt.Errorf("invalid weight %g: must be between 20 and 300 kg", s.Weight)
+	}
+	if s.Birthdate != "" {
+		birthdate, err := time.Parse("2006-01-02", s.Birthdate)
+		if err != nil {
+			return fmt.Errorf("invalid birthdate %q: must be YYYY-MM-DD", s.Birthdate)
+		}
+		if age := ageOn(birthdate, nowFunc()); age < 5 || age > 120 {
+			return fmt.Errorf("invalid birthdate %q: age must be between 5 and 120", s.Birthdate)
+		}
+	}
+	if s.Sex != "" && s.Sex != "male" && s.Sex != "female" {
+		return fmt.Errorf("invalid sex %q: must be 'male' or 'female'", s.Sex)
+	}
+	if s.Units != "" && s.Units != UnitsMetric && s.Units != UnitsImperial {
+		return fmt.Errorf("invalid units %q: must be 'metric' or 'imperial'", s.Units)
+	}
+	if s.WeekStart != "" {
+		if _, err := ParseWeekday(s.WeekStart); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HeartRateConfigured reports whether both max and resting heart rate are set.
+func (s AthleteSettings) HeartRateConfigured() bool {
+	return s.MaxHR > 0 && s.RestingHR > 0
+}
+
+// StressModel returns the athlete's heart rates for TRIMP, with the defaults
+// of DefaultStressModel for those that are unknown.
+func (s AthleteSettings) StressModel() StressModel {
+	model := DefaultStressModel()
+	if s.MaxHR > 0 {
+		model.MaxHR = s.MaxHR
+	}
+	if s.RestingHR > 0 {
+		model.RestingHR = s.RestingHR
+	}
+	if model.RestingHR >= model.MaxHR {
+		return DefaultStressModel()
+	}
+	return model
+}
+
+// Age returns the athlete's age in whole years on date, or 0 without a
+// birthdate.
+func (s AthleteSettings) Age(date time.Time) float64 {
+	birthdate, err := time.Parse("2006-01-02", s.Birthdate)
+	if err != nil {
+		return 0
+	}
+	return ageOn(birthdate, date)
+}
+
+// ageOn returns the whole years between birthdate and date.
+func ageOn(birthdate, date time.Time) float64 {
+	years := date.Year() - birthdate.Year()
+	if date.Month() < birthdate.Month() || (date.Month() == birthdate.Month() && date.Day() < birthdate.Day()) {
+		years--
+	}
+	return float64(years)
+}
+
+// SettingsChange is the athlete's settings from a date onwards.
+type SettingsChange struct {
+	EffectiveDate string          `json:"effective_date"` // YYYY-MM-DD
+	Settings      AthleteSettings `json:"settings"`
+	ChangedAt     time.Time       `json:"changed_at"`
+	Source        string          `json:"source"` // SourceUser or SourceStrava
+}
+
+// SettingsHistory is every change to an athlete's settings, so analyses of
+// the past use the FTP, weight and heart rates in effect at the time.
+type SettingsHistory struct {
+	AthleteID int64            `json:"athlete_id"`
+	Changes   []SettingsChange `json:"changes"` // by effective date, oldest first
+	// Units are the units last chosen, with the settings or on their own. They
+	// only change how stats are shown, for every date, so choosing them on
+	// their own isn't recorded as a change.
+	Units string `json:"units,omitempty"`
+}
+
+// Apply records a change, replacing any earlier change with the same
+// effective date.
+func (h *SettingsHistory) Apply(change SettingsChange) error {
+	if _, err := time.Parse("2006-01-02", change.EffectiveDate); err != nil {
+		return fmt.Errorf("invalid effective_date %q: must be YYYY-MM-DD", change.EffectiveDate)
+	}
+	if err := change.Settings.Validate(); err != nil {
+		return err
+	}
+	i := sort.Search(len(h.Changes), func(i int) bool { return h.Changes[i].EffectiveDate >= change.EffectiveDate })
+	if i < len(h.Changes) && h.Changes[i].EffectiveDate == change.EffectiveDate {
+		h.Changes[i] = change
+		return nil
+	}
+	h.Changes = append(h.Changes, SettingsChange{})
+	copy(h.Changes[i+1:], h.Changes[i:])
+	h.Changes[i] = change
+	return nil
+}
+
+// At returns the settings in effect on date (YYYY-MM-DD). Before the first
+// change, the earliest known settings are the best guess; without any
+// changes it returns the zero settings.
+func (h *SettingsHistory) At(date string) AthleteSettings {
+	if h == nil || len(h.Changes) == 0 {
+		return AthleteSettings{}
+	}
+	i := sort.Search(len(h.Changes), func(i int) bool { return h.Changes[i].EffectiveDate > date })
+	if i == 0 {
+		return h.Changes[0].Settings
+	}
+	return h.Changes[i-1].Settings
+}
+
+// PreferredUnits returns the units last chosen, or "" if none were.
+func (h *SettingsHistory) PreferredUnits() string {
+	if h == nil {
+		return ""
+	}
+	if h.Units != "" {
+		return h.Units
+	}
+	// Histories from before Units was kept
+	return h.Current().Units
+}
+
+// Current returns the latest settings, including any that take effect in the
+// future.
+func (h *SettingsHistory) Current() AthleteSettings {
+	if h == nil || len(h.Changes) == 0 {
+		return AthleteSettings{}
+	}
+	return h.Changes[len(h.Changes)-1].Settings
+}
+
+// StressModelAt returns the stress model in effect on date.
+func (h *SettingsHistory) StressModelAt(date string) StressModel {
+	return h.At(date).StressModel()
+}
+
+// stravaZoneShareOfMax is where Strava's default heart rate zones put the
+// start of the top zone: 97% of maximum heart rate.
+const stravaZoneShareOfMax = 0.97
+
+// SettingsFromStrava prefills settings from the athlete's Strava profile and
+// zones; either may be nil. Maximum heart rate can only be recovered from
+// Strava's default zones, which are derived from it, not from custom zones.
+func SettingsFromStrava(athlete *StravaAthlete, zones *AthleteZones) AthleteSettings {
+	var settings AthleteSettings
+	if athlete != nil {
+		settings.Weight = math.Round(athlete.Weight*10) / 10
+		settings.FTP = athlete.FTP
+		switch athlete.Sex {
+		case "M":
+			settings.Sex = "male"
+		case "F":
+			settings.Sex = "female"
+		}
+		switch athlete.MeasurementPreference {
+		case "meters":
+			settings.Units = UnitsMetric
+		case "feet":
+			settings.Units = UnitsImperial
+		}
+	}
+	if zones != nil && zones.HeartRate != nil && !zones.HeartRate.CustomZones {
+		if n := len(zones.HeartRate.Zones); n > 1 && zones.HeartRate.Zones[n-1].Min > 0 {
+			settings.MaxHR = math.Round(float64(zones.HeartRate.Zones[n-1].Min) / stravaZoneShareOfMax)
+		}
+	}
+	// Drop anything implausible rather than rejecting the whole profile
+	if (AthleteSettings{Weight: settings.Weight}).Validate() != nil {
+		settings.Weight = 0
+	}
+	if (AthleteSettings{FTP: settings.FTP}).Validate() != nil {
+		settings.FTP = 0
+	}
+	if (AthleteSettings{MaxHR: settings.MaxHR}).Validate() != nil {
+		settings.MaxHR = 0
+	}
+	return settings
+}
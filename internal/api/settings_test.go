@@ -0,0 +1,189 @@
+package api
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAthleteSettingsValidate(t *testing.T) {
+	pinNow(t, time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+
+	valid := AthleteSettings{
+		MaxHR: 188, RestingHR: 48, LTHR: 170, FTP: 250, Weight: 70.5,
+		Birthdate: "1985-07-15", Sex: "female", Units: UnitsMetric, WeekStart: "sunday",
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Unexpected error for valid settings: %v", err)
+	}
+	if err := (AthleteSettings{}).Validate(); err != nil {
+		t.Errorf("Expected empty settings to be valid, got %v", err)
+	}
+
+	invalid := map[string]AthleteSettings{
+		"max_hr too high":       {MaxHR: 250},
+		"resting above max":     {MaxHR: 110, RestingHR: 115},
+		"lthr above max":        {MaxHR: 180, LTHR: 185},
+		"lthr below resting":    {RestingHR: 90, LTHR: 85},
+		"ftp too low":           {FTP: 10},
+		"weight too high":       {Weight: 400},
+		"malformed birthdate":   {Birthdate: "15/07/1985"},
+		"birthdate in a minute": {Birthdate: "2024-06-01"},
+		"unknown sex":           {Sex: "M"},
+		"unknown units":         {Units: "furlongs"},
+		"unknown week start":    {WeekStart: "someday"},
+	}
+	for name, settings := range invalid {
+		if err := settings.Validate(); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+}
+
+func TestAthleteSettingsDerived(t *testing.T) {
+	settings := AthleteSettings{MaxHR: 185, Birthdate: "1980-06-15"}
+	if model := settings.StressModel(); model.MaxHR != 185 || model.RestingHR != DefaultStressModel().RestingHR {
+		t.Errorf("Expected the max HR with the default resting HR, got %+v", model)
+	}
+	if settings.HeartRateConfigured() {
+		t.Error("Expected heart rates not to be configured without resting HR")
+	}
+	if age := settings.Age(time.Date(2024, 6, 14, 0, 0, 0, 0, time.UTC)); age != 43 {
+		t.Errorf("Expected age 43 the day before the birthday, got %.0f", age)
+	}
+	if age := settings.Age(time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)); age != 44 {
+		t.Errorf("Expected age 44 on the birthday, got %.0f", age)
+	}
+	if age := (AthleteSettings{}).Age(time.Now()); age != 0 {
+		t.Errorf("Expected no age without a birthdate, got %.0f", age)
+	}
+}
+
+func TestSettingsHistory(t *testing.T) {
+	history := &SettingsHistory{AthleteID: 1}
+	if got := history.At("2024-01-01"); got != (AthleteSettings{}) {
+		t.Errorf("Expected empty settings without history, got %+v", got)
+	}
+
+	for _, change := range []SettingsChange{
+		{EffectiveDate: "2024-03-01", Settings: AthleteSettings{FTP: 250, Weight: 72}},
+		{EffectiveDate: "2024-01-01", Settings: AthleteSettings{FTP: 230, Weight: 74}},
+		{EffectiveDate: "2024-06-01", Settings: AthleteSettings{FTP: 260, Weight: 71}},
+		// The same date replaces the earlier change
+		{EffectiveDate: "2024-03-01", Settings: AthleteSettings{FTP: 245, Weight: 72}},
+	} {
+		if err := history.Apply(change); err != nil {
+			t.Fatalf("Unexpected error applying %+v: %v", change, err)
+		}
+	}
+	if len(history.Changes) != 3 || history.Changes[0].EffectiveDate != "2024-01-01" {
+		t.Fatalf("Expected 3 changes by effective date, got %+v", history.Changes)
+	}
+
+	tests := map[string]float64{
+		"2023-06-01": 230, // before the first change, the earliest known value
+		"2024-01-01": 230,
+		"2024-02-29": 230,
+		"2024-03-01": 245,
+		"2024-05-31": 245,
+		"2024-07-01": 260,
+	}
+	for date, ftp := range tests {
+		if got := history.At(date).FTP; got != ftp {
+			t.Errorf("Expected an FTP of %.0f on %s, got %.0f", ftp, date, got)
+		}
+	}
+	if history.Current().FTP != 260 {
+		t.Errorf("Expected the latest settings to be current, got %+v", history.Current())
+	}
+
+	if err := history.Apply(SettingsChange{EffectiveDate: "2024-13-01"}); err == nil {
+		t.Error("Expected an error for an invalid effective date")
+	}
+	if err := history.Apply(SettingsChange{EffectiveDate: "2024-08-01", Settings: AthleteSettings{FTP: 5}}); err == nil {
+		t.Error("Expected an error for invalid settings")
+	}
+	if len(history.Changes) != 3 {
+		t.Errorf("Expected rejected changes not to be recorded, got %d changes", len(history.Changes))
+	}
+	if got := history.PreferredUnits(); got != "" {
+		t.Errorf("Expected no preferred units, got %q", got)
+	}
+	history.Changes[2].Settings.Units = UnitsMetric
+	if got := history.PreferredUnits(); got != UnitsMetric {
+		t.Errorf("Expected the current settings' units, got %q", got)
+	}
+	history.Units = UnitsImperial
+	if got := history.PreferredUnits(); got != UnitsImperial {
+		t.Errorf("Expected the units chosen last, got %q", got)
+	}
+}
+
+func TestSettingsFromStrava(t *testing.T) {
+	athlete := &StravaAthlete{Sex: "F", Weight: 61.23, FTP: 210, MeasurementPreference: "meters"}
+	zones := &AthleteZones{HeartRate: &HeartRateZones{Zones: []ZoneRange{
+		{Min: 0, Max: 123}, {Min: 123, Max: 153}, {Min: 153, Max: 169}, {Min: 169, Max: 184}, {Min: 184, Max: -1},
+	}}}
+	settings := SettingsFromStrava(athlete, zones)
+	expected := AthleteSettings{MaxHR: math.Round(184 / 0.97), FTP: 210, Weight: 61.2, Sex: "female", Units: UnitsMetric}
+	if settings != expected {
+		t.Errorf("Expected %+v, got %+v", expected, settings)
+	}
+
+	// Custom zones say nothing about max heart rate
+	zones.HeartRate.CustomZones = true
+	if settings := SettingsFromStrava(athlete, zones); settings.MaxHR != 0 {
+		t.Errorf("Expected no max HR from custom zones, got %.0f", settings.MaxHR)
+	}
+
+	// Implausible values are dropped, the rest kept
+	odd := &StravaAthlete{Weight: 1, FTP: 210, MeasurementPreference: "feet"}
+	if settings := SettingsFromStrava(odd, nil); settings.Weight != 0 || settings.FTP != 210 || settings.Units != UnitsImperial {
+		t.Errorf("Unexpected settings from an odd profile: %+v", settings)
+	}
+	if settings := SettingsFromStrava(nil, nil); settings != (AthleteSettings{}) {
+		t.Errorf("Expected empty settings without a profile, got %+v", settings)
+	}
+}
+
+func TestSettingsHistoryDrivesAnalyses(t *testing.T) {
+	history := &SettingsHistory{}
+	history.Apply(SettingsChange{EffectiveDate: "2024-03-01", Settings: AthleteSettings{MaxHR: 200, RestingHR: 50}})
+	history.Apply(SettingsChange{EffectiveDate: "2024-03-10", Settings: AthleteSettings{MaxHR: 180, RestingHR: 50}})
+
+	// The same run is a bigger share of heart rate reserve after max HR drops
+	runs := []NormalizedActivity{
+		rollupActivity(1, "Run", "2024-03-05", 10000, 3000, heartrate(155)),
+		rollupActivity(2, "Run", "2024-03-15", 10000, 3000, heartrate(155)),
+	}
+	result := EstimateVO2max(runs, nil, VO2maxOptions{
+		MaxHR: 180, RestingHR: 50, HeartRateConfigured: true,
+		HeartRatesAt: func(date string) (float64, float64) {
+			model := history.StressModelAt(date)
+			return model.MaxHR, model.RestingHR
+		},
+	})
+	if len(result.Estimates) != 2 {
+		t.Fatalf("Expected both runs to qualify, got %+v", result.Estimates)
+	}
+	if first, second := result.Estimates[0], result.Estimates[1]; math.Abs(first.HeartRateReserve-0.7) > 1e-9 || second.HeartRateReserve <= first.HeartRateReserve {
+		t.Errorf("Expected each run to use the heart rates of its date, got %.3f and %.3f", first.HeartRateReserve, second.HeartRateReserve)
+	}
+
+	rollup := NewRollup()
+	for _, run := range runs {
+		rollup.Add(run)
+	}
+	workload, err := WorkloadFromRollup(rollup, "2024-03-05", "2024-03-15", nil, WorkloadOptions{
+		Metric:   LoadStress,
+		StressAt: history.StressModelAt,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	first, last := workload.Days[0], workload.Days[len(workload.Days)-1]
+	total := RollupTotals{MovingTime: 3000, HeartrateTime: 3000, HeartrateSum: 155 * 3000}
+	if math.Abs(first.Load-history.StressModelAt("2024-03-05").Stress(total)) > 1e-9 || last.Load <= first.Load {
+		t.Errorf("Expected each day's stress to use its heart rates, got %.1f and %.1f", first.Load, last.Load)
+	}
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// StopTime compares moving and elapsed time for a group of activities.
+type StopTime struct {
+	Count       int `json:"count"`
+	MovingTime  int `json:"moving_time"`  // in seconds
+	ElapsedTime int `json:"elapsed_time"` // in seconds
+	StoppedTime int `json:"stopped_time"` // elapsed minus moving time, in seconds
+	// MovingRatio is moving over elapsed time (0–1); 1 means no stops
+	MovingRatio float64 `json:"moving_ratio"`
+	Outliers    int     `json:"outliers"`
+}
+
+func (s *StopTime) add(activity NormalizedActivity, outlier bool) {
+	s.Count++
+	s.MovingTime += activity.MovingTime
+	s.ElapsedTime += activityElapsedTime(activity)
+	s.StoppedTime = s.ElapsedTime - s.MovingTime
+	if s.ElapsedTime > 0 {
+		s.MovingRatio = float64(s.MovingTime) / float64(s.ElapsedTime)
+	}
+	if outlier {
+		s.Outliers++
+	}
+}
+
+// StopTimePeriod is the stop time of one period.
+type StopTimePeriod struct {
+	Period string `json:"period"` // first day of the period, YYYY-MM-DD
+	StopTime
+	Sports map[string]StopTime `json:"sports"`
+}
+
+// StopTimeActivity is the stop time of a single activity.
+type StopTimeActivity struct {
+	ID          int64   `json:"id"`
+	Name        string  `json:"name"`
+	Date        string  `json:"date"` // YYYY-MM-DD
+	SportType   string  `json:"sport_type"`
+	MovingTime  int     `json:"moving_time"`  // in seconds
+	ElapsedTime int     `json:"elapsed_time"` // in seconds
+	StoppedTime int     `json:"stopped_time"` // in seconds
+	MovingRatio float64 `json:"moving_ratio"`
+	Reason      string  `json:"reason,omitempty"` // why the activity is an outlier
+}
+
+// StopTimeAnalysis is the stop time of activities in total, per sport and per
+// period, plus the activities whose stops are out of line.
+type StopTimeAnalysis struct {
+	Period   string              `json:"period"`
+	Total    StopTime            `json:"total"`
+	Sports   map[string]StopTime `json:"sports"`
+	Periods  []StopTimePeriod    `json:"periods"`
+	Outliers []StopTimeActivity  `json:"outliers"` // most time stopped first
+}
+
+// Stop time outlier settings. An activity is an outlier when it stopped for at
+// least stopOutlierMinStop and either stopped for more than it moved or its
+// moving ratio is far below what's usual for the sport.
+const (
+	stopOutlierMinStop    = 10 * 60 // seconds
+	stopOutlierMinRatio   = 0.5
+	stopOutlierMinSamples = 5   // activities of a sport needed to judge what's usual
+	stopOutlierMADs       = 3.0 // robust z-score below the sport's median ratio
+)
+
+// activityElapsedTime returns the elapsed time, which is never less than the
+// moving time (manual activities sometimes leave it at zero).
+func activityElapsedTime(activity NormalizedActivity) int {
+	if activity.ElapsedTime < activity.MovingTime {
+		return activity.MovingTime
+	}
+	return activity.ElapsedTime
+}
+
+// stopTimeActivity returns the stop time of one activity.
+func stopTimeActivity(activity NormalizedActivity) StopTimeActivity {
+	elapsed := activityElapsedTime(activity)
+	result := StopTimeActivity{
+		ID:          activity.ID,
+		Name:        activity.Name,
+		Date:        activity.LocalDateStr,
+		SportType:   activity.SportType,
+		MovingTime:  activity.MovingTime,
+		ElapsedTime: elapsed,
+		StoppedTime: elapsed - activity.MovingTime,
+		MovingRatio: 1,
+	}
+	if elapsed > 0 {
+		result.MovingRatio = float64(activity.MovingTime) / float64(elapsed)
+	}
+	return result
+}
+
+// StopTimeOutliers returns the activities whose stop time is out of line,
+// keyed by activity ID with the reason. A sport's usual moving ratio is judged
+// from all of its activities, so pass the whole range rather than a sample.
+func StopTimeOutliers(activities []NormalizedActivity) map[int64]string {
+	ratios := make(map[string][]float64)
+	for _, activity := range activities {
+		if activityElapsedTime(activity) > 0 {
+			ratios[activity.SportType] = append(ratios[activity.SportType], stopTimeActivity(activity).MovingRatio)
+		}
+	}
+
+	// Lowest usual ratio per sport: median minus stopOutlierMADs scaled MADs
+	floors := make(map[string]float64)
+	for sport, values := range ratios {
+		if len(values) < stopOutlierMinSamples {
+			continue
+		}
+		center := median(append([]float64(nil), values...))
+		deviations := make([]float64, len(values))
+		for i, v := range values {
+			deviations[i] = math.Abs(v - center)
+		}
+		// 1.4826 scales the MAD to a standard deviation for normal data
+		spread := 1.4826 * median(deviations)
+		floors[sport] = center - stopOutlierMADs*spread
+	}
+
+	outliers := make(map[int64]string)
+	for _, activity := range activities {
+		stop := stopTimeActivity(activity)
+		if stop.StoppedTime < stopOutlierMinStop {
+			continue
+		}
+		if stop.MovingRatio < stopOutlierMinRatio {
+			outliers[activity.ID] = "stopped longer than moving"
+		} else if floor, ok := floors[activity.SportType]; ok && stop.MovingRatio < floor {
+			outliers[activity.ID] = "unusually long stops for " + activity.SportType
+		}
+	}
+	return outliers
+}
+
+// CalculateStopTime analyzes elapsed versus moving time of the activities in
+// total, per sport and per period ("daily", "weekly", "monthly", "quarterly"
+// or "yearly"; weeks start on weekStart).
+func CalculateStopTime(activities []NormalizedActivity, period string, weekStart time.Weekday) StopTimeAnalysis {
+	analysis := StopTimeAnalysis{
+		Period:   period,
+		Sports:   make(map[string]StopTime),
+		Periods:  []StopTimePeriod{},
+		Outliers: []StopTimeActivity{},
+	}
+	outliers := StopTimeOutliers(activities)
+
+	periods := make(map[string]*StopTimePeriod)
+	for _, activity := range activities {
+		reason, outlier := outliers[activity.ID]
+
+		analysis.Total.add(activity, outlier)
+		sport := analysis.Sports[activity.SportType]
+		sport.add(activity, outlier)
+		analysis.Sports[activity.SportType] = sport
+
+		key := periodKey(activity.LocalDateStr, period, weekStart)
+		p, ok := periods[key]
+		if !ok {
+			p = &StopTimePeriod{Period: key, Sports: make(map[string]StopTime)}
+			periods[key] = p
+		}
+		p.add(activity, outlier)
+		periodSport := p.Sports[activity.SportType]
+		periodSport.add(activity, outlier)
+		p.Sports[activity.SportType] = periodSport
+
+		if outlier {
+			stop := stopTimeActivity(activity)
+			stop.Reason = reason
+			analysis.Outliers = append(analysis.Outliers, stop)
+		}
+	}
+
+	for _, p := range periods {
+		analysis.Periods = append(analysis.Periods, *p)
+	}
+	sort.Slice(analysis.Periods, func(i, j int) bool {
+		return analysis.Periods[i].Period < analysis.Periods[j].Period
+	})
+	sort.Slice(analysis.Outliers, func(i, j int) bool {
+		return analysis.Outliers[i].StoppedTime > analysis.Outliers[j].StoppedTime
+	})
+	return analysis
+}
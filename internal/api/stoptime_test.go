@@ -0,0 +1,85 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+// stopActivity creates an activity that moved for movingTime out of elapsedTime.
+// stopActivities returns five runs with short stops, one with the watch left
+// running for an hour, and a ride with a long cafe stop.
+func stopActivities() []NormalizedActivity {
+	return []NormalizedActivity{
+		rollupActivity(1, "Run", "2024-11-25", 10000, 3000, elapsed(3060)),
+		rollupActivity(2, "Run", "2024-11-26", 10000, 3000, elapsed(3120)),
+		rollupActivity(3, "Run", "2024-11-27", 10000, 3000, elapsed(3090)),
+		rollupActivity(4, "Run", "2024-11-28", 10000, 3000, elapsed(3030)),
+		rollupActivity(5, "Run", "2024-12-02", 10000, 3000, elapsed(3150)),
+		rollupActivity(6, "Run", "2024-12-03", 5000, 2400, elapsed(6000)), // watch left on
+		rollupActivity(7, "Ride", "2024-12-04", 60000, 7200, elapsed(9000)),
+	}
+}
+
+func TestStopTimeOutliers(t *testing.T) {
+	outliers := StopTimeOutliers(stopActivities())
+	if len(outliers) != 1 {
+		t.Fatalf("Expected only the run with the watch left on, got %v", outliers)
+	}
+	if outliers[6] != "stopped longer than moving" {
+		t.Errorf("Unexpected reason: %q", outliers[6])
+	}
+
+	// A run with 12 minutes of stops is unusual next to runs with 1–3 minutes
+	activities := append(stopActivities(), rollupActivity(8, "Run", "2024-12-05", 10000, 3000, elapsed(3720)))
+	if reason := StopTimeOutliers(activities)[8]; reason != "unusually long stops for Run" {
+		t.Errorf("Expected the 12 minute stop to be unusual, got %q", reason)
+	}
+	// but the same stop is fine without enough history to compare to
+	if _, ok := StopTimeOutliers(activities[5:])[8]; ok {
+		t.Error("Expected no outlier from too few runs")
+	}
+}
+
+func TestCalculateStopTime(t *testing.T) {
+	analysis := CalculateStopTime(stopActivities(), "weekly", time.Monday)
+
+	run := analysis.Sports["Run"]
+	if run.Count != 6 || run.MovingTime != 17400 || run.ElapsedTime != 21450 || run.StoppedTime != 4050 || run.Outliers != 1 {
+		t.Errorf("Unexpected running stop time: %+v", run)
+	}
+	if expected := 17400.0 / 21450; run.MovingRatio != expected {
+		t.Errorf("Expected moving ratio %f, got %f", expected, run.MovingRatio)
+	}
+	if analysis.Total.Count != 7 || analysis.Total.StoppedTime != 5850 {
+		t.Errorf("Unexpected total: %+v", analysis.Total)
+	}
+
+	if len(analysis.Periods) != 2 {
+		t.Fatalf("Expected 2 weeks, got %+v", analysis.Periods)
+	}
+	week := analysis.Periods[1]
+	if week.Period != "2024-12-02" || week.Count != 3 || week.Sports["Ride"].StoppedTime != 1800 {
+		t.Errorf("Unexpected second week: %+v", week)
+	}
+
+	if len(analysis.Outliers) != 1 || analysis.Outliers[0].ID != 6 || analysis.Outliers[0].StoppedTime != 3600 {
+		t.Errorf("Unexpected outliers: %+v", analysis.Outliers)
+	}
+}
+
+func TestCalculateRunningStats_ExcludeStopOutliers(t *testing.T) {
+	activities := stopActivities()
+	// The watch-left-on run was a slow 8:00/km, dragging the average down
+	stats := CalculateRunningStats(activities)
+	if stats.AveragePaceMinPerKm != "5:16" || stats.PaceExcludedRuns != 0 {
+		t.Errorf("Unexpected pace with outliers: %s (%d excluded)", stats.AveragePaceMinPerKm, stats.PaceExcludedRuns)
+	}
+
+	stats = CalculateRunningStatsWithOptions(activities, RunningStatsOptions{ExcludeStopOutliers: true})
+	if stats.AveragePaceMinPerKm != "5:00" || stats.PaceExcludedRuns != 1 {
+		t.Errorf("Unexpected pace without outliers: %s (%d excluded)", stats.AveragePaceMinPerKm, stats.PaceExcludedRuns)
+	}
+	if stats.TotalRuns != 6 || stats.TotalDistance != 55000 {
+		t.Errorf("Outliers should still count toward totals: %+v", stats)
+	}
+}
@@ -43,6 +43,7 @@ type Activity struct {
 	AverageCadence    float64   `json:"average_cadence"`
 	AverageWatts       float64   `json:"average_watts"`
 	WeightedAverageWatts float64 `json:"weighted_average_watts"`
+	DeviceWatts       bool      `json:"device_watts"`       // false when Strava estimated the power
 	Kilojoules        float64   `json:"kilojoules"`
 	HasHeartrate      bool      `json:"has_heartrate"`
 	AverageHeartrate  float64   `json:"average_heartrate"`
@@ -52,6 +53,150 @@ type Activity struct {
 	WorkoutType       *int      `json:"workout_type"`
 }
 
+// Split is a per-kilometer or per-mile split of a detailed activity.
+type Split struct {
+	Split                     int     `json:"split"`    // 1-based index
+	Distance                  float64 `json:"distance"` // in meters
+	MovingTime                int     `json:"moving_time"`  // in seconds
+	ElapsedTime               int     `json:"elapsed_time"` // in seconds
+	ElevationDifference       float64 `json:"elevation_difference"` // in meters
+	AverageSpeed              float64 `json:"average_speed"`        // in meters per second
+	AverageGradeAdjustedSpeed float64 `json:"average_grade_adjusted_speed"`
+	AverageHeartrate          float64 `json:"average_heartrate"`
+	PaceZone                  int     `json:"pace_zone"`
+}
+
+// Lap is a lap of an activity, either recorded by the device or manual.
+type Lap struct {
+	ID                 int64   `json:"id"`
+	Name               string  `json:"name"`
+	LapIndex           int     `json:"lap_index"` // 1-based index
+	Distance           float64 `json:"distance"`  // in meters
+	MovingTime         int     `json:"moving_time"`  // in seconds
+	ElapsedTime        int     `json:"elapsed_time"` // in seconds
+	StartIndex         int     `json:"start_index"`  // index into the activity's streams
+	EndIndex           int     `json:"end_index"`
+	TotalElevationGain float64 `json:"total_elevation_gain"` // in meters
+	AverageSpeed       float64 `json:"average_speed"`        // in meters per second
+	MaxSpeed           float64 `json:"max_speed"`            // in meters per second
+	AverageHeartrate   float64 `json:"average_heartrate"`
+	MaxHeartrate       float64 `json:"max_heartrate"`
+	AverageWatts       float64 `json:"average_watts"`
+	PaceZone           int     `json:"pace_zone"`
+}
+
+// DetailedActivity is an activity with its splits and laps, as returned by
+// Strava's activity detail endpoint.
+type DetailedActivity struct {
+	Activity
+	Description    string  `json:"description"`
+	SplitsMetric   []Split `json:"splits_metric"`   // per kilometer
+	SplitsStandard []Split `json:"splits_standard"` // per mile
+	Laps           []Lap   `json:"laps"`
+}
+
+// StravaAthlete is the authenticated athlete's profile, as returned by
+// Strava's /athlete endpoint.
+type StravaAthlete struct {
+	ID                    int64     `json:"id"`
+	Username              string    `json:"username"`
+	Firstname             string    `json:"firstname"`
+	Lastname              string    `json:"lastname"`
+	Profile               string    `json:"profile"` // profile picture URL
+	City                  string    `json:"city"`
+	State                 string    `json:"state"`
+	Country               string    `json:"country"`
+	Sex                   string    `json:"sex"`                    // "M", "F" or empty
+	Summit                bool      `json:"summit"`                 // subscriber
+	CreatedAt             time.Time `json:"created_at"`
+	Weight                float64   `json:"weight"`                 // in kilograms, 0 if unknown
+	FTP                   float64   `json:"ftp"`                    // in watts, 0 if unknown
+	MeasurementPreference string    `json:"measurement_preference"` // "feet" or "meters"
+	Bikes                 []Gear    `json:"bikes"`
+	Shoes                 []Gear    `json:"shoes"`
+}
+
+// Gear is a bike or pair of shoes with the distance logged on it.
+type Gear struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Primary  bool    `json:"primary"`
+	Retired  bool    `json:"retired"`
+	Distance float64 `json:"distance"` // in meters
+}
+
+// ActivityTotals are Strava's totals of one sport over one period.
+type ActivityTotals struct {
+	Count            int     `json:"count"`
+	Distance         float64 `json:"distance"`          // in meters
+	MovingTime       int     `json:"moving_time"`       // in seconds
+	ElapsedTime      int     `json:"elapsed_time"`      // in seconds
+	ElevationGain    float64 `json:"elevation_gain"`    // in meters
+	AchievementCount int     `json:"achievement_count"` // recent totals only
+}
+
+// AthleteStats are the athlete's totals as Strava counts them, from the
+// /athletes/{id}/stats endpoint: the last four weeks, the year to date and
+// all time, for rides, runs and swims. Only activities visible to everyone
+// are included.
+type AthleteStats struct {
+	BiggestRideDistance       float64        `json:"biggest_ride_distance"`        // in meters
+	BiggestClimbElevationGain float64        `json:"biggest_climb_elevation_gain"` // in meters
+	RecentRideTotals          ActivityTotals `json:"recent_ride_totals"`
+	RecentRunTotals           ActivityTotals `json:"recent_run_totals"`
+	RecentSwimTotals          ActivityTotals `json:"recent_swim_totals"`
+	YTDRideTotals             ActivityTotals `json:"ytd_ride_totals"`
+	YTDRunTotals              ActivityTotals `json:"ytd_run_totals"`
+	YTDSwimTotals             ActivityTotals `json:"ytd_swim_totals"`
+	AllRideTotals             ActivityTotals `json:"all_ride_totals"`
+	AllRunTotals              ActivityTotals `json:"all_run_totals"`
+	AllSwimTotals             ActivityTotals `json:"all_swim_totals"`
+}
+
+// ZoneRange is one zone of heart rate or power. Max is -1 for the top zone.
+type ZoneRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// HeartRateZones are the athlete's heart rate zones. Unless CustomZones is
+// set, Strava derives them from the athlete's maximum heart rate.
+type HeartRateZones struct {
+	CustomZones bool        `json:"custom_zones"`
+	Zones       []ZoneRange `json:"zones"`
+}
+
+// AthleteZones are the athlete's zones, as returned by Strava's
+// /athlete/zones endpoint. Power zones need a power meter and FTP.
+type AthleteZones struct {
+	HeartRate *HeartRateZones `json:"heart_rate"`
+	Power     *struct {
+		Zones []ZoneRange `json:"zones"`
+	} `json:"power"`
+}
+
+// Streams are an activity's recorded samples, aligned by index. A stream the
+// activity doesn't have (e.g. heartrate without a monitor) is nil.
+type Streams struct {
+	Time           []int        `json:"time"`            // seconds since the start
+	Distance       []float64    `json:"distance"`        // meters since the start
+	VelocitySmooth []float64    `json:"velocity_smooth"` // meters per second
+	Heartrate      []float64    `json:"heartrate"`       // beats per minute
+	Altitude       []float64    `json:"altitude"`        // meters
+	GradeSmooth    []float64    `json:"grade_smooth"`    // percent
+	Watts          []float64    `json:"watts"`
+	Moving         []bool       `json:"moving"`
+	LatLng         [][2]float64 `json:"latlng"` // latitude and longitude in degrees
+}
+
+// Len returns the number of samples.
+func (s *Streams) Len() int {
+	return len(s.Time)
+}
+
+// streamKeys are the streams FetchActivityStreams requests.
+const streamKeys = "time,distance,velocity_smooth,heartrate,altitude,grade_smooth,watts,moving,latlng"
+
 // FetchActivitiesOptions contains optional parameters for fetching activities.
 type FetchActivitiesOptions struct {
 	Before *int64 // Unix timestamp
@@ -88,6 +233,124 @@ func (e *APIError) IsServerError() bool {
 
 // FetchActivities retrieves the authenticated athlete's activities from Strava API.
 func (c *Client) FetchActivities(ctx context.Context, token *oauth2.Token, opts *FetchActivitiesOptions) ([]Activity, error) {
+	var activities []Activity
+	_, err := c.streamActivitiesPage(ctx, token, opts, func(activity Activity) error {
+		activities = append(activities, activity)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
+
+// FetchAthlete retrieves the authenticated athlete's profile.
+func (c *Client) FetchAthlete(ctx context.Context, token *oauth2.Token) (*StravaAthlete, error) {
+	var athlete StravaAthlete
+	if err := c.getJSON(ctx, token, "/athlete", &athlete); err != nil {
+		return nil, fmt.Errorf("failed to fetch athlete: %w", err)
+	}
+	return &athlete, nil
+}
+
+// FetchAthleteZones retrieves the authenticated athlete's heart rate and
+// power zones. It needs the profile:read_all scope.
+func (c *Client) FetchAthleteZones(ctx context.Context, token *oauth2.Token) (*AthleteZones, error) {
+	var zones AthleteZones
+	if err := c.getJSON(ctx, token, "/athlete/zones", &zones); err != nil {
+		return nil, fmt.Errorf("failed to fetch athlete zones: %w", err)
+	}
+	return &zones, nil
+}
+
+// FetchAthleteStats retrieves the totals Strava keeps for an athlete, who
+// must be the authenticated one.
+func (c *Client) FetchAthleteStats(ctx context.Context, token *oauth2.Token, athleteID int64) (*AthleteStats, error) {
+	var stats AthleteStats
+	if err := c.getJSON(ctx, token, fmt.Sprintf("/athletes/%d/stats", athleteID), &stats); err != nil {
+		return nil, fmt.Errorf("failed to fetch athlete stats: %w", err)
+	}
+	return &stats, nil
+}
+
+// FetchActivity retrieves an activity with its splits and laps.
+func (c *Client) FetchActivity(ctx context.Context, token *oauth2.Token, id int64) (*DetailedActivity, error) {
+	var activity DetailedActivity
+	if err := c.getJSON(ctx, token, fmt.Sprintf("/activities/%d", id), &activity); err != nil {
+		return nil, fmt.Errorf("failed to fetch activity %d: %w", id, err)
+	}
+	return &activity, nil
+}
+
+// FetchActivityLaps retrieves the laps of an activity.
+func (c *Client) FetchActivityLaps(ctx context.Context, token *oauth2.Token, id int64) ([]Lap, error) {
+	var laps []Lap
+	if err := c.getJSON(ctx, token, fmt.Sprintf("/activities/%d/laps", id), &laps); err != nil {
+		return nil, fmt.Errorf("failed to fetch laps of activity %d: %w", id, err)
+	}
+	return laps, nil
+}
+
+// FetchActivityStreams retrieves an activity's time, distance, velocity,
+// heartrate, altitude, grade, power and moving streams.
+func (c *Client) FetchActivityStreams(ctx context.Context, token *oauth2.Token, id int64) (*Streams, error) {
+	// Streams keyed by type, each with its samples under "data"
+	var raw struct {
+		Time           struct{ Data []int }        `json:"time"`
+		Distance       struct{ Data []float64 }    `json:"distance"`
+		VelocitySmooth struct{ Data []float64 }    `json:"velocity_smooth"`
+		Heartrate      struct{ Data []float64 }    `json:"heartrate"`
+		Altitude       struct{ Data []float64 }    `json:"altitude"`
+		GradeSmooth    struct{ Data []float64 }    `json:"grade_smooth"`
+		Watts          struct{ Data []float64 }    `json:"watts"`
+		Moving         struct{ Data []bool }       `json:"moving"`
+		LatLng         struct{ Data [][2]float64 } `json:"latlng"`
+	}
+	path := fmt.Sprintf("/activities/%d/streams?keys=%s&key_by_type=true", id, streamKeys)
+	if err := c.getJSON(ctx, token, path, &raw); err != nil {
+		return nil, fmt.Errorf("failed to fetch streams of activity %d: %w", id, err)
+	}
+	return &Streams{
+		Time:           raw.Time.Data,
+		Distance:       raw.Distance.Data,
+		VelocitySmooth: raw.VelocitySmooth.Data,
+		Heartrate:      raw.Heartrate.Data,
+		Altitude:       raw.Altitude.Data,
+		GradeSmooth:    raw.GradeSmooth.Data,
+		Watts:          raw.Watts.Data,
+		Moving:         raw.Moving.Data,
+		LatLng:         raw.LatLng.Data,
+	}, nil
+}
+
+// getJSON fetches a Strava API path and decodes the JSON response into v.
+// Non-200 responses are returned as an *APIError.
+func (c *Client) getJSON(ctx context.Context, token *oauth2.Token, path string, v interface{}) error {
+	client := c.OAuthConfig.Client(ctx, token)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.APIURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return parseAPIError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// streamActivitiesPage fetches a single page of activities and calls fn for each
+// activity as it is decoded, so the page is never held in memory as a whole.
+// It returns the number of activities decoded.
+func (c *Client) streamActivitiesPage(ctx context.Context, token *oauth2.Token, opts *FetchActivitiesOptions, fn func(Activity) error) (int, error) {
 	client := c.OAuthConfig.Client(ctx, token)
 	
 	url := fmt.Sprintf("%s/athlete/activities", c.APIURL)
@@ -95,7 +358,7 @@ func (c *Client) FetchActivities(ctx context.Context, token *oauth2.Token, opts
 	// Build query parameters
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return 0, fmt.Errorf("failed to create request: %w", err)
 	}
 	
 	q := req.URL.Query()
@@ -117,80 +380,136 @@ func (c *Client) FetchActivities(ctx context.Context, token *oauth2.Token, opts
 	
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch activities: %w", err)
+		return 0, fmt.Errorf("failed to fetch activities: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Handle different HTTP status codes
 	if resp.StatusCode != http.StatusOK {
-		apiErr := &APIError{
-			StatusCode: resp.StatusCode,
+		return 0, parseAPIError(resp)
+	}
+
+	count, err := decodeActivities(resp.Body, fn)
+	if err != nil {
+		return count, fmt.Errorf("failed to decode activities response: %w", err)
+	}
+	
+	return count, nil
+}
+
+// decodeActivities decodes a JSON array of activities element by element,
+// calling fn for each one. It returns the number of activities decoded.
+func decodeActivities(r io.Reader, fn func(Activity) error) (int, error) {
+	dec := json.NewDecoder(r)
+
+	// Expect the opening bracket of the array
+	tok, err := dec.Token()
+	if err != nil {
+		return 0, err
+	}
+	if tok == nil {
+		// A JSON null is treated as an empty page
+		return 0, nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return 0, fmt.Errorf("expected JSON array, got %v", tok)
+	}
+
+	count := 0
+	for dec.More() {
+		var activity Activity
+		if err := dec.Decode(&activity); err != nil {
+			return count, err
+		}
+		count++
+		if err := fn(activity); err != nil {
+			return count, err
 		}
+	}
 
-		// Read error response body if available
-		body, readErr := io.ReadAll(resp.Body)
-		if readErr == nil && len(body) > 0 {
-			// Try to parse as JSON error response
-			var errorResp struct {
-				Message string `json:"message"`
-				Errors  []struct {
-					Resource string `json:"resource"`
-					Field    string `json:"field"`
-					Code     string `json:"code"`
-				} `json:"errors"`
-			}
-			if json.Unmarshal(body, &errorResp) == nil && errorResp.Message != "" {
-				apiErr.Message = errorResp.Message
-			} else {
-				apiErr.Message = string(body)
-			}
+	// Consume the closing bracket
+	if _, err := dec.Token(); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+// parseAPIError builds an APIError from a non-200 Strava response.
+func parseAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+	}
+
+	// Read error response body if available
+	body, readErr := io.ReadAll(resp.Body)
+	if readErr == nil && len(body) > 0 {
+		// Try to parse as JSON error response
+		var errorResp struct {
+			Message string `json:"message"`
+			Errors  []struct {
+				Resource string `json:"resource"`
+				Field    string `json:"field"`
+				Code     string `json:"code"`
+			} `json:"errors"`
+		}
+		if json.Unmarshal(body, &errorResp) == nil && errorResp.Message != "" {
+			apiErr.Message = errorResp.Message
 		} else {
-			apiErr.Message = resp.Status
+			apiErr.Message = string(body)
 		}
+	} else {
+		apiErr.Message = resp.Status
+	}
 
-		// Handle rate limiting (429)
-		if resp.StatusCode == http.StatusTooManyRequests {
-			// Check for Retry-After header
-			if retryAfterStr := resp.Header.Get("Retry-After"); retryAfterStr != "" {
-				if seconds, err := strconv.Atoi(retryAfterStr); err == nil {
-					apiErr.RetryAfter = time.Duration(seconds) * time.Second
-				}
+	// Handle rate limiting (429)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		// Check for Retry-After header
+		if retryAfterStr := resp.Header.Get("Retry-After"); retryAfterStr != "" {
+			if seconds, err := strconv.Atoi(retryAfterStr); err == nil {
+				apiErr.RetryAfter = time.Duration(seconds) * time.Second
 			}
-			// Default retry after 60 seconds if not specified
-			if apiErr.RetryAfter == 0 {
-				apiErr.RetryAfter = 60 * time.Second
-			}
-			return nil, apiErr
-		}
-
-		// Handle unauthorized (401) - token may need refresh
-		if resp.StatusCode == http.StatusUnauthorized {
-			apiErr.Message = "Unauthorized: token may be expired or invalid"
-			return nil, apiErr
 		}
-
-		// Handle server errors (5xx)
-		if resp.StatusCode >= 500 && resp.StatusCode < 600 {
-			apiErr.Message = fmt.Sprintf("Strava API server error: %s", apiErr.Message)
-			return nil, apiErr
+		// Default retry after 60 seconds if not specified
+		if apiErr.RetryAfter == 0 {
+			apiErr.RetryAfter = 60 * time.Second
 		}
+		return apiErr
+	}
 
-		// Other errors
-		return nil, apiErr
+	// Handle unauthorized (401) - token may need refresh
+	if resp.StatusCode == http.StatusUnauthorized {
+		apiErr.Message = "Unauthorized: token may be expired or invalid"
+		return apiErr
 	}
 
-	var activities []Activity
-	if err := json.NewDecoder(resp.Body).Decode(&activities); err != nil {
-		return nil, fmt.Errorf("failed to decode activities response: %w", err)
+	// Handle server errors (5xx)
+	if resp.StatusCode >= 500 && resp.StatusCode < 600 {
+		apiErr.Message = fmt.Sprintf("Strava API server error: %s", apiErr.Message)
+		return apiErr
 	}
-	
-	return activities, nil
+
+	// Other errors
+	return apiErr
 }
 
 // FetchAllActivities retrieves all activities from Strava API by paginating through all pages.
 // This function automatically handles pagination to fetch the complete activity history.
 func (c *Client) FetchAllActivities(ctx context.Context, token *oauth2.Token, opts *FetchActivitiesOptions) ([]Activity, error) {
 	var allActivities []Activity
+	err := c.StreamActivities(ctx, token, opts, func(activity Activity) error {
+		allActivities = append(allActivities, activity)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return allActivities, nil
+}
+
+// StreamActivities paginates through all activities like FetchAllActivities, but
+// calls fn for each activity as soon as it is decoded instead of collecting them.
+// Returning an error from fn stops the stream and is returned to the caller.
+func (c *Client) StreamActivities(ctx context.Context, token *oauth2.Token, opts *FetchActivitiesOptions, fn func(Activity) error) error {
 	page := 1
 	perPage := 200 // Use max per_page to minimize number of requests
 	
@@ -207,22 +526,14 @@ func (c *Client) FetchAllActivities(ctx context.Context, token *oauth2.Token, op
 		// Set current page
 		paginationOpts.Page = &page
 		
-		// Fetch current page
-		activities, err := c.FetchActivities(ctx, token, paginationOpts)
+		// Fetch and stream current page
+		count, err := c.streamActivitiesPage(ctx, token, paginationOpts, fn)
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch activities page %d: %w", page, err)
+			return fmt.Errorf("failed to fetch activities page %d: %w", page, err)
 		}
 		
-		// If no activities returned, we've reached the end
-		if len(activities) == 0 {
-			break
-		}
-		
-		// Append activities from this page
-		allActivities = append(allActivities, activities...)
-		
-		// If we got fewer activities than per_page, we've reached the last page
-		if len(activities) < perPage {
+		// If we got fewer activities than per_page (or none), we've reached the last page
+		if count < perPage {
 			break
 		}
 		
@@ -230,6 +541,5 @@ func (c *Client) FetchAllActivities(ctx context.Context, token *oauth2.Token, op
 		page++
 	}
 	
-	return allActivities, nil
+	return nil
 }
-
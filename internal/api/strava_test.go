@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// stravaServer serves canned responses by path (with the query) and returns a
+// client talking to it with a token that doesn't need refreshing.
+func stravaServer(t *testing.T, handler http.HandlerFunc) (*Client, *oauth2.Token) {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	token := &oauth2.Token{AccessToken: "test-token", TokenType: "Bearer", Expiry: time.Now().Add(time.Hour)}
+	return NewClient(ts.URL, &oauth2.Config{}), token
+}
+
+func TestClientFetch(t *testing.T) {
+	responses := map[string]string{
+		"/athlete":           `{"id": 42, "firstname": "Alex", "measurement_preference": "meters", "shoes": [{"id": "g1", "name": "Trainers", "distance": 500000}]}`,
+		"/athlete/zones":     `{"heart_rate": {"custom_zones": true, "zones": [{"min": 0, "max": 120}, {"min": 120, "max": -1}]}}`,
+		"/athletes/42/stats": `{"biggest_ride_distance": 160000, "all_run_totals": {"count": 300, "distance": 3000000}}`,
+		"/activities/7":      `{"id": 7, "name": "Track", "sport_type": "Run", "distance": 8000, "splits_metric": [{"split": 1, "distance": 1000, "moving_time": 240}], "laps": [{"id": 1, "lap_index": 1}]}`,
+		"/activities/7/laps": `[{"id": 1, "lap_index": 1, "distance": 400, "moving_time": 80}, {"id": 2, "lap_index": 2, "distance": 400, "moving_time": 78}]`,
+		"/activities/7/streams?keys=" + streamKeys + "&key_by_type=true": `{"time": {"data": [0, 1, 2]}, "heartrate": {"data": [120, 125, 130]}, "moving": {"data": [true, true, false]}, "latlng": {"data": [[51.5, -0.1], [51.5, -0.1], [51.5, -0.1]]}}`,
+	}
+	client, token := stravaServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Errorf("Expected the access token to be sent, got %q", got)
+		}
+		body, ok := responses[r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, body)
+	})
+	ctx := context.Background()
+
+	athlete, err := client.FetchAthlete(ctx, token)
+	if err != nil || athlete.ID != 42 || athlete.MeasurementPreference != "meters" || len(athlete.Shoes) != 1 || athlete.Shoes[0].Distance != 500000 {
+		t.Errorf("Unexpected athlete %+v (%v)", athlete, err)
+	}
+	zones, err := client.FetchAthleteZones(ctx, token)
+	if err != nil || zones.HeartRate == nil || !zones.HeartRate.CustomZones || len(zones.HeartRate.Zones) != 2 || zones.HeartRate.Zones[1].Max != -1 || zones.Power != nil {
+		t.Errorf("Unexpected zones %+v (%v)", zones, err)
+	}
+	stats, err := client.FetchAthleteStats(ctx, token, 42)
+	if err != nil || stats.BiggestRideDistance != 160000 || stats.AllRunTotals.Count != 300 {
+		t.Errorf("Unexpected stats %+v (%v)", stats, err)
+	}
+	activity, err := client.FetchActivity(ctx, token, 7)
+	if err != nil || activity.ID != 7 || activity.SportType != "Run" || len(activity.SplitsMetric) != 1 || activity.SplitsMetric[0].MovingTime != 240 || len(activity.Laps) != 1 {
+		t.Errorf("Unexpected activity %+v (%v)", activity, err)
+	}
+	laps, err := client.FetchActivityLaps(ctx, token, 7)
+	if err != nil || len(laps) != 2 || laps[1].LapIndex != 2 || laps[1].MovingTime != 78 {
+		t.Errorf("Unexpected laps %+v (%v)", laps, err)
+	}
+	streams, err := client.FetchActivityStreams(ctx, token, 7)
+	if err != nil || streams.Len() != 3 || streams.Heartrate[2] != 130 || streams.Moving[2] || streams.LatLng[0] != [2]float64{51.5, -0.1} {
+		t.Errorf("Unexpected streams %+v (%v)", streams, err)
+	}
+	if streams != nil && (streams.Distance != nil || streams.Watts != nil) {
+		t.Errorf("Expected streams the activity doesn't have to be nil, got %+v", streams)
+	}
+}
+
+func TestClientFetchErrors(t *testing.T) {
+	client, token := stravaServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/activities/1":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message": "Record Not Found", "errors": [{"resource": "Activity", "field": "id", "code": "invalid"}]}`)
+		case "/activities/1/laps":
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"message": "Rate Limit Exceeded"}`)
+		case "/athlete":
+			io.WriteString(w, `{"id": "not a number"}`)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	ctx := context.Background()
+
+	_, err := client.FetchActivity(ctx, token, 1)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "Record Not Found" {
+		t.Errorf("Expected a 404 APIError with Strava's message, got %v", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "failed to fetch activity 1") {
+		t.Errorf("Expected the error to name the activity, got %v", err)
+	}
+
+	_, err = client.FetchActivityLaps(ctx, token, 1)
+	if !errors.As(err, &apiErr) || !apiErr.IsRateLimit() || apiErr.RetryAfter != 2*time.Minute {
+		t.Errorf("Expected a rate limit error retrying after 2 minutes, got %v", err)
+	}
+
+	_, err = client.FetchActivityStreams(ctx, token, 1)
+	if !errors.As(err, &apiErr) || !apiErr.IsUnauthorized() {
+		t.Errorf("Expected an unauthorized error, got %v", err)
+	}
+
+	_, err = client.FetchAthlete(ctx, token)
+	if err == nil || errors.As(err, &apiErr) || !strings.Contains(err.Error(), "failed to decode response") {
+		t.Errorf("Expected a decoding error, got %v", err)
+	}
+}
+
+func TestParseAPIError(t *testing.T) {
+	tests := []struct {
+		status     int
+		header     string
+		body       string
+		message    string
+		retryAfter time.Duration
+	}{
+		{http.StatusBadRequest, "", `{"message": "Bad Request", "errors": []}`, "Bad Request", 0},
+		{http.StatusBadRequest, "", "not json", "not json", 0},
+		{http.StatusNotFound, "", "", "404 Not Found", 0},
+		{http.StatusUnauthorized, "", `{"message": "Authorization Error"}`, "Unauthorized: token may be expired or invalid", 0},
+		{http.StatusTooManyRequests, "", `{"message": "Rate Limit Exceeded"}`, "Rate Limit Exceeded", time.Minute},
+		{http.StatusTooManyRequests, "900", "", "429 Too Many Requests", 15 * time.Minute},
+		{http.StatusTooManyRequests, "soon", "", "429 Too Many Requests", time.Minute},
+		{http.StatusServiceUnavailable, "", "upstream down", "Strava API server error: upstream down", 0},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{
+			StatusCode: tt.status,
+			Status:     fmt.Sprintf("%d %s", tt.status, http.StatusText(tt.status)),
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(tt.body)),
+		}
+		if tt.header != "" {
+			resp.Header.Set("Retry-After", tt.header)
+		}
+		err := parseAPIError(resp)
+		if err.StatusCode != tt.status || err.Message != tt.message || err.RetryAfter != tt.retryAfter {
+			t.Errorf("Expected %d %q retrying after %s, got %d %q retrying after %s", tt.status, tt.message, tt.retryAfter, err.StatusCode, err.Message, err.RetryAfter)
+		}
+	}
+	if err := (&APIError{StatusCode: 502, Message: "bad gateway"}); !err.IsServerError() || err.Error() != "Strava API error (status 502): bad gateway" {
+		t.Errorf("Unexpected server error %q", err.Error())
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"sort"
+	"time"
+)
+
+// Streaks describes runs of consecutive days with at least one activity.
+type Streaks struct {
+	Current      int    `json:"current"`      // days in the streak that is still alive
+	CurrentStart string `json:"currentStart"` // first day of the current streak (YYYY-MM-DD)
+	Longest      int    `json:"longest"`      // days in the longest streak ever
+	LongestStart string `json:"longestStart"`
+	LongestEnd   string `json:"longestEnd"`
+	ActiveToday  bool   `json:"activeToday"` // whether today already has an activity
+}
+
+// CalculateStreaks calculates activity streaks from the dates (YYYY-MM-DD) that
+// have activities. today is the athlete's current date (see Calendar.Today).
+//
+// The current streak is still alive when the last active day is today or
+// yesterday, so it does not drop to zero in the morning before the day's workout.
+// Activity dates are local to where they were recorded, so after traveling to a
+// timezone ahead of home the latest date can be after today; the streak then
+// counts back from that date.
+func CalculateStreaks(activeDates []string, today time.Time) Streaks {
+	var streaks Streaks
+	if len(activeDates) == 0 {
+		return streaks
+	}
+
+	dates := append([]string(nil), activeDates...)
+	sort.Strings(dates)
+
+	todayStr := truncateToDate(today).Format("2006-01-02")
+	runStart, runLength := "", 0
+	var previous time.Time
+	for i, dateStr := range dates {
+		date, err := time.Parse("2006-01-02", dateStr)
+		if err != nil || (i > 0 && date.Equal(previous)) {
+			continue
+		}
+		if runLength > 0 && date.Equal(previous.AddDate(0, 0, 1)) {
+			runLength++
+		} else {
+			runStart, runLength = dateStr, 1
+		}
+		previous = date
+
+		if runLength > streaks.Longest {
+			streaks.Longest = runLength
+			streaks.LongestStart = runStart
+			streaks.LongestEnd = dateStr
+		}
+		if dateStr == todayStr {
+			streaks.ActiveToday = true
+		}
+	}
+
+	// previous is now the last active day and runLength the streak ending there
+	yesterday := truncateToDate(today).AddDate(0, 0, -1)
+	if !previous.Before(yesterday) {
+		streaks.Current = runLength
+		streaks.CurrentStart = runStart
+	}
+	return streaks
+}
+
+// ActiveDates returns the dates (YYYY-MM-DD) with at least one activity accepted
+// by filter (nil accepts all), in order.
+func (r *Rollup) ActiveDates(filter func(sportType string) bool) []string {
+	var dates []string
+	r.forEachDay("", "", filter, func(date, sport string, totals RollupTotals) {
+		if len(dates) == 0 || dates[len(dates)-1] != date {
+			dates = append(dates, date)
+		}
+	})
+	return dates
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Embed the timezone database so athlete timezones resolve even on hosts
+	// without /usr/share/zoneinfo
+	_ "time/tzdata"
+)
+
+// nowFunc returns the current time; tests replace it to pin "today".
+var nowFunc = time.Now
+
+// stravaTimezonePattern matches Strava's timezone format, e.g.
+// "(GMT-08:00) America/Los_Angeles".
+var stravaTimezonePattern = regexp.MustCompile(`^\(GMT([+-])(\d{1,2}):(\d{2})\)\s*(.*)$`)
+
+// ParseStravaTimezone parses a timezone in Strava's "(GMT-08:00) America/Los_Angeles"
+// format. A bare IANA name ("America/Los_Angeles") is accepted too. If the IANA
+// name is unknown, the GMT offset is used as a fixed zone.
+func ParseStravaTimezone(tz string) (*time.Location, error) {
+	tz = strings.TrimSpace(tz)
+	if tz == "" {
+		return nil, fmt.Errorf("empty timezone")
+	}
+
+	match := stravaTimezonePattern.FindStringSubmatch(tz)
+	if match == nil {
+		// Not in Strava's format; try it as an IANA name
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", tz, err)
+		}
+		return loc, nil
+	}
+
+	name := strings.TrimSpace(match[4])
+	if name != "" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc, nil
+		}
+	}
+
+	// Fall back to the fixed offset from the "(GMT±hh:mm)" prefix
+	hours, _ := strconv.Atoi(match[2])
+	minutes, _ := strconv.Atoi(match[3])
+	offset := hours*3600 + minutes*60
+	if match[1] == "-" {
+		offset = -offset
+	}
+	if name == "" {
+		name = fmt.Sprintf("GMT%s%s:%s", match[1], match[2], match[3])
+	}
+	return time.FixedZone(name, offset), nil
+}
+
+// locationCache memoizes parsed activity timezones; an athlete only has a handful.
+var locationCache sync.Map // timezone string -> *time.Location (nil if invalid)
+
+// activityLocation returns the parsed location for an activity timezone, or nil.
+func activityLocation(tz string) *time.Location {
+	if tz == "" {
+		return nil
+	}
+	if cached, ok := locationCache.Load(tz); ok {
+		return cached.(*time.Location)
+	}
+	loc, err := ParseStravaTimezone(tz)
+	if err != nil {
+		loc = nil
+	}
+	locationCache.Store(tz, loc)
+	return loc
+}
+
+// HomeTimezone returns the athlete's home timezone: the timezone most of their
+// activities were recorded in, so occasional travel does not move it. Ties go to
+// the timezone of the most recent activity. Returns "" if no activity has one.
+func HomeTimezone(activities []Activity) string {
+	counts := make(map[string]int)
+	latest := make(map[string]time.Time)
+	for _, activity := range activities {
+		if activity.Timezone == "" {
+			continue
+		}
+		counts[activity.Timezone]++
+		if activity.StartDate.After(latest[activity.Timezone]) {
+			latest[activity.Timezone] = activity.StartDate
+		}
+	}
+	return mostFrequentTimezone(counts, latest)
+}
+
+// mostFrequentTimezone picks the timezone with the highest count, breaking ties
+// by the most recent activity.
+func mostFrequentTimezone(counts map[string]int, latest map[string]time.Time) string {
+	home := ""
+	for tz, count := range counts {
+		if home == "" || count > counts[home] ||
+			(count == counts[home] && latest[tz].After(latest[home])) ||
+			(count == counts[home] && latest[tz].Equal(latest[home]) && tz < home) {
+			home = tz
+		}
+	}
+	return home
+}
+
+// Calendar describes how dates are bucketed for an athlete: the home timezone
+// that decides what "today" is, and the first day of the week.
+type Calendar struct {
+	Location  *time.Location // athlete's home timezone (nil means the server's local time)
+	WeekStart time.Weekday   // first day of weekly periods
+}
+
+// DefaultCalendar uses the server's local time and Monday-based weeks.
+func DefaultCalendar() Calendar {
+	return Calendar{Location: time.Local, WeekStart: time.Monday}
+}
+
+// Today returns today's date in the calendar's timezone, as midnight UTC like
+// every other local date in this package.
+func (c Calendar) Today() time.Time {
+	loc := c.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	year, month, day := nowFunc().In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// PeriodKey returns the start date (YYYY-MM-DD) of the period containing dateStr.
+func (c Calendar) PeriodKey(dateStr, period string) string {
+	return periodKey(dateStr, period, c.WeekStart)
+}
+
+// ParseWeekday parses a weekday name ("monday", "Sun", ...) case-insensitively.
+func ParseWeekday(name string) (time.Weekday, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) >= 3 {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			full := strings.ToLower(d.String())
+			if name == full || name == full[:3] {
+				return d, nil
+			}
+		}
+	}
+	return time.Sunday, fmt.Errorf("invalid weekday %q", name)
+}
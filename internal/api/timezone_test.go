@@ -0,0 +1,190 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+// pinNow replaces nowFunc for the duration of a test.
+func pinNow(t *testing.T, now time.Time) {
+	t.Helper()
+	original := nowFunc
+	nowFunc = func() time.Time { return now }
+	t.Cleanup(func() { nowFunc = original })
+}
+
+func TestParseStravaTimezone(t *testing.T) {
+	tests := []struct {
+		input      string
+		wantName   string
+		wantOffset int // seconds east of UTC on 2024-01-15
+	}{
+		{"(GMT-08:00) America/Los_Angeles", "America/Los_Angeles", -8 * 3600},
+		{"(GMT+09:00) Asia/Tokyo", "Asia/Tokyo", 9 * 3600},
+		{"Europe/London", "Europe/London", 0},
+		{"(GMT+05:30) Not/A_Zone", "Not/A_Zone", 5*3600 + 1800},
+		{"(GMT-03:00)", "GMT-03:00", -3 * 3600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			loc, err := ParseStravaTimezone(tt.input)
+			if err != nil {
+				t.Fatalf("ParseStravaTimezone(%q) returned error: %v", tt.input, err)
+			}
+			if loc.String() != tt.wantName {
+				t.Errorf("Expected location %s, got %s", tt.wantName, loc)
+			}
+			_, offset := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC).In(loc).Zone()
+			if offset != tt.wantOffset {
+				t.Errorf("Expected offset %d, got %d", tt.wantOffset, offset)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", "Not/A_Zone"} {
+		if _, err := ParseStravaTimezone(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestCalendar_TodayUsesHomeTimezone(t *testing.T) {
+	// 8 PM on Nov 25 in Los Angeles is already Nov 26 in UTC
+	pinNow(t, time.Date(2024, 11, 26, 4, 0, 0, 0, time.UTC))
+
+	la, _ := time.LoadLocation("America/Los_Angeles")
+	if today := (Calendar{Location: la}).Today(); today.Format("2006-01-02") != "2024-11-25" {
+		t.Errorf("Expected today to be 2024-11-25 in Los Angeles, got %s", today.Format("2006-01-02"))
+	}
+	if today := (Calendar{Location: time.UTC}).Today(); today.Format("2006-01-02") != "2024-11-26" {
+		t.Errorf("Expected today to be 2024-11-26 in UTC, got %s", today.Format("2006-01-02"))
+	}
+
+	start, end := (&NormalizeOptions{Location: la}).Bounds()
+	if start.Format("2006-01-02") != "2024-11-18" || end.Format("2006-01-02") != "2024-11-25" {
+		t.Errorf("Expected default range 2024-11-18..2024-11-25, got %s..%s",
+			start.Format("2006-01-02"), end.Format("2006-01-02"))
+	}
+}
+
+func TestCalendar_PeriodKeyWeekStart(t *testing.T) {
+	// Saturday Nov 30, 2024
+	monday := Calendar{WeekStart: time.Monday}
+	sunday := Calendar{WeekStart: time.Sunday}
+
+	if key := monday.PeriodKey("2024-11-30", "weekly"); key != "2024-11-25" {
+		t.Errorf("Expected Monday week 2024-11-25, got %s", key)
+	}
+	if key := sunday.PeriodKey("2024-11-30", "weekly"); key != "2024-11-24" {
+		t.Errorf("Expected Sunday week 2024-11-24, got %s", key)
+	}
+	// A Sunday starts its own week with Sunday weeks, but ends the week with Monday weeks
+	if key := sunday.PeriodKey("2024-12-01", "weekly"); key != "2024-12-01" {
+		t.Errorf("Expected Sunday week 2024-12-01, got %s", key)
+	}
+	if key := monday.PeriodKey("2024-12-01", "weekly"); key != "2024-11-25" {
+		t.Errorf("Expected Monday week 2024-11-25, got %s", key)
+	}
+}
+
+func TestNormalizeActivity_KeepsDateWhereRecorded(t *testing.T) {
+	// 7 AM on Nov 26 in Tokyo is still Nov 25 back home in Los Angeles
+	activity := Activity{
+		ID:             1,
+		StartDate:      time.Date(2024, 11, 25, 22, 0, 0, 0, time.UTC),
+		StartDateLocal: time.Date(2024, 11, 26, 7, 0, 0, 0, time.UTC),
+		Timezone:       "(GMT+09:00) Asia/Tokyo",
+	}
+	if date := NormalizeActivity(activity).LocalDateStr; date != "2024-11-26" {
+		t.Errorf("Expected the Tokyo date 2024-11-26, got %s", date)
+	}
+
+	// Without a timezone the date comes from start_date_local
+	activity.Timezone = ""
+	if date := NormalizeActivity(activity).LocalDateStr; date != "2024-11-26" {
+		t.Errorf("Expected 2024-11-26 from start_date_local, got %s", date)
+	}
+}
+
+func TestHomeTimezone(t *testing.T) {
+	la := "(GMT-08:00) America/Los_Angeles"
+	tokyo := "(GMT+09:00) Asia/Tokyo"
+	base := time.Date(2024, 11, 1, 15, 0, 0, 0, time.UTC)
+
+	activities := []Activity{
+		{ID: 1, StartDate: base, Timezone: la},
+		{ID: 2, StartDate: base.AddDate(0, 0, 1), Timezone: la},
+		{ID: 3, StartDate: base.AddDate(0, 0, 2), Timezone: tokyo},
+		{ID: 4, StartDate: base.AddDate(0, 0, 3)},
+	}
+	if home := HomeTimezone(activities); home != la {
+		t.Errorf("Expected home timezone %s, got %s", la, home)
+	}
+
+	// The rollup tracks the same counts, and forgets replaced activities
+	rollup := NewRollup()
+	for _, activity := range activities {
+		rollup.Add(NormalizeActivity(activity))
+	}
+	if home := rollup.HomeTimezone(); home != la {
+		t.Errorf("Expected rollup home timezone %s, got %s", la, home)
+	}
+	moved := activities[0]
+	moved.Timezone = tokyo
+	rollup.Add(NormalizeActivity(moved))
+	if home := rollup.HomeTimezone(); home != tokyo {
+		t.Errorf("Expected rollup home timezone %s after edit, got %s", tokyo, home)
+	}
+
+	if home := HomeTimezone(nil); home != "" {
+		t.Errorf("Expected no home timezone, got %s", home)
+	}
+}
+
+func TestParseWeekday(t *testing.T) {
+	for input, expected := range map[string]time.Weekday{"monday": time.Monday, "Sun": time.Sunday, " SATURDAY ": time.Saturday} {
+		day, err := ParseWeekday(input)
+		if err != nil || day != expected {
+			t.Errorf("ParseWeekday(%q) = %v, %v; want %v", input, day, err, expected)
+		}
+	}
+	for _, invalid := range []string{"", "mo", "funday"} {
+		if _, err := ParseWeekday(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestCalculateStreaks(t *testing.T) {
+	dates := []string{
+		"2024-11-01", "2024-11-02", "2024-11-03", "2024-11-04", // longest: 4 days
+		"2024-11-10",
+		"2024-11-23", "2024-11-24", "2024-11-24", // duplicate date
+	}
+	today := time.Date(2024, 11, 25, 0, 0, 0, 0, time.UTC)
+
+	// Active yesterday: the streak is still alive this morning
+	streaks := CalculateStreaks(dates, today)
+	if streaks.Current != 2 || streaks.CurrentStart != "2024-11-23" || streaks.ActiveToday {
+		t.Errorf("Unexpected current streak: %+v", streaks)
+	}
+	if streaks.Longest != 4 || streaks.LongestStart != "2024-11-01" || streaks.LongestEnd != "2024-11-04" {
+		t.Errorf("Unexpected longest streak: %+v", streaks)
+	}
+
+	// Missing a whole day breaks it
+	if streaks := CalculateStreaks(dates, today.AddDate(0, 0, 1)); streaks.Current != 0 {
+		t.Errorf("Expected broken streak, got %+v", streaks)
+	}
+
+	// An activity recorded in a timezone ahead of home lands on "tomorrow"
+	ahead := append(dates, "2024-11-25", "2024-11-26")
+	if streaks := CalculateStreaks(ahead, today); streaks.Current != 4 || !streaks.ActiveToday {
+		t.Errorf("Expected the streak to include days ahead of home, got %+v", streaks)
+	}
+
+	if streaks := CalculateStreaks(nil, today); streaks != (Streaks{}) {
+		t.Errorf("Expected empty streaks, got %+v", streaks)
+	}
+}
@@ -15,84 +15,192 @@ func formatPaceSeconds(paceSec float64) string {
 }
 
 // TrendDataPoint represents a single data point in a trend chart.
+// Every numeric series is smoothed (or accumulated) the same way: pace, heart
+// rate and power are derived from the smoothed totals, so they stay consistent
+// with the smoothed distance and time.
 type TrendDataPoint struct {
-	Date          string  `json:"date"`           // YYYY-MM-DD format
-	Distance      float64 `json:"distance"`     // in meters
-	DistanceKm    float64 `json:"distance_km"`  // in kilometers
-	DistanceMiles float64 `json:"distance_miles"`
-	Pace          string  `json:"pace"`          // formatted as "X:XX min/mi"
-	PaceMinPerKm  string  `json:"pace_min_per_km"` // formatted as "X:XX min/km"
-	Count         int     `json:"count"`         // number of activities
+	Date               string  `json:"date"`     // YYYY-MM-DD format
+	Distance           float64 `json:"distance"` // in meters
+	DistanceKm         float64 `json:"distance_km"`
+	DistanceMiles      float64 `json:"distance_miles"`
+	MovingTime         float64 `json:"moving_time"`    // in seconds
+	ElevationGain      float64 `json:"elevation_gain"` // in meters
+	ElevationGainFeet  float64 `json:"elevation_gain_feet"`
+	AverageHeartrate   float64 `json:"average_heartrate"`     // moving-time weighted, 0 without data
+	AverageWatts       float64 `json:"average_watts"`         // moving-time weighted, 0 without data
+	PaceSecondsPerKm   float64 `json:"pace_seconds_per_km"`   // 0 without distance
+	PaceSecondsPerMile float64 `json:"pace_seconds_per_mile"` // 0 without distance
+	Pace               string  `json:"pace"`                  // formatted as "X:XX min/mi"
+	PaceMinPerKm       string  `json:"pace_min_per_km"`       // formatted as "X:XX min/km"
+	Count              int     `json:"count"`                 // number of activities (not smoothed)
+
+	// Grade-adjusted pace: the flat pace of the same effort, estimated from
+	// elevation gain for runs, walks and hikes (see EstimateGradeAdjustment)
+	GradeAdjustedPaceSecondsPerKm   float64 `json:"grade_adjusted_pace_seconds_per_km"`   // 0 without distance
+	GradeAdjustedPaceSecondsPerMile float64 `json:"grade_adjusted_pace_seconds_per_mile"` // 0 without distance
+	GradeAdjustedPace               string  `json:"grade_adjusted_pace"`                  // formatted as "X:XX min/mi"
+	GradeAdjustedPaceMinPerKm       string  `json:"grade_adjusted_pace_min_per_km"`       // formatted as "X:XX min/km"
+
+	// Efficiency factor: normalized graded speed (m/min) of runs, walks and
+	// hikes, or normalized power of rides, per beat of heart rate
+	EfficiencyFactor      float64 `json:"efficiency_factor"`       // 0 without data
+	PowerEfficiencyFactor float64 `json:"power_efficiency_factor"` // 0 without data
 }
 
 // TrendData represents aggregated trend data for a time period.
 type TrendData struct {
-	Period string           `json:"period"` // "daily", "weekly", "monthly"
-	Points []TrendDataPoint  `json:"points"`
+	Period     string           `json:"period"` // "daily", "weekly", "monthly", "quarterly", "yearly"
+	Cumulative bool             `json:"cumulative"`
+	Smoothing  TrendSmoothing   `json:"smoothing"`
+	Points     []TrendDataPoint `json:"points"`
+	Analysis   *TrendAnalysis   `json:"analysis,omitempty"` // regressions and forecasts, if requested
 }
 
-// CalculateTrends calculates trend data for activities aggregated by time period.
-// period can be "daily", "weekly", or "monthly"
-// runningOnly filters to only running activities if true
-func CalculateTrends(activities []NormalizedActivity, period string, runningOnly bool) TrendData {
-	// Filter to running activities if requested
-	var filteredActivities []NormalizedActivity
-	if runningOnly {
-		for _, activity := range activities {
-			// Use the same running activity check as in running.go
-			if activity.SportType == "Run" || activity.SportType == "VirtualRun" || activity.SportType == "TrailRun" {
-				filteredActivities = append(filteredActivities, activity)
-			}
-		}
-	} else {
-		filteredActivities = activities
+// Smoothing methods for TrendSmoothing.Method.
+const (
+	SmoothingNone = "none" // raw period values
+	SmoothingSMA  = "sma"  // centered simple moving average over Window points
+	SmoothingEWMA = "ewma" // exponentially weighted moving average with weight Alpha
+)
+
+// TrendSmoothing selects how trend series are smoothed.
+type TrendSmoothing struct {
+	Method string  `json:"method"`           // SmoothingNone, SmoothingSMA or SmoothingEWMA
+	Window int     `json:"window,omitempty"` // points averaged by SMA
+	Alpha  float64 `json:"alpha,omitempty"`  // weight of the newest point for EWMA, in (0, 1]
+}
+
+// DefaultTrendSmoothing returns the smoothing used when none is requested:
+// a 3-point moving average for daily trends, none for longer periods.
+func DefaultTrendSmoothing(period string) TrendSmoothing {
+	if period == "daily" {
+		return TrendSmoothing{Method: SmoothingSMA, Window: 3}
 	}
+	return TrendSmoothing{Method: SmoothingNone}
+}
 
-	if len(filteredActivities) == 0 {
-		return TrendData{
-			Period: period,
-			Points: []TrendDataPoint{},
+// Validate checks that the smoothing parameters are usable.
+func (s TrendSmoothing) Validate() error {
+	switch s.Method {
+	case SmoothingNone:
+		return nil
+	case SmoothingSMA:
+		if s.Window < 1 {
+			return fmt.Errorf("smoothing window must be at least 1, got %d", s.Window)
 		}
+		return nil
+	case SmoothingEWMA:
+		if s.Alpha <= 0 || s.Alpha > 1 {
+			return fmt.Errorf("smoothing alpha must be in (0, 1], got %g", s.Alpha)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid smoothing method %q", s.Method)
 	}
+}
 
-	// Group activities by time period
-	grouped := groupByPeriod(filteredActivities, period)
+// TrendOptions controls how trends are aggregated.
+type TrendOptions struct {
+	Period      string       // "daily", "weekly", "monthly", "quarterly", or "yearly"
+	RunningOnly bool         // only include running activities
+	WeekStart   time.Weekday // first day of weekly periods
+	Cumulative  bool         // running totals from the start of the range; not smoothed
+	// Smoothing applied to the series; the zero value selects DefaultTrendSmoothing
+	Smoothing TrendSmoothing
+	// Regression fits linear and Theil-Sen trend lines to every series
+	Regression bool
+	// ForecastPeriods forecasts distance, moving time and elevation this many
+	// periods past the end of the range (0 for none)
+	ForecastPeriods int
+}
 
-	// Calculate averages for each period
-	points := make([]TrendDataPoint, 0, len(grouped))
-	for dateStr, group := range grouped {
-		point := calculatePeriodAverage(group, dateStr)
-		points = append(points, point)
+// CalculateTrends calculates trend data for activities aggregated by time period.
+// period can be "daily", "weekly", "monthly", "quarterly", or "yearly"
+// runningOnly filters to only running activities if true
+// Weeks start on Monday; use CalculateTrendsWithOptions to change that.
+func CalculateTrends(activities []NormalizedActivity, period string, runningOnly bool) TrendData {
+	return CalculateTrendsWithOptions(activities, TrendOptions{
+		Period:      period,
+		RunningOnly: runningOnly,
+		WeekStart:   time.Monday,
+	})
+}
+
+// CalculateTrendsWithOptions calculates trend data for activities using opts.
+func CalculateTrendsWithOptions(activities []NormalizedActivity, opts TrendOptions) TrendData {
+	// Aggregate through a throwaway rollup so per-request and precomputed
+	// trends share a single code path
+	rollup := NewRollup()
+	rollup.Add(activities...)
+	return TrendsFromRollup(rollup, "", "", opts)
+}
+
+// TrendsFromRollup calculates trend data from precomputed daily rollups between
+// start and end (inclusive, YYYY-MM-DD; empty means unbounded).
+func TrendsFromRollup(rollup *Rollup, start, end string, opts TrendOptions) TrendData {
+	period := opts.Period
+	smoothing := opts.Smoothing
+	if smoothing.Method == "" {
+		smoothing = DefaultTrendSmoothing(period)
+	}
+	if opts.Cumulative {
+		smoothing = TrendSmoothing{Method: SmoothingNone}
 	}
 
-	// Sort by date
-	sortTrendPoints(points)
+	// Filter to running activities if requested
+	var filter func(string) bool
+	if opts.RunningOnly {
+		filter = IsRunningActivity
+	}
 
-	// Apply smoothing for daily data
-	if period == "daily" && len(points) > 1 {
-		points = applyMovingAverage(points, 3) // 3-day moving average
+	data := TrendData{
+		Period:     period,
+		Cumulative: opts.Cumulative,
+		Smoothing:  smoothing,
+		Points:     []TrendDataPoint{},
 	}
 
-	return TrendData{
-		Period: period,
-		Points: points,
+	periods := rollup.Periods(start, end, period, opts.WeekStart, filter)
+	if len(periods) == 0 {
+		return data
 	}
-}
 
-// groupByPeriod groups activities by the specified time period.
-func groupByPeriod(activities []NormalizedActivity, period string) map[string][]NormalizedActivity {
-	groups := make(map[string][]NormalizedActivity)
+	// Work on the additive totals (already sorted by date), so derived values
+	// like pace are computed from smoothed or accumulated sums
+	series := make([]trendTotals, len(periods))
+	for i, p := range periods {
+		series[i] = trendTotalsOf(p.Total)
+	}
+	switch {
+	case opts.Cumulative:
+		for i := 1; i < len(series); i++ {
+			series[i].add(series[i-1])
+		}
+	case smoothing.Method == SmoothingSMA:
+		series = applyMovingAverage(series, smoothing.Window)
+	case smoothing.Method == SmoothingEWMA:
+		series = applyEWMA(series, smoothing.Alpha)
+	}
 
-	for _, activity := range activities {
-		dateKey := getPeriodKey(activity.LocalDateStr, period)
-		groups[dateKey] = append(groups[dateKey], activity)
+	count := 0
+	for i, p := range periods {
+		count += p.Total.Count
+		point := trendPointFromTotals(p.Period, series[i])
+		point.Count = p.Total.Count
+		if opts.Cumulative {
+			point.Count = count
+		}
+		data.Points = append(data.Points, point)
 	}
 
-	return groups
+	if opts.Regression || opts.ForecastPeriods > 0 {
+		data.Analysis = analyzeTrends(periods, period, end, opts.WeekStart, opts.Regression, opts.ForecastPeriods)
+	}
+	return data
 }
 
-// getPeriodKey returns a date key for the specified period.
-func getPeriodKey(dateStr string, period string) string {
+// periodKey returns a date key for the specified period. Weeks start on weekStart.
+func periodKey(dateStr string, period string, weekStart time.Weekday) string {
 	// Parse the date string (YYYY-MM-DD)
 	t, err := time.Parse("2006-01-02", dateStr)
 	if err != nil {
@@ -101,113 +209,184 @@ func getPeriodKey(dateStr string, period string) string {
 
 	switch period {
 	case "weekly":
-		// Get the start of the week (Monday)
-		weekday := int(t.Weekday())
-		if weekday == 0 {
-			weekday = 7 // Sunday = 7
-		}
-		weekStart := t.AddDate(0, 0, -(weekday - 1))
-		return weekStart.Format("2006-01-02")
+		// Get the start of the week (days since the configured first weekday)
+		daysSinceStart := (int(t.Weekday()) - int(weekStart) + 7) % 7
+		return t.AddDate(0, 0, -daysSinceStart).Format("2006-01-02")
 	case "monthly":
 		// Get the first day of the month
 		monthStart := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
 		return monthStart.Format("2006-01-02")
+	case "quarterly":
+		// Get the first day of the quarter
+		quarterStart := time.Date(t.Year(), (t.Month()-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC)
+		return quarterStart.Format("2006-01-02")
+	case "yearly":
+		// Get the first day of the year
+		yearStart := time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		return yearStart.Format("2006-01-02")
 	default: // "daily"
 		return dateStr
 	}
 }
 
-// calculatePeriodAverage calculates the average distance and pace for a group of activities.
-func calculatePeriodAverage(activities []NormalizedActivity, dateStr string) TrendDataPoint {
-	var totalDistance float64
-	var totalMovingTime int
-	count := len(activities)
+// trendTotals are the additive sums behind a trend point, as floats so they
+// can be averaged.
+type trendTotals struct {
+	distance      float64
+	movingTime    float64
+	distanceTime  float64
+	flatDistance  float64
+	elevationGain float64
+	heartrateTime float64
+	heartrateSum  float64
+	wattsTime     float64
+	wattsSum      float64
+	paceEFTime    float64
+	paceEFSum     float64
+	powerEFTime   float64
+	powerEFSum    float64
+}
+
+func trendTotalsOf(totals RollupTotals) trendTotals {
+	return trendTotals{
+		distance:      totals.Distance,
+		movingTime:    float64(totals.MovingTime),
+		distanceTime:  float64(totals.DistanceTime),
+		flatDistance:  totals.FlatDistance,
+		elevationGain: totals.ElevationGain,
+		heartrateTime: float64(totals.HeartrateTime),
+		heartrateSum:  totals.HeartrateSum,
+		wattsTime:     float64(totals.WattsTime),
+		wattsSum:      totals.WattsSum,
+		paceEFTime:    float64(totals.PaceEFTime),
+		paceEFSum:     totals.PaceEFSum,
+		powerEFTime:   float64(totals.PowerEFTime),
+		powerEFSum:    totals.PowerEFSum,
+	}
+}
+
+func (t *trendTotals) add(other trendTotals) {
+	t.distance += other.distance
+	t.movingTime += other.movingTime
+	t.distanceTime += other.distanceTime
+	t.flatDistance += other.flatDistance
+	t.elevationGain += other.elevationGain
+	t.heartrateTime += other.heartrateTime
+	t.heartrateSum += other.heartrateSum
+	t.wattsTime += other.wattsTime
+	t.wattsSum += other.wattsSum
+	t.paceEFTime += other.paceEFTime
+	t.paceEFSum += other.paceEFSum
+	t.powerEFTime += other.powerEFTime
+	t.powerEFSum += other.powerEFSum
+}
 
-	for _, activity := range activities {
-		totalDistance += activity.Distance
-		totalMovingTime += activity.MovingTime
+func (t trendTotals) scale(factor float64) trendTotals {
+	return trendTotals{
+		distance:      t.distance * factor,
+		movingTime:    t.movingTime * factor,
+		distanceTime:  t.distanceTime * factor,
+		flatDistance:  t.flatDistance * factor,
+		elevationGain: t.elevationGain * factor,
+		heartrateTime: t.heartrateTime * factor,
+		heartrateSum:  t.heartrateSum * factor,
+		wattsTime:     t.wattsTime * factor,
+		wattsSum:      t.wattsSum * factor,
+		paceEFTime:    t.paceEFTime * factor,
+		paceEFSum:     t.paceEFSum * factor,
+		powerEFTime:   t.powerEFTime * factor,
+		powerEFSum:    t.powerEFSum * factor,
 	}
+}
 
+// trendPointFromTotals calculates the series values of a period's totals.
+func trendPointFromTotals(dateStr string, totals trendTotals) TrendDataPoint {
 	point := TrendDataPoint{
-		Date:          dateStr,
-		Distance:      totalDistance,
-		DistanceKm:    totalDistance / 1000.0,
-		DistanceMiles: totalDistance / 1609.34,
-		Count:        count,
+		Date:              dateStr,
+		Distance:          totals.distance,
+		DistanceKm:        totals.distance / 1000.0,
+		DistanceMiles:     totals.distance / 1609.34,
+		MovingTime:        totals.movingTime,
+		ElevationGain:     totals.elevationGain,
+		ElevationGainFeet: totals.elevationGain * 3.28084,
+	}
+	if totals.heartrateTime > 0 {
+		point.AverageHeartrate = totals.heartrateSum / totals.heartrateTime
+	}
+	if totals.wattsTime > 0 {
+		point.AverageWatts = totals.wattsSum / totals.wattsTime
+	}
+	if totals.paceEFTime > 0 {
+		point.EfficiencyFactor = totals.paceEFSum / totals.paceEFTime
+	}
+	if totals.powerEFTime > 0 {
+		point.PowerEfficiencyFactor = totals.powerEFSum / totals.powerEFTime
 	}
 
-	// Calculate average pace if we have distance and time
-	if count > 0 && totalDistance > 0 && totalMovingTime > 0 {
+	// Calculate average pace if we have distance and time. Only the time of
+	// activities that covered distance counts, so strength sessions don't slow it down.
+	if totals.distance > 0 && totals.distanceTime > 0 {
 		// Pace in seconds per meter
-		paceSecPerMeter := float64(totalMovingTime) / totalDistance
-		
+		paceSecPerMeter := totals.distanceTime / totals.distance
+
 		// Convert to min/mi
-		paceSecPerMile := paceSecPerMeter * 1609.34
-		point.Pace = formatPaceSeconds(paceSecPerMile)
-		
+		point.PaceSecondsPerMile = paceSecPerMeter * 1609.34
+		point.Pace = formatPaceSeconds(point.PaceSecondsPerMile)
+
 		// Convert to min/km
-		paceSecPerKm := paceSecPerMeter * 1000
-		point.PaceMinPerKm = formatPaceSeconds(paceSecPerKm)
+		point.PaceSecondsPerKm = paceSecPerMeter * 1000
+		point.PaceMinPerKm = formatPaceSeconds(point.PaceSecondsPerKm)
+	}
+	if totals.flatDistance > 0 && totals.distanceTime > 0 {
+		paceSecPerMeter := totals.distanceTime / totals.flatDistance
+		point.GradeAdjustedPaceSecondsPerMile = paceSecPerMeter * 1609.34
+		point.GradeAdjustedPace = formatPaceSeconds(point.GradeAdjustedPaceSecondsPerMile)
+		point.GradeAdjustedPaceSecondsPerKm = paceSecPerMeter * 1000
+		point.GradeAdjustedPaceMinPerKm = formatPaceSeconds(point.GradeAdjustedPaceSecondsPerKm)
 	}
 
 	return point
 }
 
-// sortTrendPoints sorts trend points by date.
-func sortTrendPoints(points []TrendDataPoint) {
-	// Simple bubble sort (fine for small datasets)
-	for i := 0; i < len(points)-1; i++ {
-		for j := i + 1; j < len(points); j++ {
-			if points[i].Date > points[j].Date {
-				points[i], points[j] = points[j], points[i]
-			}
-		}
+// applyMovingAverage smooths the series with a centered moving average over
+// window neighbouring points (clipped at the edges).
+func applyMovingAverage(series []trendTotals, window int) []trendTotals {
+	if window <= 1 {
+		return series
 	}
-}
 
-// applyMovingAverage applies a moving average smoothing to trend points.
-func applyMovingAverage(points []TrendDataPoint, window int) []TrendDataPoint {
-	if len(points) <= window {
-		return points
-	}
-
-	smoothed := make([]TrendDataPoint, len(points))
+	smoothed := make([]trendTotals, len(series))
 	halfWindow := window / 2
-
-	for i := range points {
-		smoothed[i] = points[i] // Copy the point
-
-		// Calculate moving average for distance
-		var sumDistance float64
-		var count int
-
+	for i := range series {
 		start := i - halfWindow
+		end := start + window
 		if start < 0 {
 			start = 0
 		}
-		end := i + halfWindow + 1
-		if end > len(points) {
-			end = len(points)
+		if end > len(series) {
+			end = len(series)
 		}
 
+		var sum trendTotals
 		for j := start; j < end; j++ {
-			sumDistance += points[j].Distance
-			if points[j].Distance > 0 {
-				count++
-			}
+			sum.add(series[j])
 		}
+		smoothed[i] = sum.scale(1 / float64(end-start))
+	}
+	return smoothed
+}
 
-		if count > 0 {
-			avgDistance := sumDistance / float64(count)
-			smoothed[i].Distance = avgDistance
-			smoothed[i].DistanceKm = avgDistance / 1000.0
-			smoothed[i].DistanceMiles = avgDistance / 1609.34
+// applyEWMA smooths the series with an exponentially weighted moving average;
+// alpha is the weight of the newest point.
+func applyEWMA(series []trendTotals, alpha float64) []trendTotals {
+	smoothed := make([]trendTotals, len(series))
+	for i := range series {
+		if i == 0 {
+			smoothed[i] = series[i]
+			continue
 		}
-
-		// Note: Pace smoothing would require storing time separately
-		// For now, pace remains as calculated from original data
+		smoothed[i] = series[i].scale(alpha)
+		smoothed[i].add(smoothed[i-1].scale(1 - alpha))
 	}
-
 	return smoothed
 }
-
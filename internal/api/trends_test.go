@@ -0,0 +1,136 @@
+package api
+
+import (
+	"math"
+	"testing"
+)
+
+// trendActivities returns runs on three consecutive days plus a strength session.
+func trendActivities() []NormalizedActivity {
+	a := rollupActivity(1, "Run", "2024-11-25", 5000, 1500) // 5:00/km
+	a.AverageHeartrate = 140
+	a.TotalElevationGain = 50
+	b := rollupActivity(2, "Run", "2024-11-26", 10000, 3300) // 5:30/km
+	b.AverageHeartrate = 150
+	b.TotalElevationGain = 100
+	c := rollupActivity(3, "Run", "2024-11-27", 6000, 1800) // 5:00/km
+	c.AverageWatts = 250
+	return []NormalizedActivity{a, b, c, strengthActivity(4, "2024-11-26")}
+}
+
+func TestCalculateTrends_NumericSeries(t *testing.T) {
+	trends := CalculateTrendsWithOptions(trendActivities(), TrendOptions{
+		Period:    "daily",
+		Smoothing: TrendSmoothing{Method: SmoothingNone},
+	})
+	if len(trends.Points) != 3 {
+		t.Fatalf("Expected 3 points, got %d", len(trends.Points))
+	}
+
+	// The strength session adds time and a count but doesn't slow the pace down
+	p := trends.Points[1]
+	if p.Count != 2 || p.MovingTime != 5100 || p.ElevationGain != 100 || p.AverageHeartrate != 150 {
+		t.Errorf("Unexpected point: %+v", p)
+	}
+	if p.PaceSecondsPerKm != 330 || p.PaceMinPerKm != "5:30" {
+		t.Errorf("Expected 5:30/km, got %f (%s)", p.PaceSecondsPerKm, p.PaceMinPerKm)
+	}
+	if trends.Points[2].AverageWatts != 250 || trends.Points[2].AverageHeartrate != 0 {
+		t.Errorf("Unexpected power/heart rate: %+v", trends.Points[2])
+	}
+}
+
+func TestCalculateTrends_Smoothing(t *testing.T) {
+	// Daily trends default to a 3-point moving average of every series
+	trends := CalculateTrends(trendActivities(), "daily", true)
+	if trends.Smoothing.Method != SmoothingSMA || trends.Smoothing.Window != 3 {
+		t.Errorf("Expected default 3-point SMA, got %+v", trends.Smoothing)
+	}
+	first := trends.Points[0]
+	if first.Distance != 7500 || first.MovingTime != 2400 {
+		t.Errorf("Expected the first point to average two days, got %+v", first)
+	}
+	// Pace comes from the smoothed totals: 4800s over 15km
+	if math.Abs(first.PaceSecondsPerKm-320) > 1e-9 {
+		t.Errorf("Expected smoothed pace 320s/km, got %f", first.PaceSecondsPerKm)
+	}
+	if first.Count != 1 {
+		t.Errorf("Expected counts to stay unsmoothed, got %d", first.Count)
+	}
+
+	ewma := CalculateTrendsWithOptions(trendActivities(), TrendOptions{
+		Period:      "daily",
+		RunningOnly: true,
+		Smoothing:   TrendSmoothing{Method: SmoothingEWMA, Alpha: 0.5},
+	})
+	// 5000, then 0.5*10000 + 0.5*5000, then 0.5*6000 + 0.5*7500
+	expected := []float64{5000, 7500, 6750}
+	for i, point := range ewma.Points {
+		if point.Distance != expected[i] {
+			t.Errorf("EWMA point %d: expected %f, got %f", i, expected[i], point.Distance)
+		}
+	}
+}
+
+func TestCalculateTrends_Cumulative(t *testing.T) {
+	trends := CalculateTrendsWithOptions(trendActivities(), TrendOptions{
+		Period:      "daily",
+		RunningOnly: true,
+		Cumulative:  true,
+	})
+	if !trends.Cumulative || trends.Smoothing.Method != SmoothingNone {
+		t.Errorf("Expected unsmoothed cumulative trends, got %+v", trends)
+	}
+	last := trends.Points[len(trends.Points)-1]
+	if last.Distance != 21000 || last.Count != 3 || last.ElevationGain != 150 {
+		t.Errorf("Unexpected cumulative totals: %+v", last)
+	}
+	if math.Abs(last.PaceSecondsPerKm-6600.0/21) > 1e-9 {
+		t.Errorf("Expected pace to date, got %f", last.PaceSecondsPerKm)
+	}
+}
+
+func TestCalculateTrends_Quarterly(t *testing.T) {
+	activities := []NormalizedActivity{
+		rollupActivity(1, "Run", "2024-01-15", 5000, 1500),
+		rollupActivity(2, "Run", "2024-03-31", 5000, 1500),
+		rollupActivity(3, "Run", "2024-04-01", 5000, 1500),
+		rollupActivity(4, "Run", "2024-12-31", 5000, 1500),
+	}
+	trends := CalculateTrends(activities, "quarterly", true)
+	if len(trends.Points) != 3 {
+		t.Fatalf("Expected 3 quarters, got %+v", trends.Points)
+	}
+	for i, expected := range []struct {
+		date  string
+		count int
+	}{{"2024-01-01", 2}, {"2024-04-01", 1}, {"2024-10-01", 1}} {
+		if trends.Points[i].Date != expected.date || trends.Points[i].Count != expected.count {
+			t.Errorf("Quarter %d: expected %s with %d, got %+v", i, expected.date, expected.count, trends.Points[i])
+		}
+	}
+}
+
+func TestTrendSmoothing_Validate(t *testing.T) {
+	valid := []TrendSmoothing{
+		{Method: SmoothingNone},
+		{Method: SmoothingSMA, Window: 7},
+		{Method: SmoothingEWMA, Alpha: 1},
+		DefaultTrendSmoothing("weekly"),
+	}
+	for _, s := range valid {
+		if err := s.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", s, err)
+		}
+	}
+	invalid := []TrendSmoothing{
+		{Method: SmoothingSMA},
+		{Method: SmoothingEWMA, Alpha: 1.5},
+		{Method: "median"},
+	}
+	for _, s := range invalid {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", s)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package api
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// VO2max estimation methods.
+const (
+	// VO2maxFromRuns extrapolates the oxygen cost of each run's grade-adjusted
+	// speed (ACSM running equation) to maximum effort, taking the run's share
+	// of heart rate reserve as its share of VO2 reserve (Swain), as Firstbeat
+	// does with submaximal runs
+	VO2maxFromRuns = "heart_rate_speed"
+	// VO2maxFromHeartRate uses only the ratio of maximum to resting heart rate
+	// (Uth-Sørensen: 15.3 × max HR / resting HR)
+	VO2maxFromHeartRate = "uth_sorensen"
+)
+
+// VO2max confidence levels.
+const (
+	ConfidenceHigh   = "high"
+	ConfidenceMedium = "medium"
+	ConfidenceLow    = "low"
+)
+
+// VO2max estimation settings.
+const (
+	vo2RestingMlKgMin = 3.5     // oxygen uptake at rest (1 MET), in ml/kg/min
+	vo2PerMeter       = 0.2     // ml/kg per meter run on the flat (ACSM)
+	vo2MinSeconds     = 20 * 60 // heart rate needs time to settle
+	// A run's share of heart rate reserve must lie between these: easier runs
+	// are too far from maximum to extrapolate, harder ones aren't steady
+	vo2MinReserve = 0.5
+	vo2MaxReserve = 0.95
+	// vo2GoodReserve and above gives full confidence in a run's estimate
+	vo2GoodReserve = 0.7
+	// vo2SmoothingAlpha is the weight of each new run in the smoothed trend
+	vo2SmoothingAlpha = 0.2
+	// vo2HighConfidenceRuns qualifying runs give a high-confidence estimate
+	vo2HighConfidenceRuns = 5
+)
+
+// VO2maxOptions are the athlete's details used to estimate VO2max.
+type VO2maxOptions struct {
+	MaxHR     float64
+	RestingHR float64
+	// HeartRateConfigured is whether MaxHR and RestingHR are the athlete's own
+	// rather than defaults, which makes every estimate far less certain
+	HeartRateConfigured bool
+	Sex                 string  // "male", "female" or "" when unknown
+	Age                 float64 // in years, 0 when unknown
+	// HeartRatesAt, if set, returns the max and resting heart rate in effect
+	// on a date (YYYY-MM-DD), so each run is judged by the heart rates the
+	// athlete had then; MaxHR and RestingHR are the current ones
+	HeartRatesAt func(date string) (maxHR, restingHR float64)
+}
+
+// VO2maxEstimate is the VO2max estimated from one run.
+type VO2maxEstimate struct {
+	ID        int64   `json:"id"`
+	Name      string  `json:"name"`
+	Date      string  `json:"date"` // YYYY-MM-DD
+	SportType string  `json:"sport_type"`
+	VO2max    float64 `json:"vo2max"` // in ml/kg/min
+	// Speed is the grade-adjusted speed, in meters per minute
+	Speed float64 `json:"speed"`
+	// HeartRateReserve is the run's average heart rate as a share of the
+	// heart rate reserve (0 at resting, 1 at maximum)
+	HeartRateReserve float64 `json:"heart_rate_reserve"`
+	Weight           float64 `json:"weight"` // 0-1, how much the run counts in the trend
+}
+
+// VO2maxPoint is the smoothed VO2max after a run.
+type VO2maxPoint struct {
+	Date   string  `json:"date"` // YYYY-MM-DD
+	VO2max float64 `json:"vo2max"`
+}
+
+// VO2max is the athlete's estimated VO2max and fitness age.
+type VO2max struct {
+	Method            string  `json:"method"` // VO2maxFromRuns or VO2maxFromHeartRate
+	MethodDescription string  `json:"method_description"`
+	VO2max            float64 `json:"vo2max"` // latest smoothed estimate, in ml/kg/min; 0 if unknown
+	// UthSorensen is the estimate from heart rates alone, for comparison
+	UthSorensen float64          `json:"uth_sorensen"`
+	Estimates   []VO2maxEstimate `json:"estimates"` // qualifying runs, oldest first
+	Trend       []VO2maxPoint    `json:"trend"`     // smoothed after each run
+	Regression  *Regression      `json:"regression,omitempty"`
+	Confidence  string           `json:"confidence"` // ConfidenceHigh, ConfidenceMedium or ConfidenceLow
+	Reasons     []string         `json:"confidence_reasons"`
+	FitnessAge  float64          `json:"fitness_age,omitempty"` // 0 if VO2max is unknown
+	Age         float64          `json:"age,omitempty"`
+	Norms       string           `json:"norms"`
+	HeartRate   VO2maxHeartRate  `json:"heart_rate"`
+}
+
+// VO2maxHeartRate echoes the heart rates and sex an estimate used, and
+// whether the heart rates were the athlete's own.
+type VO2maxHeartRate struct {
+	MaxHR      float64 `json:"max_hr"`
+	RestingHR  float64 `json:"resting_hr"`
+	Configured bool    `json:"configured"`
+	Sex        string  `json:"sex,omitempty"`
+}
+
+// vo2maxNorms are the median VO2max (ml/kg/min) at the middle of each decade
+// of age from 25 to 75, from the ACSM treadmill norms.
+var vo2maxNorms = map[string][]float64{
+	"male":   {48.0, 42.4, 37.8, 32.6, 28.2, 24.4},
+	"female": {37.6, 30.2, 26.7, 23.4, 20.0, 18.3},
+}
+
+// normsDescription describes vo2maxNorms.
+const normsDescription = "ACSM treadmill norms (50th percentile by age)"
+
+// FitnessAge returns the age at which the median VO2max of the population
+// equals vo2max, between 20 and 80. sex selects the norms; without it the
+// average of both is used.
+func FitnessAge(vo2max float64, sex string) float64 {
+	norms, ok := vo2maxNorms[sex]
+	if !ok {
+		norms = make([]float64, len(vo2maxNorms["male"]))
+		for i := range norms {
+			norms[i] = (vo2maxNorms["male"][i] + vo2maxNorms["female"][i]) / 2
+		}
+	}
+	// Norms fall with age, 10 years apart from 25; extend the first and last
+	// decades' slopes to 20 and 80
+	age := func(i int, v float64) float64 {
+		return 25 + 10*(float64(i)+(norms[i]-v)/(norms[i]-norms[i+1]))
+	}
+	if vo2max >= norms[0] {
+		return math.Max(20, age(0, vo2max))
+	}
+	for i := 0; i < len(norms)-1; i++ {
+		if vo2max >= norms[i+1] {
+			return age(i, vo2max)
+		}
+	}
+	return math.Min(80, age(len(norms)-2, vo2max))
+}
+
+// UthSorensenVO2max returns 15.3 × maxHR / restingHR, or 0 without both.
+func UthSorensenVO2max(maxHR, restingHR float64) float64 {
+	if maxHR <= 0 || restingHR <= 0 {
+		return 0
+	}
+	return 15.3 * maxHR / restingHR
+}
+
+// IsVO2maxRun reports whether a run can estimate VO2max: a run with heart
+// rate, long enough for heart rate to settle, and not tagged as a workout, as
+// the average heart rate of intervals doesn't match their average speed.
+func IsVO2maxRun(activity NormalizedActivity) bool {
+	if !IsRunningActivity(activity.SportType) || activity.AverageHeartrate <= 0 {
+		return false
+	}
+	if activity.WorkoutType != nil && *activity.WorkoutType == workoutWorkout {
+		return false
+	}
+	return activity.MovingTime >= vo2MinSeconds && activity.Distance > 0
+}
+
+// EstimateVO2max estimates VO2max from each qualifying run (see IsVO2maxRun)
+// whose heart rate is between 50% and 95% of heart rate reserve, smooths the
+// estimates into a trend, and derives fitness age. Grade factors measured
+// from streams are used where known, otherwise estimated from elevation gain.
+// Without qualifying runs it falls back to the Uth-Sørensen estimate.
+func EstimateVO2max(activities []NormalizedActivity, gradeFactors map[int64]float64, opts VO2maxOptions) VO2max {
+	result := VO2max{
+		Method:      VO2maxFromRuns,
+		UthSorensen: UthSorensenVO2max(opts.MaxHR, opts.RestingHR),
+		Estimates:   []VO2maxEstimate{},
+		Trend:       []VO2maxPoint{},
+		Reasons:     []string{},
+		Age:         opts.Age,
+		Norms:       normsDescription,
+		HeartRate:   VO2maxHeartRate{MaxHR: opts.MaxHR, RestingHR: opts.RestingHR, Configured: opts.HeartRateConfigured, Sex: opts.Sex},
+	}
+
+	sorted := append([]NormalizedActivity(nil), activities...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].StartDate.Before(sorted[j].StartDate) })
+	var first time.Time
+	var xs []float64 // days since the first qualifying run
+	for _, activity := range sorted {
+		maxHR, restingHR := opts.MaxHR, opts.RestingHR
+		if opts.HeartRatesAt != nil {
+			maxHR, restingHR = opts.HeartRatesAt(activity.LocalDateStr)
+		}
+		reserve := maxHR - restingHR
+		if reserve <= 0 || !IsVO2maxRun(activity) {
+			continue
+		}
+		share := (activity.AverageHeartrate - restingHR) / reserve
+		if share < vo2MinReserve || share > vo2MaxReserve {
+			continue
+		}
+		if len(result.Estimates) == 0 {
+			first = activity.LocalDate
+		}
+		xs = append(xs, activity.LocalDate.Sub(first).Hours()/24)
+		factor, _ := activityGradeAdjustment(activity, gradeFactors)
+		speed := activity.Distance * factor / float64(activity.MovingTime) * 60
+		vo2 := vo2RestingMlKgMin + vo2PerMeter*speed
+		result.Estimates = append(result.Estimates, VO2maxEstimate{
+			ID:               activity.ID,
+			Name:             activity.Name,
+			Date:             activity.LocalDateStr,
+			SportType:        activity.SportType,
+			VO2max:           vo2RestingMlKgMin + (vo2-vo2RestingMlKgMin)/share,
+			Speed:            speed,
+			HeartRateReserve: share,
+			Weight:           math.Min(1, (share-vo2MinReserve)/(vo2GoodReserve-vo2MinReserve)),
+		})
+	}
+
+	// Smooth with an exponentially weighted average, where runs closer to
+	// maximum effort count for more
+	var smoothed float64
+	var ys []float64
+	for i, estimate := range result.Estimates {
+		if i == 0 {
+			smoothed = estimate.VO2max
+		} else {
+			alpha := vo2SmoothingAlpha * math.Max(estimate.Weight, 0.25)
+			smoothed += alpha * (estimate.VO2max - smoothed)
+		}
+		result.Trend = append(result.Trend, VO2maxPoint{Date: estimate.Date, VO2max: smoothed})
+		ys = append(ys, estimate.VO2max)
+	}
+	result.Regression = LinearRegression(xs, ys)
+
+	switch {
+	case len(result.Estimates) > 0:
+		result.VO2max = smoothed
+		result.MethodDescription = "Each run's grade-adjusted speed gives its oxygen cost (ACSM: 3.5 + 0.2 ml/kg/min per m/min); " +
+			"taking its share of heart rate reserve as its share of VO2 reserve extrapolates that to maximum effort. " +
+			"Estimates are smoothed with an exponentially weighted average."
+	case result.UthSorensen > 0:
+		result.Method = VO2maxFromHeartRate
+		result.VO2max = result.UthSorensen
+		result.MethodDescription = "No run qualified, so VO2max is estimated from heart rates alone (Uth-Sørensen: 15.3 × max HR / resting HR)."
+	}
+	if result.VO2max > 0 {
+		result.FitnessAge = FitnessAge(result.VO2max, opts.Sex)
+	}
+	result.Confidence, result.Reasons = vo2maxConfidence(result, opts)
+	return result
+}
+
+// vo2maxConfidence rates an estimate and explains what lowers it.
+func vo2maxConfidence(result VO2max, opts VO2maxOptions) (string, []string) {
+	reasons := []string{}
+	score := 2 // high, lowered by each problem
+	if !opts.HeartRateConfigured {
+		reasons = append(reasons, "Max and resting heart rate are defaults, not your own")
+		score--
+	}
+	switch {
+	case result.Method == VO2maxFromHeartRate:
+		reasons = append(reasons, "No run with heart rate was long and hard enough; the heart-rate-only estimate is rough")
+		score = 0
+	case len(result.Estimates) < vo2HighConfidenceRuns:
+		reasons = append(reasons, "Fewer than 5 qualifying runs")
+		score--
+	}
+	var weight float64
+	for _, estimate := range result.Estimates {
+		weight += estimate.Weight
+	}
+	if len(result.Estimates) > 0 && weight/float64(len(result.Estimates)) < 0.5 {
+		reasons = append(reasons, "Most runs were easy; runs above 70% of heart rate reserve give better estimates")
+		score--
+	}
+	if opts.Sex == "" {
+		reasons = append(reasons, "Fitness age averages the norms of men and women without your sex")
+	}
+	switch {
+	case score >= 2:
+		return ConfidenceHigh, reasons
+	case score == 1:
+		return ConfidenceMedium, reasons
+	}
+	return ConfidenceLow, reasons
+}
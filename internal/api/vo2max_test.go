@@ -0,0 +1,83 @@
+package api
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFitnessAge(t *testing.T) {
+	// Halfway between the medians of men aged 35 and 45
+	if age := FitnessAge(40.1, "male"); math.Abs(age-40) > 1e-9 {
+		t.Errorf("Expected a fitness age of 40, got %.2f", age)
+	}
+	if age := FitnessAge(45, "female"); age != 20 {
+		t.Errorf("Expected the youngest fitness age for a fit woman, got %.2f", age)
+	}
+	if age := FitnessAge(10, "male"); age != 80 {
+		t.Errorf("Expected the oldest fitness age, got %.2f", age)
+	}
+	if male, either := FitnessAge(35, "male"), FitnessAge(35, ""); either >= male {
+		t.Errorf("Expected averaged norms to give a younger age than men's, got %.1f and %.1f", either, male)
+	}
+}
+
+func TestEstimateVO2max(t *testing.T) {
+	opts := VO2maxOptions{MaxHR: 190, RestingHR: 50, HeartRateConfigured: true, Sex: "male"}
+	activities := []NormalizedActivity{
+		// 200 m/min at 70% of heart rate reserve: 3.5 + 40 / 0.7
+		rollupActivity(2, "Run", "2024-03-08", 10000, 3000, heartrate(148)),
+		rollupActivity(1, "Run", "2024-03-01", 10000, 3000, heartrate(150)),
+		rollupActivity(3, "Run", "2024-03-15", 10000, 3000, heartrate(146)),
+		// Too easy, too short, no heart rate, not a run
+		rollupActivity(4, "Run", "2024-03-16", 10000, 3600, heartrate(100)),
+		rollupActivity(5, "Run", "2024-03-17", 3000, 900, heartrate(160)),
+		rollupActivity(6, "Run", "2024-03-18", 10000, 3000),
+		rollupActivity(7, "Ride", "2024-03-19", 40000, 3600, heartrate(150)),
+	}
+	workout := workoutWorkout
+	intervals := rollupActivity(8, "Run", "2024-03-20", 10000, 3000, heartrate(160))
+	intervals.WorkoutType = &workout
+	activities = append(activities, intervals)
+
+	result := EstimateVO2max(activities, nil, opts)
+	if result.Method != VO2maxFromRuns || len(result.Estimates) != 3 || result.Estimates[0].ID != 1 {
+		t.Fatalf("Expected 3 qualifying runs, oldest first, got %+v", result.Estimates)
+	}
+	if estimate := result.Estimates[1]; math.Abs(estimate.VO2max-(3.5+40/0.7)) > 1e-9 || math.Abs(estimate.Weight-1) > 1e-9 {
+		t.Errorf("Unexpected estimate %+v", estimate)
+	}
+	if len(result.Trend) != 3 || result.VO2max != result.Trend[2].VO2max {
+		t.Errorf("Expected the latest smoothed value, got %.2f from %+v", result.VO2max, result.Trend)
+	}
+	// Heart rate falling at the same pace is improving fitness
+	if result.Regression == nil || result.Regression.Slope <= 0 || result.Trend[2].VO2max <= result.Trend[0].VO2max {
+		t.Errorf("Expected a rising trend, got %+v", result.Regression)
+	}
+	if result.FitnessAge != 20 || math.Abs(result.UthSorensen-15.3*190/50) > 1e-9 {
+		t.Errorf("Unexpected fitness age %.1f or Uth-Sørensen %.1f", result.FitnessAge, result.UthSorensen)
+	}
+	if result.Confidence != ConfidenceMedium || len(result.Reasons) != 1 {
+		t.Errorf("Expected medium confidence from 3 runs, got %s %v", result.Confidence, result.Reasons)
+	}
+
+	// Hills make the same pace harder
+	hilly := rollupActivity(1, "Run", "2024-03-01", 10000, 3000, heartrate(148))
+	hilly.TotalElevationGain = 300
+	if got := EstimateVO2max([]NormalizedActivity{hilly}, nil, opts); got.VO2max <= 3.5+40/0.7 {
+		t.Errorf("Expected a hilly run to estimate higher, got %.2f", got.VO2max)
+	}
+}
+
+func TestEstimateVO2maxFallback(t *testing.T) {
+	opts := VO2maxOptions{MaxHR: 190, RestingHR: 60}
+	result := EstimateVO2max([]NormalizedActivity{strengthActivity(1, "2024-03-01")}, nil, opts)
+	if result.Method != VO2maxFromHeartRate || math.Abs(result.VO2max-15.3*190/60) > 1e-9 {
+		t.Errorf("Expected the Uth-Sørensen estimate, got %s %.2f", result.Method, result.VO2max)
+	}
+	if result.Confidence != ConfidenceLow || len(result.Reasons) != 3 {
+		t.Errorf("Expected low confidence with 3 reasons, got %s %v", result.Confidence, result.Reasons)
+	}
+	if result.FitnessAge == 0 || result.MethodDescription == "" {
+		t.Errorf("Expected a fitness age and method description, got %+v", result)
+	}
+}
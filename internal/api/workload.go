@@ -0,0 +1,339 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Workload load metrics for WorkloadOptions.Metric.
+const (
+	LoadDistance = "distance" // kilometers
+	LoadTime     = "time"     // moving minutes
+	LoadStress   = "stress"   // Banister TRIMP from heart rate
+)
+
+// Workload flags set on weeks and alerts.
+const (
+	FlagWeeklyIncrease = "weekly_increase" // weekly load jumped more than the threshold
+	FlagHighACWR       = "high_acwr"       // acute:chronic ratio above the threshold
+	FlagHighMonotony   = "high_monotony"   // training too uniform (Foster)
+	FlagHighStrain     = "high_strain"     // weekly load times monotony above the threshold
+)
+
+// StressModel converts heart rate into Banister's training impulse (TRIMP).
+type StressModel struct {
+	RestingHR float64 `json:"resting_hr"`
+	MaxHR     float64 `json:"max_hr"`
+}
+
+// DefaultStressModel uses typical resting and maximum heart rates until the
+// athlete's own values are known.
+func DefaultStressModel() StressModel {
+	return StressModel{RestingHR: 60, MaxHR: 190}
+}
+
+// defaultHeartRateReserve is the intensity assumed for time without heart rate
+// data: an easy effort at half the heart rate reserve.
+const defaultHeartRateReserve = 0.5
+
+// trimp returns Banister's TRIMP for minutes at a fraction of heart rate reserve.
+func trimp(minutes, reserve float64) float64 {
+	reserve = math.Max(0, math.Min(reserve, 1))
+	return minutes * reserve * 0.64 * math.Exp(1.92*reserve)
+}
+
+// Stress returns the TRIMP of a day's or period's totals. Heart rate is only
+// known as a moving-time weighted average, so the TRIMP is an estimate; time
+// without heart rate counts as an easy effort.
+func (m StressModel) Stress(totals RollupTotals) float64 {
+	var stress float64
+	if totals.HeartrateTime > 0 && m.MaxHR > m.RestingHR {
+		reserve := (totals.AverageHeartrate() - m.RestingHR) / (m.MaxHR - m.RestingHR)
+		stress += trimp(float64(totals.HeartrateTime)/60, reserve)
+	}
+	if withoutHR := totals.MovingTime - totals.HeartrateTime; withoutHR > 0 {
+		stress += trimp(float64(withoutHR)/60, defaultHeartRateReserve)
+	}
+	return stress
+}
+
+// WorkloadThresholds are the limits that flag a week. Zero disables a check.
+type WorkloadThresholds struct {
+	WeeklyIncrease float64 `json:"weekly_increase"` // fraction, e.g. 0.10 for the 10% rule
+	ACWR           float64 `json:"acwr"`
+	Monotony       float64 `json:"monotony"`
+	Strain         float64 `json:"strain"` // in load units; depends on the metric
+}
+
+// DefaultWorkloadThresholds flags weekly jumps over 10%, an ACWR over 1.5 and
+// Foster's monotony over 2.0. Strain depends on the metric, so it is off.
+func DefaultWorkloadThresholds() WorkloadThresholds {
+	return WorkloadThresholds{WeeklyIncrease: 0.10, ACWR: 1.5, Monotony: 2.0}
+}
+
+// WorkloadOptions controls the workload calculation.
+type WorkloadOptions struct {
+	Metric     string       // LoadDistance, LoadTime or LoadStress
+	WeekStart  time.Weekday // first day of weekly totals
+	Thresholds WorkloadThresholds
+	Stress     StressModel // used for LoadStress
+	// StressAt, if set, returns the stress model in effect on a date
+	// (YYYY-MM-DD), so past days use the heart rates the athlete had then;
+	// it takes precedence over Stress
+	StressAt func(date string) StressModel
+}
+
+// WorkloadDay is the training load on one day with rolling averages.
+type WorkloadDay struct {
+	Date    string  `json:"date"` // YYYY-MM-DD
+	Load    float64 `json:"load"`
+	Acute   float64 `json:"acute"`   // mean daily load over the last 7 days
+	Chronic float64 `json:"chronic"` // mean daily load over the last 28 days (includes the acute week)
+	// ChronicUncoupled is the mean daily load over the 21 days before the acute week
+	ChronicUncoupled float64 `json:"chronic_uncoupled"`
+	ACWR             float64 `json:"acwr"`           // Acute / Chronic, 0 without chronic load
+	ACWRUncoupled    float64 `json:"acwr_uncoupled"` // Acute / ChronicUncoupled
+	Monotony         float64 `json:"monotony"`       // mean / standard deviation of the last 7 days' loads
+	Strain           float64 `json:"strain"`         // last 7 days' load * monotony
+}
+
+// WorkloadWeek is the training load of one week.
+type WorkloadWeek struct {
+	Week     string   `json:"week"` // first day of the week (YYYY-MM-DD)
+	Load     float64  `json:"load"`
+	Change   *float64 `json:"change"` // fraction vs. the previous week; nil if that week had no load
+	Monotony float64  `json:"monotony"`
+	Strain   float64  `json:"strain"`
+	MaxACWR  float64  `json:"max_acwr"` // highest coupled ACWR on any day of the week
+	Complete bool     `json:"complete"` // false for the week still in progress
+	Flags    []string `json:"flags"`
+}
+
+// WorkloadAlert is a threshold broken recently, for a dashboard warning.
+type WorkloadAlert struct {
+	Flag      string  `json:"flag"`
+	Date      string  `json:"date"` // the day (ACWR) or week start (weekly checks)
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Message   string  `json:"message"`
+}
+
+// Workload is the acute:chronic workload analysis of a date range.
+type Workload struct {
+	Metric     string             `json:"metric"`
+	Unit       string             `json:"unit"`
+	Thresholds WorkloadThresholds `json:"thresholds"`
+	Days       []WorkloadDay      `json:"days"`
+	Weeks      []WorkloadWeek     `json:"weeks"`
+	Alerts     []WorkloadAlert    `json:"alerts"` // flags of the latest day and latest complete week
+}
+
+// acuteDays and chronicDays are the rolling windows of the ACWR.
+const (
+	acuteDays   = 7
+	chronicDays = 28
+)
+
+// WorkloadFromRollup calculates daily loads, rolling acute (7-day) and chronic
+// (28-day) loads, the coupled and uncoupled ACWR, and Foster's monotony and
+// strain between start and end (inclusive, YYYY-MM-DD) for sports accepted by
+// filter (nil accepts all). The rollup must also cover the 27 days before start
+// for the chronic load to be complete. Weeks are flagged when they break
+// opts.Thresholds.
+func WorkloadFromRollup(rollup *Rollup, start, end string, filter func(sportType string) bool, opts WorkloadOptions) (Workload, error) {
+	startDate, err := time.Parse("2006-01-02", start)
+	if err != nil {
+		return Workload{}, fmt.Errorf("invalid start date %q: %w", start, err)
+	}
+	endDate, err := time.Parse("2006-01-02", end)
+	if err != nil {
+		return Workload{}, fmt.Errorf("invalid end date %q: %w", end, err)
+	}
+	if endDate.Before(startDate) {
+		return Workload{}, fmt.Errorf("end date %s is before start date %s", end, start)
+	}
+
+	var load func(date string, totals RollupTotals) float64
+	workload := Workload{Metric: opts.Metric, Thresholds: opts.Thresholds, Days: []WorkloadDay{}, Weeks: []WorkloadWeek{}, Alerts: []WorkloadAlert{}}
+	switch opts.Metric {
+	case LoadDistance:
+		workload.Unit = "km"
+		load = func(_ string, t RollupTotals) float64 { return t.Distance / 1000 }
+	case LoadTime:
+		workload.Unit = "min"
+		load = func(_ string, t RollupTotals) float64 { return float64(t.MovingTime) / 60 }
+	case LoadStress:
+		workload.Unit = "TRIMP"
+		load = func(date string, t RollupTotals) float64 {
+			if opts.StressAt != nil {
+				return opts.StressAt(date).Stress(t)
+			}
+			return opts.Stress.Stress(t)
+		}
+	default:
+		return Workload{}, fmt.Errorf("invalid load metric %q", opts.Metric)
+	}
+
+	// Daily loads on a continuous calendar, starting early enough to fill the
+	// chronic window of the first day
+	historyStart := startDate.AddDate(0, 0, -(chronicDays - 1))
+	days := int(endDate.Sub(historyStart).Hours()/24) + 1
+	loads := make([]float64, days)
+	for _, day := range rollup.Days(historyStart.Format("2006-01-02"), end, filter) {
+		date, err := time.Parse("2006-01-02", day.Date)
+		if err != nil {
+			continue
+		}
+		loads[int(date.Sub(historyStart).Hours()/24)] = load(day.Date, day.Total)
+	}
+
+	// Prefix sums make every window an O(1) difference
+	sums := make([]float64, days+1)
+	for i, l := range loads {
+		sums[i+1] = sums[i] + l
+	}
+	window := func(from, to int) float64 { return sums[to] - sums[from] } // loads[from:to]
+
+	for i := chronicDays - 1; i < days; i++ {
+		day := WorkloadDay{
+			Date:             historyStart.AddDate(0, 0, i).Format("2006-01-02"),
+			Load:             loads[i],
+			Acute:            window(i+1-acuteDays, i+1) / acuteDays,
+			Chronic:          window(i+1-chronicDays, i+1) / chronicDays,
+			ChronicUncoupled: window(i+1-chronicDays, i+1-acuteDays) / (chronicDays - acuteDays),
+		}
+		if day.Chronic > 0 {
+			day.ACWR = day.Acute / day.Chronic
+		}
+		if day.ChronicUncoupled > 0 {
+			day.ACWRUncoupled = day.Acute / day.ChronicUncoupled
+		}
+		day.Monotony, day.Strain = fosterMonotony(loads[i+1-acuteDays : i+1])
+		workload.Days = append(workload.Days, day)
+	}
+
+	workload.Weeks = workloadWeeks(workload.Days, opts.WeekStart, opts.Thresholds)
+	workload.Alerts = workloadAlerts(workload, opts.Thresholds)
+	return workload, nil
+}
+
+// fosterMonotony returns Foster's monotony (mean daily load / standard
+// deviation) and strain (total load * monotony) of a week of daily loads.
+// Monotony is 0 when the loads don't vary (including a week of rest).
+func fosterMonotony(loads []float64) (float64, float64) {
+	var total float64
+	for _, l := range loads {
+		total += l
+	}
+	mean := total / float64(len(loads))
+	var variance float64
+	for _, l := range loads {
+		variance += (l - mean) * (l - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(loads)))
+	if stddev == 0 {
+		return 0, 0
+	}
+	monotony := mean / stddev
+	return monotony, total * monotony
+}
+
+// workloadWeeks groups the days into weeks starting on weekStart and flags the
+// weeks that break the thresholds. Partial weeks at either end are included;
+// only complete weeks are compared with the week before.
+func workloadWeeks(days []WorkloadDay, weekStart time.Weekday, thresholds WorkloadThresholds) []WorkloadWeek {
+	weeks := []WorkloadWeek{}
+	var weekDays []WorkloadDay
+	flush := func() {
+		if len(weekDays) == 0 {
+			return
+		}
+		week := WorkloadWeek{
+			Week:     periodKey(weekDays[0].Date, "weekly", weekStart),
+			Complete: len(weekDays) == 7,
+			Flags:    []string{},
+		}
+		loads := make([]float64, len(weekDays))
+		for i, day := range weekDays {
+			loads[i] = day.Load
+			week.Load += day.Load
+			week.MaxACWR = math.Max(week.MaxACWR, day.ACWR)
+		}
+		if week.Complete {
+			week.Monotony, week.Strain = fosterMonotony(loads)
+		}
+		if n := len(weeks); n > 0 && week.Complete && weeks[n-1].Complete && weeks[n-1].Load > 0 {
+			change := week.Load/weeks[n-1].Load - 1
+			week.Change = &change
+		}
+
+		if thresholds.WeeklyIncrease > 0 && week.Change != nil && *week.Change > thresholds.WeeklyIncrease {
+			week.Flags = append(week.Flags, FlagWeeklyIncrease)
+		}
+		if thresholds.ACWR > 0 && week.MaxACWR > thresholds.ACWR {
+			week.Flags = append(week.Flags, FlagHighACWR)
+		}
+		if thresholds.Monotony > 0 && week.Monotony > thresholds.Monotony {
+			week.Flags = append(week.Flags, FlagHighMonotony)
+		}
+		if thresholds.Strain > 0 && week.Strain > thresholds.Strain {
+			week.Flags = append(week.Flags, FlagHighStrain)
+		}
+		weeks = append(weeks, week)
+		weekDays = nil
+	}
+
+	for _, day := range days {
+		if len(weekDays) > 0 && periodKey(day.Date, "weekly", weekStart) != periodKey(weekDays[0].Date, "weekly", weekStart) {
+			flush()
+		}
+		weekDays = append(weekDays, day)
+	}
+	flush()
+	return weeks
+}
+
+// workloadAlerts returns the thresholds broken on the latest day (ACWR) and in
+// the latest complete week (weekly increase, monotony, strain).
+func workloadAlerts(workload Workload, thresholds WorkloadThresholds) []WorkloadAlert {
+	alerts := []WorkloadAlert{}
+	if len(workload.Days) > 0 {
+		latest := workload.Days[len(workload.Days)-1]
+		if thresholds.ACWR > 0 && latest.ACWR > thresholds.ACWR {
+			alerts = append(alerts, WorkloadAlert{
+				Flag:      FlagHighACWR,
+				Date:      latest.Date,
+				Value:     latest.ACWR,
+				Threshold: thresholds.ACWR,
+				Message:   fmt.Sprintf("Acute:chronic workload ratio is %.2f, above %.2f", latest.ACWR, thresholds.ACWR),
+			})
+		}
+	}
+
+	for i := len(workload.Weeks) - 1; i >= 0; i-- {
+		week := workload.Weeks[i]
+		if !week.Complete {
+			continue
+		}
+		for _, flag := range week.Flags {
+			alert := WorkloadAlert{Flag: flag, Date: week.Week}
+			switch flag {
+			case FlagWeeklyIncrease:
+				alert.Value, alert.Threshold = *week.Change, thresholds.WeeklyIncrease
+				alert.Message = fmt.Sprintf("Load in the week of %s rose %.0f%%, more than %.0f%%", week.Week, *week.Change*100, thresholds.WeeklyIncrease*100)
+			case FlagHighMonotony:
+				alert.Value, alert.Threshold = week.Monotony, thresholds.Monotony
+				alert.Message = fmt.Sprintf("Training monotony in the week of %s was %.2f, above %.2f", week.Week, week.Monotony, thresholds.Monotony)
+			case FlagHighStrain:
+				alert.Value, alert.Threshold = week.Strain, thresholds.Strain
+				alert.Message = fmt.Sprintf("Training strain in the week of %s was %.0f %s, above %.0f", week.Week, week.Strain, workload.Unit, thresholds.Strain)
+			default:
+				continue // ACWR is reported for the latest day
+			}
+			alerts = append(alerts, alert)
+		}
+		break
+	}
+	return alerts
+}
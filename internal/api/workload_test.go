@@ -0,0 +1,122 @@
+package api
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// steadyThenJump runs 5km a day for five weeks, then 10km a day for a week.
+func steadyThenJump() *Rollup {
+	rollup := NewRollup()
+	start := time.Date(2024, 9, 2, 0, 0, 0, 0, time.UTC) // Monday
+	id := int64(1)
+	for d := 0; d < 42; d++ {
+		distance := 5000.0
+		if d >= 35 {
+			distance = 10000
+		}
+		rollup.Add(rollupActivity(id, "Run", start.AddDate(0, 0, d).Format("2006-01-02"), distance, 1800))
+		id++
+	}
+	return rollup
+}
+
+func TestWorkloadFromRollup_ACWR(t *testing.T) {
+	workload, err := WorkloadFromRollup(steadyThenJump(), "2024-09-30", "2024-10-13", nil, WorkloadOptions{
+		Metric:     LoadDistance,
+		WeekStart:  time.Monday,
+		Thresholds: DefaultWorkloadThresholds(),
+	})
+	if err != nil {
+		t.Fatalf("WorkloadFromRollup returned error: %v", err)
+	}
+	if len(workload.Days) != 14 || workload.Unit != "km" {
+		t.Fatalf("Expected 14 days in km, got %d in %s", len(workload.Days), workload.Unit)
+	}
+
+	// Four steady weeks: acute equals chronic
+	steady := workload.Days[6]
+	if steady.Acute != 5 || steady.Chronic != 5 || steady.ACWR != 1 || steady.ACWRUncoupled != 1 {
+		t.Errorf("Unexpected steady-state day: %+v", steady)
+	}
+
+	// After a week at double the load: acute 10, chronic (3*7*5 + 7*10)/28 = 6.25,
+	// uncoupled chronic 5
+	last := workload.Days[13]
+	if last.Acute != 10 || last.Chronic != 6.25 || last.ACWR != 1.6 || last.ACWRUncoupled != 2 {
+		t.Errorf("Unexpected day after the jump: %+v", last)
+	}
+
+	if len(workload.Weeks) != 2 {
+		t.Fatalf("Expected 2 weeks, got %+v", workload.Weeks)
+	}
+	jump := workload.Weeks[1]
+	if jump.Change == nil || *jump.Change != 1 || !hasFlag(jump.Flags, FlagWeeklyIncrease) || !hasFlag(jump.Flags, FlagHighACWR) {
+		t.Errorf("Expected the jump week to be flagged, got %+v", jump)
+	}
+	if len(workload.Weeks[0].Flags) != 0 {
+		t.Errorf("Expected no flags on the steady week, got %v", workload.Weeks[0].Flags)
+	}
+
+	// The banner gets the latest ACWR and the latest complete week's jump
+	if len(workload.Alerts) != 2 || workload.Alerts[0].Flag != FlagHighACWR || workload.Alerts[1].Flag != FlagWeeklyIncrease {
+		t.Errorf("Unexpected alerts: %+v", workload.Alerts)
+	}
+}
+
+func TestFosterMonotony(t *testing.T) {
+	// Identical days (or rest) have no variation to measure
+	if monotony, strain := fosterMonotony([]float64{5, 5, 5, 5, 5, 5, 5}); monotony != 0 || strain != 0 {
+		t.Errorf("Expected 0 for uniform loads, got %f, %f", monotony, strain)
+	}
+
+	loads := []float64{10, 0, 10, 0, 10, 0, 12}
+	monotony, strain := fosterMonotony(loads)
+	mean := 42.0 / 7
+	var variance float64
+	for _, l := range loads {
+		variance += (l - mean) * (l - mean)
+	}
+	expected := mean / math.Sqrt(variance/7)
+	if math.Abs(monotony-expected) > 1e-9 || math.Abs(strain-42*expected) > 1e-9 {
+		t.Errorf("Expected monotony %f and strain %f, got %f and %f", expected, 42*expected, monotony, strain)
+	}
+}
+
+func TestStressModel(t *testing.T) {
+	model := DefaultStressModel()
+
+	// An hour at 125 bpm is half the heart rate reserve
+	withHR := model.Stress(RollupTotals{MovingTime: 3600, HeartrateTime: 3600, HeartrateSum: 125 * 3600})
+	withoutHR := model.Stress(RollupTotals{MovingTime: 3600})
+	expected := 60 * 0.5 * 0.64 * math.Exp(0.96)
+	if math.Abs(withHR-expected) > 1e-9 || math.Abs(withoutHR-expected) > 1e-9 {
+		t.Errorf("Expected TRIMP %f, got %f with and %f without heart rate", expected, withHR, withoutHR)
+	}
+
+	// Harder efforts weigh exponentially more
+	hard := model.Stress(RollupTotals{MovingTime: 3600, HeartrateTime: 3600, HeartrateSum: 170 * 3600})
+	if hard < 2*withHR {
+		t.Errorf("Expected a hard hour to be far more stressful, got %f vs %f", hard, withHR)
+	}
+}
+
+func TestWorkloadFromRollup_InvalidOptions(t *testing.T) {
+	rollup := NewRollup()
+	if _, err := WorkloadFromRollup(rollup, "2024-10-01", "2024-10-07", nil, WorkloadOptions{Metric: "watts"}); err == nil {
+		t.Error("Expected error for unknown metric")
+	}
+	if _, err := WorkloadFromRollup(rollup, "2024-10-07", "2024-10-01", nil, WorkloadOptions{Metric: LoadTime}); err == nil {
+		t.Error("Expected error for reversed range")
+	}
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
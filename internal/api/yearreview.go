@@ -0,0 +1,349 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Landmark is a well-known distance to compare a year's distance with.
+type Landmark struct {
+	Name     string  `json:"name"`     // completes "you ran ...", e.g. "from San Francisco to Los Angeles"
+	Distance float64 `json:"distance"` // in meters
+}
+
+// landmarks are ordered by distance; straight-line distances between cities.
+var landmarks = []Landmark{
+	{"a marathon", 42195},
+	{"across Lake Tahoe and back", 70000},
+	{"from London to Paris", 344000},
+	{"from San Francisco to Los Angeles", 559000},
+	{"from New York to Chicago", 1145000},
+	{"from Land's End to John o' Groats", 1407000},
+	{"from New York to San Francisco", 4130000},
+	{"from London to New York", 5570000},
+	{"around the Earth", 40075000},
+	{"to the Moon", 384400000},
+}
+
+// landmarkVerbs describe covering a distance in each sport.
+var landmarkVerbs = map[string]string{
+	"Run": "ran", "TrailRun": "ran", "VirtualRun": "ran",
+	"Ride": "rode", "MountainBikeRide": "rode", "GravelRide": "rode", "EBikeRide": "rode", "VirtualRide": "rode",
+	"Swim": "swam", "Walk": "walked", "Hike": "hiked", "Rowing": "rowed",
+	"NordicSki": "skied", "BackcountrySki": "skied", "AlpineSki": "skied",
+}
+
+// YearSportTotals is a year's volume of one sport.
+type YearSportTotals struct {
+	SportType     string  `json:"sport_type"`
+	Count         int     `json:"count"`
+	Distance      float64 `json:"distance"`       // in meters
+	MovingTime    int     `json:"moving_time"`    // in seconds
+	ElevationGain float64 `json:"elevation_gain"` // in meters
+}
+
+// YearActivity is a standout activity of the year.
+type YearActivity struct {
+	ID         int64   `json:"id"`
+	Name       string  `json:"name"`
+	SportType  string  `json:"sport_type"`
+	Date       string  `json:"date"`        // YYYY-MM-DD
+	Distance   float64 `json:"distance"`    // in meters
+	MovingTime int     `json:"moving_time"` // in seconds
+}
+
+// YearPeriod is a standout month or week of the year.
+type YearPeriod struct {
+	Start      string  `json:"start"` // YYYY-MM-DD
+	Count      int     `json:"count"`
+	Distance   float64 `json:"distance"`    // in meters
+	MovingTime int     `json:"moving_time"` // in seconds
+	ActiveDays int     `json:"active_days"`
+}
+
+// YearRecord is a personal record set during the year that still stood at its
+// end.
+type YearRecord struct {
+	Record string     `json:"record"` // "fastest_mile", "fastest_10k", "longest_run" or "most_elevation"
+	Label  string     `json:"label"`
+	Run    *RunRecord `json:"run"`
+}
+
+// YearStreak is the year's longest streak of active days.
+type YearStreak struct {
+	Days  int    `json:"days"`
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	// AllTime reports whether no earlier streak was as long
+	AllTime bool `json:"all_time"`
+}
+
+// LandmarkComparison compares a sport's distance with the largest landmark it
+// covers.
+type LandmarkComparison struct {
+	SportType string   `json:"sport_type"`
+	Distance  float64  `json:"distance"` // in meters
+	Landmark  Landmark `json:"landmark"`
+	Times     float64  `json:"times"`   // how many times over
+	Message   string   `json:"message"` // e.g. "You ran from San Francisco to Los Angeles 1.3 times"
+}
+
+// YearInReview summarizes an athlete's year.
+type YearInReview struct {
+	Year       int               `json:"year"`
+	Start      string            `json:"start"` // YYYY-MM-DD
+	End        string            `json:"end"`   // YYYY-MM-DD; today during the year
+	Total      YearSportTotals   `json:"total"`
+	Sports     []YearSportTotals `json:"sports"` // most moving time first
+	ActiveDays int               `json:"active_days"`
+	Longest    *YearActivity     `json:"longest,omitempty"` // by moving time
+	// BiggestMonth has the most moving time, MostConsistentWeek the most
+	// active days (then moving time)
+	BiggestMonth       *YearPeriod          `json:"biggest_month,omitempty"`
+	MostConsistentWeek *YearPeriod          `json:"most_consistent_week,omitempty"`
+	Running            RunningStats         `json:"running"`
+	Records            []YearRecord         `json:"records"`
+	Streak             YearStreak           `json:"streak"`
+	FavoriteWeekday    string               `json:"favorite_weekday,omitempty"` // e.g. "Saturday"
+	FavoriteHour       int                  `json:"favorite_hour"`              // local start hour, -1 without activities
+	Landmarks          []LandmarkComparison `json:"landmarks"`
+	Days               []DailyRollup        `json:"days"` // heatmap data
+}
+
+// YearInReviewFor summarizes the year of the athlete's history (every
+// activity, so records and streaks can be compared with earlier years).
+// During the current year, per the calendar, the review runs up to today.
+func YearInReviewFor(history []NormalizedActivity, year int, calendar Calendar) YearInReview {
+	start := fmt.Sprintf("%04d-01-01", year)
+	end := fmt.Sprintf("%04d-12-31", year)
+	if today := calendar.Today().Format("2006-01-02"); today >= start && today < end {
+		end = today
+	}
+	review := YearInReview{
+		Year:         year,
+		Start:        start,
+		End:          end,
+		Total:        YearSportTotals{SportType: "all"},
+		Sports:       []YearSportTotals{},
+		Records:      []YearRecord{},
+		Landmarks:    []LandmarkComparison{},
+		FavoriteHour: -1,
+	}
+
+	var activities, untilEnd []NormalizedActivity
+	for _, activity := range history {
+		if activity.LocalDateStr > end {
+			continue
+		}
+		untilEnd = append(untilEnd, activity)
+		if activity.LocalDateStr >= start {
+			activities = append(activities, activity)
+		}
+	}
+	rollup := NewRollup()
+	rollup.Add(activities...)
+
+	yearTotals(&review, rollup, start, end)
+	review.Days = rollup.Days(start, end, nil)
+	review.ActiveDays = len(review.Days)
+	review.BiggestMonth = biggestMonth(rollup, start, end)
+	review.MostConsistentWeek = mostConsistentWeek(review.Days, calendar.WeekStart)
+
+	for _, activity := range activities {
+		if review.Longest == nil || activity.MovingTime > review.Longest.MovingTime {
+			review.Longest = &YearActivity{
+				ID:         activity.ID,
+				Name:       activity.Name,
+				SportType:  activity.SportType,
+				Date:       activity.LocalDateStr,
+				Distance:   activity.Distance,
+				MovingTime: activity.MovingTime,
+			}
+		}
+	}
+
+	review.Running = CalculateRunningStats(activities)
+	review.Records = recordsSet(CalculatePersonalRecords(untilEnd), start)
+	review.Streak = yearStreak(rollup.ActiveDates(nil), untilEnd, end)
+	review.FavoriteWeekday, review.FavoriteHour = favoriteTimes(CalculateTrainingPatterns(activities, start, end))
+	return review
+}
+
+// yearTotals fills in the review's totals per sport and the landmarks they
+// cover.
+func yearTotals(review *YearInReview, rollup *Rollup, start, end string) {
+	totals := rollup.Totals(start, end, nil)
+	review.Total.Count = totals.Total.Count
+	review.Total.Distance = totals.Total.Distance
+	review.Total.MovingTime = totals.Total.MovingTime
+	review.Total.ElevationGain = totals.Total.ElevationGain
+	for sport, t := range totals.Sports {
+		review.Sports = append(review.Sports, YearSportTotals{
+			SportType:     sport,
+			Count:         t.Count,
+			Distance:      t.Distance,
+			MovingTime:    t.MovingTime,
+			ElevationGain: t.ElevationGain,
+		})
+	}
+	sort.Slice(review.Sports, func(i, j int) bool {
+		if review.Sports[i].MovingTime != review.Sports[j].MovingTime {
+			return review.Sports[i].MovingTime > review.Sports[j].MovingTime
+		}
+		return review.Sports[i].SportType < review.Sports[j].SportType
+	})
+
+	for _, sport := range review.Sports {
+		if comparison, ok := compareWithLandmark(sport.SportType, sport.Distance); ok {
+			review.Landmarks = append(review.Landmarks, comparison)
+		}
+	}
+}
+
+// compareWithLandmark finds the largest landmark the distance covers.
+func compareWithLandmark(sportType string, distance float64) (LandmarkComparison, bool) {
+	i := sort.Search(len(landmarks), func(i int) bool { return landmarks[i].Distance > distance })
+	if i == 0 {
+		return LandmarkComparison{}, false
+	}
+	landmark := landmarks[i-1]
+	verb, ok := landmarkVerbs[sportType]
+	if !ok {
+		verb = "covered the distance"
+	}
+	comparison := LandmarkComparison{
+		SportType: sportType,
+		Distance:  distance,
+		Landmark:  landmark,
+		Times:     distance / landmark.Distance,
+	}
+	comparison.Message = fmt.Sprintf("You %s %s", verb, landmark.Name)
+	if comparison.Times >= 1.1 {
+		comparison.Message += fmt.Sprintf(" %.1f times", comparison.Times)
+	}
+	return comparison, true
+}
+
+// biggestMonth is the month with the most moving time.
+func biggestMonth(rollup *Rollup, start, end string) *YearPeriod {
+	trends := TrendsFromRollup(rollup, start, end, TrendOptions{
+		Period:    "monthly",
+		Smoothing: TrendSmoothing{Method: SmoothingNone},
+	})
+	var biggest *TrendDataPoint
+	for i, point := range trends.Points {
+		if point.Count > 0 && (biggest == nil || point.MovingTime > biggest.MovingTime) {
+			biggest = &trends.Points[i]
+		}
+	}
+	if biggest == nil {
+		return nil
+	}
+	monthStart, _ := time.Parse("2006-01-02", biggest.Date)
+	monthEnd := monthStart.AddDate(0, 1, -1).Format("2006-01-02")
+	return &YearPeriod{
+		Start:      biggest.Date,
+		Count:      biggest.Count,
+		Distance:   biggest.Distance,
+		MovingTime: int(biggest.MovingTime),
+		ActiveDays: len(rollup.Days(biggest.Date, monthEnd, nil)),
+	}
+}
+
+// mostConsistentWeek is the week with the most active days, then the most
+// moving time.
+func mostConsistentWeek(days []DailyRollup, weekStart time.Weekday) *YearPeriod {
+	weeks := make(map[string]*YearPeriod)
+	var best *YearPeriod
+	for _, day := range days {
+		key := periodKey(day.Date, "weekly", weekStart)
+		week, ok := weeks[key]
+		if !ok {
+			week = &YearPeriod{Start: key}
+			weeks[key] = week
+		}
+		week.Count += day.Total.Count
+		week.Distance += day.Total.Distance
+		week.MovingTime += day.Total.MovingTime
+		week.ActiveDays++
+	}
+	for _, week := range weeks {
+		if best == nil || week.ActiveDays > best.ActiveDays ||
+			(week.ActiveDays == best.ActiveDays && (week.MovingTime > best.MovingTime ||
+				(week.MovingTime == best.MovingTime && week.Start < best.Start))) {
+			best = week
+		}
+	}
+	return best
+}
+
+// recordsSet lists the personal records that were set on or after start.
+func recordsSet(prs PersonalRecords, start string) []YearRecord {
+	records := []YearRecord{}
+	for _, record := range []YearRecord{
+		{"fastest_mile", "Fastest mile", prs.FastestMile},
+		{"fastest_10k", "Fastest 10K", prs.Fastest10K},
+		{"longest_run", "Longest run", prs.LongestRun},
+		{"most_elevation", "Most elevation in a run", prs.MostElevation},
+	} {
+		if record.Run == nil || record.Run.Date < start {
+			continue
+		}
+		// Flat runs make a "most elevation" record of nothing
+		if record.Record != "most_elevation" || record.Run.ElevationGain > 0 {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// yearStreak is the longest streak in the year's active dates, and whether no
+// streak before it, up to end, was as long.
+func yearStreak(yearDates []string, untilEnd []NormalizedActivity, end string) YearStreak {
+	endDate, _ := time.Parse("2006-01-02", end)
+	streaks := CalculateStreaks(yearDates, endDate)
+	streak := YearStreak{Days: streaks.Longest, Start: streaks.LongestStart, End: streaks.LongestEnd}
+	if streak.Days == 0 {
+		return streak
+	}
+
+	// Earlier streaks are those before this one started; one running into the
+	// year from December is split at New Year
+	var earlier []string
+	for _, activity := range untilEnd {
+		if activity.LocalDateStr < streak.Start {
+			earlier = append(earlier, activity.LocalDateStr)
+		}
+	}
+	streak.AllTime = CalculateStreaks(earlier, endDate).Longest < streak.Days
+	return streak
+}
+
+// favoriteTimes returns the weekday and local hour most activities started,
+// or "" and -1 without activities.
+func favoriteTimes(patterns TrainingPatterns) (string, int) {
+	var weekdays [7]int
+	var hours [24]int
+	for weekday, row := range patterns.PunchCard {
+		for hour, cell := range row {
+			weekdays[weekday] += cell.Count
+			hours[hour] += cell.Count
+		}
+	}
+	weekday, hour := -1, -1
+	for i, count := range weekdays {
+		if count > 0 && (weekday == -1 || count > weekdays[weekday]) {
+			weekday = i
+		}
+	}
+	for i, count := range hours {
+		if count > 0 && (hour == -1 || count > hours[hour]) {
+			hour = i
+		}
+	}
+	if weekday == -1 {
+		return "", -1
+	}
+	return time.Weekday(weekday).String(), hour
+}
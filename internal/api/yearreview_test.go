@@ -0,0 +1,89 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func yearReviewHistory() []NormalizedActivity {
+	return []NormalizedActivity{
+		// 2023: a 10K and a four-day streak
+		rollupActivity(1, "Run", "2023-06-01", 10000, 3000),
+		rollupActivity(2, "Run", "2023-06-02", 5000, 1500),
+		rollupActivity(3, "Run", "2023-06-03", 5000, 1500),
+		rollupActivity(4, "Run", "2023-06-04", 5000, 1500),
+		// 2024: a Monday-to-Friday streak, a faster 10K and a long ride
+		rollupActivity(10, "Run", "2024-03-04", 5000, 1500),
+		rollupActivity(11, "Run", "2024-03-05", 5000, 1500),
+		rollupActivity(12, "Run", "2024-03-06", 5000, 1500),
+		rollupActivity(13, "Run", "2024-03-07", 5000, 1500),
+		rollupActivity(14, "Run", "2024-03-08", 5000, 1500),
+		rollupActivity(15, "Run", "2024-03-20", 10000, 2900),
+		rollupActivity(16, "Ride", "2024-07-13", 120000, 18000),
+		// 2025 doesn't count
+		rollupActivity(20, "Run", "2025-01-02", 10000, 2500),
+	}
+}
+
+func TestYearInReviewFor(t *testing.T) {
+	pinNow(t, time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC))
+
+	review := YearInReviewFor(yearReviewHistory(), 2024, Calendar{Location: time.UTC, WeekStart: time.Monday})
+	if review.Start != "2024-01-01" || review.End != "2024-12-31" {
+		t.Errorf("Expected the whole of 2024, got %s to %s", review.Start, review.End)
+	}
+	if review.Total.Count != 7 || review.Total.Distance != 155000 || review.ActiveDays != 7 || len(review.Days) != 7 {
+		t.Errorf("Unexpected totals %+v over %d active days", review.Total, review.ActiveDays)
+	}
+	if len(review.Sports) != 2 || review.Sports[0].SportType != "Ride" || review.Sports[1].Count != 6 {
+		t.Errorf("Expected rides then runs by moving time, got %+v", review.Sports)
+	}
+	if review.Longest == nil || review.Longest.ID != 16 {
+		t.Errorf("Expected the ride to be the longest activity, got %+v", review.Longest)
+	}
+	if month := review.BiggestMonth; month == nil || month.Start != "2024-07-01" || month.ActiveDays != 1 {
+		t.Errorf("Expected July to be the biggest month, got %+v", month)
+	}
+	if week := review.MostConsistentWeek; week == nil || week.Start != "2024-03-04" || week.ActiveDays != 5 || week.Distance != 25000 {
+		t.Errorf("Expected the week of March 4 to be the most consistent, got %+v", week)
+	}
+	if review.Running.TotalRuns != 6 {
+		t.Errorf("Expected 6 runs in the running stats, got %d", review.Running.TotalRuns)
+	}
+
+	// The longest run is still from 2023; only the 10K got faster
+	if len(review.Records) != 1 || review.Records[0].Record != "fastest_10k" || review.Records[0].Run.ID != 15 {
+		t.Errorf("Expected a 10K record, got %+v", review.Records)
+	}
+	if streak := review.Streak; streak.Days != 5 || streak.Start != "2024-03-04" || streak.End != "2024-03-08" || !streak.AllTime {
+		t.Errorf("Expected an all-time five-day streak, got %+v", streak)
+	}
+	if review.FavoriteWeekday != "Wednesday" || review.FavoriteHour != 7 {
+		t.Errorf("Expected Wednesdays at 7, got %s at %d", review.FavoriteWeekday, review.FavoriteHour)
+	}
+
+	if len(review.Landmarks) != 1 {
+		t.Fatalf("Expected only the rides to reach a landmark, got %+v", review.Landmarks)
+	}
+	if landmark := review.Landmarks[0]; landmark.SportType != "Ride" || !strings.HasPrefix(landmark.Message, "You rode across Lake Tahoe and back 1.7 times") {
+		t.Errorf("Unexpected landmark %+v", landmark)
+	}
+}
+
+func TestYearInReviewForCurrentYear(t *testing.T) {
+	pinNow(t, time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC))
+
+	review := YearInReviewFor(yearReviewHistory(), 2024, Calendar{Location: time.UTC, WeekStart: time.Monday})
+	if review.End != "2024-06-15" {
+		t.Errorf("Expected the review to run up to today, got %s", review.End)
+	}
+	if review.Total.Count != 6 || review.BiggestMonth == nil || review.BiggestMonth.Start != "2024-03-01" {
+		t.Errorf("Expected only the runs so far, got %+v and biggest month %+v", review.Total, review.BiggestMonth)
+	}
+
+	empty := YearInReviewFor(yearReviewHistory(), 2020, Calendar{Location: time.UTC, WeekStart: time.Monday})
+	if empty.Total.Count != 0 || empty.Longest != nil || empty.BiggestMonth != nil || empty.FavoriteHour != -1 || len(empty.Records) != 0 {
+		t.Errorf("Expected an empty review of a year without activities, got %+v", empty)
+	}
+}
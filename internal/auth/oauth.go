@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 
 	"github.com/arungupta/strava-stats-go/internal/config"
 	"github.com/gorilla/sessions"
@@ -24,18 +25,33 @@ var StravaEndpoint = oauth2.Endpoint{
 
 // Athlete represents the Strava athlete profile.
 type Athlete struct {
-	ID        int    `json:"id"`
+	ID        int64  `json:"id"`
 	Username  string `json:"username"`
 	Firstname string `json:"firstname"`
 	Lastname  string `json:"lastname"`
 	Profile   string `json:"profile"`
 }
 
+// TokenStore keeps each athlete's current Strava token, so every session of the
+// athlete and requests without one (like calendar feeds) share it. Strava
+// rotates the refresh token on refresh, so copies refreshed independently
+// would invalidate each other.
+type TokenStore interface {
+	// LoadToken returns the athlete's token, or nil if none is stored.
+	LoadToken(athleteID int64) (*oauth2.Token, error)
+	SaveToken(athleteID int64, token *oauth2.Token) error
+}
+
 // Authenticator handles OAuth2 authentication.
 type Authenticator struct {
 	Config       *oauth2.Config
 	Store        sessions.Store
 	StravaAPIURL string
+	// Tokens, if set, holds the tokens of athletes; otherwise they live only in
+	// their session
+	Tokens TokenStore
+
+	tokenMu sync.Mutex // serializes reading, refreshing and saving stored tokens
 }
 
 // NewAuthenticator creates a new Authenticator instance.
@@ -44,7 +60,7 @@ func NewAuthenticator(cfg *config.Config) *Authenticator {
 		ClientID:     cfg.StravaClientID,
 		ClientSecret: cfg.StravaClientSecret,
 		RedirectURL:  cfg.StravaCallbackURL,
-		Scopes:       []string{"read", "activity:read_all"},
+		Scopes:       []string{"read", "activity:read_all", "profile:read_all"},
 		Endpoint:     StravaEndpoint,
 	}
 	store := sessions.NewCookieStore([]byte(cfg.SessionSecret))
@@ -152,9 +168,13 @@ func (a *Authenticator) CallbackHandler(w http.ResponseWriter, r *http.Request)
 	// Extract athlete info
 	var displayName string
 	var profileURL string
+	var athleteID int64
 
 	if athlete := token.Extra("athlete"); athlete != nil {
 		if athleteMap, ok := athlete.(map[string]interface{}); ok {
+			if id, ok := athleteMap["id"].(float64); ok {
+				athleteID = int64(id)
+			}
 			firstname, _ := athleteMap["firstname"].(string)
 			lastname, _ := athleteMap["lastname"].(string)
 			username, _ := athleteMap["username"].(string)
@@ -180,6 +200,9 @@ func (a *Authenticator) CallbackHandler(w http.ResponseWriter, r *http.Request)
 			if profileURL == "" {
 				profileURL = fetchedAthlete.Profile
 			}
+			if athleteID == 0 {
+				athleteID = fetchedAthlete.ID
+			}
 		} else {
 			log.Printf("Failed to fetch athlete: %v", err)
 		}
@@ -195,6 +218,13 @@ func (a *Authenticator) CallbackHandler(w http.ResponseWriter, r *http.Request)
 		session.Values["athlete_profile"] = profileURL
 	}
 
+	if athleteID != 0 {
+		session.Values["athlete_id"] = athleteID
+		if err := a.saveAthleteToken(athleteID, token); err != nil {
+			log.Printf("Failed to store token of athlete %d: %v", athleteID, err)
+		}
+	}
+
 	if err := session.Save(r, w); err != nil {
 		http.Error(w, "Failed to save session", http.StatusInternalServerError)
 		return
@@ -221,6 +251,12 @@ func (a *Authenticator) GetToken(w http.ResponseWriter, r *http.Request) (*oauth
 		return nil, fmt.Errorf("failed to unmarshal token: %w", err)
 	}
 
+	// The stored token is the current one; the session's only seeds the store
+	// for sessions from before it was kept
+	if id, ok := session.Values["athlete_id"].(int64); ok && id != 0 && a.Tokens != nil {
+		return a.athleteToken(r.Context(), id, &token)
+	}
+
 	// Create a TokenSource that will automatically refresh the token if it's expired.
 	// Note: We must use a.Config.TokenSource to get the refresh behavior.
 	src := a.Config.TokenSource(r.Context(), &token)
@@ -244,6 +280,89 @@ func (a *Authenticator) GetToken(w http.ResponseWriter, r *http.Request) (*oauth
 	return newToken, nil
 }
 
+// AthleteToken returns the athlete's stored token, refreshing it if necessary,
+// for requests made on the athlete's behalf without a session.
+func (a *Authenticator) AthleteToken(ctx context.Context, athleteID int64) (*oauth2.Token, error) {
+	return a.athleteToken(ctx, athleteID, nil)
+}
+
+// AdoptToken stores token as the athlete's unless one is stored already.
+func (a *Authenticator) AdoptToken(athleteID int64, token *oauth2.Token) error {
+	if a.Tokens == nil {
+		return fmt.Errorf("no token store")
+	}
+	a.tokenMu.Lock()
+	defer a.tokenMu.Unlock()
+	stored, err := a.Tokens.LoadToken(athleteID)
+	if err != nil || stored != nil {
+		return err
+	}
+	return a.Tokens.SaveToken(athleteID, token)
+}
+
+// athleteToken returns the athlete's stored token, or fallback if none is
+// stored, refreshing it if necessary and saving the result. Holding the lock
+// throughout means only one request spends a refresh token.
+func (a *Authenticator) athleteToken(ctx context.Context, athleteID int64, fallback *oauth2.Token) (*oauth2.Token, error) {
+	a.tokenMu.Lock()
+	defer a.tokenMu.Unlock()
+
+	token, err := a.Tokens.LoadToken(athleteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load token: %w", err)
+	}
+	stored := token != nil
+	if !stored {
+		if fallback == nil {
+			return nil, fmt.Errorf("no token stored for athlete %d", athleteID)
+		}
+		token = fallback
+	}
+
+	newToken, err := a.Config.TokenSource(ctx, token).Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get valid token: %w", err)
+	}
+	if !stored || newToken.AccessToken != token.AccessToken || newToken.RefreshToken != token.RefreshToken {
+		if err := a.Tokens.SaveToken(athleteID, newToken); err != nil {
+			return nil, fmt.Errorf("failed to save refreshed token: %w", err)
+		}
+	}
+	return newToken, nil
+}
+
+// saveAthleteToken stores a token just issued at login, if tokens are stored.
+func (a *Authenticator) saveAthleteToken(athleteID int64, token *oauth2.Token) error {
+	if a.Tokens == nil {
+		return nil
+	}
+	a.tokenMu.Lock()
+	defer a.tokenMu.Unlock()
+	return a.Tokens.SaveToken(athleteID, token)
+}
+
+// GetAthleteID returns the authenticated athlete's Strava ID. Sessions created
+// before the ID was stored fall back to fetching the athlete profile once.
+func (a *Authenticator) GetAthleteID(w http.ResponseWriter, r *http.Request, token *oauth2.Token) (int64, error) {
+	session, _ := a.Store.Get(r, "strava-session")
+	if id, ok := session.Values["athlete_id"].(int64); ok && id != 0 {
+		return id, nil
+	}
+
+	athlete, err := a.FetchAthlete(r.Context(), token)
+	if err != nil {
+		return 0, err
+	}
+	if athlete.ID == 0 {
+		return 0, fmt.Errorf("athlete profile has no id")
+	}
+	session.Values["athlete_id"] = athlete.ID
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Failed to save athlete id to session: %v", err)
+	}
+	return athlete.ID, nil
+}
+
 // FetchAthlete retrieves the authenticated athlete's profile from Strava API.
 func (a *Authenticator) FetchAthlete(ctx context.Context, token *oauth2.Token) (*Athlete, error) {
 	client := a.Config.Client(ctx, token)
@@ -1,10 +1,13 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -412,6 +415,9 @@ func TestCallbackHandler_FetchFallback(t *testing.T) {
 	if name, ok := session.Values["athlete_name"]; !ok || name != "Fetched User" {
 		t.Errorf("session does not contain fetched athlete name: got %v want 'Fetched User'", name)
 	}
+	if id, ok := session.Values["athlete_id"]; !ok || id != int64(123) {
+		t.Errorf("session does not contain fetched athlete id: got %v want 123", id)
+	}
 }
 
 func TestCallbackHandler_ProfileExtraction(t *testing.T) {
@@ -507,3 +513,86 @@ func TestLogoutHandler(t *testing.T) {
 		t.Errorf("handler did not set session cookie (to delete it)")
 	}
 }
+
+// memoryTokenStore is a TokenStore in memory
+type memoryTokenStore map[int64]*oauth2.Token
+
+func (m memoryTokenStore) LoadToken(athleteID int64) (*oauth2.Token, error) {
+	return m[athleteID], nil
+}
+
+func (m memoryTokenStore) SaveToken(athleteID int64, token *oauth2.Token) error {
+	m[athleteID] = token
+	return nil
+}
+
+func TestGetToken_SharedStore(t *testing.T) {
+	// 1. Setup a token server that rotates refresh tokens, like Strava
+	var mu sync.Mutex
+	refreshes := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		r.ParseForm()
+		if want := fmt.Sprintf("refresh-%d", refreshes); r.Form.Get("refresh_token") != want {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+		refreshes++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "access-%d", "refresh_token": "refresh-%d", "token_type": "Bearer", "expires_in": 3600}`, refreshes, refreshes)
+	}))
+	defer ts.Close()
+
+	authenticator := NewAuthenticator(&config.Config{SessionSecret: "test-secret"})
+	authenticator.Config.Endpoint.TokenURL = ts.URL
+	tokens := memoryTokenStore{}
+	authenticator.Tokens = tokens
+
+	// 2. A session from before tokens were stored, holding an expired token
+	expired := &oauth2.Token{AccessToken: "access-0", RefreshToken: "refresh-0", TokenType: "Bearer", Expiry: time.Now().Add(-time.Hour)}
+	tokenJson, _ := json.Marshal(expired)
+	recorder := httptest.NewRecorder()
+	reqSetup, _ := http.NewRequest("GET", "/", nil)
+	session, _ := authenticator.Store.Get(reqSetup, "strava-session")
+	session.Values["token"] = string(tokenJson)
+	session.Values["athlete_id"] = int64(7)
+	session.Save(reqSetup, recorder)
+	cookie := recorder.Result().Cookies()[0]
+
+	// 3. Requests with the session and without one share a single refresh
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.AddCookie(cookie)
+		token, err := authenticator.GetToken(httptest.NewRecorder(), req)
+		if err != nil || token.AccessToken != "access-1" {
+			t.Fatalf("Expected the refreshed token, got %v (%v)", token, err)
+		}
+	}
+	token, err := authenticator.AthleteToken(context.Background(), 7)
+	if err != nil || token.AccessToken != "access-1" {
+		t.Errorf("Expected the session's refreshed token without a session, got %v (%v)", token, err)
+	}
+	if refreshes != 1 || tokens[7].RefreshToken != "refresh-1" {
+		t.Errorf("Expected one refresh, stored, got %d and %v", refreshes, tokens[7])
+	}
+
+	// 4. Once the stored token expires, requests without a session refresh it for everyone
+	tokens[7].Expiry = time.Now().Add(-time.Hour)
+	if token, err := authenticator.AthleteToken(context.Background(), 7); err != nil || token.AccessToken != "access-2" {
+		t.Errorf("Expected a refreshed token, got %v (%v)", token, err)
+	}
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	if token, err := authenticator.GetToken(httptest.NewRecorder(), req); err != nil || token.AccessToken != "access-2" {
+		t.Errorf("Expected the session to use the token refreshed without it, got %v (%v)", token, err)
+	}
+
+	if _, err := authenticator.AthleteToken(context.Background(), 8); err == nil {
+		t.Error("Expected an error for an athlete without a token")
+	}
+	if err := authenticator.AdoptToken(7, expired); err != nil || tokens[7].AccessToken != "access-2" {
+		t.Errorf("Expected a stored token not to be replaced, got %v (%v)", tokens[7], err)
+	}
+}
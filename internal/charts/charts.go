@@ -0,0 +1,217 @@
+// Package charts draws the dashboard's charts on the server, as SVG or PNG, so
+// they can go into emails, READMEs and PDFs without a browser.
+//
+// A chart is a list of simple shapes (rectangles, polylines, doughnut wedges
+// and text) laid out in pixels; the same shapes render to SVG and, without any
+// dependencies beyond the standard library, to PNG. A Painter draws them on
+// anything else, such as a PDF page.
+package charts
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strings"
+)
+
+// Palette is the dashboard's color scheme, for series and slices in order.
+var Palette = []string{
+	"#fc4c02", // Strava Orange
+	"#ff6b35", // Orange Red
+	"#ff8c42", // Dark Orange
+	"#ffa366", // Light Orange
+	"#ffb88c", // Pale Orange
+	"#ffccb3", // Very Pale Orange
+	"#ff6b9d", // Pink
+	"#c44569", // Dark Pink
+	"#f8b500", // Yellow
+	"#4ecdc4", // Teal
+	"#95e1d3", // Light Teal
+	"#a8e6cf", // Mint
+}
+
+// Colors shared by the charts.
+const (
+	background = "#ffffff"
+	textColor  = "#333333"
+	mutedColor = "#888888"
+	gridColor  = "#e0e0e0"
+	accent     = "#fc4c02"
+)
+
+// Chart is a drawing of Width×Height pixels.
+type Chart struct {
+	Width, Height int
+	Title         string
+	shapes        []shape
+}
+
+// shape is anything a chart is drawn with.
+type shape interface {
+	svg(b *bytes.Buffer)
+	raster(c *canvas)
+	draw(p Painter)
+}
+
+// rect is a filled rectangle, with an optional tooltip.
+type rect struct {
+	x, y, w, h float64
+	fill       string
+	tooltip    string
+}
+
+// polyline is a stroked line through points.
+type polyline struct {
+	points []point
+	stroke string
+	width  float64
+}
+
+type point struct{ x, y float64 }
+
+// wedge is a slice of a doughnut: the ring between inner and outer radius
+// from start to end, in radians clockwise from 12 o'clock.
+type wedge struct {
+	cx, cy, inner, outer float64
+	start, end           float64
+	fill                 string
+	tooltip              string
+}
+
+// text is a label with its baseline at y, anchored "start", "middle" or "end"
+// at x.
+type text struct {
+	x, y   float64
+	size   float64
+	anchor string
+	fill   string
+	value  string
+}
+
+func newChart(width, height int, title string) *Chart {
+	c := &Chart{Width: width, Height: height, Title: title}
+	c.add(&rect{x: 0, y: 0, w: float64(width), h: float64(height), fill: background})
+	if title != "" {
+		c.add(&text{x: float64(width) / 2, y: 20, size: 14, anchor: "middle", fill: textColor, value: title})
+	}
+	return c
+}
+
+func (c *Chart) add(s shape) {
+	c.shapes = append(c.shapes, s)
+}
+
+// WriteSVG writes the chart as a standalone SVG document.
+func (c *Chart) WriteSVG(w io.Writer) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="-apple-system, 'Segoe UI', Roboto, sans-serif">`,
+		c.Width, c.Height, c.Width, c.Height)
+	fmt.Fprintf(&b, "<title>%s</title>", html.EscapeString(c.Title))
+	for _, s := range c.shapes {
+		s.svg(&b)
+	}
+	b.WriteString("</svg>\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// SVG returns the chart as a standalone SVG document.
+func (c *Chart) SVG() []byte {
+	var b bytes.Buffer
+	c.WriteSVG(&b)
+	return b.Bytes()
+}
+
+func (r *rect) svg(b *bytes.Buffer) {
+	fmt.Fprintf(b, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"`, num(r.x), num(r.y), num(r.w), num(r.h), r.fill)
+	if r.tooltip == "" {
+		b.WriteString("/>")
+		return
+	}
+	fmt.Fprintf(b, "><title>%s</title></rect>", html.EscapeString(r.tooltip))
+}
+
+func (p *polyline) svg(b *bytes.Buffer) {
+	coords := make([]string, len(p.points))
+	for i, pt := range p.points {
+		coords[i] = num(pt.x) + "," + num(pt.y)
+	}
+	fmt.Fprintf(b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="%s" stroke-linejoin="round"/>`,
+		strings.Join(coords, " "), p.stroke, num(p.width))
+}
+
+func (wg *wedge) svg(b *bytes.Buffer) {
+	end := wg.end
+	if end-wg.start >= 2*math.Pi {
+		// An arc can't end where it starts
+		end = wg.start + 2*math.Pi - 1e-4
+	}
+	large := 0
+	if end-wg.start > math.Pi {
+		large = 1
+	}
+	x1, y1 := polar(wg.cx, wg.cy, wg.outer, wg.start)
+	x2, y2 := polar(wg.cx, wg.cy, wg.outer, end)
+	x3, y3 := polar(wg.cx, wg.cy, wg.inner, end)
+	x4, y4 := polar(wg.cx, wg.cy, wg.inner, wg.start)
+	fmt.Fprintf(b, `<path d="M%s,%s A%s,%s 0 %d 1 %s,%s L%s,%s A%s,%s 0 %d 0 %s,%s Z" fill="%s" stroke="%s" stroke-width="1">`,
+		num(x1), num(y1), num(wg.outer), num(wg.outer), large, num(x2), num(y2),
+		num(x3), num(y3), num(wg.inner), num(wg.inner), large, num(x4), num(y4), wg.fill, background)
+	fmt.Fprintf(b, "<title>%s</title></path>", html.EscapeString(wg.tooltip))
+}
+
+func (t *text) svg(b *bytes.Buffer) {
+	fmt.Fprintf(b, `<text x="%s" y="%s" font-size="%s" text-anchor="%s" fill="%s">%s</text>`,
+		num(t.x), num(t.y), num(t.size), t.anchor, t.fill, html.EscapeString(t.value))
+}
+
+// polar returns the point at radius r and angle a (clockwise from 12 o'clock)
+// around (cx, cy).
+func polar(cx, cy, r, a float64) (float64, float64) {
+	return cx + r*math.Sin(a), cy - r*math.Cos(a)
+}
+
+// num formats a coordinate compactly.
+func num(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// niceStep returns a round axis step (1, 2 or 5 times a power of ten) that
+// divides max into about ticks steps.
+func niceStep(max float64, ticks int) float64 {
+	if max <= 0 {
+		return 1
+	}
+	raw := max / float64(ticks)
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if raw <= m*magnitude {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// yAxis draws horizontal grid lines with labels for values from 0 to max
+// within the plot area, and returns the scale from value to y.
+func (c *Chart) yAxis(left, top, right, bottom, max float64, format func(float64) string) func(float64) float64 {
+	step := niceStep(max, 4)
+	ceiling := math.Ceil(max/step) * step
+	if ceiling == 0 {
+		ceiling = step
+	}
+	scale := func(v float64) float64 { return bottom - v/ceiling*(bottom-top) }
+	for v := 0.0; v <= ceiling+step/2; v += step {
+		y := scale(v)
+		c.add(&polyline{points: []point{{left, y}, {right, y}}, stroke: gridColor, width: 1})
+		c.add(&text{x: left - 6, y: y + 4, size: 10, anchor: "end", fill: mutedColor, value: format(v)})
+	}
+	return scale
+}
@@ -0,0 +1,223 @@
+package charts
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+)
+
+// svgCounts parses an SVG document and counts its elements by name.
+func svgCounts(t *testing.T, svg []byte) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	decoder := xml.NewDecoder(bytes.NewReader(svg))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err.Error() == "EOF" {
+				return counts
+			}
+			t.Fatalf("Unexpected invalid SVG: %v", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			counts[start.Name.Local]++
+		}
+	}
+}
+
+func TestHeatmap(t *testing.T) {
+	days := []api.DailyRollup{
+		{Date: "2024-03-04", Total: api.RollupTotals{Count: 1, MovingTime: 1200}},
+		{Date: "2024-03-06", Total: api.RollupTotals{Count: 2, MovingTime: 4 * 3600}},
+	}
+	chart, err := Heatmap(days, "2024-03-01", "2024-03-31", time.Monday)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svg := chart.SVG()
+	counts := svgCounts(t, svg)
+	// Background, 31 days and 5 legend swatches
+	if counts["rect"] != 1+31+5 {
+		t.Errorf("Expected 37 rects, got %d", counts["rect"])
+	}
+	for _, want := range []string{
+		`fill="#9be9a8"><title>2024-03-04: 1 activity, 20m</title>`,
+		`fill="#216e39"><title>2024-03-06: 2 activities, 4h</title>`,
+		"2024-03-05: rest day",
+		">Mar</text>",
+	} {
+		if !bytes.Contains(svg, []byte(want)) {
+			t.Errorf("Expected the heatmap to contain %q", want)
+		}
+	}
+
+	if _, err := Heatmap(nil, "2024-03-31", "2024-03-01", time.Monday); err == nil {
+		t.Error("Expected an error for an end date before the start date")
+	}
+}
+
+func TestHeatmapLevel(t *testing.T) {
+	for movingTime, want := range map[int]int{0: 0, 600: 1, 1800: 2, 5399: 2, 5400: 3, 3 * 3600: 4} {
+		if got := heatmapLevel(movingTime); got != want {
+			t.Errorf("Expected level %d for %ds, got %d", want, movingTime, got)
+		}
+	}
+}
+
+func TestDoughnut(t *testing.T) {
+	var slices []Slice
+	for i := 0; i < 14; i++ {
+		slices = append(slices, Slice{Label: string(rune('A' + i)), Value: float64(14 - i)})
+	}
+	slices = append(slices, Slice{Label: "Zero"})
+	svg := Doughnut("Sports", slices, func(v float64) string { return "x" }).SVG()
+	counts := svgCounts(t, svg)
+	if counts["path"] != len(Palette) {
+		t.Errorf("Expected %d wedges, got %d", len(Palette), counts["path"])
+	}
+	// The three smallest of 105 are combined: 3+2+1 = 6
+	if !bytes.Contains(svg, []byte("Other 5.7%")) {
+		t.Errorf("Expected an Other slice, got %s", svg)
+	}
+	if bytes.Contains(svg, []byte("Zero")) {
+		t.Error("Expected empty slices to be left out")
+	}
+
+	single := Doughnut("Sports", []Slice{{Label: "Run", Value: 1}}, func(v float64) string { return "x" })
+	if !bytes.Contains(single.SVG(), []byte("Run 100.0%")) {
+		t.Error("Expected a single slice to take the whole doughnut")
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := api.DistanceHistogram{Bins: []api.HistogramBin{
+		{Range: "0-1 mi", RangeKm: "0-1 km", Count: 2},
+		{Range: "1-2 mi", RangeKm: "1-2 km", Count: 7},
+		{Range: "2-3 mi", RangeKm: "2-3 km", Count: 0},
+	}}
+	svg := Histogram(h, true).SVG()
+	counts := svgCounts(t, svg)
+	if counts["rect"] != 1+3 {
+		t.Errorf("Expected a bar per bin, got %d rects", counts["rect"])
+	}
+	if !bytes.Contains(svg, []byte("1-2 km: 7 runs")) || bytes.Contains(svg, []byte("1-2 mi")) {
+		t.Errorf("Expected metric labels, got %s", svg)
+	}
+}
+
+func TestTrendLine(t *testing.T) {
+	trends := api.TrendData{Period: "weekly", Points: []api.TrendDataPoint{
+		{Date: "2024-03-04", DistanceKm: 20, PaceSecondsPerKm: 300},
+		{Date: "2024-03-11", DistanceKm: 35, PaceSecondsPerKm: 290},
+	}}
+	chart, err := TrendLine(trends, SeriesPace, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svg := chart.SVG()
+	if svgCounts(t, svg)["polyline"] == 0 || !bytes.Contains(svg, []byte("2024-03-11: 4:50/km")) {
+		t.Errorf("Unexpected pace chart %s", svg)
+	}
+	if !strings.Contains(chart.Title, "weekly") {
+		t.Errorf("Expected the period in the title, got %q", chart.Title)
+	}
+	if _, err := TrendLine(trends, "cadence", true); err == nil {
+		t.Error("Expected an error for an unknown series")
+	}
+}
+
+func TestPlanVsActual(t *testing.T) {
+	done := 75.0
+	adherence := api.PlanAdherence{Period: "weekly", Periods: []api.PlanPeriod{
+		{Period: "2024-03-04", PlannedSessions: 4, PlannedDistance: 30000, Activities: 3, ActualDistance: 25000, Compliance: api.PlanCompliance{CompletionPercent: &done}},
+		{Period: "2024-03-11", PlannedSessions: 4, PlannedDistance: 35000, PlannedDuration: 3600},
+	}}
+	chart, err := PlanVsActual(adherence, SeriesDistance, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svg := chart.SVG()
+	// Background, two legend swatches and two bars per week
+	if counts := svgCounts(t, svg); counts["rect"] != 1+2+4 {
+		t.Errorf("Expected 7 rects, got %d", counts["rect"])
+	}
+	for _, want := range []string{
+		"2024-03-04 planned: 30 km in 4 sessions",
+		"2024-03-04 actual: 25 km in 3 activities, 75% of sessions done",
+		"2024-03-11 actual: 0 km in 0 activities<",
+	} {
+		if !bytes.Contains(svg, []byte(want)) {
+			t.Errorf("Expected the chart to contain %q, got %s", want, svg)
+		}
+	}
+
+	chart, err = PlanVsActual(adherence, SeriesTime, false)
+	if err != nil || !bytes.Contains(chart.SVG(), []byte("2024-03-11 planned: 1h in 4 sessions")) {
+		t.Errorf("Unexpected time chart (%v)", err)
+	}
+	if _, err := PlanVsActual(adherence, SeriesPace, true); err == nil {
+		t.Error("Expected an error for a series other than distance or time")
+	}
+	if empty, _ := PlanVsActual(api.PlanAdherence{}, SeriesDistance, true); !bytes.Contains(empty.SVG(), []byte("No data")) {
+		t.Error("Expected an empty chart to say so")
+	}
+}
+
+func TestWritePNG(t *testing.T) {
+	chart := Doughnut("Sports", []Slice{{Label: "Run", Value: 3}, {Label: "Ride", Value: 1}}, func(v float64) string { return "x" })
+	var b bytes.Buffer
+	if err := chart.WritePNG(&b); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	img, err := png.Decode(&b)
+	if err != nil {
+		t.Fatalf("Unexpected invalid PNG: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != chart.Width || bounds.Dy() != chart.Height {
+		t.Errorf("Expected %dx%d, got %v", chart.Width, chart.Height, bounds)
+	}
+
+	white := color.RGBA{255, 255, 255, 255}
+	orange := parseColor(Palette[0])
+	// The corner is background, the top of the ring the largest slice and
+	// the hole in the middle background again
+	for _, check := range []struct {
+		x, y int
+		want color.RGBA
+	}{{0, 0, white}, {152, 85, orange}, {150, 175, white}} {
+		if got := color.RGBAModel.Convert(img.At(check.x, check.y)); got != check.want {
+			t.Errorf("Expected %v at (%d, %d), got %v", check.want, check.x, check.y, got)
+		}
+	}
+}
+
+// recordingPainter counts what a chart draws.
+type recordingPainter struct {
+	rects, polygons, polylines int
+	texts                      []string
+}
+
+func (p *recordingPainter) Rect(x, y, w, h float64, fill string)                       { p.rects++ }
+func (p *recordingPainter) Polygon(points [][2]float64, fill string)                   { p.polygons++ }
+func (p *recordingPainter) Polyline(points [][2]float64, stroke string, width float64) { p.polylines++ }
+func (p *recordingPainter) Text(x, y, size float64, anchor, fill, value string) {
+	p.texts = append(p.texts, value)
+}
+
+func TestDraw(t *testing.T) {
+	var p recordingPainter
+	Doughnut("Sports", []Slice{{Label: "Run", Value: 3}, {Label: "Ride", Value: 1}}, func(v float64) string { return "x" }).Draw(&p)
+	// Background and two legend swatches; a polygon per wedge
+	if p.rects != 3 || p.polygons != 2 || p.polylines != 0 {
+		t.Errorf("Unexpected shapes: %d rects, %d polygons, %d polylines", p.rects, p.polygons, p.polylines)
+	}
+	if len(p.texts) != 3 || p.texts[0] != "Sports" || p.texts[1] != "Run 75.0%" {
+		t.Errorf("Unexpected texts %q", p.texts)
+	}
+}
@@ -0,0 +1,64 @@
+package charts
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Slice is one part of a doughnut chart.
+type Slice struct {
+	Label string
+	Value float64
+}
+
+// Doughnut draws slices as a doughnut with a legend, largest first. Slices
+// beyond the palette are combined into "Other"; format renders a value for
+// tooltips.
+func Doughnut(title string, slices []Slice, format func(float64) string) *Chart {
+	sorted := make([]Slice, 0, len(slices))
+	total := 0.0
+	for _, s := range slices {
+		if s.Value > 0 {
+			sorted = append(sorted, s)
+			total += s.Value
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Value > sorted[j].Value })
+	if len(sorted) > len(Palette) {
+		other := Slice{Label: "Other"}
+		for _, s := range sorted[len(Palette)-1:] {
+			other.Value += s.Value
+		}
+		sorted = append(sorted[:len(Palette)-1], other)
+	}
+
+	const cx, cy, outer, inner = 150.0, 175.0, 120.0, 60.0
+	height := 340
+	if legend := 50 + 20*len(sorted); legend > height {
+		height = legend
+	}
+	c := newChart(520, height, title)
+	if total == 0 {
+		c.add(&text{x: cx, y: cy, size: 12, anchor: "middle", fill: mutedColor, value: "No activities"})
+		return c
+	}
+
+	angle := 0.0
+	for i, s := range sorted {
+		share := s.Value / total
+		end := angle + share*2*math.Pi
+		if i == len(sorted)-1 {
+			end = 2 * math.Pi
+		}
+		color := Palette[i%len(Palette)]
+		tooltip := fmt.Sprintf("%s: %s (%.1f%%)", s.Label, format(s.Value), share*100)
+		c.add(&wedge{cx: cx, cy: cy, inner: inner, outer: outer, start: angle, end: end, fill: color, tooltip: tooltip})
+		angle = end
+
+		y := 50 + float64(i)*20
+		c.add(&rect{x: 300, y: y, w: 12, h: 12, fill: color})
+		c.add(&text{x: 320, y: y + 10, size: 11, anchor: "start", fill: textColor, value: fmt.Sprintf("%s %.1f%%", s.Label, share*100)})
+	}
+	return c
+}
@@ -0,0 +1,52 @@
+package charts
+
+import "math"
+
+// Painter draws a chart onto another surface, such as a PDF page. Coordinates
+// are chart pixels from the top left, and colors "#rrggbb".
+type Painter interface {
+	Rect(x, y, w, h float64, fill string)
+	Polygon(points [][2]float64, fill string)
+	Polyline(points [][2]float64, stroke string, width float64)
+	// Text draws value with its baseline at y, anchored "start", "middle"
+	// or "end" at x.
+	Text(x, y, size float64, anchor, fill, value string)
+}
+
+// Draw paints the chart with p. Tooltips are left out.
+func (c *Chart) Draw(p Painter) {
+	for _, s := range c.shapes {
+		s.draw(p)
+	}
+}
+
+func (r *rect) draw(p Painter) {
+	p.Rect(r.x, r.y, r.w, r.h, r.fill)
+}
+
+func (l *polyline) draw(p Painter) {
+	points := make([][2]float64, len(l.points))
+	for i, pt := range l.points {
+		points[i] = [2]float64{pt.x, pt.y}
+	}
+	p.Polyline(points, l.stroke, l.width)
+}
+
+func (wg *wedge) draw(p Painter) {
+	// Arcs become polygons, one segment per few degrees
+	steps := int(math.Ceil((wg.end-wg.start)/(math.Pi/60))) + 1
+	points := make([][2]float64, 0, 2*(steps+1))
+	for i := 0; i <= steps; i++ {
+		x, y := polar(wg.cx, wg.cy, wg.outer, wg.start+(wg.end-wg.start)*float64(i)/float64(steps))
+		points = append(points, [2]float64{x, y})
+	}
+	for i := steps; i >= 0; i-- {
+		x, y := polar(wg.cx, wg.cy, wg.inner, wg.start+(wg.end-wg.start)*float64(i)/float64(steps))
+		points = append(points, [2]float64{x, y})
+	}
+	p.Polygon(points, wg.fill)
+}
+
+func (t *text) draw(p Painter) {
+	p.Text(t.x, t.y, t.size, t.anchor, t.fill, t.value)
+}
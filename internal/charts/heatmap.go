@@ -0,0 +1,111 @@
+package charts
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+)
+
+// heatmapColors are the dashboard's heatmap colors, from a rest day up to the
+// most moving time.
+var heatmapColors = [...]string{"#ebedf0", "#9be9a8", "#40c463", "#30a14e", "#216e39"}
+
+const (
+	heatmapCell = 11
+	heatmapGap  = 3
+)
+
+// heatmapLevel buckets a day's moving time the way the dashboard does.
+func heatmapLevel(movingTime int) int {
+	hours := float64(movingTime) / 3600
+	switch {
+	case movingTime <= 0:
+		return 0
+	case hours < 0.5:
+		return 1
+	case hours < 1.5:
+		return 2
+	case hours < 3:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// Heatmap draws a calendar of the days from start to end (YYYY-MM-DD), one
+// column per week starting on weekStart, colored by moving time.
+func Heatmap(days []api.DailyRollup, start, end string, weekStart time.Weekday) (*Chart, error) {
+	first, err := time.Parse("2006-01-02", start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date: %w", err)
+	}
+	last, err := time.Parse("2006-01-02", end)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end date: %w", err)
+	}
+	if last.Before(first) {
+		return nil, fmt.Errorf("end date %s is before start date %s", end, start)
+	}
+
+	totals := make(map[string]api.RollupTotals, len(days))
+	for _, day := range days {
+		totals[day.Date] = day.Total
+	}
+
+	// Back up to the first day of the week, so rows line up with weekdays
+	date := first.AddDate(0, 0, -((int(first.Weekday()) - int(weekStart) + 7) % 7))
+	weeks := int(last.Sub(date).Hours()/24)/7 + 1
+
+	const left, top = 40.0, 50.0
+	pitch := float64(heatmapCell + heatmapGap)
+	width := int(left) + weeks*int(pitch) + 50
+	if width < 300 {
+		width = 300
+	}
+	c := newChart(width, int(top)+7*int(pitch)+40, fmt.Sprintf("Activity %s to %s", start, end))
+
+	for i := 0; i < 7; i += 2 {
+		// Every other weekday, like the dashboard
+		label := time.Weekday((int(weekStart) + i) % 7).String()[:3]
+		c.add(&text{x: left - 6, y: top + float64(i)*pitch + 9, size: 9, anchor: "end", fill: mutedColor, value: label})
+	}
+
+	lastMonth := -1
+	for week := 0; week < weeks; week++ {
+		x := left + float64(week)*pitch
+		for row := 0; row < 7; row++ {
+			if !date.Before(first) && !date.After(last) {
+				if month := int(date.Month()); date.Day() <= 7 && month != lastMonth || lastMonth == -1 {
+					c.add(&text{x: x, y: top - 6, size: 9, anchor: "start", fill: mutedColor, value: date.Format("Jan")})
+					lastMonth = month
+				}
+				dateStr := date.Format("2006-01-02")
+				day, ok := totals[dateStr]
+				tooltip := dateStr + ": rest day"
+				level := 0
+				if ok {
+					level = heatmapLevel(day.MovingTime)
+					noun := "activities"
+					if day.Count == 1 {
+						noun = "activity"
+					}
+					tooltip = fmt.Sprintf("%s: %d %s, %s", dateStr, day.Count, noun, api.FormatDuration(day.MovingTime))
+				}
+				c.add(&rect{x: x, y: top + float64(row)*pitch, w: heatmapCell, h: heatmapCell, fill: heatmapColors[level], tooltip: tooltip})
+			}
+			date = date.AddDate(0, 0, 1)
+		}
+	}
+
+	// Less/More legend, bottom right
+	legendY := top + 7*pitch + 12
+	x := float64(width) - 50 - float64(len(heatmapColors))*pitch
+	c.add(&text{x: x - 6, y: legendY + 9, size: 9, anchor: "end", fill: mutedColor, value: "Less"})
+	for _, color := range heatmapColors {
+		c.add(&rect{x: x, y: legendY, w: heatmapCell, h: heatmapCell, fill: color})
+		x += pitch
+	}
+	c.add(&text{x: x + 3, y: legendY + 9, size: 9, anchor: "start", fill: mutedColor, value: "More"})
+	return c, nil
+}
@@ -0,0 +1,48 @@
+package charts
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+)
+
+// Histogram draws the run distance histogram as bars, labeled in kilometers
+// if metric and miles otherwise.
+func Histogram(h api.DistanceHistogram, metric bool) *Chart {
+	c := newChart(640, 320, "Run Distance Distribution")
+	const left, top, right, bottom = 50.0, 40.0, 620.0, 270.0
+	if len(h.Bins) == 0 {
+		c.add(&text{x: float64(c.Width) / 2, y: (top + bottom) / 2, size: 12, anchor: "middle", fill: mutedColor, value: "No runs"})
+		return c
+	}
+
+	max := 0
+	for _, bin := range h.Bins {
+		if bin.Count > max {
+			max = bin.Count
+		}
+	}
+	// At least four runs high, so the axis counts in whole runs
+	scale := c.yAxis(left, top, right, bottom, math.Max(float64(max), 4), func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	})
+
+	slot := (right - left) / float64(len(h.Bins))
+	// Leave room for labels like "10.0-11.0 km" under every labeled bin
+	every := int(math.Ceil(70 / slot))
+	for i, bin := range h.Bins {
+		label := bin.Range
+		if metric {
+			label = bin.RangeKm
+		}
+		x := left + float64(i)*slot
+		y := scale(float64(bin.Count))
+		tooltip := label + ": " + strconv.Itoa(bin.Count) + " runs"
+		c.add(&rect{x: x + slot*0.1, y: y, w: slot * 0.8, h: bottom - y, fill: accent, tooltip: tooltip})
+		if i%every == 0 {
+			c.add(&text{x: x + slot/2, y: bottom + 14, size: 9, anchor: "middle", fill: mutedColor, value: label})
+		}
+	}
+	return c
+}
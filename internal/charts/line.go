@@ -0,0 +1,118 @@
+package charts
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+)
+
+// Trend series for TrendLine.
+const (
+	SeriesDistance  = "distance"
+	SeriesTime      = "time"
+	SeriesElevation = "elevation"
+	SeriesPace      = "pace"
+)
+
+// Line draws values as a line over labels, one point per label, with format
+// rendering axis values and tooltips.
+func Line(title string, labels []string, values []float64, format func(float64) string) *Chart {
+	c := newChart(720, 320, title)
+	const left, top, right, bottom = 60.0, 40.0, 670.0, 270.0
+	if len(values) == 0 {
+		c.add(&text{x: float64(c.Width) / 2, y: (top + bottom) / 2, size: 12, anchor: "middle", fill: mutedColor, value: "No data"})
+		return c
+	}
+
+	max := 0.0
+	for _, v := range values {
+		max = math.Max(max, v)
+	}
+	scale := c.yAxis(left, top, right, bottom, max, format)
+
+	x := func(i int) float64 {
+		if len(values) == 1 {
+			return (left + right) / 2
+		}
+		return left + float64(i)*(right-left)/float64(len(values)-1)
+	}
+	line := &polyline{stroke: accent, width: 2}
+	for i, v := range values {
+		line.points = append(line.points, point{x(i), scale(v)})
+	}
+	c.add(line)
+
+	// Label about eight points along the axis
+	every := int(math.Ceil(float64(len(labels)) / 8))
+	for i, v := range values {
+		label := ""
+		if i < len(labels) {
+			label = labels[i]
+		}
+		c.add(&rect{x: x(i) - 2, y: scale(v) - 2, w: 4, h: 4, fill: accent, tooltip: label + ": " + format(v)})
+		if label != "" && i%every == 0 {
+			c.add(&text{x: x(i), y: bottom + 14, size: 9, anchor: "middle", fill: mutedColor, value: label})
+		}
+	}
+	return c
+}
+
+// TrendLine draws one series of trends: distance, moving time, elevation gain
+// or pace, in kilometers and meters if metric and miles and feet otherwise.
+func TrendLine(trends api.TrendData, series string, metric bool) (*Chart, error) {
+	var (
+		title  string
+		value  func(api.TrendDataPoint) float64
+		format func(float64) string
+	)
+	switch series {
+	case SeriesDistance:
+		title = "Distance"
+		if metric {
+			value = func(p api.TrendDataPoint) float64 { return p.DistanceKm }
+			format = func(v float64) string { return fmt.Sprintf("%.0f km", v) }
+		} else {
+			value = func(p api.TrendDataPoint) float64 { return p.DistanceMiles }
+			format = func(v float64) string { return fmt.Sprintf("%.0f mi", v) }
+		}
+	case SeriesTime:
+		title = "Moving Time"
+		value = func(p api.TrendDataPoint) float64 { return p.MovingTime / 3600 }
+		format = func(v float64) string { return fmt.Sprintf("%.0fh", v) }
+	case SeriesElevation:
+		title = "Elevation Gain"
+		if metric {
+			value = func(p api.TrendDataPoint) float64 { return p.ElevationGain }
+			format = func(v float64) string { return fmt.Sprintf("%.0f m", v) }
+		} else {
+			value = func(p api.TrendDataPoint) float64 { return p.ElevationGainFeet }
+			format = func(v float64) string { return fmt.Sprintf("%.0f ft", v) }
+		}
+	case SeriesPace:
+		title = "Pace"
+		if metric {
+			value = func(p api.TrendDataPoint) float64 { return p.PaceSecondsPerKm }
+			format = func(v float64) string { return formatPace(v) + "/km" }
+		} else {
+			value = func(p api.TrendDataPoint) float64 { return p.PaceSecondsPerMile }
+			format = func(v float64) string { return formatPace(v) + "/mi" }
+		}
+	default:
+		return nil, fmt.Errorf("invalid series %q (use distance, time, elevation or pace)", series)
+	}
+
+	labels := make([]string, len(trends.Points))
+	values := make([]float64, len(trends.Points))
+	for i, p := range trends.Points {
+		labels[i] = p.Date
+		values[i] = value(p)
+	}
+	return Line(fmt.Sprintf("%s (%s)", title, trends.Period), labels, values, format), nil
+}
+
+// formatPace formats seconds as minutes and seconds, like "8:05".
+func formatPace(seconds float64) string {
+	s := int(math.Round(seconds))
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
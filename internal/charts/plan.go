@@ -0,0 +1,81 @@
+package charts
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+)
+
+// plannedColor fills the bars of planned volume, next to the actual volume in
+// the accent color.
+const plannedColor = "#ffccb3"
+
+// PlanVsActual draws planned against actual volume per period of a plan
+// adherence report, as pairs of bars: distance or moving time (SeriesDistance
+// or SeriesTime), in kilometers if metric and miles otherwise.
+func PlanVsActual(adherence api.PlanAdherence, series string, metric bool) (*Chart, error) {
+	var (
+		title           string
+		planned, actual func(api.PlanPeriod) float64
+		format          func(float64) string
+	)
+	switch series {
+	case SeriesDistance:
+		title = "Planned vs Actual Distance"
+		unit, meters := "mi", 1609.34
+		if metric {
+			unit, meters = "km", 1000
+		}
+		planned = func(p api.PlanPeriod) float64 { return p.PlannedDistance / meters }
+		actual = func(p api.PlanPeriod) float64 { return p.ActualDistance / meters }
+		format = func(v float64) string { return fmt.Sprintf("%.0f %s", v, unit) }
+	case SeriesTime:
+		title = "Planned vs Actual Time"
+		planned = func(p api.PlanPeriod) float64 { return float64(p.PlannedDuration) / 3600 }
+		actual = func(p api.PlanPeriod) float64 { return float64(p.ActualDuration) / 3600 }
+		format = func(v float64) string { return api.FormatDuration(int(math.Round(v * 3600))) }
+	default:
+		return nil, fmt.Errorf("invalid series %q (use distance or time)", series)
+	}
+
+	c := newChart(720, 320, fmt.Sprintf("%s (%s)", title, adherence.Period))
+	const left, top, right, bottom = 60.0, 40.0, 670.0, 270.0
+	if len(adherence.Periods) == 0 {
+		c.add(&text{x: float64(c.Width) / 2, y: (top + bottom) / 2, size: 12, anchor: "middle", fill: mutedColor, value: "No data"})
+		return c, nil
+	}
+
+	max := 0.0
+	for _, p := range adherence.Periods {
+		max = math.Max(max, math.Max(planned(p), actual(p)))
+	}
+	scale := c.yAxis(left, top, right, bottom, max, format)
+
+	// Legend
+	for i, entry := range []struct{ label, fill string }{{"Planned", plannedColor}, {"Actual", accent}} {
+		x := right - 150 + float64(i)*80
+		c.add(&rect{x: x, y: 16, w: 10, h: 10, fill: entry.fill})
+		c.add(&text{x: x + 14, y: 25, size: 10, anchor: "start", fill: textColor, value: entry.label})
+	}
+
+	slot := (right - left) / float64(len(adherence.Periods))
+	// Label about eight periods along the axis
+	every := int(math.Ceil(float64(len(adherence.Periods)) / 8))
+	for i, p := range adherence.Periods {
+		x := left + float64(i)*slot
+		bar := slot * 0.4
+		plannedY, actualY := scale(planned(p)), scale(actual(p))
+		c.add(&rect{x: x + slot*0.1, y: plannedY, w: bar, h: bottom - plannedY, fill: plannedColor,
+			tooltip: fmt.Sprintf("%s planned: %s in %d sessions", p.Period, format(planned(p)), p.PlannedSessions)})
+		tooltip := fmt.Sprintf("%s actual: %s in %d activities", p.Period, format(actual(p)), p.Activities)
+		if percent := p.Compliance.CompletionPercent; percent != nil {
+			tooltip += fmt.Sprintf(", %.0f%% of sessions done", *percent)
+		}
+		c.add(&rect{x: x + slot*0.5, y: actualY, w: bar, h: bottom - actualY, fill: accent, tooltip: tooltip})
+		if i%every == 0 {
+			c.add(&text{x: x + slot/2, y: bottom + 14, size: 9, anchor: "middle", fill: mutedColor, value: p.Period})
+		}
+	}
+	return c, nil
+}
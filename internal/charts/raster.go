@@ -0,0 +1,133 @@
+package charts
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+)
+
+// canvas is the raster a chart is drawn on for PNG.
+type canvas struct {
+	img *image.RGBA
+}
+
+// Image rasterizes the chart. Shapes are drawn without anti-aliasing, and
+// text in a built-in 5×7 pixel font covering printable ASCII.
+func (c *Chart) Image() *image.RGBA {
+	cv := &canvas{img: image.NewRGBA(image.Rect(0, 0, c.Width, c.Height))}
+	for _, s := range c.shapes {
+		s.raster(cv)
+	}
+	return cv.img
+}
+
+// WritePNG writes the chart as a PNG image.
+func (c *Chart) WritePNG(w io.Writer) error {
+	return png.Encode(w, c.Image())
+}
+
+// parseColor parses a "#rrggbb" color; anything else is black.
+func parseColor(s string) color.RGBA {
+	if len(s) != 7 || s[0] != '#' {
+		return color.RGBA{A: 255}
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{A: 255}
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}
+}
+
+func (cv *canvas) fillRect(x0, y0, x1, y1 int, c color.RGBA) {
+	bounds := cv.img.Bounds()
+	r := image.Rect(x0, y0, x1, y1).Intersect(bounds)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cv.img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+func (r *rect) raster(cv *canvas) {
+	x0, y0 := int(math.Round(r.x)), int(math.Round(r.y))
+	x1, y1 := int(math.Round(r.x+r.w)), int(math.Round(r.y+r.h))
+	cv.fillRect(x0, y0, x1, y1, parseColor(r.fill))
+}
+
+func (p *polyline) raster(cv *canvas) {
+	c := parseColor(p.stroke)
+	half := math.Max(p.width/2, 0.5)
+	// Stamp squares along each segment, every half pixel
+	for i := 1; i < len(p.points); i++ {
+		a, b := p.points[i-1], p.points[i]
+		steps := int(math.Ceil(math.Hypot(b.x-a.x, b.y-a.y)*2)) + 1
+		for s := 0; s <= steps; s++ {
+			t := float64(s) / float64(steps)
+			x, y := a.x+(b.x-a.x)*t, a.y+(b.y-a.y)*t
+			cv.fillRect(int(math.Floor(x-half+0.5)), int(math.Floor(y-half+0.5)), int(math.Floor(x+half+0.5)), int(math.Floor(y+half+0.5)), c)
+		}
+	}
+}
+
+func (wg *wedge) raster(cv *canvas) {
+	c := parseColor(wg.fill)
+	x0, y0 := int(math.Floor(wg.cx-wg.outer)), int(math.Floor(wg.cy-wg.outer))
+	x1, y1 := int(math.Ceil(wg.cx+wg.outer)), int(math.Ceil(wg.cy+wg.outer))
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			dx, dy := float64(x)+0.5-wg.cx, float64(y)+0.5-wg.cy
+			if r := math.Hypot(dx, dy); r < wg.inner || r > wg.outer {
+				continue
+			}
+			// Angle clockwise from 12 o'clock, in [0, 2π)
+			a := math.Atan2(dx, -dy)
+			if a < 0 {
+				a += 2 * math.Pi
+			}
+			if a >= wg.start && a < wg.end {
+				if image.Pt(x, y).In(cv.img.Bounds()) {
+					cv.img.SetRGBA(x, y, c)
+				}
+			}
+		}
+	}
+}
+
+func (t *text) raster(cv *canvas) {
+	c := parseColor(t.fill)
+	scale := int(math.Max(1, math.Round(t.size/10)))
+	width := textWidth(t.value, scale)
+	x := int(math.Round(t.x))
+	switch t.anchor {
+	case "middle":
+		x -= width / 2
+	case "end":
+		x -= width
+	}
+	top := int(math.Round(t.y)) - glyphHeight*scale
+	for _, r := range t.value {
+		glyph := glyphFor(r)
+		for col := 0; col < glyphWidth; col++ {
+			bits := glyph[col]
+			for row := 0; row < glyphHeight; row++ {
+				if bits&(1<<row) != 0 {
+					px, py := x+col*scale, top+row*scale
+					cv.fillRect(px, py, px+scale, py+scale, c)
+				}
+			}
+		}
+		x += (glyphWidth + 1) * scale
+	}
+}
+
+// textWidth is the width of s in the built-in font at scale.
+func textWidth(s string, scale int) int {
+	n := len([]rune(s))
+	if n == 0 {
+		return 0
+	}
+	return (n*(glyphWidth+1) - 1) * scale
+}
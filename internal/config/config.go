@@ -14,6 +14,8 @@ type Config struct {
 	StravaCallbackURL  string
 	SessionSecret      string
 	Port               string
+	DataDir            string // where athlete settings and other state are persisted
+	AchievementsFile   string // JSON achievement rules replacing the built-in ones; empty for those
 }
 
 func Load() (*Config, error) {
@@ -33,6 +35,8 @@ func Load() (*Config, error) {
 		StravaCallbackURL:  getEnv("STRAVA_CALLBACK_URL", "http://localhost:8080/auth/callback"),
 		SessionSecret:      sessionSecret,
 		Port:               getEnv("PORT", "8080"),
+		DataDir:            getEnv("DATA_DIR", "data"),
+		AchievementsFile:   os.Getenv("ACHIEVEMENTS_FILE"),
 	}
 
 	return cfg, nil
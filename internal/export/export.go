@@ -0,0 +1,73 @@
+// Package export writes tables such as activities, trends and daily rollups
+// as CSV, JSON Lines or Parquet. Rows are written one at a time, so exports
+// of any size stream out without being built in memory; Parquet holds one
+// row group at a time.
+package export
+
+import (
+	"fmt"
+	"io"
+)
+
+// Formats an export can be written in.
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+// Type is the type of a column's values.
+type Type int
+
+// Column types, with the Go type of their values in a row.
+const (
+	Bool   Type = iota // bool
+	Int                // int64
+	Float              // float64
+	String             // string
+	Time               // time.Time
+)
+
+// Column is a named, typed column of a table.
+type Column struct {
+	Name     string
+	Type     Type
+	Optional bool // values may be nil
+}
+
+// Writer writes the rows of a table.
+type Writer interface {
+	// Write writes a row with one value per column, of the column's type or
+	// nil for an optional column.
+	Write(row []interface{}) error
+	// Close finishes the export. It doesn't close the underlying writer.
+	Close() error
+}
+
+// NewWriter starts an export of columns in format to w.
+func NewWriter(format string, w io.Writer, columns []Column) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns)
+	case FormatJSONL:
+		return newJSONLWriter(w, columns), nil
+	case FormatParquet:
+		return newParquetWriter(w, columns, parquetRowGroupRows), nil
+	default:
+		return nil, fmt.Errorf("invalid format %q: must be 'csv', 'jsonl' or 'parquet'", format)
+	}
+}
+
+// ContentType returns the MIME type of format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSONL:
+		return "application/x-ndjson"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "application/octet-stream"
+	}
+}
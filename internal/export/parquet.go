@@ -0,0 +1,268 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// parquetRowGroupRows is how many rows are buffered per row group, which
+// bounds the memory a Parquet export holds.
+const parquetRowGroupRows = 8192
+
+// Parquet physical types, converted types and encodings used (see the
+// parquet-format Thrift definitions).
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	repetitionRequired = 0
+	repetitionOptional = 1
+)
+
+// parquetColumn buffers one column's values for the current row group.
+type parquetColumn struct {
+	values  bytes.Buffer // PLAIN encoded non-null values
+	bools   []bool       // values of a Bool column, bit-packed on flush
+	defined []bool       // definition level of each row of an Optional column
+}
+
+// parquetWriter writes an uncompressed Parquet file with a data page per
+// column per row group, PLAIN encoded, and the footer once it's closed.
+type parquetWriter struct {
+	w            *countingWriter
+	columns      []Column
+	buffers      []parquetColumn
+	rowGroupRows int
+	rows         int // rows in the current row group
+	totalRows    int64
+	rowGroups    []interface{}
+	err          error
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func newParquetWriter(w io.Writer, columns []Column, rowGroupRows int) *parquetWriter {
+	p := &parquetWriter{
+		w:            &countingWriter{w: w},
+		columns:      columns,
+		buffers:      make([]parquetColumn, len(columns)),
+		rowGroupRows: rowGroupRows,
+	}
+	_, p.err = p.w.Write([]byte("PAR1"))
+	return p
+}
+
+func (p *parquetWriter) Write(row []interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	var scratch [8]byte
+	for i, v := range row {
+		column, buf := p.columns[i], &p.buffers[i]
+		if column.Optional {
+			buf.defined = append(buf.defined, v != nil)
+			if v == nil {
+				continue
+			}
+		}
+		switch column.Type {
+		case Bool:
+			b, _ := v.(bool)
+			buf.bools = append(buf.bools, b)
+		case Int:
+			n, _ := v.(int64)
+			binary.LittleEndian.PutUint64(scratch[:], uint64(n))
+			buf.values.Write(scratch[:])
+		case Float:
+			f, _ := v.(float64)
+			binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(f))
+			buf.values.Write(scratch[:])
+		case Time:
+			t, _ := v.(time.Time)
+			binary.LittleEndian.PutUint64(scratch[:], uint64(t.UnixMilli()))
+			buf.values.Write(scratch[:])
+		default:
+			s, _ := v.(string)
+			binary.LittleEndian.PutUint32(scratch[:4], uint32(len(s)))
+			buf.values.Write(scratch[:4])
+			buf.values.WriteString(s)
+		}
+	}
+	p.rows++
+	if p.rows == p.rowGroupRows {
+		p.err = p.flush()
+	}
+	return p.err
+}
+
+// flush writes the buffered rows as a row group.
+func (p *parquetWriter) flush() error {
+	if p.rows == 0 {
+		return nil
+	}
+	var chunks []interface{}
+	var groupSize int64
+	for i, column := range p.columns {
+		buf := &p.buffers[i]
+		var page bytes.Buffer
+		if column.Optional {
+			levels := bitPack(buf.defined)
+			var header bytes.Buffer
+			writeUvarint(&header, uint64(len(levels))<<1|1) // bit-packed run of len(levels) groups of 8
+			binary.Write(&page, binary.LittleEndian, uint32(header.Len()+len(levels)))
+			page.Write(header.Bytes())
+			page.Write(levels)
+		}
+		if column.Type == Bool {
+			page.Write(bitPack(buf.bools))
+		} else {
+			page.Write(buf.values.Bytes())
+		}
+
+		header := encodeThrift(tStruct{
+			{1, int32(0)}, // DATA_PAGE
+			{2, int32(page.Len())},
+			{3, int32(page.Len())},
+			{5, tStruct{
+				{1, int32(p.rows)},
+				{2, int32(encodingPlain)},
+				{3, int32(encodingRLE)},
+				{4, int32(encodingRLE)},
+			}},
+		})
+		offset := p.w.n
+		if _, err := p.w.Write(header); err != nil {
+			return err
+		}
+		if _, err := p.w.Write(page.Bytes()); err != nil {
+			return err
+		}
+		size := int64(len(header) + page.Len())
+		groupSize += size
+
+		physical, _ := parquetTypes(column.Type)
+		chunks = append(chunks, tStruct{
+			{2, offset},
+			{3, tStruct{
+				{1, int32(physical)},
+				{2, tList{thriftI32, []interface{}{int32(encodingPlain), int32(encodingRLE)}}},
+				{3, tList{thriftBinary, []interface{}{column.Name}}},
+				{4, int32(0)}, // UNCOMPRESSED
+				{5, int64(p.rows)},
+				{6, size},
+				{7, size},
+				{9, offset},
+			}},
+		})
+
+		buf.values.Reset()
+		buf.bools = buf.bools[:0]
+		buf.defined = buf.defined[:0]
+	}
+	p.rowGroups = append(p.rowGroups, tStruct{
+		{1, tList{thriftStruct, chunks}},
+		{2, groupSize},
+		{3, int64(p.rows)},
+	})
+	p.totalRows += int64(p.rows)
+	p.rows = 0
+	return nil
+}
+
+func (p *parquetWriter) Close() error {
+	if p.err != nil {
+		return p.err
+	}
+	if err := p.flush(); err != nil {
+		return err
+	}
+
+	schema := []interface{}{tStruct{
+		{4, "schema"},
+		{5, int32(len(p.columns))},
+	}}
+	for _, column := range p.columns {
+		physical, converted := parquetTypes(column.Type)
+		repetition := int32(repetitionRequired)
+		if column.Optional {
+			repetition = repetitionOptional
+		}
+		element := tStruct{
+			{1, int32(physical)},
+			{3, repetition},
+			{4, column.Name},
+		}
+		if converted >= 0 {
+			element = append(element, tField{6, int32(converted)})
+		}
+		schema = append(schema, element)
+	}
+	footer := encodeThrift(tStruct{
+		{1, int32(1)},
+		{2, tList{thriftStruct, schema}},
+		{3, p.totalRows},
+		{4, tList{thriftStruct, p.rowGroups}},
+		{6, "strava-stats-go"},
+	})
+	if _, err := p.w.Write(footer); err != nil {
+		return err
+	}
+	var tail [8]byte
+	binary.LittleEndian.PutUint32(tail[:4], uint32(len(footer)))
+	copy(tail[4:], "PAR1")
+	_, err := p.w.Write(tail[:])
+	return err
+}
+
+// parquetTypes returns the physical and converted type of a column type; the
+// converted type is -1 when there is none.
+func parquetTypes(t Type) (physical, converted int) {
+	switch t {
+	case Bool:
+		return parquetBoolean, -1
+	case Int:
+		return parquetInt64, -1
+	case Float:
+		return parquetDouble, -1
+	case Time:
+		return parquetInt64, convertedTimestampMillis
+	default:
+		return parquetByteArray, convertedUTF8
+	}
+}
+
+// bitPack packs values LSB first, padding the last byte with zeros.
+func bitPack(values []bool) []byte {
+	packed := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	buf.Write(scratch[:binary.PutUvarint(scratch[:], v)])
+}
@@ -0,0 +1,138 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Table maps the fields of a struct type to columns named by their JSON tags.
+// Embedded structs are flattened like encoding/json does. Pointer fields are
+// optional columns; slices, maps and other structs are exported as JSON
+// strings.
+type Table struct {
+	columns []Column
+	fields  [][]int // reflect field index path of each column
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// NewTable returns the table of sample's struct type.
+func NewTable(sample interface{}) *Table {
+	t := &Table{}
+	seen := make(map[string]bool)
+	var walk func(typ reflect.Type, prefix []int)
+	walk = func(typ reflect.Type, prefix []int) {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			path := append(append([]int{}, prefix...), i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				walk(field.Type, path)
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if !field.IsExported() || name == "-" || seen[name] {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			seen[name] = true
+			t.columns = append(t.columns, columnOf(name, field.Type))
+			t.fields = append(t.fields, path)
+		}
+	}
+	walk(reflect.Indirect(reflect.ValueOf(sample)).Type(), nil)
+	return t
+}
+
+func columnOf(name string, typ reflect.Type) Column {
+	column := Column{Name: name}
+	if typ.Kind() == reflect.Ptr {
+		column.Optional = true
+		typ = typ.Elem()
+	}
+	switch {
+	case typ == timeType:
+		column.Type = Time
+	case typ.Kind() == reflect.Bool:
+		column.Type = Bool
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Uint64:
+		column.Type = Int
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		column.Type = Float
+	default:
+		column.Type = String
+	}
+	return column
+}
+
+// Columns returns the table's columns in field order.
+func (t *Table) Columns() []Column {
+	return t.columns
+}
+
+// Select returns a table of just the named columns, in the order given.
+// Unknown names are an error.
+func (t *Table) Select(names []string) (*Table, error) {
+	selected := &Table{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		found := false
+		for i, column := range t.columns {
+			if column.Name == name {
+				selected.columns = append(selected.columns, column)
+				selected.fields = append(selected.fields, t.fields[i])
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+	}
+	if len(selected.columns) == 0 {
+		return nil, fmt.Errorf("no fields requested")
+	}
+	return selected, nil
+}
+
+// Row returns the column values of v, a struct of the table's type or a
+// pointer to one.
+func (t *Table) Row(v interface{}) []interface{} {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	row := make([]interface{}, len(t.columns))
+	for i, column := range t.columns {
+		field := value.FieldByIndex(t.fields[i])
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		}
+		switch column.Type {
+		case Time:
+			row[i] = field.Interface().(time.Time)
+		case Bool:
+			row[i] = field.Bool()
+		case Int:
+			if field.Kind() >= reflect.Uint {
+				row[i] = int64(field.Uint())
+			} else {
+				row[i] = field.Int()
+			}
+		case Float:
+			row[i] = field.Float()
+		default:
+			if field.Kind() == reflect.String {
+				row[i] = field.String()
+			} else {
+				encoded, _ := json.Marshal(field.Interface())
+				row[i] = string(encoded)
+			}
+		}
+	}
+	return row
+}
@@ -0,0 +1,94 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// formatValue formats a row value for CSV.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case string:
+		return v
+	default:
+		return ""
+	}
+}
+
+// csvWriter writes a header row, then a record per row.
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w io.Writer, columns []Column) (*csvWriter, error) {
+	c := &csvWriter{w: csv.NewWriter(w), record: make([]string, len(columns))}
+	for i, column := range columns {
+		c.record[i] = column.Name
+	}
+	return c, c.w.Write(c.record)
+}
+
+func (c *csvWriter) Write(row []interface{}) error {
+	for i, v := range row {
+		c.record[i] = formatValue(v)
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonlWriter writes a JSON object per line, with keys in column order.
+type jsonlWriter struct {
+	w    *bufio.Writer
+	keys [][]byte // pre-encoded `"name":`
+	buf  []byte
+}
+
+func newJSONLWriter(w io.Writer, columns []Column) *jsonlWriter {
+	j := &jsonlWriter{w: bufio.NewWriter(w)}
+	for _, column := range columns {
+		key, _ := json.Marshal(column.Name)
+		j.keys = append(j.keys, append(key, ':'))
+	}
+	return j
+}
+
+func (j *jsonlWriter) Write(row []interface{}) error {
+	j.buf = append(j.buf[:0], '{')
+	for i, v := range row {
+		if i > 0 {
+			j.buf = append(j.buf, ',')
+		}
+		j.buf = append(j.buf, j.keys[i]...)
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		j.buf = append(j.buf, value...)
+	}
+	j.buf = append(j.buf, '}', '\n')
+	_, err := j.w.Write(j.buf)
+	return err
+}
+
+func (j *jsonlWriter) Close() error {
+	return j.w.Flush()
+}
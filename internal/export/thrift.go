@@ -0,0 +1,109 @@
+package export
+
+import "bytes"
+
+// Parquet metadata is serialized with the Thrift compact protocol. Only the
+// value types the format needs are supported: i32, i64, binary, lists and
+// structs.
+
+// Compact protocol type codes.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// tField is a struct field: an int32, int64, string, tStruct or tList value.
+type tField struct {
+	id    int16
+	value interface{}
+}
+
+// tStruct is a Thrift struct with its fields in ascending ID order.
+type tStruct []tField
+
+// tList is a Thrift list of elements of one type.
+type tList struct {
+	elem  byte
+	items []interface{}
+}
+
+type thriftEncoder struct {
+	buf bytes.Buffer
+}
+
+func thriftType(v interface{}) byte {
+	switch v.(type) {
+	case int32:
+		return thriftI32
+	case int64:
+		return thriftI64
+	case string:
+		return thriftBinary
+	case tList:
+		return thriftList
+	default:
+		return thriftStruct
+	}
+}
+
+func (e *thriftEncoder) varint(v uint64) {
+	for v >= 0x80 {
+		e.buf.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	e.buf.WriteByte(byte(v))
+}
+
+func (e *thriftEncoder) zigzag(v int64) {
+	e.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (e *thriftEncoder) value(v interface{}) {
+	switch v := v.(type) {
+	case int32:
+		e.zigzag(int64(v))
+	case int64:
+		e.zigzag(v)
+	case string:
+		e.varint(uint64(len(v)))
+		e.buf.WriteString(v)
+	case tList:
+		if len(v.items) < 15 {
+			e.buf.WriteByte(byte(len(v.items))<<4 | v.elem)
+		} else {
+			e.buf.WriteByte(0xf0 | v.elem)
+			e.varint(uint64(len(v.items)))
+		}
+		for _, item := range v.items {
+			e.value(item)
+		}
+	case tStruct:
+		e.structure(v)
+	}
+}
+
+func (e *thriftEncoder) structure(s tStruct) {
+	var last int16
+	for _, f := range s {
+		typ := thriftType(f.value)
+		if delta := f.id - last; delta > 0 && delta <= 15 {
+			e.buf.WriteByte(byte(delta)<<4 | typ)
+		} else {
+			e.buf.WriteByte(typ)
+			e.zigzag(int64(f.id))
+		}
+		e.value(f.value)
+		last = f.id
+	}
+	e.buf.WriteByte(0) // stop
+}
+
+// encodeThrift serializes s with the compact protocol.
+func encodeThrift(s tStruct) []byte {
+	var e thriftEncoder
+	e.structure(s)
+	return e.buf.Bytes()
+}
@@ -0,0 +1,169 @@
+package ical
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+)
+
+// sportEmojis are shown before event summaries, like the dashboard's activity
+// list.
+var sportEmojis = map[string]string{
+	"Run": "🏃", "TrailRun": "🏃", "VirtualRun": "🏃",
+	"Ride": "🚴", "MountainBikeRide": "🚵", "GravelRide": "🚴", "EBikeRide": "🚴", "VirtualRide": "🚴",
+	"Walk": "🚶", "Hike": "🥾", "Swim": "🏊", "Rowing": "🚣",
+	"AlpineSki": "⛷️", "BackcountrySki": "⛷️", "NordicSki": "⛷️", "Snowboard": "🏂",
+	"Workout": "💪", "WeightTraining": "🏋️", "Yoga": "🧘",
+}
+
+// SportEmoji returns the emoji of a sport, or a stopwatch for sports without
+// one.
+func SportEmoji(sportType string) string {
+	if emoji, ok := sportEmojis[sportType]; ok {
+		return emoji
+	}
+	return "⏱️"
+}
+
+// EventOptions controls how activities and workouts read as events.
+type EventOptions struct {
+	Metric bool // kilometers rather than miles
+}
+
+// distance formats meters in the athlete's units.
+func (o EventOptions) distance(meters float64) string {
+	if o.Metric {
+		return fmt.Sprintf("%.1f km", meters/1000)
+	}
+	return fmt.Sprintf("%.1f mi", meters/1609.34)
+}
+
+// pace formats how fast a distance was covered: minutes per kilometer or mile
+// on foot, per 100 m or 100 yd swimming, and speed otherwise. It's empty
+// without distance or time.
+func (o EventOptions) pace(sportType string, meters float64, seconds int) string {
+	if meters <= 0 || seconds <= 0 {
+		return ""
+	}
+	perMeter := float64(seconds) / meters
+	switch {
+	case api.IsGradeAdjustable(sportType):
+		if o.Metric {
+			return minutesSeconds(perMeter*1000) + " /km"
+		}
+		return minutesSeconds(perMeter*1609.34) + " /mi"
+	case sportType == "Swim":
+		if o.Metric {
+			return minutesSeconds(perMeter*100) + " /100m"
+		}
+		return minutesSeconds(perMeter*91.44) + " /100yd"
+	default:
+		if o.Metric {
+			return fmt.Sprintf("%.1f km/h", meters/float64(seconds)*3.6)
+		}
+		return fmt.Sprintf("%.1f mph", meters/float64(seconds)*2.23694)
+	}
+}
+
+// minutesSeconds formats seconds as "m:ss".
+func minutesSeconds(seconds float64) string {
+	total := int(math.Round(seconds))
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
+// ActivityLocation returns the timezone an activity was recorded in, or UTC if
+// Strava's timezone is missing or unknown.
+func ActivityLocation(activity api.NormalizedActivity) *time.Location {
+	if loc, err := api.ParseStravaTimezone(activity.Timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// ActivityEvent returns the event of an activity: it starts when the activity
+// did, in its timezone, and lasts its elapsed time. The summary has the
+// sport's emoji, the name, the distance and the pace, or the moving time of
+// activities without distance.
+func ActivityEvent(activity api.NormalizedActivity, opts EventOptions) Event {
+	summary := []string{SportEmoji(activity.SportType) + " " + strings.TrimSpace(activity.Name)}
+	if activity.Distance > 0 {
+		summary = append(summary, opts.distance(activity.Distance))
+		if pace := opts.pace(activity.SportType, activity.Distance, activity.MovingTime); pace != "" {
+			summary = append(summary, pace)
+		}
+	} else if activity.MovingTime > 0 {
+		summary = append(summary, api.FormatDuration(activity.MovingTime))
+	}
+
+	description := []string{activity.SportType}
+	if activity.MovingTime > 0 {
+		description = append(description, "Moving time: "+api.FormatDuration(activity.MovingTime))
+	}
+	if activity.TotalElevationGain > 0 {
+		if opts.Metric {
+			description = append(description, fmt.Sprintf("Elevation gain: %.0f m", activity.TotalElevationGain))
+		} else {
+			description = append(description, fmt.Sprintf("Elevation gain: %.0f ft", activity.ElevationGainFeet))
+		}
+	}
+	if activity.HasHeartrate && activity.AverageHeartrate > 0 {
+		description = append(description, fmt.Sprintf("Average heart rate: %.0f bpm", activity.AverageHeartrate))
+	}
+	if activity.AverageWatts > 0 {
+		description = append(description, fmt.Sprintf("Average power: %.0f W", activity.AverageWatts))
+	}
+	url := "https://www.strava.com/activities/" + strconv.FormatInt(activity.ID, 10)
+	description = append(description, url)
+
+	elapsed := activity.ElapsedTime
+	if elapsed <= 0 {
+		elapsed = activity.MovingTime
+	}
+	return Event{
+		UID:         fmt.Sprintf("activity-%d@strava-stats-go", activity.ID),
+		Start:       activity.StartDate.In(ActivityLocation(activity)),
+		Duration:    time.Duration(elapsed) * time.Second,
+		Summary:     strings.Join(summary, " · "),
+		Description: strings.Join(description, "\n"),
+		URL:         url,
+		Categories:  []string{activity.SportType},
+	}
+}
+
+// PlannedEvent returns the all-day event of a planned workout. The summary
+// marks it as planned and has the sport's emoji, the title (or sport) and the
+// targets.
+func PlannedEvent(workout api.PlannedWorkout, opts EventOptions) Event {
+	title := strings.TrimSpace(workout.Title)
+	if title == "" {
+		title = workout.SportType
+	}
+	summary := []string{"📋 " + SportEmoji(workout.SportType) + " " + title}
+	if workout.Distance > 0 {
+		summary = append(summary, opts.distance(workout.Distance))
+	}
+	if workout.Duration > 0 {
+		summary = append(summary, api.FormatDuration(workout.Duration))
+	}
+	if workout.Intensity != "" {
+		summary = append(summary, workout.Intensity)
+	}
+
+	description := []string{"Planned " + workout.SportType}
+	if workout.Notes != "" {
+		description = append(description, workout.Notes)
+	}
+	date, _ := time.Parse("2006-01-02", workout.Date)
+	return Event{
+		UID:         "plan-" + workout.ID + "@strava-stats-go",
+		Start:       date,
+		AllDay:      true,
+		Summary:     strings.Join(summary, " · "),
+		Description: strings.Join(description, "\n"),
+		Categories:  []string{workout.SportType, "Planned"},
+	}
+}
@@ -0,0 +1,272 @@
+// Package ical writes iCalendar (RFC 5545) feeds, such as an athlete's
+// activities and planned workouts, for calendar apps to subscribe to.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Calendar describes a feed.
+type Calendar struct {
+	Name        string        // shown by calendar apps (X-WR-CALNAME)
+	Description string        // optional
+	Refresh     time.Duration // how often subscribers should check for updates; 0 leaves it to them
+}
+
+// Event is a VEVENT. Timed events start in the location of Start: UTC is
+// written as UTC, any other location by its TZID with a VTIMEZONE.
+type Event struct {
+	UID         string
+	Start       time.Time
+	AllDay      bool // only Start's date counts; a zero Duration lasts the day
+	Duration    time.Duration
+	Summary     string
+	Description string // optional
+	URL         string // optional
+	Categories  []string
+}
+
+// maxLineOctets is the longest a content line may be before it is folded.
+const maxLineOctets = 75
+
+// writer writes content lines, folded and terminated with CRLF.
+type writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (w *writer) line(name, value string) {
+	if w.err != nil {
+		return
+	}
+	line := name + ":" + value
+	limit := maxLineOctets
+	for len(line) > limit {
+		// Fold at the last rune boundary that fits
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.w.WriteString(line[:cut])
+		w.w.WriteString("\r\n ")
+		line = line[cut:]
+		limit = maxLineOctets - 1 // the leading space counts
+	}
+	w.w.WriteString(line)
+	_, w.err = w.w.WriteString("\r\n")
+}
+
+// escapeText escapes a TEXT value.
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// formatDuration formats a non-negative duration, e.g. "PT1H2M3S".
+func formatDuration(d time.Duration) string {
+	seconds := int64(d.Round(time.Second) / time.Second)
+	if seconds <= 0 {
+		return "PT0S"
+	}
+	var b strings.Builder
+	b.WriteString("PT")
+	if h := seconds / 3600; h > 0 {
+		fmt.Fprintf(&b, "%dH", h)
+	}
+	if m := seconds % 3600 / 60; m > 0 {
+		fmt.Fprintf(&b, "%dM", m)
+	}
+	if s := seconds % 60; s > 0 {
+		fmt.Fprintf(&b, "%dS", s)
+	}
+	return b.String()
+}
+
+// Write writes the calendar with its events, in the order given, stamped
+// (DTSTAMP) with stamp.
+func Write(out io.Writer, cal Calendar, events []Event, stamp time.Time) error {
+	w := &writer{w: bufio.NewWriter(out)}
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//strava-stats-go//Training Calendar//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	if cal.Name != "" {
+		w.line("X-WR-CALNAME", escapeText(cal.Name))
+	}
+	if cal.Description != "" {
+		w.line("X-WR-CALDESC", escapeText(cal.Description))
+	}
+	if cal.Refresh > 0 {
+		w.line("REFRESH-INTERVAL;VALUE=DURATION", formatDuration(cal.Refresh))
+		w.line("X-PUBLISHED-TTL", formatDuration(cal.Refresh))
+	}
+	for _, zone := range timezones(events) {
+		zone.write(w)
+	}
+
+	dtstamp := stamp.UTC().Format("20060102T150405Z")
+	for _, e := range events {
+		w.line("BEGIN", "VEVENT")
+		w.line("UID", escapeText(e.UID))
+		w.line("DTSTAMP", dtstamp)
+		switch {
+		case e.AllDay:
+			w.line("DTSTART;VALUE=DATE", e.Start.Format("20060102"))
+		case e.Start.Location() == time.UTC:
+			w.line("DTSTART", e.Start.Format("20060102T150405Z"))
+		default:
+			w.line("DTSTART;TZID="+tzid(e.Start.Location()), e.Start.Format("20060102T150405"))
+		}
+		if e.AllDay && e.Duration == 0 {
+			w.line("DURATION", "P1D")
+		} else {
+			w.line("DURATION", formatDuration(e.Duration))
+		}
+		w.line("SUMMARY", escapeText(e.Summary))
+		if e.Description != "" {
+			w.line("DESCRIPTION", escapeText(e.Description))
+		}
+		if e.URL != "" {
+			w.line("URL", e.URL)
+		}
+		if len(e.Categories) > 0 {
+			escaped := make([]string, len(e.Categories))
+			for i, c := range e.Categories {
+				escaped[i] = escapeText(c)
+			}
+			w.line("CATEGORIES", strings.Join(escaped, ","))
+		}
+		w.line("TRANSP", "TRANSPARENT") // training shouldn't show as busy
+		w.line("END", "VEVENT")
+	}
+	w.line("END", "VCALENDAR")
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+// tzid returns the TZID parameter value of loc, quoted if it has characters
+// that can't appear in a bare parameter value, like the colon of fixed zones
+// ("GMT-08:00").
+func tzid(loc *time.Location) string {
+	if strings.ContainsAny(loc.String(), `:;,"`) {
+		return `"` + strings.ReplaceAll(loc.String(), `"`, "") + `"`
+	}
+	return loc.String()
+}
+
+// timezone is a VTIMEZONE covering the years of the events in it.
+type timezone struct {
+	loc              *time.Location
+	fromYear, toYear int
+}
+
+// timezones returns the zones timed events start in, other than UTC, by name.
+func timezones(events []Event) []*timezone {
+	byName := make(map[string]*timezone)
+	for _, e := range events {
+		loc := e.Start.Location()
+		if e.AllDay || loc == time.UTC {
+			continue
+		}
+		year := e.Start.Year()
+		zone, ok := byName[loc.String()]
+		if !ok {
+			byName[loc.String()] = &timezone{loc: loc, fromYear: year, toYear: year}
+			continue
+		}
+		zone.fromYear = min(zone.fromYear, year)
+		zone.toYear = max(zone.toYear, year)
+	}
+	zones := make([]*timezone, 0, len(byName))
+	for _, zone := range byName {
+		zones = append(zones, zone)
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].loc.String() < zones[j].loc.String() })
+	return zones
+}
+
+// transition is a change of a zone's UTC offset.
+type transition struct {
+	at       time.Time // first instant of the new offset
+	from, to int       // offsets in seconds east of UTC
+	name     string    // abbreviation after the change
+	daylight bool
+}
+
+// transitions returns the offset changes of loc between start and end. Zones
+// change offset at most once a day, so days are stepped through and each
+// change narrowed down to the second.
+func transitions(loc *time.Location, start, end time.Time) []transition {
+	var changes []transition
+	prev := start.In(loc)
+	for prev.Before(end) {
+		next := prev.Add(24 * time.Hour)
+		_, before := prev.Zone()
+		if _, after := next.Zone(); after != before {
+			lo, hi := prev, next
+			for hi.Sub(lo) > time.Second {
+				mid := lo.Add(hi.Sub(lo) / 2)
+				if _, offset := mid.Zone(); offset == before {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			name, after := hi.Zone()
+			changes = append(changes, transition{at: hi, from: before, to: after, name: name, daylight: hi.IsDST()})
+		}
+		prev = next
+	}
+	return changes
+}
+
+// formatOffset formats an offset as ±hhmm, or ±hhmmss for odd seconds.
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	if seconds%60 != 0 {
+		return fmt.Sprintf("%s%02d%02d%02d", sign, seconds/3600, seconds%3600/60, seconds%60)
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// write writes the VTIMEZONE: the offset in effect at the start of the first
+// year, then every change until the end of the last year.
+func (z *timezone) write(w *writer) {
+	start := time.Date(z.fromYear, 1, 1, 0, 0, 0, 0, z.loc)
+	end := time.Date(z.toYear+1, 1, 1, 0, 0, 0, 0, z.loc)
+
+	observance := func(daylight bool, onset time.Time, from, to int, name string) {
+		kind := "STANDARD"
+		if daylight {
+			kind = "DAYLIGHT"
+		}
+		w.line("BEGIN", kind)
+		// Onsets are local times in the offset before the change
+		w.line("DTSTART", onset.UTC().Add(time.Duration(from)*time.Second).Format("20060102T150405"))
+		w.line("TZOFFSETFROM", formatOffset(from))
+		w.line("TZOFFSETTO", formatOffset(to))
+		w.line("TZNAME", escapeText(name))
+		w.line("END", kind)
+	}
+
+	w.line("BEGIN", "VTIMEZONE")
+	// Only the DTSTART parameter is quoted; the property value is the bare name
+	w.line("TZID", z.loc.String())
+	name, offset := start.Zone()
+	observance(start.IsDST(), start, offset, offset, name)
+	for _, t := range transitions(z.loc, start, end) {
+		observance(t.daylight, t.at, t.from, t.to, t.name)
+	}
+	w.line("END", "VTIMEZONE")
+}
@@ -0,0 +1,250 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+)
+
+func writeCalendar(t *testing.T, events []Event) string {
+	t.Helper()
+	var buf bytes.Buffer
+	stamp := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	if err := Write(&buf, Calendar{Name: "Training, all", Refresh: time.Hour}, events, stamp); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return buf.String()
+}
+
+// unfold joins folded content lines.
+func unfold(s string) string {
+	return strings.ReplaceAll(s, "\r\n ", "")
+}
+
+func TestWriteEvents(t *testing.T) {
+	la, _ := time.LoadLocation("America/Los_Angeles")
+	out := writeCalendar(t, []Event{
+		{
+			UID:         "a@test",
+			Start:       time.Date(2024, 3, 9, 7, 30, 0, 0, la),
+			Duration:    time.Hour + 2*time.Minute + 3*time.Second,
+			Summary:     "Run; fast, then slow",
+			Description: "line one\nline two",
+			Categories:  []string{"Run"},
+		},
+		{UID: "b@test", Start: time.Date(2024, 3, 9, 15, 0, 0, 0, time.UTC), Summary: "Swim"},
+		{UID: "c@test", Start: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), AllDay: true, Summary: "Plan"},
+		{UID: "d@test\r\nBEGIN:VEVENT", Start: time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC), AllDay: true, Summary: "Injected"},
+	})
+
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("Expected lines of at most %d octets, got %d: %q", maxLineOctets, len(line), line)
+		}
+	}
+	if strings.Contains(strings.ReplaceAll(out, "\r\n", ""), "\n") {
+		t.Error("Expected every line to end with CRLF")
+	}
+	unfolded := unfold(out)
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"X-WR-CALNAME:Training\\, all\r\n",
+		"REFRESH-INTERVAL;VALUE=DURATION:PT1H\r\n",
+		"DTSTAMP:20240310T120000Z\r\n",
+		"DTSTART;TZID=America/Los_Angeles:20240309T073000\r\nDURATION:PT1H2M3S\r\n",
+		"SUMMARY:Run\\; fast\\, then slow\r\n",
+		"DESCRIPTION:line one\\nline two\r\n",
+		"DTSTART:20240309T150000Z\r\nDURATION:PT0S\r\n",
+		"DTSTART;VALUE=DATE:20240311\r\nDURATION:P1D\r\n",
+		"UID:d@test\\nBEGIN:VEVENT\r\n", // escaped, not a line of its own
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(unfolded, want) {
+			t.Errorf("Expected calendar to contain %q, got:\n%s", want, unfolded)
+		}
+	}
+	if n := strings.Count(out, "BEGIN:VTIMEZONE"); n != 1 {
+		t.Errorf("Expected 1 VTIMEZONE, got %d", n)
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	la, _ := time.LoadLocation("America/Los_Angeles")
+	out := writeCalendar(t, []Event{{UID: "a", Start: time.Date(2024, 6, 1, 8, 0, 0, 0, la)}})
+	want := "BEGIN:VTIMEZONE\r\nTZID:America/Los_Angeles\r\n" +
+		"BEGIN:STANDARD\r\nDTSTART:20240101T000000\r\nTZOFFSETFROM:-0800\r\nTZOFFSETTO:-0800\r\nTZNAME:PST\r\nEND:STANDARD\r\n" +
+		"BEGIN:DAYLIGHT\r\nDTSTART:20240310T020000\r\nTZOFFSETFROM:-0800\r\nTZOFFSETTO:-0700\r\nTZNAME:PDT\r\nEND:DAYLIGHT\r\n" +
+		"BEGIN:STANDARD\r\nDTSTART:20241103T020000\r\nTZOFFSETFROM:-0700\r\nTZOFFSETTO:-0800\r\nTZNAME:PST\r\nEND:STANDARD\r\n" +
+		"END:VTIMEZONE\r\n"
+	if !strings.Contains(out, want) {
+		t.Errorf("Expected VTIMEZONE:\n%s\ngot:\n%s", want, out)
+	}
+
+	fixed := time.FixedZone("GMT+05:30", 5*3600+30*60)
+	out = writeCalendar(t, []Event{{UID: "a", Start: time.Date(2024, 6, 1, 8, 0, 0, 0, fixed)}})
+	for _, want := range []string{"DTSTART;TZID=\"GMT+05:30\":20240601T080000\r\n", "TZID:GMT+05:30\r\n", "TZOFFSETTO:+0530\r\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected calendar to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestFolding(t *testing.T) {
+	summary := strings.Repeat("🏃", 40)
+	out := writeCalendar(t, []Event{{UID: "a", Start: time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC), Summary: summary}})
+	if !strings.Contains(unfold(out), "SUMMARY:"+summary+"\r\n") {
+		t.Errorf("Expected the folded summary to unfold to the original")
+	}
+	for _, line := range strings.Split(out, "\r\n") {
+		if !utf8.ValidString(line) {
+			t.Errorf("Expected folds between runes, got %q", line)
+		}
+	}
+}
+
+func TestActivityEvent(t *testing.T) {
+	activity := api.NormalizeActivity(api.Activity{
+		ID:                 42,
+		Name:               "Morning Run",
+		SportType:          "Run",
+		StartDate:          time.Date(2024, 3, 9, 15, 30, 0, 0, time.UTC),
+		Timezone:           "(GMT-08:00) America/Los_Angeles",
+		MovingTime:         3000,
+		ElapsedTime:        3300,
+		Distance:           10000,
+		TotalElevationGain: 120,
+		HasHeartrate:       true,
+		AverageHeartrate:   151.4,
+	})
+	event := ActivityEvent(activity, EventOptions{Metric: true})
+	if event.Summary != "🏃 Morning Run · 10.0 km · 5:00 /km" {
+		t.Errorf("Unexpected summary %q", event.Summary)
+	}
+	if got := event.Start.Format("2006-01-02 15:04 MST"); got != "2024-03-09 07:30 PST" {
+		t.Errorf("Expected start in the activity's timezone, got %s", got)
+	}
+	if event.Duration != 55*time.Minute {
+		t.Errorf("Expected the elapsed time as duration, got %s", event.Duration)
+	}
+	if event.UID != "activity-42@strava-stats-go" || event.URL != "https://www.strava.com/activities/42" {
+		t.Errorf("Unexpected UID %q or URL %q", event.UID, event.URL)
+	}
+	want := "Run\nMoving time: 50m\nElevation gain: 120 m\nAverage heart rate: 151 bpm\nhttps://www.strava.com/activities/42"
+	if event.Description != want {
+		t.Errorf("Expected description %q, got %q", want, event.Description)
+	}
+
+	imperial := ActivityEvent(activity, EventOptions{})
+	if imperial.Summary != "🏃 Morning Run · 6.2 mi · 8:03 /mi" {
+		t.Errorf("Unexpected imperial summary %q", imperial.Summary)
+	}
+
+	ride := api.NormalizeActivity(api.Activity{ID: 1, Name: "Commute", SportType: "Ride", Distance: 20000, MovingTime: 2400, StartDate: activity.StartDate})
+	if got := ActivityEvent(ride, EventOptions{Metric: true}); got.Summary != "🚴 Commute · 20.0 km · 30.0 km/h" || got.Start.Location() != time.UTC {
+		t.Errorf("Unexpected ride summary %q or location %s", got.Summary, got.Start.Location())
+	}
+	swim := api.NormalizeActivity(api.Activity{ID: 2, Name: "Pool", SportType: "Swim", Distance: 1500, MovingTime: 1800})
+	if got := ActivityEvent(swim, EventOptions{Metric: true}).Summary; got != "🏊 Pool · 1.5 km · 2:00 /100m" {
+		t.Errorf("Unexpected swim summary %q", got)
+	}
+	lift := api.NormalizeActivity(api.Activity{ID: 3, Name: "Gym", SportType: "WeightTraining", MovingTime: 2700})
+	if got := ActivityEvent(lift, EventOptions{}); got.Summary != "🏋️ Gym · 45m" || got.Duration != 45*time.Minute {
+		t.Errorf("Unexpected summary %q or duration %s without distance", got.Summary, got.Duration)
+	}
+}
+
+func TestPlannedEvent(t *testing.T) {
+	event := PlannedEvent(api.PlannedWorkout{
+		ID: "2024-03-12-1", Date: "2024-03-12", SportType: "Run", Title: "Tempo",
+		Distance: 8000, Duration: 2400, Intensity: "tempo", Notes: "3 x 10 min",
+	}, EventOptions{Metric: true})
+	if event.Summary != "📋 🏃 Tempo · 8.0 km · 40m · tempo" {
+		t.Errorf("Unexpected summary %q", event.Summary)
+	}
+	if !event.AllDay || event.Start.Format("2006-01-02") != "2024-03-12" || event.UID != "plan-2024-03-12-1@strava-stats-go" {
+		t.Errorf("Expected an all-day event on the planned date, got %+v", event)
+	}
+	if event.Description != "Planned Run\n3 x 10 min" {
+		t.Errorf("Unexpected description %q", event.Description)
+	}
+}
+
+func TestRead(t *testing.T) {
+	la, _ := time.LoadLocation("America/Los_Angeles")
+	written := []Event{
+		{UID: "a@test", Start: time.Date(2024, 3, 9, 7, 30, 0, 0, la), Duration: time.Hour, Summary: "Run; fast, then " + strings.Repeat("slow ", 20), Description: "line one\nline two", Categories: []string{"Run", "A, B"}},
+		{UID: "b@test", Start: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), AllDay: true, Summary: "Plan"},
+	}
+	events, err := Read(strings.NewReader(writeCalendar(t, written)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	got := events[0]
+	if !got.Start.Equal(written[0].Start) || got.Start.Location().String() != "America/Los_Angeles" || got.Duration != time.Hour {
+		t.Errorf("Unexpected start %s or duration %s", got.Start, got.Duration)
+	}
+	if got.Summary != written[0].Summary || got.Description != written[0].Description {
+		t.Errorf("Expected text to round-trip, got %q and %q", got.Summary, got.Description)
+	}
+	if len(got.Categories) != 2 || got.Categories[1] != "A, B" {
+		t.Errorf("Unexpected categories %q", got.Categories)
+	}
+	if !events[1].AllDay || events[1].Duration != 0 || events[1].Start.Format("2006-01-02") != "2024-03-11" {
+		t.Errorf("Unexpected all-day event %+v", events[1])
+	}
+
+	ics := "BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:20240312T060000Z\nDTEND:20240312T064500Z\nSUMMARY:Easy\nBEGIN:VALARM\nDESCRIPTION:Reminder\nEND:VALARM\nEND:VEVENT\nEND:VCALENDAR\n"
+	events, err = Read(strings.NewReader(ics))
+	if err != nil || len(events) != 1 || events[0].Duration != 45*time.Minute || events[0].Description != "" {
+		t.Errorf("Expected the duration from DTEND and alarms skipped, got %+v (%v)", events, err)
+	}
+	if _, err := Read(strings.NewReader("not a calendar")); err == nil {
+		t.Error("Expected an error without a VCALENDAR")
+	}
+}
+
+func TestReadPlan(t *testing.T) {
+	ics := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20240312\r\nSUMMARY:Tempo 10 km\r\nDESCRIPTION:3 x 10 min at threshold\r\nCATEGORIES:Running\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nDTSTART;TZID=Europe/Paris:20240313T180000\r\nDURATION:PT1H30M\r\nSUMMARY:Endurance ride\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20240314\r\nSUMMARY:Mobility\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	workouts, err := ReadPlan(strings.NewReader(ics))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(workouts) != 3 {
+		t.Fatalf("Expected 3 workouts, got %d", len(workouts))
+	}
+	tempo, ride, other := workouts[0], workouts[1], workouts[2]
+	if tempo.Date != "2024-03-12" || tempo.SportType != "Run" || tempo.Distance != 10000 || tempo.Duration != 0 || tempo.Intensity != "tempo" {
+		t.Errorf("Unexpected tempo workout %+v", tempo)
+	}
+	if ride.Date != "2024-03-13" || ride.SportType != "Ride" || ride.Duration != 5400 || ride.Intensity != "endurance" {
+		t.Errorf("Unexpected ride %+v", ride)
+	}
+	if other.SportType != "Workout" || other.Title != "Mobility" {
+		t.Errorf("Unexpected fallback workout %+v", other)
+	}
+
+	// Planned workouts read back from the feed
+	var buf bytes.Buffer
+	planned := PlannedEvent(api.PlannedWorkout{ID: "x", Date: "2024-03-12", SportType: "Run", Title: "Tempo", Distance: 8000, Duration: 2400, Intensity: "tempo"}, EventOptions{Metric: true})
+	if err := Write(&buf, Calendar{}, []Event{planned}, time.Now()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	workouts, err = ReadPlan(&buf)
+	if err != nil || len(workouts) != 1 {
+		t.Fatalf("Expected 1 workout, got %+v (%v)", workouts, err)
+	}
+	if w := workouts[0]; w.SportType != "Run" || w.Distance != 8000 || w.Duration != 2400 || w.Intensity != "tempo" {
+		t.Errorf("Expected the feed's planned workout to read back, got %+v", w)
+	}
+}
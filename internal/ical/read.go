@@ -0,0 +1,274 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+)
+
+// property is a content line: NAME;PARAM=value:VALUE.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseProperty splits a content line into its name, parameters and value.
+// Parameter values may be quoted, so colons and semicolons inside quotes don't
+// end them.
+func parseProperty(line string) (property, bool) {
+	p := property{params: make(map[string]string)}
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case c == ';' || c == ':':
+			part := line[start:i]
+			if start == 0 {
+				p.name = strings.ToUpper(part)
+			} else if key, value, ok := strings.Cut(part, "="); ok {
+				p.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+			}
+			start = i + 1
+			if c == ':' {
+				p.value = line[i+1:]
+				return p, p.name != ""
+			}
+		}
+	}
+	return p, false
+}
+
+// unescapeText reverses escapeText.
+func unescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// splitList splits a TEXT list on unescaped commas.
+func splitList(s string) []string {
+	var items []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			items = append(items, unescapeText(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(items, unescapeText(s[start:]))
+}
+
+// parseTime parses a DATE or DATE-TIME value: all-day if it's a date, in UTC
+// if it ends in Z, and otherwise in the TZID location, or UTC if that isn't a
+// known zone.
+func parseTime(p property) (t time.Time, allDay bool, err error) {
+	value := strings.TrimSpace(p.value)
+	if p.params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err = time.Parse("20060102", value)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	loc := time.UTC
+	if tz := p.params["TZID"]; tz != "" {
+		if l, err := time.LoadLocation(strings.TrimPrefix(tz, "/")); err == nil {
+			loc = l
+		}
+	}
+	t, err = time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+var durationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseDuration parses a DURATION value like "PT1H30M" or "P1D".
+func parseDuration(s string) (time.Duration, error) {
+	match := durationPattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if match == nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if n, err := strconv.Atoi(match[i+2]); err == nil {
+			d += time.Duration(n) * unit
+		}
+	}
+	if match[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// Read reads the events of a calendar. Only the properties Event has are
+// read; an all-day event's Duration is zero unless it spans more than a day.
+// Events without DTSTART are skipped.
+func Read(r io.Reader) ([]Event, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	// Unfold continuation lines into the line before
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, fmt.Errorf("invalid calendar: no VCALENDAR")
+	}
+
+	var events []Event
+	var event *Event
+	var end time.Time
+	hasStart := false
+	depth := 0 // components nested in the event, like VALARM
+	for n, line := range lines {
+		p, ok := parseProperty(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VEVENT") && event == nil:
+			event, end, hasStart, depth = &Event{}, time.Time{}, false, 0
+		case event == nil:
+		case p.name == "BEGIN":
+			depth++
+		case p.name == "END" && depth > 0:
+			depth--
+		case depth > 0:
+		case p.name == "END" && strings.EqualFold(p.value, "VEVENT"):
+			if hasStart {
+				if event.Duration == 0 && !end.IsZero() {
+					event.Duration = end.Sub(event.Start)
+				}
+				if event.AllDay && event.Duration == 24*time.Hour {
+					event.Duration = 0
+				}
+				events = append(events, *event)
+			}
+			event = nil
+		case p.name == "UID":
+			event.UID = p.value
+		case p.name == "DTSTART":
+			start, allDay, err := parseTime(p)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid DTSTART: %w", n+1, err)
+			}
+			event.Start, event.AllDay, hasStart = start, allDay, true
+		case p.name == "DTEND":
+			t, _, err := parseTime(p)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid DTEND: %w", n+1, err)
+			}
+			end = t
+		case p.name == "DURATION":
+			d, err := parseDuration(p.value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			event.Duration = d
+		case p.name == "SUMMARY":
+			event.Summary = unescapeText(p.value)
+		case p.name == "DESCRIPTION":
+			event.Description = unescapeText(p.value)
+		case p.name == "URL":
+			event.URL = p.value
+		case p.name == "CATEGORIES":
+			for _, c := range splitList(p.value) {
+				if c = strings.TrimSpace(c); c != "" {
+					event.Categories = append(event.Categories, c)
+				}
+			}
+		}
+	}
+	return events, nil
+}
+
+// ReadPlan reads planned workouts from a calendar, such as one a coaching
+// platform exports: one workout per event, on the date it starts. The sport is
+// the first category naming one, else the first sport named in the summary or
+// description, else "Workout". Targets are read from the text, like "10 km"
+// or "45 min", with the length of timed events as the duration target if the
+// text has none. The intensity is a category naming one, or the first
+// intensity word in the text, like "tempo".
+func ReadPlan(r io.Reader) ([]api.PlannedWorkout, error) {
+	events, err := Read(r)
+	if err != nil {
+		return nil, err
+	}
+	workouts := make([]api.PlannedWorkout, 0, len(events))
+	for _, e := range events {
+		text := e.Summary + "\n" + e.Description
+		w := api.PlannedWorkout{
+			Date:     e.Start.Format("2006-01-02"),
+			Title:    strings.TrimSpace(e.Summary),
+			Notes:    strings.TrimSpace(e.Description),
+			Distance: api.FindDistance(text),
+			Duration: api.FindDuration(text),
+		}
+		for _, c := range e.Categories {
+			if sport, ok := api.KnownSport(c); ok {
+				w.SportType = sport
+				break
+			}
+		}
+		if w.SportType == "" {
+			w.SportType = api.DetectSport(text)
+		}
+		if w.SportType == "" {
+			w.SportType = "Workout"
+		}
+		if w.Duration == 0 && !e.AllDay && e.Duration > 0 {
+			w.Duration = int(e.Duration / time.Second)
+		}
+		for _, c := range e.Categories {
+			if api.IntensityLevel(c) > 0 {
+				w.Intensity = strings.ToLower(c)
+				break
+			}
+		}
+		if w.Intensity == "" {
+			w.Intensity = api.DetectIntensity(text)
+		}
+		workouts = append(workouts, w)
+	}
+	return workouts, nil
+}
@@ -0,0 +1,228 @@
+// Package pdf writes simple PDF documents: pages of filled shapes, lines and
+// text in the standard Helvetica fonts, which every PDF viewer has, so nothing
+// needs embedding.
+//
+// Coordinates are points (1/72 inch) from the top left of the page, like the
+// charts package; they are flipped to PDF's bottom-left origin on output.
+// Output is deterministic, so documents can be compared byte for byte.
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes in points.
+const (
+	LetterWidth  = 612.0
+	LetterHeight = 792.0
+	A4Width      = 595.28
+	A4Height     = 841.89
+)
+
+// Font is one of the standard fonts.
+type Font int
+
+// Fonts available on every page.
+const (
+	Helvetica Font = iota
+	HelveticaBold
+)
+
+var fontNames = [...]string{"Helvetica", "Helvetica-Bold"}
+
+// Document is a PDF document of pages of the same size.
+type Document struct {
+	Width, Height float64
+	Title         string
+	Author        string
+	Created       time.Time // left out of the document when zero
+	pages         []*Page
+}
+
+// New starts an empty document with pages of width×height points.
+func New(width, height float64) *Document {
+	return &Document{Width: width, Height: height}
+}
+
+// AddPage appends a blank page and returns it.
+func (d *Document) AddPage() *Page {
+	p := &Page{doc: d}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Pages returns the document's pages in order.
+func (d *Document) Pages() []*Page {
+	return d.pages
+}
+
+// Page is a page of the document. Drawing appends to its content, so later
+// shapes cover earlier ones.
+type Page struct {
+	doc     *Document
+	content bytes.Buffer
+}
+
+// Point is a position on the page.
+type Point struct{ X, Y float64 }
+
+// Rect fills a rectangle with its top left corner at (x, y).
+func (p *Page) Rect(x, y, w, h float64, fill string) {
+	fmt.Fprintf(&p.content, "%s rg %s %s %s %s re f\n", rgb(fill), num(x), num(p.doc.Height-y-h), num(w), num(h))
+}
+
+// Polygon fills the polygon through points.
+func (p *Page) Polygon(points []Point, fill string) {
+	if len(points) < 3 {
+		return
+	}
+	fmt.Fprintf(&p.content, "%s rg ", rgb(fill))
+	p.path(points)
+	p.content.WriteString("h f\n")
+}
+
+// Line strokes a line through points with round joins and caps.
+func (p *Page) Line(points []Point, stroke string, width float64) {
+	if len(points) < 2 {
+		return
+	}
+	fmt.Fprintf(&p.content, "%s RG %s w 1 J 1 j ", rgb(stroke), num(width))
+	p.path(points)
+	p.content.WriteString("S\n")
+}
+
+func (p *Page) path(points []Point) {
+	for i, pt := range points {
+		op := "l"
+		if i == 0 {
+			op = "m"
+		}
+		fmt.Fprintf(&p.content, "%s %s %s ", num(pt.X), num(p.doc.Height-pt.Y), op)
+	}
+}
+
+// Text draws s with its baseline starting at (x, y). Characters outside the
+// fonts' Windows-1252 character set are replaced or left out (see Encode).
+func (p *Page) Text(x, y float64, font Font, size float64, color, s string) {
+	encoded := Encode(s)
+	if encoded == "" {
+		return
+	}
+	fmt.Fprintf(&p.content, "BT %s rg /F%d %s Tf %s %s Td (%s) Tj ET\n",
+		rgb(color), int(font)+1, num(size), num(x), num(p.doc.Height-y), escape(encoded))
+}
+
+// WriteTo writes the document.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	var offsets []int64
+	object := func(body string) {
+		offsets = append(offsets, cw.n)
+		fmt.Fprintf(cw, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Objects: catalog, page tree, fonts, info, then each page and its content
+	const firstPage = 6
+	fmt.Fprint(cw, "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	for _, name := range fontNames {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+	}
+	info := "<< /Producer (Strava Stats)"
+	if d.Title != "" {
+		info += " /Title (" + escape(Encode(d.Title)) + ")"
+	}
+	if d.Author != "" {
+		info += " /Author (" + escape(Encode(d.Author)) + ")"
+	}
+	if !d.Created.IsZero() {
+		info += " /CreationDate (D:" + d.Created.UTC().Format("20060102150405") + "Z)"
+	}
+	object(info + " >>")
+
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			num(d.Width), num(d.Height), firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.content.Len(), page.content.Bytes()))
+	}
+
+	xref := cw.n
+	fmt.Fprintf(cw, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(cw, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(cw, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+// countingWriter counts the bytes written, for the cross-reference table,
+// and keeps the first error.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+// rgb converts a "#rrggbb" color to PDF color components; anything else is
+// black.
+func rgb(color string) string {
+	if len(color) != 7 || color[0] != '#' {
+		return "0 0 0"
+	}
+	v, err := strconv.ParseUint(color[1:], 16, 32)
+	if err != nil {
+		return "0 0 0"
+	}
+	return fmt.Sprintf("%s %s %s", num(float64(v>>16)/255), num(float64(v>>8&0xff)/255), num(float64(v&0xff)/255))
+}
+
+// num formats a number compactly.
+func num(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// escape escapes a Windows-1252 string for a PDF string literal.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' || c == '(' || c == ')':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 32 || c > 126:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,125 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteTo(t *testing.T) {
+	doc := New(LetterWidth, LetterHeight)
+	doc.Title = "Report (March)"
+	doc.Created = time.Date(2024, 4, 1, 9, 30, 0, 0, time.UTC)
+	page := doc.AddPage()
+	page.Rect(72, 72, 100, 50, "#fc4c02")
+	page.Text(72, 200, HelveticaBold, 12, "#333333", "Café (5K) \\ 🏃")
+	page.Line([]Point{{0, 0}, {10, 10}}, "#000000", 1)
+	doc.AddPage()
+
+	var b bytes.Buffer
+	n, err := doc.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out := b.Bytes()
+	if int(n) != len(out) {
+		t.Errorf("Expected %d bytes written, got %d", len(out), n)
+	}
+
+	for _, want := range []string{
+		"%PDF-1.4\n",
+		"/Count 2",
+		"/Title (Report \\(March\\))",
+		"/CreationDate (D:20240401093000Z)",
+		// The rectangle's bottom left corner, flipped from the top
+		"0.99 0.3 0.01 rg 72 670 100 50 re f\n",
+		"/F2 12 Tf 72 592 Td (Caf\\351 \\(5K\\) \\\\) Tj",
+		"0 0 0 RG 1 w 1 J 1 j 0 792 m 10 782 l S\n",
+	} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("Expected the document to contain %q", want)
+		}
+	}
+	if !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Errorf("Expected the document to end with %q", "%%EOF")
+	}
+
+	// Every cross-reference entry points at its object
+	xref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+	if xref == nil {
+		t.Fatal("Expected a startxref")
+	}
+	start, _ := strconv.Atoi(string(xref[1]))
+	if !bytes.HasPrefix(out[start:], []byte("xref\n")) {
+		t.Fatalf("Expected the cross-reference table at %d", start)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[start:], -1)
+	if len(entries) != 9 {
+		t.Errorf("Expected 9 objects, got %d", len(entries))
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(out[offset:], []byte(want)) {
+			t.Errorf("Expected object %d at offset %d", i+1, offset)
+		}
+	}
+
+	// Stream lengths match their content
+	for _, m := range regexp.MustCompile(`(?s)/Length (\d+) >>\nstream\n(.*?)endstream`).FindAllSubmatch(out, -1) {
+		if length, _ := strconv.Atoi(string(m[1])); length != len(m[2]) {
+			t.Errorf("Expected a stream of %d bytes, got %d", length, len(m[2]))
+		}
+	}
+}
+
+func TestWriteToDeterministic(t *testing.T) {
+	render := func() []byte {
+		doc := New(A4Width, A4Height)
+		doc.AddPage().Text(10, 10, Helvetica, 10, "#000000", "Same")
+		var b bytes.Buffer
+		doc.WriteTo(&b)
+		return b.Bytes()
+	}
+	if first, second := render(), render(); !bytes.Equal(first, second) {
+		t.Error("Expected identical documents to be written identically")
+	}
+	if bytes.Contains(render(), []byte("CreationDate")) {
+		t.Error("Expected no creation date without Created")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for input, want := range map[string]string{
+		"Morning Run":       "Morning Run",
+		"Zürich – Basel":    "Z\xfcrich \x96 Basel",
+		"🏃‍♀️ Tempo  run 💪": "Tempo run",
+		"東京マラソン":            "??????",
+	} {
+		if got := Encode(input); got != want {
+			t.Errorf("Expected %q for %q, got %q", want, input, got)
+		}
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	// 'H' and 'i' are 722 and 222 thousandths in Helvetica
+	if got := TextWidth("Hi", Helvetica, 10); got != 9.44 {
+		t.Errorf("Expected 9.44, got %v", got)
+	}
+	if TextWidth("Hi", HelveticaBold, 10) <= TextWidth("Hi", Helvetica, 10) {
+		t.Error("Expected bold text to be wider")
+	}
+
+	name := "Lunch Run along the river with friends"
+	short := Truncate(name, Helvetica, 10, 80)
+	if !strings.HasSuffix(short, "…") || TextWidth(short, Helvetica, 10) > 80 {
+		t.Errorf("Expected %q to be truncated to 80 points, got %q", name, short)
+	}
+	if got := Truncate("5K", Helvetica, 10, 80); got != "5K" {
+		t.Errorf("Expected short text to be unchanged, got %q", got)
+	}
+}
@@ -0,0 +1,92 @@
+package pdf
+
+import (
+	"strings"
+	"unicode"
+)
+
+// winAnsi maps the characters of Windows-1252 outside Latin-1 to their codes.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// Encode converts s to the fonts' Windows-1252 encoding. Emoji and other
+// symbols are left out, and any other character becomes '?'.
+func Encode(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= ' ' && r <= '~' || r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		case winAnsi[r] != 0:
+			b.WriteByte(winAnsi[r])
+		case r == '\t' || r == '\n':
+			b.WriteByte(' ')
+		case unicode.Is(unicode.So, r) || unicode.Is(unicode.Sk, r) || unicode.In(r, unicode.Cf, unicode.Mn, unicode.Cs) || r >= 0x1f000:
+			// Emoji, their modifiers and joiners
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return strings.TrimSpace(strings.Join(strings.Fields(b.String()), " "))
+}
+
+// Character widths of printable ASCII, from ' ' to '~', in thousandths of the
+// font size, from the fonts' metrics.
+var widths = [...][95]uint16{
+	Helvetica: {
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	},
+	HelveticaBold: {
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	},
+}
+
+// punctuationWidths are the widths of common punctuation beyond ASCII in
+// Helvetica, close enough for the bold font too.
+var punctuationWidths = map[byte]int{0x85: 1000, 0x91: 222, 0x92: 222, 0x93: 333, 0x94: 333, 0x95: 350, 0x96: 556, 0x97: 1000, 0xb7: 278}
+
+// TextWidth returns the width of s in points.
+func TextWidth(s string, font Font, size float64) float64 {
+	encoded := Encode(s)
+	total := 0
+	for i := 0; i < len(encoded); i++ {
+		if c := encoded[i]; c >= ' ' && c <= '~' {
+			total += int(widths[font][c-' '])
+		} else if w, ok := punctuationWidths[c]; ok {
+			total += w
+		} else {
+			// Accented letters are about as wide as a digit
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// Truncate shortens s with an ellipsis to fit within width points.
+func Truncate(s string, font Font, size, width float64) string {
+	if TextWidth(s, font, size) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		if t := strings.TrimSpace(string(runes)) + "…"; TextWidth(t, font, size) <= width {
+			return t
+		}
+	}
+	return ""
+}
@@ -0,0 +1,441 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+	"github.com/arungupta/strava-stats-go/internal/charts"
+	"github.com/arungupta/strava-stats-go/internal/pdf"
+)
+
+// Page layout, in points on US Letter paper.
+const (
+	margin       = 40.0
+	contentWidth = pdf.LetterWidth - 2*margin
+	footerHeight = 24.0
+	rowHeight    = 14.0
+)
+
+// Colors, as on the dashboard.
+const (
+	accent     = "#fc4c02"
+	textColor  = "#333333"
+	mutedColor = "#888888"
+	cardColor  = "#fafafa"
+	ruleColor  = "#eeeeee"
+	headColor  = "#f5f5f5"
+)
+
+// layout places blocks down the pages, starting a new page when a block
+// doesn't fit.
+type layout struct {
+	doc  *pdf.Document
+	page *pdf.Page
+	y    float64
+}
+
+func (l *layout) newPage() {
+	l.page = l.doc.AddPage()
+	l.y = margin
+}
+
+// ensure starts a new page unless height more points fit on this one.
+func (l *layout) ensure(height float64) {
+	if l.y+height > l.doc.Height-margin-footerHeight {
+		l.newPage()
+	}
+}
+
+// heading starts a section, keeping it on the page with at least keep points
+// of what follows.
+func (l *layout) heading(title string, keep float64) {
+	l.ensure(30 + keep)
+	l.y += 18
+	l.page.Text(margin, l.y, pdf.HelveticaBold, 13, textColor, title)
+	l.y += 12
+}
+
+// paragraph writes a line of muted text.
+func (l *layout) paragraph(s string) {
+	l.ensure(rowHeight)
+	l.page.Text(margin, l.y+10, pdf.Helvetica, 9, mutedColor, s)
+	l.y += rowHeight + 4
+}
+
+// card is a summary card: a label, a big value and a detail line.
+type card struct {
+	label, value, detail string
+}
+
+// cards draws a row of summary cards.
+func (l *layout) cards(cards []card) {
+	const height, gap = 54.0, 10.0
+	l.ensure(height)
+	width := (contentWidth - gap*float64(len(cards)-1)) / float64(len(cards))
+	for i, c := range cards {
+		x := margin + float64(i)*(width+gap)
+		center := x + width/2
+		l.page.Rect(x, l.y, width, height, cardColor)
+		l.centered(center, l.y+15, pdf.Helvetica, 8, mutedColor, c.label)
+		l.centered(center, l.y+34, pdf.HelveticaBold, 16, accent, pdf.Truncate(c.value, pdf.HelveticaBold, 16, width-8))
+		l.centered(center, l.y+47, pdf.Helvetica, 7, mutedColor, c.detail)
+	}
+	l.y += height + 6
+}
+
+func (l *layout) centered(x, y float64, font pdf.Font, size float64, color, s string) {
+	l.page.Text(x-pdf.TextWidth(s, font, size)/2, y, font, size, color, s)
+}
+
+// column is a table column; widths are fractions of the content width.
+type column struct {
+	title string
+	width float64
+	right bool // right-aligned, for numbers
+}
+
+// table draws rows under a header row, repeating the header on every page.
+func (l *layout) table(columns []column, rows [][]string) {
+	header := func() {
+		l.page.Rect(margin, l.y, contentWidth, rowHeight, headColor)
+		l.row(columns, nil, pdf.HelveticaBold)
+	}
+	l.ensure(2 * rowHeight)
+	header()
+	for _, cells := range rows {
+		if l.y+rowHeight > l.doc.Height-margin-footerHeight {
+			l.newPage()
+			header()
+		}
+		l.row(columns, cells, pdf.Helvetica)
+		l.page.Rect(margin, l.y-0.5, contentWidth, 0.5, ruleColor)
+	}
+	l.y += 6
+}
+
+// row writes one table row; nil cells write the column titles.
+func (l *layout) row(columns []column, cells []string, font pdf.Font) {
+	const size, padding = 8.0, 4.0
+	x := margin
+	for i, col := range columns {
+		width := col.width * contentWidth
+		value := col.title
+		if cells != nil {
+			value = cells[i]
+		}
+		value = pdf.Truncate(value, font, size, width-2*padding)
+		textX := x + padding
+		if col.right {
+			textX = x + width - padding - pdf.TextWidth(value, font, size)
+		}
+		l.page.Text(textX, l.y+10, font, size, textColor, value)
+		x += width
+	}
+	l.y += rowHeight
+}
+
+// chart draws a chart across the content width, no larger than its own size.
+func (l *layout) chart(c *charts.Chart) {
+	scale := math.Min(1, contentWidth/float64(c.Width))
+	height := float64(c.Height) * scale
+	l.ensure(height)
+	x := margin + (contentWidth-float64(c.Width)*scale)/2
+	c.Draw(&chartPainter{page: l.page, x: x, y: l.y, scale: scale})
+	l.y += height + 10
+}
+
+// chartPainter draws charts on a PDF page at (x, y), scaled.
+type chartPainter struct {
+	page        *pdf.Page
+	x, y, scale float64
+}
+
+func (p *chartPainter) point(x, y float64) pdf.Point {
+	return pdf.Point{X: p.x + x*p.scale, Y: p.y + y*p.scale}
+}
+
+func (p *chartPainter) points(points [][2]float64) []pdf.Point {
+	result := make([]pdf.Point, len(points))
+	for i, pt := range points {
+		result[i] = p.point(pt[0], pt[1])
+	}
+	return result
+}
+
+func (p *chartPainter) Rect(x, y, w, h float64, fill string) {
+	pt := p.point(x, y)
+	p.page.Rect(pt.X, pt.Y, w*p.scale, h*p.scale, fill)
+}
+
+func (p *chartPainter) Polygon(points [][2]float64, fill string) {
+	p.page.Polygon(p.points(points), fill)
+}
+
+func (p *chartPainter) Polyline(points [][2]float64, stroke string, width float64) {
+	p.page.Line(p.points(points), stroke, width*p.scale)
+}
+
+func (p *chartPainter) Text(x, y, size float64, anchor, fill, value string) {
+	pt := p.point(x, y)
+	size *= p.scale
+	switch anchor {
+	case "middle":
+		pt.X -= pdf.TextWidth(value, pdf.Helvetica, size) / 2
+	case "end":
+		pt.X -= pdf.TextWidth(value, pdf.Helvetica, size)
+	}
+	p.page.Text(pt.X, pt.Y, pdf.Helvetica, size, fill, value)
+}
+
+// WritePDF lays out the report and writes it as a PDF document.
+func (m Monthly) WritePDF(w io.Writer) error {
+	doc := pdf.New(pdf.LetterWidth, pdf.LetterHeight)
+	doc.Title = "Training Report " + m.dateRange()
+	doc.Author = m.Athlete
+	doc.Created = m.Generated
+	l := &layout{doc: doc}
+	l.newPage()
+
+	// Header
+	l.page.Text(margin, l.y+20, pdf.HelveticaBold, 20, accent, "Training Report")
+	subtitle := m.dateRange()
+	if m.Athlete != "" {
+		subtitle = m.Athlete + " · " + subtitle
+	}
+	l.page.Text(margin, l.y+38, pdf.Helvetica, 10, mutedColor, subtitle)
+	l.y += 50
+
+	m.summary(l)
+	m.running(l)
+
+	heatmap, err := charts.Heatmap(m.Days, m.Start, m.End, m.WeekStart)
+	if err != nil {
+		return err
+	}
+	trends, err := charts.TrendLine(m.Trends, charts.SeriesDistance, m.Metric)
+	if err != nil {
+		return err
+	}
+	l.heading("Charts", 0)
+	l.chart(heatmap)
+	l.chart(trends)
+	if m.Running.TotalRuns > 0 {
+		l.chart(charts.Histogram(m.Histogram, m.Metric))
+	}
+
+	m.activities(l)
+
+	// Footers, now the page count is known
+	pages := doc.Pages()
+	for i, page := range pages {
+		y := doc.Height - margin + 4
+		footer := "Strava Stats training report, " + m.dateRange()
+		if !m.Generated.IsZero() {
+			footer += ". Generated " + m.Generated.Format("January 2, 2006")
+		}
+		page.Rect(margin, y-12, contentWidth, 0.5, ruleColor)
+		page.Text(margin, y, pdf.Helvetica, 7, mutedColor, footer)
+		number := fmt.Sprintf("Page %d of %d", i+1, len(pages))
+		page.Text(margin+contentWidth-pdf.TextWidth(number, pdf.Helvetica, 7), y, pdf.Helvetica, 7, mutedColor, number)
+	}
+
+	_, err = doc.WriteTo(w)
+	return err
+}
+
+// summary writes the summary cards and totals per sport.
+func (m Monthly) summary(l *layout) {
+	total := m.Totals.Total
+	l.heading("Summary", 54)
+	l.cards([]card{
+		{"Activities", fmt.Sprint(total.Count), fmt.Sprintf("on %d %s", m.ActiveDays, plural(m.ActiveDays, "day", "days"))},
+		{"Moving Time", api.FormatDuration(total.MovingTime), ""},
+		{"Distance", m.distance(total.Distance), ""},
+		{"Elevation", m.elevation(total.ElevationGain), ""},
+	})
+	if total.Count == 0 {
+		l.paragraph("No activities in this period.")
+		return
+	}
+
+	sports := make([]string, 0, len(m.Totals.Sports))
+	for sport := range m.Totals.Sports {
+		sports = append(sports, sport)
+	}
+	sort.Slice(sports, func(i, j int) bool {
+		a, b := m.Totals.Sports[sports[i]], m.Totals.Sports[sports[j]]
+		if a.MovingTime != b.MovingTime {
+			return a.MovingTime > b.MovingTime
+		}
+		return sports[i] < sports[j]
+	})
+	rows := make([][]string, len(sports))
+	for i, sport := range sports {
+		t := m.Totals.Sports[sport]
+		rows[i] = []string{sport, fmt.Sprint(t.Count), m.distanceOrDash(t.Distance), api.FormatDuration(t.MovingTime), m.elevation(t.ElevationGain)}
+	}
+	l.heading("By Sport", 2*rowHeight)
+	l.table([]column{
+		{title: "Sport", width: 0.32},
+		{title: "Activities", width: 0.14, right: true},
+		{title: "Distance", width: 0.18, right: true},
+		{title: "Moving Time", width: 0.18, right: true},
+		{title: "Elevation", width: 0.18, right: true},
+	}, rows)
+}
+
+// running writes the running stats and personal records.
+func (m Monthly) running(l *layout) {
+	if m.Running.TotalRuns == 0 {
+		return
+	}
+	pace := m.Running.AveragePace + " /mi"
+	if m.Metric {
+		pace = m.Running.AveragePaceMinPerKm + " /km"
+	}
+	l.heading("Running", 54)
+	l.cards([]card{
+		{"Runs", fmt.Sprint(m.Running.TotalRuns), ""},
+		{"Runs Over 10K", fmt.Sprint(m.Running.RunsOver10K), ""},
+		{"Distance", m.distance(m.Running.TotalDistance), ""},
+		{"Average Pace", pace, ""},
+	})
+
+	var rows [][]string
+	for _, record := range []struct {
+		label string
+		run   *api.RunRecord
+	}{
+		{"Fastest Mile", m.Records.FastestMile},
+		{"Fastest 10K", m.Records.Fastest10K},
+		{"Longest Run", m.Records.LongestRun},
+		{"Most Elevation", m.Records.MostElevation},
+	} {
+		if run := record.run; run != nil {
+			pace := run.Pace + " /mi"
+			if m.Metric {
+				pace = run.PaceMinPerKm + " /km"
+			}
+			rows = append(rows, []string{record.label, run.Name, shortDate(run.Date), m.distance(run.Distance), api.FormatDuration(run.MovingTime), pace, m.elevation(run.ElevationGain)})
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+	l.heading("Personal Records", 2*rowHeight)
+	l.table([]column{
+		{title: "Record", width: 0.15},
+		{title: "Run", width: 0.27},
+		{title: "Date", width: 0.09},
+		{title: "Distance", width: 0.12, right: true},
+		{title: "Time", width: 0.12, right: true},
+		{title: "Pace", width: 0.13, right: true},
+		{title: "Elevation", width: 0.12, right: true},
+	}, rows)
+}
+
+// activities writes the activity list.
+func (m Monthly) activities(l *layout) {
+	if len(m.Activities) == 0 {
+		return
+	}
+	rows := make([][]string, len(m.Activities))
+	for i, a := range m.Activities {
+		rows[i] = []string{shortDate(a.LocalDateStr), a.Name, a.SportType, m.distanceOrDash(a.Distance), api.FormatDuration(a.MovingTime), m.speed(a), m.elevation(a.TotalElevationGain)}
+	}
+	l.heading("Activities", 2*rowHeight)
+	l.table([]column{
+		{title: "Date", width: 0.09},
+		{title: "Name", width: 0.33},
+		{title: "Sport", width: 0.13},
+		{title: "Distance", width: 0.11, right: true},
+		{title: "Time", width: 0.12, right: true},
+		{title: "Pace/Speed", width: 0.12, right: true},
+		{title: "Elevation", width: 0.10, right: true},
+	}, rows)
+}
+
+// dateRange formats the report's range like "March 1 – 31, 2024".
+func (m Monthly) dateRange() string {
+	start, err1 := time.Parse("2006-01-02", m.Start)
+	end, err2 := time.Parse("2006-01-02", m.End)
+	switch {
+	case err1 != nil || err2 != nil:
+		return m.Start + " – " + m.End
+	case start.Equal(end):
+		return start.Format("January 2, 2006")
+	case start.Year() != end.Year():
+		return start.Format("January 2, 2006") + " – " + end.Format("January 2, 2006")
+	case start.Month() != end.Month():
+		return start.Format("January 2") + " – " + end.Format("January 2, 2006")
+	default:
+		return start.Format("January 2") + " – " + end.Format("2, 2006")
+	}
+}
+
+// distance formats meters in the report's units.
+func (m Monthly) distance(meters float64) string {
+	if m.Metric {
+		return fmt.Sprintf("%.1f km", meters/1000)
+	}
+	return fmt.Sprintf("%.1f mi", meters/1609.34)
+}
+
+// distanceOrDash is distance, but a dash for activities without any, such as
+// strength training.
+func (m Monthly) distanceOrDash(meters float64) string {
+	if meters <= 0 {
+		return "–"
+	}
+	return m.distance(meters)
+}
+
+// elevation formats meters in the report's units.
+func (m Monthly) elevation(meters float64) string {
+	if m.Metric {
+		return fmt.Sprintf("%.0f m", meters)
+	}
+	return fmt.Sprintf("%.0f ft", meters*3.28084)
+}
+
+// speed formats an activity's pace for runs, walks and hikes and its speed
+// otherwise, in the report's units.
+func (m Monthly) speed(a api.NormalizedActivity) string {
+	if a.Distance <= 0 || a.MovingTime <= 0 {
+		return "–"
+	}
+	onFoot := api.IsRunningActivity(a.SportType) || a.SportType == "Walk" || a.SportType == "Hike"
+	unit, unitMeters := "mi", 1609.34
+	if m.Metric {
+		unit, unitMeters = "km", 1000.0
+	}
+	if !onFoot {
+		if m.Metric {
+			return fmt.Sprintf("%.1f km/h", a.AverageSpeedKmh)
+		}
+		return fmt.Sprintf("%.1f mph", a.AverageSpeedMph)
+	}
+	pace := int(math.Round(float64(a.MovingTime) / (a.Distance / unitMeters)))
+	return fmt.Sprintf("%d:%02d /%s", pace/60, pace%60, unit)
+}
+
+// shortDate formats a YYYY-MM-DD date like "Mar 4".
+func shortDate(date string) string {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return t.Format("Jan 2")
+}
+
+// plural picks the singular or plural noun for n.
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return singular
+	}
+	return pluralForm
+}
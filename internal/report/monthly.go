@@ -0,0 +1,122 @@
+// Package report lays out printable training reports as PDF.
+package report
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+)
+
+// Options controls what a report shows and how.
+type Options struct {
+	Athlete   string       // name in the header; may be empty
+	Metric    bool         // kilometers and meters rather than miles and feet
+	WeekStart time.Weekday // first day of the week in the heatmap and weekly trends
+	Generated time.Time    // shown in the footer and recorded in the PDF; zero leaves it out
+}
+
+// Monthly is a training report for a date range, usually a month: summary
+// cards, totals per sport, running stats and PRs, the distance histogram,
+// distance trends, a heatmap and every activity.
+type Monthly struct {
+	Options
+	Start, End string // YYYY-MM-DD, inclusive
+
+	Activities []api.NormalizedActivity // in the range, oldest first
+	Totals     api.PeriodTotals
+	ActiveDays int
+	Running    api.RunningStats
+	Records    api.PersonalRecords
+	Histogram  api.DistanceHistogram
+	Trends     api.TrendData
+	Days       []api.DailyRollup
+}
+
+// NewMonthly gathers the report for start to end (YYYY-MM-DD, inclusive) from
+// the athlete's activities, which may extend beyond the range.
+func NewMonthly(history []api.NormalizedActivity, start, end string, opts Options) Monthly {
+	report := Monthly{Options: opts, Start: start, End: end}
+	for _, activity := range history {
+		if activity.LocalDateStr >= start && activity.LocalDateStr <= end {
+			report.Activities = append(report.Activities, activity)
+		}
+	}
+	sort.Slice(report.Activities, func(i, j int) bool {
+		a, b := report.Activities[i], report.Activities[j]
+		if !a.StartDateLocal.Equal(b.StartDateLocal) {
+			return a.StartDateLocal.Before(b.StartDateLocal)
+		}
+		return a.ID < b.ID
+	})
+
+	// Totals, days and trends go through a rollup, like the dashboard's
+	rollup := api.NewRollup()
+	rollup.Add(report.Activities...)
+	report.Totals = rollup.Totals(start, end, nil)
+	report.Days = rollup.Days(start, end, nil)
+	report.ActiveDays = len(report.Days)
+	report.Trends = api.TrendsFromRollup(rollup, start, end, api.TrendOptions{
+		Period:    trendPeriod(start, end),
+		WeekStart: opts.WeekStart,
+		Smoothing: api.TrendSmoothing{Method: api.SmoothingNone},
+	})
+
+	report.Running = api.CalculateRunningStats(report.Activities)
+	report.Records = api.CalculatePersonalRecords(report.Activities)
+	report.Histogram = api.GenerateDistanceHistogram(report.Activities, !opts.Metric)
+	return report
+}
+
+// trendPeriod picks daily trends for a month, weekly for up to half a year and
+// monthly beyond.
+func trendPeriod(start, end string) string {
+	first, err1 := time.Parse("2006-01-02", start)
+	last, err2 := time.Parse("2006-01-02", end)
+	if err1 != nil || err2 != nil {
+		return "weekly"
+	}
+	switch days := last.Sub(first).Hours() / 24; {
+	case days <= 31:
+		return "daily"
+	case days <= 183:
+		return "weekly"
+	default:
+		return "monthly"
+	}
+}
+
+// ParseRange resolves a report's date range: month (YYYY-MM) selects that
+// month, start and end (YYYY-MM-DD) an explicit range, and with neither the
+// report covers this month up to today. Ranges end no later than today.
+func ParseRange(month, start, end string, today time.Time) (string, string, error) {
+	todayStr := today.Format("2006-01-02")
+	switch {
+	case month != "" && (start != "" || end != ""):
+		return "", "", fmt.Errorf("invalid range: use either month or start and end")
+	case month != "":
+		first, err := time.Parse("2006-01", month)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid month %q: must be YYYY-MM", month)
+		}
+		start = first.Format("2006-01-02")
+		end = first.AddDate(0, 1, -1).Format("2006-01-02")
+	case start != "" || end != "":
+		for _, date := range []string{start, end} {
+			if _, err := time.Parse("2006-01-02", date); err != nil {
+				return "", "", fmt.Errorf("invalid date %q: start and end must be YYYY-MM-DD", date)
+			}
+		}
+	default:
+		start = today.Format("2006-01") + "-01"
+		end = todayStr
+	}
+	if end > todayStr {
+		end = todayStr
+	}
+	if end < start {
+		return "", "", fmt.Errorf("invalid range: %s is after %s", start, end)
+	}
+	return start, end, nil
+}
@@ -0,0 +1,157 @@
+package report
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arungupta/strava-stats-go/internal/api"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// reportHistory returns the end of February and March 2024, every activity
+// starting at 7 AM local time.
+func reportHistory() []api.NormalizedActivity {
+	at := func(month time.Month, day int) time.Time { return time.Date(2024, month, day, 7, 0, 0, 0, time.UTC) }
+	var history []api.NormalizedActivity
+	for _, activity := range []api.Activity{
+		{ID: 1, Name: "February run", SportType: "Run", StartDateLocal: at(2, 28), Distance: 8000, MovingTime: 2400, TotalElevationGain: 30},
+		{ID: 2, Name: "Easy run", SportType: "Run", StartDateLocal: at(3, 2), Distance: 8000, MovingTime: 2520, TotalElevationGain: 40},
+		{ID: 3, Name: "Track mile", SportType: "Run", StartDateLocal: at(3, 5), Distance: 1609.34, MovingTime: 380},
+		{ID: 4, Name: "Tempo 10K 🏃", SportType: "Run", StartDateLocal: at(3, 9), Distance: 10000, MovingTime: 2700, TotalElevationGain: 60},
+		{ID: 5, Name: "Coffee ride with the club along the coast road", SportType: "Ride", StartDateLocal: at(3, 10), Distance: 60000, MovingTime: 7200, TotalElevationGain: 650},
+		{ID: 6, Name: "Long run", SportType: "Run", StartDateLocal: at(3, 17), Distance: 21100, MovingTime: 6600, TotalElevationGain: 180},
+		{ID: 7, Name: "Strength", SportType: "WeightTraining", StartDateLocal: at(3, 20), MovingTime: 2700},
+		{ID: 8, Name: "Zwift", SportType: "VirtualRide", StartDateLocal: at(3, 24), Distance: 30000, MovingTime: 3600, TotalElevationGain: 200},
+	} {
+		activity.StartDate = activity.StartDateLocal
+		activity.ElapsedTime = activity.MovingTime + 60
+		activity.AverageSpeed = activity.Distance / float64(activity.MovingTime)
+		history = append(history, api.NormalizeActivity(activity))
+	}
+	return history
+}
+
+func marchReport(metric bool) Monthly {
+	return NewMonthly(reportHistory(), "2024-03-01", "2024-03-31", Options{
+		Athlete:   "Alex Runner",
+		Metric:    metric,
+		WeekStart: time.Monday,
+		Generated: time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC),
+	})
+}
+
+func TestNewMonthly(t *testing.T) {
+	report := marchReport(false)
+	if len(report.Activities) != 7 || report.Activities[0].ID != 2 || report.Activities[6].ID != 8 {
+		t.Errorf("Expected March's activities oldest first, got %d", len(report.Activities))
+	}
+	if report.Totals.Total.Count != 7 || report.ActiveDays != 7 || len(report.Days) != 7 {
+		t.Errorf("Unexpected totals %+v over %d days", report.Totals.Total, report.ActiveDays)
+	}
+	if report.Running.TotalRuns != 4 || report.Records.Fastest10K == nil || report.Records.Fastest10K.ID != 4 {
+		t.Errorf("Unexpected running stats %+v and records %+v", report.Running, report.Records)
+	}
+	if report.Trends.Period != "daily" {
+		t.Errorf("Expected daily trends for a month, got %s", report.Trends.Period)
+	}
+	if len(report.Histogram.Bins) == 0 || !strings.HasSuffix(report.Histogram.Bins[0].Range, "mi") {
+		t.Errorf("Expected a histogram in miles, got %+v", report.Histogram)
+	}
+}
+
+// TestWritePDFGolden checks the layout stays stable. Run with -update to
+// rewrite the golden files after an intended change, and look them over.
+func TestWritePDFGolden(t *testing.T) {
+	for name, report := range map[string]Monthly{
+		"monthly_imperial.pdf": marchReport(false),
+		"monthly_metric.pdf":   marchReport(true),
+		"monthly_empty.pdf":    NewMonthly(nil, "2024-03-01", "2024-03-31", Options{WeekStart: time.Sunday}),
+	} {
+		var b bytes.Buffer
+		if err := report.WritePDF(&b); err != nil {
+			t.Fatalf("Unexpected error for %s: %v", name, err)
+		}
+		path := filepath.Join("testdata", name)
+		if *update {
+			if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		golden, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Unexpected error reading %s (run with -update to create it): %v", path, err)
+		}
+		if !bytes.Equal(b.Bytes(), golden) {
+			t.Errorf("Expected %s to match the golden file; run with -update if the change is intended", name)
+		}
+	}
+}
+
+func TestWritePDFPaginates(t *testing.T) {
+	var history []api.NormalizedActivity
+	for day := 1; day <= 31; day++ {
+		start := time.Date(2024, 3, day, 7, 0, 0, 0, time.UTC)
+		for i := int64(0); i < 3; i++ {
+			history = append(history, api.NormalizeActivity(api.Activity{
+				ID: int64(day)*10 + i, Name: "Run", SportType: "Run", StartDate: start, StartDateLocal: start,
+				Distance: 5000, MovingTime: 1500, ElapsedTime: 1560, TotalElevationGain: 10, AverageSpeed: 5000.0 / 1500,
+			}))
+		}
+	}
+	var b bytes.Buffer
+	if err := NewMonthly(history, "2024-03-01", "2024-03-31", Options{}).WritePDF(&b); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out := b.String()
+	if !strings.Contains(out, "/Count 4") || !strings.Contains(out, "(Page 4 of 4)") {
+		t.Error("Expected 93 activities to run over four pages")
+	}
+	// The list starts after the charts and takes three pages, each with the
+	// table header
+	if strings.Count(out, "(Pace/Speed)") != 3 {
+		t.Errorf("Expected the activity table header three times, got %d", strings.Count(out, "(Pace/Speed)"))
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	today := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		month, start, end  string
+		wantStart, wantEnd string
+	}{
+		{"", "", "", "2024-03-01", "2024-03-15"},
+		{"2024-02", "", "", "2024-02-01", "2024-02-29"},
+		{"", "2024-01-10", "2024-02-09", "2024-01-10", "2024-02-09"},
+		{"", "2024-03-01", "2024-12-31", "2024-03-01", "2024-03-15"},
+	} {
+		start, end, err := ParseRange(tc.month, tc.start, tc.end, today)
+		if err != nil || start != tc.wantStart || end != tc.wantEnd {
+			t.Errorf("Expected %s to %s for %+v, got %s to %s (%v)", tc.wantStart, tc.wantEnd, tc, start, end, err)
+		}
+	}
+	for _, bad := range [][3]string{{"March", "", ""}, {"2024-02", "2024-02-01", ""}, {"", "2024-03-10", "2024-03-01"}, {"", "2024-03-01", ""}} {
+		if _, _, err := ParseRange(bad[0], bad[1], bad[2], today); err == nil {
+			t.Errorf("Expected an error for %v", bad)
+		}
+	}
+}
+
+func TestDateRange(t *testing.T) {
+	for _, tc := range [][3]string{
+		{"2024-03-01", "2024-03-31", "March 1 – 31, 2024"},
+		{"2024-03-15", "2024-04-14", "March 15 – April 14, 2024"},
+		{"2023-12-01", "2024-01-31", "December 1, 2023 – January 31, 2024"},
+		{"2024-03-05", "2024-03-05", "March 5, 2024"},
+	} {
+		if got := (Monthly{Start: tc[0], End: tc[1]}).dateRange(); got != tc[2] {
+			t.Errorf("Expected %q, got %q", tc[2], got)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Package store persists small JSON documents, such as athlete settings, as
+// files under a data directory.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// validName matches collection names and keys; they become file and directory
+// names, so anything that could escape the data directory is rejected.
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Store keeps one JSON file per key, grouped into a directory per collection
+// (e.g. <dir>/settings/12345.json). It is safe for concurrent use; writes go
+// to a temporary file that replaces the old one, so a crash never leaves a
+// half-written document.
+type Store struct {
+	mu  sync.RWMutex
+	dir string
+}
+
+// New creates a store under dir, creating the directory if needed.
+func New(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory %s: %w", dir, err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// path returns the file of a key in a collection.
+func (s *Store) path(collection, key string) (string, error) {
+	if !validName.MatchString(collection) {
+		return "", fmt.Errorf("invalid collection %q", collection)
+	}
+	if !validName.MatchString(key) {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(s.dir, collection, key+".json"), nil
+}
+
+// Load decodes the document stored under key into v. It returns false, and
+// leaves v alone, if there is no such document.
+func (s *Store) Load(collection, key string, v interface{}) (bool, error) {
+	path, err := s.path(collection, key)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s/%s: %w", collection, key, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to decode %s/%s: %w", collection, key, err)
+	}
+	return true, nil
+}
+
+// Save stores v as JSON under key, replacing any previous document.
+func (s *Store) Save(collection, key string, v interface{}) error {
+	path, err := s.path(collection, key)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s/%s: %w", collection, key, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create %s directory: %w", collection, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save %s/%s: %w", collection, key, err)
+	}
+	defer os.Remove(tmp.Name()) // a no-op once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save %s/%s: %w", collection, key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save %s/%s: %w", collection, key, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save %s/%s: %w", collection, key, err)
+	}
+	return nil
+}
+
+// Delete removes the document stored under key, if any.
+func (s *Store) Delete(collection, key string) error {
+	path, err := s.path(collection, key)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s/%s: %w", collection, key, err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type document struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestStoreSaveAndLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	s, err := New(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error creating store: %v", err)
+	}
+
+	var doc document
+	if found, err := s.Load("settings", "42", &doc); found || err != nil {
+		t.Fatalf("Expected no document yet, got found=%v err=%v", found, err)
+	}
+
+	if err := s.Save("settings", "42", document{Name: "first", Count: 1}); err != nil {
+		t.Fatalf("Unexpected error saving: %v", err)
+	}
+	if err := s.Save("settings", "42", document{Name: "second", Count: 2}); err != nil {
+		t.Fatalf("Unexpected error saving again: %v", err)
+	}
+	found, err := s.Load("settings", "42", &doc)
+	if !found || err != nil || doc.Name != "second" || doc.Count != 2 {
+		t.Errorf("Expected the second document, got %+v (found=%v err=%v)", doc, found, err)
+	}
+
+	// Only the document is left behind, no temporary files
+	entries, _ := os.ReadDir(filepath.Join(dir, "settings"))
+	if len(entries) != 1 || entries[0].Name() != "42.json" {
+		t.Errorf("Expected only 42.json, got %v", entries)
+	}
+
+	// A reopened store sees the same data
+	reopened, _ := New(dir)
+	if found, _ := reopened.Load("settings", "42", &doc); !found {
+		t.Error("Expected the document to persist")
+	}
+
+	if err := s.Delete("settings", "42"); err != nil {
+		t.Fatalf("Unexpected error deleting: %v", err)
+	}
+	if found, _ := s.Load("settings", "42", &doc); found {
+		t.Error("Expected the document to be deleted")
+	}
+	if err := s.Delete("settings", "42"); err != nil {
+		t.Errorf("Expected deleting a missing document to succeed, got %v", err)
+	}
+}
+
+func TestStoreRejectsUnsafeNames(t *testing.T) {
+	s, _ := New(t.TempDir())
+	for _, name := range []string{"", "..", "../etc", "a/b", "a.json"} {
+		if err := s.Save("settings", name, document{}); err == nil {
+			t.Errorf("Expected key %q to be rejected", name)
+		}
+		if _, err := s.Load(name, "42", &document{}); err == nil {
+			t.Errorf("Expected collection %q to be rejected", name)
+		}
+	}
+}
+
+func TestStoreCorruptDocument(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := New(dir)
+	os.MkdirAll(filepath.Join(dir, "settings"), 0o700)
+	os.WriteFile(filepath.Join(dir, "settings", "7.json"), []byte("{not json"), 0o600)
+
+	if _, err := s.Load("settings", "7", &document{}); err == nil {
+		t.Error("Expected an error decoding a corrupt document")
+	}
+}